@@ -54,6 +54,13 @@ type Cell struct {
 	VMerge         int
 	cellType       CellType
 	DataValidation *xlsxCellDataValidation
+	// RichText holds the formatted runs of a string cell that was
+	// read from, or will be written as, rich text.  The runs are
+	// written in place of Value as long as their plain text is
+	// still the Value of the cell.
+	RichText []RichTextRun
+	Comment   *Comment
+	Hyperlink *Hyperlink
 }
 
 // CellInterface defines the public API of the Cell.
@@ -83,6 +90,22 @@ func (c *Cell) SetString(s string) {
 	c.Value = s
 	c.formula = ""
 	c.cellType = CellTypeString
+	c.RichText = nil
+}
+
+// SetRichText sets the value of a cell to a string made up of runs of
+// rich text.  Value is set to the plain text of the runs.
+func (c *Cell) SetRichText(runs []RichTextRun) {
+	c.Value = richTextToPlainString(runs)
+	c.formula = ""
+	c.cellType = CellTypeString
+	c.RichText = runs
+}
+
+// IsRichText returns true if the cell holds runs of rich text, whose
+// plain text is the value of the cell.
+func (c *Cell) IsRichText() bool {
+	return richTextFor(c.RichText, c.Value) != nil
 }
 
 // String returns the value of a Cell as a string.  If you'd like to
@@ -185,6 +208,7 @@ func (c *Cell) SetDateTimeWithFormat(n float64, format string) {
 	c.NumFmt = format
 	c.formula = ""
 	c.cellType = CellTypeNumeric
+	c.RichText = nil
 }
 
 // Float returns the value of cell as a number.
@@ -263,6 +287,7 @@ func (c *Cell) setNumeric(s string) {
 	c.NumFmt = builtInNumFmt[builtInNumFmtIndex_GENERAL]
 	c.formula = ""
 	c.cellType = CellTypeNumeric
+	c.RichText = nil
 }
 
 // Int returns the value of cell as integer.
@@ -284,6 +309,7 @@ func (c *Cell) SetBool(b bool) {
 		c.Value = "0"
 	}
 	c.cellType = CellTypeBool
+	c.RichText = nil
 }
 
 // Bool returns a boolean from a cell's value.
@@ -306,11 +332,13 @@ func (c *Cell) Bool() bool {
 func (c *Cell) SetFormula(formula string) {
 	c.formula = formula
 	c.cellType = CellTypeNumeric
+	c.RichText = nil
 }
 
 func (c *Cell) SetStringFormula(formula string) {
 	c.formula = formula
 	c.cellType = CellTypeStringFormula
+	c.RichText = nil
 }
 
 // Formula returns the formula string for the cell.
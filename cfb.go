@@ -0,0 +1,563 @@
+package xlsx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// An encrypted workbook is not a zip file but an OLE compound file, a
+// small file system made of fixed size sectors, which holds the
+// encrypted package in one of its streams.  The format is described in
+// [MS-CFB].
+
+var cfbSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+const (
+	cfbHeaderSize       = 512
+	cfbDirEntrySize     = 128
+	cfbMiniSectorSize   = 64
+	cfbMiniStreamCutoff = 4096
+	cfbHeaderDIFATCount = 109
+
+	cfbMaxRegSect  = 0xFFFFFFFA
+	cfbDIFATSect   = 0xFFFFFFFC
+	cfbFATSect     = 0xFFFFFFFD
+	cfbEndOfChain  = 0xFFFFFFFE
+	cfbFreeSect    = 0xFFFFFFFF
+	cfbNoStream    = 0xFFFFFFFF
+	cfbTypeStorage = 1
+	cfbTypeStream  = 2
+	cfbTypeRoot    = 5
+)
+
+var errNotCompoundFile = errors.New("not a compound file")
+
+// isCompoundFile returns true if r starts with the signature of a
+// compound file.
+func isCompoundFile(r io.ReaderAt, size int64) bool {
+	if size < cfbHeaderSize {
+		return false
+	}
+	signature := make([]byte, len(cfbSignature))
+	if _, err := r.ReadAt(signature, 0); err != nil {
+		return false
+	}
+	return bytes.Equal(signature, cfbSignature)
+}
+
+// cfbDirEntry is an entry of the directory of a compound file.
+type cfbDirEntry struct {
+	name        string
+	objectType  byte
+	left        uint32
+	right       uint32
+	child       uint32
+	startSector uint32
+	size        uint64
+}
+
+// compoundFile is a compound file that has been opened for reading.
+type compoundFile struct {
+	r              io.ReaderAt
+	size           int64
+	sectorSize     int
+	fat            []uint32
+	miniFAT        []uint32
+	entries        []cfbDirEntry
+	miniStream     []byte
+	miniStreamRead bool
+}
+
+// readCompoundFile reads the header, the allocation tables and the
+// directory of a compound file.
+func readCompoundFile(r io.ReaderAt, size int64) (*compoundFile, error) {
+	if !isCompoundFile(r, size) {
+		return nil, errNotCompoundFile
+	}
+	header := make([]byte, cfbHeaderSize)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, err
+	}
+	le := binary.LittleEndian
+	sectorShift := le.Uint16(header[0x1E:])
+	if sectorShift != 9 && sectorShift != 12 {
+		return nil, fmt.Errorf("invalid sector size in compound file")
+	}
+	cf := &compoundFile{r: r, size: size, sectorSize: 1 << sectorShift}
+
+	// The sectors of the FAT are listed in the header, and then in
+	// a chain of DIFAT sectors.
+	numFATSectors := int(le.Uint32(header[0x2C:]))
+	var fatSectors []uint32
+	for i := 0; i < cfbHeaderDIFATCount && len(fatSectors) < numFATSectors; i++ {
+		fatSectors = append(fatSectors, le.Uint32(header[0x4C+4*i:]))
+	}
+	perSector := cf.sectorSize / 4
+	difatSector := le.Uint32(header[0x44:])
+	for seen := 0; len(fatSectors) < numFATSectors && difatSector <= cfbMaxRegSect; seen++ {
+		if int64(seen) > size/int64(cf.sectorSize) {
+			return nil, fmt.Errorf("invalid DIFAT in compound file")
+		}
+		sector, err := cf.readSector(difatSector)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < perSector-1 && len(fatSectors) < numFATSectors; i++ {
+			fatSectors = append(fatSectors, le.Uint32(sector[4*i:]))
+		}
+		difatSector = le.Uint32(sector[cf.sectorSize-4:])
+	}
+	if len(fatSectors) < numFATSectors {
+		return nil, fmt.Errorf("invalid DIFAT in compound file")
+	}
+	for _, fatSector := range fatSectors {
+		sector, err := cf.readSector(fatSector)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < perSector; i++ {
+			cf.fat = append(cf.fat, le.Uint32(sector[4*i:]))
+		}
+	}
+
+	dir, err := cf.readChain(le.Uint32(header[0x30:]), -1)
+	if err != nil {
+		return nil, err
+	}
+	for offset := 0; offset+cfbDirEntrySize <= len(dir); offset += cfbDirEntrySize {
+		entry := readCFBDirEntry(dir[offset : offset+cfbDirEntrySize])
+		if cf.sectorSize == 512 {
+			// Only the low 32 bits of the size are used by
+			// version 3, the others may hold anything.
+			entry.size &= 0xFFFFFFFF
+		}
+		cf.entries = append(cf.entries, entry)
+	}
+	if len(cf.entries) == 0 || cf.entries[0].objectType != cfbTypeRoot {
+		return nil, fmt.Errorf("compound file has no root entry")
+	}
+
+	miniFAT, err := cf.readChain(le.Uint32(header[0x3C:]), -1)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i+4 <= len(miniFAT); i += 4 {
+		cf.miniFAT = append(cf.miniFAT, le.Uint32(miniFAT[i:]))
+	}
+	return cf, nil
+}
+
+func readCFBDirEntry(b []byte) cfbDirEntry {
+	le := binary.LittleEndian
+	nameLength := int(le.Uint16(b[64:]))
+	if nameLength > 64 {
+		nameLength = 64
+	}
+	name := make([]uint16, 0, 32)
+	for i := 0; i+1 < nameLength; i += 2 {
+		if u := le.Uint16(b[i:]); u != 0 {
+			name = append(name, u)
+		}
+	}
+	return cfbDirEntry{
+		name:        string(utf16.Decode(name)),
+		objectType:  b[66],
+		left:        le.Uint32(b[68:]),
+		right:       le.Uint32(b[72:]),
+		child:       le.Uint32(b[76:]),
+		startSector: le.Uint32(b[116:]),
+		size:        le.Uint64(b[120:]),
+	}
+}
+
+func (cf *compoundFile) readSector(sector uint32) ([]byte, error) {
+	offset := int64(sector+1) * int64(cf.sectorSize)
+	if sector > cfbMaxRegSect || offset+int64(cf.sectorSize) > cf.size {
+		return nil, fmt.Errorf("invalid sector %d in compound file", sector)
+	}
+	b := make([]byte, cf.sectorSize)
+	_, err := cf.r.ReadAt(b, offset)
+	return b, err
+}
+
+// readChain reads the sectors of a chain in the FAT, up to size bytes,
+// or the whole chain if size is negative.
+func (cf *compoundFile) readChain(sector uint32, size int64) ([]byte, error) {
+	var b []byte
+	for sector != cfbEndOfChain && (size < 0 || int64(len(b)) < size) {
+		if int(sector) >= len(cf.fat) || len(b) > int(cf.size) {
+			return nil, fmt.Errorf("invalid sector chain in compound file")
+		}
+		data, err := cf.readSector(sector)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, data...)
+		sector = cf.fat[sector]
+	}
+	if size >= 0 {
+		if int64(len(b)) < size {
+			return nil, fmt.Errorf("stream is shorter than its size in compound file")
+		}
+		b = b[:size]
+	}
+	return b, nil
+}
+
+// readMiniChain reads size bytes from a chain in the mini FAT.
+func (cf *compoundFile) readMiniChain(sector uint32, size int64) ([]byte, error) {
+	if !cf.miniStreamRead {
+		root := cf.entries[0]
+		miniStream, err := cf.readChain(root.startSector, int64(root.size))
+		if err != nil {
+			return nil, err
+		}
+		cf.miniStream = miniStream
+		cf.miniStreamRead = true
+	}
+	var b []byte
+	for sector != cfbEndOfChain && int64(len(b)) < size {
+		offset := int(sector) * cfbMiniSectorSize
+		if int(sector) >= len(cf.miniFAT) || offset+cfbMiniSectorSize > len(cf.miniStream) {
+			return nil, fmt.Errorf("invalid mini sector chain in compound file")
+		}
+		b = append(b, cf.miniStream[offset:offset+cfbMiniSectorSize]...)
+		sector = cf.miniFAT[sector]
+	}
+	if int64(len(b)) < size {
+		return nil, fmt.Errorf("stream is shorter than its size in compound file")
+	}
+	return b[:size], nil
+}
+
+// stream returns the contents of the stream at path, whose elements
+// are the names of the storages that hold it followed by its own name.
+func (cf *compoundFile) stream(path ...string) ([]byte, error) {
+	entry := cf.entries[0]
+	for _, name := range path {
+		id := cf.findChild(entry.child, name)
+		if id == cfbNoStream {
+			return nil, fmt.Errorf("compound file has no stream %q", strings.Join(path, "/"))
+		}
+		entry = cf.entries[id]
+	}
+	if entry.objectType != cfbTypeStream {
+		return nil, fmt.Errorf("%q is not a stream in compound file", strings.Join(path, "/"))
+	}
+	if entry.size < cfbMiniStreamCutoff {
+		return cf.readMiniChain(entry.startSector, int64(entry.size))
+	}
+	return cf.readChain(entry.startSector, int64(entry.size))
+}
+
+// findChild searches the tree of siblings below id for name.
+func (cf *compoundFile) findChild(id uint32, name string) uint32 {
+	for steps := 0; id != cfbNoStream && int(id) < len(cf.entries) && steps < len(cf.entries); steps++ {
+		switch c := compareCFBNames(name, cf.entries[id].name); {
+		case c < 0:
+			id = cf.entries[id].left
+		case c > 0:
+			id = cf.entries[id].right
+		default:
+			return id
+		}
+	}
+	return cfbNoStream
+}
+
+// compareCFBNames orders names the way the directory of a compound
+// file does: shorter names first, then by their upper case letters.
+func compareCFBNames(a, b string) int {
+	ua, ub := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	if len(ua) != len(ub) {
+		return len(ua) - len(ub)
+	}
+	return strings.Compare(strings.ToUpper(a), strings.ToUpper(b))
+}
+
+// cfbEntry is a storage or a stream of a compound file that is going
+// to be written.
+type cfbEntry struct {
+	name     string
+	data     []byte
+	children []*cfbEntry
+	storage  bool
+}
+
+// cfbStorage returns a storage that holds children.
+func cfbStorage(name string, children ...*cfbEntry) *cfbEntry {
+	return &cfbEntry{name: name, children: children, storage: true}
+}
+
+// cfbStream returns a stream that holds data.
+func cfbStream(name string, data []byte) *cfbEntry {
+	return &cfbEntry{name: name, data: data}
+}
+
+// writeCompoundFile writes a version 3 compound file, with 512 byte
+// sectors, whose root storage holds entries.
+func writeCompoundFile(w io.Writer, entries ...*cfbEntry) error {
+	const sectorSize = 512
+	const perSector = sectorSize / 4
+
+	// Number the entries of the directory, with the root first.
+	root := cfbStorage("Root Entry", entries...)
+	var all []*cfbEntry
+	var collect func(e *cfbEntry)
+	collect = func(e *cfbEntry) {
+		all = append(all, e)
+		for _, child := range e.children {
+			collect(child)
+		}
+	}
+	collect(root)
+	ids := make(map[*cfbEntry]uint32, len(all))
+	for i, e := range all {
+		ids[e] = uint32(i)
+	}
+
+	// Small streams go in the mini stream, which is itself stored
+	// as the data of the root.
+	var miniStream []byte
+	var miniFAT []uint32
+	starts := make(map[*cfbEntry]uint32, len(all))
+	for _, e := range all[1:] {
+		if e.storage || len(e.data) == 0 || len(e.data) >= cfbMiniStreamCutoff {
+			continue
+		}
+		first := uint32(len(miniFAT))
+		count := (len(e.data) + cfbMiniSectorSize - 1) / cfbMiniSectorSize
+		for i := 0; i < count; i++ {
+			miniFAT = append(miniFAT, first+uint32(i)+1)
+		}
+		miniFAT[len(miniFAT)-1] = cfbEndOfChain
+		starts[e] = first
+		miniStream = append(miniStream, padTo(e.data, cfbMiniSectorSize)...)
+	}
+	root.data = miniStream
+
+	// Lay the sectors out as the data of the streams, then the
+	// directory, the mini FAT, the FAT and the DIFAT.
+	var fat []uint32
+	var body bytes.Buffer
+	addChain := func(data []byte) uint32 {
+		if len(data) == 0 {
+			return cfbEndOfChain
+		}
+		first := uint32(len(fat))
+		count := (len(data) + sectorSize - 1) / sectorSize
+		for i := 0; i < count; i++ {
+			fat = append(fat, first+uint32(i)+1)
+		}
+		fat[len(fat)-1] = cfbEndOfChain
+		body.Write(padTo(data, sectorSize))
+		return first
+	}
+	starts[root] = addChain(miniStream)
+	for _, e := range all[1:] {
+		if !e.storage && len(e.data) >= cfbMiniStreamCutoff {
+			starts[e] = addChain(e.data)
+		}
+	}
+
+	// The children of every storage form a tree, in which each
+	// entry points to its left and right siblings.
+	children := make(map[*cfbEntry]uint32, len(all))
+	siblings := make(map[uint32][2]uint32, len(all))
+	for _, e := range all {
+		children[e] = buildCFBTree(e.children, ids, siblings)
+	}
+	dir := make([]byte, 0, len(all)*cfbDirEntrySize)
+	for _, e := range all {
+		start, ok := starts[e]
+		if !ok {
+			start = cfbEndOfChain
+		}
+		if e.storage && e != root {
+			start = 0
+		}
+		lr, ok := siblings[ids[e]]
+		if !ok {
+			lr = [2]uint32{cfbNoStream, cfbNoStream}
+		}
+		dir = append(dir, makeCFBDirEntry(e, e == root, start, lr[0], lr[1], children[e])...)
+	}
+	for len(dir)%sectorSize != 0 {
+		dir = append(dir, makeCFBDirEntry(nil, false, 0, cfbNoStream, cfbNoStream, cfbNoStream)...)
+	}
+	firstDirSector := addChain(dir)
+
+	firstMiniFATSector := uint32(cfbEndOfChain)
+	if len(miniFAT) > 0 {
+		b := make([]byte, 4*len(miniFAT))
+		for i, next := range miniFAT {
+			binary.LittleEndian.PutUint32(b[4*i:], next)
+		}
+		for len(b)%sectorSize != 0 {
+			b = append(b, 0xFF, 0xFF, 0xFF, 0xFF)
+		}
+		firstMiniFATSector = addChain(b)
+	}
+	numMiniFATSectors := (4*len(miniFAT) + sectorSize - 1) / sectorSize
+
+	// The FAT has to describe its own sectors and those of the
+	// DIFAT, so their number is found by iterating.
+	numFATSectors, numDIFATSectors := 0, 0
+	for {
+		total := len(fat) + numFATSectors + numDIFATSectors
+		f := (total + perSector - 1) / perSector
+		d := 0
+		if f > cfbHeaderDIFATCount {
+			d = (f - cfbHeaderDIFATCount + perSector - 2) / (perSector - 1)
+		}
+		if f == numFATSectors && d == numDIFATSectors {
+			break
+		}
+		numFATSectors, numDIFATSectors = f, d
+	}
+	firstFATSector := uint32(len(fat))
+	for i := 0; i < numFATSectors; i++ {
+		fat = append(fat, cfbFATSect)
+	}
+	firstDIFATSector := uint32(len(fat))
+	for i := 0; i < numDIFATSectors; i++ {
+		fat = append(fat, cfbDIFATSect)
+	}
+	for len(fat) < numFATSectors*perSector {
+		fat = append(fat, cfbFreeSect)
+	}
+	fatBytes := make([]byte, 4*len(fat))
+	for i, next := range fat {
+		binary.LittleEndian.PutUint32(fatBytes[4*i:], next)
+	}
+	body.Write(fatBytes)
+
+	difat := make([]uint32, 0, numFATSectors)
+	for i := 0; i < numFATSectors; i++ {
+		difat = append(difat, firstFATSector+uint32(i))
+	}
+	for i := 0; i < numDIFATSectors; i++ {
+		sector := make([]byte, sectorSize)
+		for j := 0; j < perSector-1; j++ {
+			value := uint32(cfbFreeSect)
+			if k := cfbHeaderDIFATCount + i*(perSector-1) + j; k < len(difat) {
+				value = difat[k]
+			}
+			binary.LittleEndian.PutUint32(sector[4*j:], value)
+		}
+		next := uint32(cfbEndOfChain)
+		if i+1 < numDIFATSectors {
+			next = firstDIFATSector + uint32(i) + 1
+		}
+		binary.LittleEndian.PutUint32(sector[sectorSize-4:], next)
+		body.Write(sector)
+	}
+
+	header := make([]byte, cfbHeaderSize)
+	le := binary.LittleEndian
+	copy(header, cfbSignature)
+	le.PutUint16(header[0x18:], 0x003E)
+	le.PutUint16(header[0x1A:], 3)
+	le.PutUint16(header[0x1C:], 0xFFFE)
+	le.PutUint16(header[0x1E:], 9)
+	le.PutUint16(header[0x20:], 6)
+	le.PutUint32(header[0x2C:], uint32(numFATSectors))
+	le.PutUint32(header[0x30:], firstDirSector)
+	le.PutUint32(header[0x38:], cfbMiniStreamCutoff)
+	le.PutUint32(header[0x3C:], firstMiniFATSector)
+	le.PutUint32(header[0x40:], uint32(numMiniFATSectors))
+	if numDIFATSectors > 0 {
+		le.PutUint32(header[0x44:], firstDIFATSector)
+	} else {
+		le.PutUint32(header[0x44:], cfbEndOfChain)
+	}
+	le.PutUint32(header[0x48:], uint32(numDIFATSectors))
+	for i := 0; i < cfbHeaderDIFATCount; i++ {
+		value := uint32(cfbFreeSect)
+		if i < len(difat) {
+			value = difat[i]
+		}
+		le.PutUint32(header[0x4C+4*i:], value)
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(body.Bytes())
+	return err
+}
+
+// buildCFBTree arranges entries, which are the children of a storage,
+// in a balanced binary tree ordered by name, and returns the id of its
+// root.  The left and right siblings of every entry are stored in
+// siblings.  All the nodes are black, which readers accept.
+func buildCFBTree(entries []*cfbEntry, ids map[*cfbEntry]uint32, siblings map[uint32][2]uint32) uint32 {
+	sorted := append([]*cfbEntry(nil), entries...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return compareCFBNames(sorted[i].name, sorted[j].name) < 0
+	})
+	var build func(lo, hi int) uint32
+	build = func(lo, hi int) uint32 {
+		if lo >= hi {
+			return cfbNoStream
+		}
+		mid := (lo + hi) / 2
+		left := build(lo, mid)
+		right := build(mid+1, hi)
+		id := ids[sorted[mid]]
+		siblings[id] = [2]uint32{left, right}
+		return id
+	}
+	return build(0, len(sorted))
+}
+
+// makeCFBDirEntry returns the 128 bytes of a directory entry, or of an
+// unused entry when e is nil.
+func makeCFBDirEntry(e *cfbEntry, root bool, start, left, right, child uint32) []byte {
+	b := make([]byte, cfbDirEntrySize)
+	le := binary.LittleEndian
+	le.PutUint32(b[68:], left)
+	le.PutUint32(b[72:], right)
+	le.PutUint32(b[76:], child)
+	if e == nil {
+		return b
+	}
+	name := utf16.Encode([]rune(e.name))
+	if len(name) > 31 {
+		name = name[:31]
+	}
+	for i, u := range name {
+		le.PutUint16(b[2*i:], u)
+	}
+	le.PutUint16(b[64:], uint16(2*len(name)+2))
+	switch {
+	case root:
+		b[66] = cfbTypeRoot
+	case e.storage:
+		b[66] = cfbTypeStorage
+	default:
+		b[66] = cfbTypeStream
+	}
+	b[67] = 1 // black
+	le.PutUint32(b[116:], start)
+	if !e.storage || root {
+		le.PutUint64(b[120:], uint64(len(e.data)))
+	}
+	return b
+}
+
+// padTo returns data padded with zeros to a multiple of size.
+func padTo(data []byte, size int) []byte {
+	if len(data)%size == 0 {
+		return data
+	}
+	padded := make([]byte, len(data)+size-len(data)%size)
+	copy(padded, data)
+	return padded
+}
@@ -0,0 +1,77 @@
+package xlsx
+
+import (
+	"bytes"
+
+	. "gopkg.in/check.v1"
+)
+
+type CFBSuite struct{}
+
+var _ = Suite(&CFBSuite{})
+
+// Streams in the mini stream, in sectors and in nested storages can
+// be read back from a written compound file.
+func (s *CFBSuite) TestCompoundFileRoundTrip(c *C) {
+	small := []byte("a small stream")
+	medium := bytes.Repeat([]byte{1, 2, 3}, 2000)
+	var names []*cfbEntry
+	for _, name := range []string{"b", "A", "ccc", "dd", "E", "f"} {
+		names = append(names, cfbStream(name, []byte(name)))
+	}
+
+	var buf bytes.Buffer
+	err := writeCompoundFile(&buf,
+		cfbStream("Small", small),
+		cfbStream("Medium", medium),
+		cfbStream("Empty", nil),
+		cfbStorage("Storage", cfbStorage("Inner", names...)),
+	)
+	c.Assert(err, IsNil)
+	c.Assert(buf.Len()%512, Equals, 0)
+
+	r := bytes.NewReader(buf.Bytes())
+	c.Assert(isCompoundFile(r, r.Size()), Equals, true)
+	cf, err := readCompoundFile(r, r.Size())
+	c.Assert(err, IsNil)
+	data, err := cf.stream("Small")
+	c.Assert(err, IsNil)
+	c.Assert(data, DeepEquals, small)
+	data, err = cf.stream("medium")
+	c.Assert(err, IsNil)
+	c.Assert(data, DeepEquals, medium)
+	data, err = cf.stream("Empty")
+	c.Assert(err, IsNil)
+	c.Assert(data, HasLen, 0)
+	for _, name := range []string{"A", "b", "ccc", "dd", "E", "f"} {
+		data, err = cf.stream("Storage", "Inner", name)
+		c.Assert(err, IsNil)
+		c.Assert(string(data), Equals, name)
+	}
+	_, err = cf.stream("Missing")
+	c.Assert(err, NotNil)
+	_, err = cf.stream("Storage")
+	c.Assert(err, NotNil)
+
+	_, err = readCompoundFile(bytes.NewReader(medium), int64(len(medium)))
+	c.Assert(err, Equals, errNotCompoundFile)
+}
+
+// A stream that needs more FAT sectors than fit in the header is
+// listed in DIFAT sectors.
+func (s *CFBSuite) TestCompoundFileDIFAT(c *C) {
+	large := make([]byte, 8<<20)
+	for i := range large {
+		large[i] = byte(i / 512)
+	}
+	var buf bytes.Buffer
+	c.Assert(writeCompoundFile(&buf, cfbStream("Large", large)), IsNil)
+
+	r := bytes.NewReader(buf.Bytes())
+	cf, err := readCompoundFile(r, r.Size())
+	c.Assert(err, IsNil)
+	c.Assert(len(cf.fat) > cfbHeaderDIFATCount*128, Equals, true)
+	data, err := cf.stream("Large")
+	c.Assert(err, IsNil)
+	c.Assert(bytes.Equal(data, large), Equals, true)
+}
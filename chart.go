@@ -0,0 +1,539 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// namespaceChart is the namespace of the elements of a chart part.
+const namespaceChart = "http://schemas.openxmlformats.org/drawingml/2006/chart"
+
+const contentTypeChart = "application/vnd.openxmlformats-officedocument.drawingml.chart+xml"
+
+// The default size of a chart, in pixels.
+const (
+	defaultChartWidth  = 480
+	defaultChartHeight = 288
+)
+
+// ChartType is the kind of a Chart.
+type ChartType string
+
+const (
+	ChartTypeBar     ChartType = "bar"
+	ChartTypeColumn  ChartType = "column"
+	ChartTypeLine    ChartType = "line"
+	ChartTypePie     ChartType = "pie"
+	ChartTypeScatter ChartType = "scatter"
+	ChartTypeArea    ChartType = "area"
+)
+
+// ChartGrouping says how the series of a bar, column, line or area
+// chart are put together.
+type ChartGrouping string
+
+const (
+	// ChartGroupingStandard puts the series side by side, or in
+	// front of each other.
+	ChartGroupingStandard ChartGrouping = ""
+	// ChartGroupingStacked stacks the values of the series.
+	ChartGroupingStacked ChartGrouping = "stacked"
+	// ChartGroupingPercentStacked stacks the values of the series,
+	// showing each as a percentage of the total.
+	ChartGroupingPercentStacked ChartGrouping = "percentStacked"
+)
+
+// ChartLegendPosition is where the legend of a chart is shown.
+type ChartLegendPosition string
+
+const (
+	ChartLegendRight    ChartLegendPosition = "r"
+	ChartLegendLeft     ChartLegendPosition = "l"
+	ChartLegendTop      ChartLegendPosition = "t"
+	ChartLegendBottom   ChartLegendPosition = "b"
+	ChartLegendTopRight ChartLegendPosition = "tr"
+)
+
+// Chart is a chart drawn on a sheet.  Its series refer to ranges of
+// cells in the workbook, so Excel updates the chart when the data in
+// those cells changes.
+//
+// A chart read from a file is written back as it was read, with all
+// the formatting that Chart doesn't hold, until any of its fields
+// other than Name and Anchor are changed; it is then made again from
+// its fields.  Charts of kinds that Chart can't make are read too,
+// with a Type named after the element that holds their series, such
+// as "radar" or "doughnut", and can't be written once changed.  A
+// chart that combines several kinds, such as columns and a line, gets
+// the Type of the first, and the series of all of them.
+type Chart struct {
+	Type     ChartType
+	Name     string
+	Title    string
+	Grouping ChartGrouping
+	Series   []*ChartSeries
+	// XAxis is the category axis, or the horizontal value axis of a
+	// scatter chart.  YAxis is the value axis.  Pie charts have no
+	// axes.
+	XAxis  ChartAxis
+	YAxis  ChartAxis
+	Legend ChartLegend
+	Anchor DrawingAnchor
+	// original is the XML of the chart part that the chart was
+	// read from, and rels are the relationships of that part.  read
+	// is a copy of the chart as it was read.
+	original string
+	rels     []xlsxWorkbookRelation
+	read     *Chart
+}
+
+// ChartSeries is a series of values in a Chart.  References are
+// formulas such as "Sheet1!$B$2:$B$10".
+type ChartSeries struct {
+	// Name is the name of the series shown in the legend.  NameRef
+	// refers to a cell holding the name instead.
+	Name    string
+	NameRef string
+	// Categories refers to the labels of the values, or to the X
+	// values of a scatter chart.
+	Categories string
+	// Values refers to the values of the series, or to the Y values
+	// of a scatter chart.
+	Values string
+	// Color is the RGB or ARGB color of the series, e.g. "FF4472C4".
+	// When it is empty Excel picks a color.
+	Color string
+}
+
+// ChartAxis is an axis of a Chart.
+type ChartAxis struct {
+	Title          string
+	Hidden         bool
+	MajorGridlines bool
+}
+
+// ChartLegend is the legend of a Chart.
+type ChartLegend struct {
+	Hidden bool
+	// Position defaults to ChartLegendRight.
+	Position ChartLegendPosition
+}
+
+// ChartOptions control how AddChart places a chart.
+type ChartOptions struct {
+	// Width and Height are the size of the chart in pixels.  They
+	// default to 480 by 288.
+	Width  int
+	Height int
+	// OffsetX and OffsetY move the chart right and down from the top
+	// left corner of its cell, in pixels.
+	OffsetX int
+	OffsetY int
+	// AnchorType defaults to DrawingAnchorTwoCell.
+	AnchorType DrawingAnchorType
+}
+
+// AddChart places a chart on the sheet, with its top left corner in
+// the named cell.  The options may be nil.
+func (s *Sheet) AddChart(cell string, chart *Chart, options *ChartOptions) error {
+	if options == nil {
+		options = &ChartOptions{}
+	}
+	if err := chart.validate(); err != nil {
+		return err
+	}
+	width, height := options.Width, options.Height
+	if width <= 0 {
+		width = defaultChartWidth
+	}
+	if height <= 0 {
+		height = defaultChartHeight
+	}
+	anchor, err := s.makeDrawingAnchor(options.AnchorType, cell, int64(options.OffsetX), int64(options.OffsetY), int64(width), int64(height))
+	if err != nil {
+		return err
+	}
+	chart.Anchor = anchor
+	if chart.Name == "" {
+		chart.Name = fmt.Sprintf("Chart %d", len(s.Charts)+1)
+	}
+	s.Charts = append(s.Charts, chart)
+	return nil
+}
+
+// clone returns a copy of the chart that doesn't share its series.
+func (c *Chart) clone() Chart {
+	clone := *c
+	if c.Series != nil {
+		clone.Series = make([]*ChartSeries, len(c.Series))
+		for i, series := range c.Series {
+			copied := *series
+			clone.Series[i] = &copied
+		}
+	}
+	return clone
+}
+
+// changed reports whether the chart has been changed since it was
+// read, which is always the case for a chart that wasn't read from a
+// file.  Its Name and Anchor belong to the drawing that shows it, and
+// are left out.
+func (c *Chart) changed() bool {
+	if c.read == nil {
+		return true
+	}
+	current := *c
+	current.Name, current.Anchor, current.read = c.read.Name, c.read.Anchor, nil
+	return !reflect.DeepEqual(current, *c.read)
+}
+
+// validate returns an error if the chart can't be written.
+func (c *Chart) validate() error {
+	switch c.Type {
+	case ChartTypeBar, ChartTypeColumn, ChartTypeLine, ChartTypePie, ChartTypeScatter, ChartTypeArea:
+	default:
+		return fmt.Errorf("invalid chart type %q", c.Type)
+	}
+	switch c.Grouping {
+	case ChartGroupingStandard, ChartGroupingStacked, ChartGroupingPercentStacked:
+	default:
+		return fmt.Errorf("invalid chart grouping %q", c.Grouping)
+	}
+	if len(c.Series) == 0 {
+		return fmt.Errorf("chart %q has no series", c.Name)
+	}
+	for i, series := range c.Series {
+		if series.Values == "" {
+			return fmt.Errorf("series %d of chart %q has no values", i+1, c.Name)
+		}
+	}
+	return nil
+}
+
+// The ids of the axes of a chart, which only have to be unique within
+// the chart.
+const (
+	chartXAxisID = 500000001
+	chartYAxisID = 500000002
+)
+
+// makeXLSXChartSpace builds the chart part for a Chart.
+func (c *Chart) makeXLSXChartSpace() (string, error) {
+	if err := c.validate(); err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	fmt.Fprintf(&buf, `<c:chartSpace xmlns:c="%s" xmlns:a="%s" xmlns:r="%s">`, namespaceChart, namespaceDrawingML, namespaceRelationships)
+	buf.WriteString(`<c:roundedCorners val="0"/><c:chart>`)
+	if c.Title != "" {
+		writeChartTitle(&buf, c.Title)
+		buf.WriteString(`<c:autoTitleDeleted val="0"/>`)
+	} else {
+		buf.WriteString(`<c:autoTitleDeleted val="1"/>`)
+	}
+	buf.WriteString(`<c:plotArea><c:layout/>`)
+	c.writeChartGroup(&buf)
+	switch c.Type {
+	case ChartTypePie:
+	case ChartTypeScatter:
+		writeChartValAx(&buf, chartXAxisID, chartYAxisID, "b", c.XAxis, "midCat")
+		writeChartValAx(&buf, chartYAxisID, chartXAxisID, "l", c.YAxis, "midCat")
+	case ChartTypeBar:
+		writeChartCatAx(&buf, chartXAxisID, chartYAxisID, "l", c.XAxis)
+		writeChartValAx(&buf, chartYAxisID, chartXAxisID, "b", c.YAxis, "between")
+	default:
+		writeChartCatAx(&buf, chartXAxisID, chartYAxisID, "b", c.XAxis)
+		writeChartValAx(&buf, chartYAxisID, chartXAxisID, "l", c.YAxis, "between")
+	}
+	buf.WriteString(`</c:plotArea>`)
+	if !c.Legend.Hidden {
+		position := c.Legend.Position
+		if position == "" {
+			position = ChartLegendRight
+		}
+		fmt.Fprintf(&buf, `<c:legend><c:legendPos val="%s"/><c:overlay val="0"/></c:legend>`, position)
+	}
+	buf.WriteString(`<c:plotVisOnly val="1"/><c:dispBlanksAs val="gap"/></c:chart></c:chartSpace>`)
+	return buf.String(), nil
+}
+
+// writeChartGroup writes the element that holds the series of the
+// chart, such as barChart or lineChart.
+func (c *Chart) writeChartGroup(buf *bytes.Buffer) {
+	grouping := string(c.Grouping)
+	switch c.Type {
+	case ChartTypeBar, ChartTypeColumn:
+		if grouping == "" {
+			grouping = "clustered"
+		}
+		barDir := "col"
+		if c.Type == ChartTypeBar {
+			barDir = "bar"
+		}
+		fmt.Fprintf(buf, `<c:barChart><c:barDir val="%s"/><c:grouping val="%s"/><c:varyColors val="0"/>`, barDir, grouping)
+		c.writeChartSeries(buf)
+		buf.WriteString(`<c:gapWidth val="150"/>`)
+		if c.Grouping != ChartGroupingStandard {
+			buf.WriteString(`<c:overlap val="100"/>`)
+		}
+		writeChartAxIDs(buf)
+		buf.WriteString(`</c:barChart>`)
+	case ChartTypeLine:
+		if grouping == "" {
+			grouping = "standard"
+		}
+		fmt.Fprintf(buf, `<c:lineChart><c:grouping val="%s"/><c:varyColors val="0"/>`, grouping)
+		c.writeChartSeries(buf)
+		buf.WriteString(`<c:marker val="1"/>`)
+		writeChartAxIDs(buf)
+		buf.WriteString(`</c:lineChart>`)
+	case ChartTypeArea:
+		if grouping == "" {
+			grouping = "standard"
+		}
+		fmt.Fprintf(buf, `<c:areaChart><c:grouping val="%s"/><c:varyColors val="0"/>`, grouping)
+		c.writeChartSeries(buf)
+		writeChartAxIDs(buf)
+		buf.WriteString(`</c:areaChart>`)
+	case ChartTypePie:
+		buf.WriteString(`<c:pieChart><c:varyColors val="1"/>`)
+		c.writeChartSeries(buf)
+		buf.WriteString(`<c:firstSliceAng val="0"/></c:pieChart>`)
+	case ChartTypeScatter:
+		buf.WriteString(`<c:scatterChart><c:scatterStyle val="lineMarker"/><c:varyColors val="0"/>`)
+		c.writeChartSeries(buf)
+		writeChartAxIDs(buf)
+		buf.WriteString(`</c:scatterChart>`)
+	}
+}
+
+// writeChartSeries writes the ser elements of the chart.
+func (c *Chart) writeChartSeries(buf *bytes.Buffer) {
+	for i, series := range c.Series {
+		fmt.Fprintf(buf, `<c:ser><c:idx val="%d"/><c:order val="%d"/>`, i, i)
+		if series.NameRef != "" {
+			buf.WriteString(`<c:tx><c:strRef><c:f>`)
+			xml.EscapeText(buf, []byte(series.NameRef))
+			buf.WriteString(`</c:f></c:strRef></c:tx>`)
+		} else if series.Name != "" {
+			buf.WriteString(`<c:tx><c:v>`)
+			xml.EscapeText(buf, []byte(series.Name))
+			buf.WriteString(`</c:v></c:tx>`)
+		}
+		if series.Color != "" {
+			color := series.Color
+			if len(color) == 8 {
+				color = color[2:]
+			}
+			fill := fmt.Sprintf(`<a:solidFill><a:srgbClr val="%s"/></a:solidFill>`, color)
+			if c.Type == ChartTypeLine || c.Type == ChartTypeScatter {
+				fill = `<a:ln w="28575" cap="rnd">` + fill + `</a:ln>`
+			}
+			buf.WriteString(`<c:spPr>` + fill + `</c:spPr>`)
+		}
+		switch c.Type {
+		case ChartTypeBar, ChartTypeColumn:
+			buf.WriteString(`<c:invertIfNegative val="0"/>`)
+		case ChartTypeLine:
+			buf.WriteString(`<c:marker><c:symbol val="none"/></c:marker>`)
+		case ChartTypeScatter:
+			buf.WriteString(`<c:marker><c:symbol val="circle"/></c:marker>`)
+		}
+		categories, values := "cat", "val"
+		if c.Type == ChartTypeScatter {
+			categories, values = "xVal", "yVal"
+		}
+		if series.Categories != "" {
+			// The X values of a scatter chart are numbers, where the
+			// categories of other charts are labels.
+			refType := "strRef"
+			if c.Type == ChartTypeScatter {
+				refType = "numRef"
+			}
+			fmt.Fprintf(buf, `<c:%s><c:%s><c:f>`, categories, refType)
+			xml.EscapeText(buf, []byte(series.Categories))
+			fmt.Fprintf(buf, `</c:f></c:%s></c:%s>`, refType, categories)
+		}
+		fmt.Fprintf(buf, `<c:%s><c:numRef><c:f>`, values)
+		xml.EscapeText(buf, []byte(series.Values))
+		fmt.Fprintf(buf, `</c:f></c:numRef></c:%s>`, values)
+		switch c.Type {
+		case ChartTypeLine, ChartTypeScatter:
+			buf.WriteString(`<c:smooth val="0"/>`)
+		}
+		buf.WriteString(`</c:ser>`)
+	}
+}
+
+// writeChartAxIDs writes the ids of the axes used by a chart group.
+func writeChartAxIDs(buf *bytes.Buffer) {
+	fmt.Fprintf(buf, `<c:axId val="%d"/><c:axId val="%d"/>`, chartXAxisID, chartYAxisID)
+}
+
+// writeChartTitle writes the title element of a chart or axis.
+func writeChartTitle(buf *bytes.Buffer, title string) {
+	buf.WriteString(`<c:title><c:tx><c:rich><a:bodyPr/><a:p><a:r><a:t>`)
+	xml.EscapeText(buf, []byte(title))
+	buf.WriteString(`</a:t></a:r></a:p></c:rich></c:tx><c:overlay val="0"/></c:title>`)
+}
+
+// writeChartAxisStart writes the elements that category and value
+// axes have in common, up to their tick labels.
+func writeChartAxisStart(buf *bytes.Buffer, id int, position string, axis ChartAxis) {
+	fmt.Fprintf(buf, `<c:axId val="%d"/><c:scaling><c:orientation val="minMax"/></c:scaling><c:delete val="%d"/><c:axPos val="%s"/>`,
+		id, bool2Int(axis.Hidden), position)
+	if axis.MajorGridlines {
+		buf.WriteString(`<c:majorGridlines/>`)
+	}
+	if axis.Title != "" {
+		writeChartTitle(buf, axis.Title)
+	}
+}
+
+// writeChartCatAx writes a category axis.
+func writeChartCatAx(buf *bytes.Buffer, id, crossID int, position string, axis ChartAxis) {
+	buf.WriteString(`<c:catAx>`)
+	writeChartAxisStart(buf, id, position, axis)
+	fmt.Fprintf(buf, `<c:majorTickMark val="out"/><c:minorTickMark val="none"/><c:tickLblPos val="nextTo"/><c:crossAx val="%d"/><c:crosses val="autoZero"/>`, crossID)
+	buf.WriteString(`<c:auto val="1"/><c:lblAlgn val="ctr"/><c:lblOffset val="100"/><c:noMultiLvlLbl val="0"/></c:catAx>`)
+}
+
+// writeChartValAx writes a value axis.
+func writeChartValAx(buf *bytes.Buffer, id, crossID int, position string, axis ChartAxis, crossBetween string) {
+	buf.WriteString(`<c:valAx>`)
+	writeChartAxisStart(buf, id, position, axis)
+	buf.WriteString(`<c:numFmt formatCode="General" sourceLinked="1"/>`)
+	fmt.Fprintf(buf, `<c:majorTickMark val="out"/><c:minorTickMark val="none"/><c:tickLblPos val="nextTo"/><c:crossAx val="%d"/><c:crosses val="autoZero"/>`, crossID)
+	fmt.Fprintf(buf, `<c:crossBetween val="%s"/></c:valAx>`, crossBetween)
+}
+
+// writeXLSXGraphicFrame writes the graphicFrame element that places a
+// chart, which is the target of the relationship rID, in a drawing.
+func (c *Chart) writeXLSXGraphicFrame(buf *bytes.Buffer, id int, rID string) {
+	buf.WriteString(`<xdr:graphicFrame macro=""><xdr:nvGraphicFramePr>`)
+	writeDrawingCNvPr(buf, id, c.Name, "")
+	buf.WriteString(`<xdr:cNvGraphicFramePr/></xdr:nvGraphicFramePr>`)
+	fmt.Fprintf(buf, `<xdr:xfrm><a:off x="0" y="0"/><a:ext cx="%d" cy="%d"/></xdr:xfrm>`, c.Anchor.Width, c.Anchor.Height)
+	fmt.Fprintf(buf, `<a:graphic><a:graphicData uri="%s"><c:chart xmlns:c="%s" r:id="%s"/></a:graphicData></a:graphic></xdr:graphicFrame>`,
+		namespaceChart, namespaceChart, rID)
+}
+
+// readChart reads the chart of a graphic frame.  Graphic frames that
+// hold something else, such as a diagram, or a chart without a plot,
+// result in nil.
+func readChart(files map[string]*zip.File, rels map[string]xlsxWorkbookRelation, xFrame *xlsxDrawingGraphicFrame, anchor DrawingAnchor) (*Chart, error) {
+	if xFrame.Chart == nil {
+		return nil, nil
+	}
+	rel, ok := rels[xFrame.Chart.Id]
+	if !ok {
+		return nil, nil
+	}
+	f, ok := files[rel.Target]
+	if !ok {
+		return nil, fmt.Errorf("chart %q not found", rel.Target)
+	}
+	content, err := readZipFileBytes(f)
+	if err != nil {
+		return nil, err
+	}
+	chartRels, err := readPartRelations(files, rel.Target)
+	if err != nil {
+		return nil, err
+	}
+	xChartSpace := new(xlsxChartSpace)
+	if err = xml.Unmarshal(content, xChartSpace); err != nil {
+		return nil, err
+	}
+	if anchor.Type == DrawingAnchorTwoCell && xFrame.Ext != nil {
+		anchor.Width, anchor.Height = xFrame.Ext.Cx, xFrame.Ext.Cy
+	}
+	chart := &Chart{
+		Name:     xFrame.CNvPr.Name,
+		Title:    xChartSpace.Chart.Title.text(),
+		Anchor:   anchor,
+		original: string(content),
+		rels:     unmodelledRelationships(chartRels, nil),
+	}
+	if xLegend := xChartSpace.Chart.Legend; xLegend != nil {
+		chart.Legend.Position = ChartLegendPosition(xLegend.LegendPos.Val)
+	} else {
+		chart.Legend.Hidden = true
+	}
+	axes := make(map[string]xlsxChartPlotAreaItem)
+	var groups []*xlsxChartPlotAreaItem
+	for i, item := range xChartSpace.Chart.PlotArea.Items {
+		switch {
+		case item.XMLName.Local == "catAx", item.XMLName.Local == "valAx", item.XMLName.Local == "dateAx":
+			if len(item.AxID) > 0 {
+				axes[item.AxID[0].Val] = item
+			}
+		case strings.HasSuffix(item.XMLName.Local, "Chart"):
+			groups = append(groups, &xChartSpace.Chart.PlotArea.Items[i])
+		}
+	}
+	if len(groups) == 0 {
+		return nil, nil
+	}
+	group := groups[0]
+	chart.Type = ChartType(strings.TrimSuffix(group.XMLName.Local, "Chart"))
+	if group.XMLName.Local == "barChart" {
+		chart.Type = ChartTypeColumn
+		if group.BarDir.Val == "bar" {
+			chart.Type = ChartTypeBar
+		}
+	}
+	switch group.Grouping.Val {
+	case "stacked", "percentStacked":
+		chart.Grouping = ChartGrouping(group.Grouping.Val)
+	}
+	for i, xAxID := range group.AxID {
+		xAxis, ok := axes[xAxID.Val]
+		if !ok || i > 1 {
+			continue
+		}
+		axis := ChartAxis{
+			Title:          xAxis.Title.text(),
+			Hidden:         xAxis.Delete.Val == "1" || xAxis.Delete.Val == "true",
+			MajorGridlines: xAxis.MajorGridlines != nil,
+		}
+		if i == 0 {
+			chart.XAxis = axis
+		} else {
+			chart.YAxis = axis
+		}
+	}
+	for _, group := range groups {
+		for _, xSer := range group.Ser {
+			series := &ChartSeries{
+				Name:       xSer.Tx.V,
+				NameRef:    xSer.Tx.StrRef,
+				Categories: xSer.Cat.ref(),
+				Values:     xSer.Val.ref(),
+			}
+			// Scatter and bubble charts have X and Y values.
+			if xSer.XVal.ref() != "" || xSer.YVal.ref() != "" {
+				series.Categories = xSer.XVal.ref()
+				series.Values = xSer.YVal.ref()
+			}
+			if xSer.SpPr != nil {
+				color := xSer.SpPr.SolidFill.Val
+				if color == "" {
+					color = xSer.SpPr.LineFill.Val
+				}
+				if color != "" {
+					series.Color = "FF" + strings.ToUpper(color)
+				}
+			}
+			chart.Series = append(chart.Series, series)
+		}
+	}
+	read := chart.clone()
+	chart.read = &read
+	return chart, nil
+}
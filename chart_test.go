@@ -0,0 +1,204 @@
+package xlsx
+
+import (
+	"bytes"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type ChartSuite struct{}
+
+var _ = Suite(&ChartSuite{})
+
+// A chart is written to its own part, which the drawing of the sheet
+// refers to, and its series refer to ranges of cells.
+func (s *ChartSuite) TestMarshalChart(c *C) {
+	f := NewFile()
+	sheet, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	err = sheet.AddChart("E2", &Chart{
+		Type:  ChartTypeColumn,
+		Title: "Sales & Costs",
+		Series: []*ChartSeries{
+			{NameRef: "Sheet1!$B$1", Categories: "Sheet1!$A$2:$A$5", Values: "Sheet1!$B$2:$B$5", Color: "FF4472C4"},
+		},
+		YAxis:  ChartAxis{Title: "Amount", MajorGridlines: true},
+		Legend: ChartLegend{Position: ChartLegendBottom},
+	}, nil)
+	c.Assert(err, IsNil)
+
+	parts, err := f.MarshallParts()
+	c.Assert(err, IsNil)
+	c.Assert(parts["xl/charts/chart1.xml"], Equals, `<?xml version="1.0" encoding="UTF-8"?>
+<c:chartSpace xmlns:c="http://schemas.openxmlformats.org/drawingml/2006/chart" xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">`+
+		`<c:roundedCorners val="0"/><c:chart>`+
+		`<c:title><c:tx><c:rich><a:bodyPr/><a:p><a:r><a:t>Sales &amp; Costs</a:t></a:r></a:p></c:rich></c:tx><c:overlay val="0"/></c:title><c:autoTitleDeleted val="0"/>`+
+		`<c:plotArea><c:layout/>`+
+		`<c:barChart><c:barDir val="col"/><c:grouping val="clustered"/><c:varyColors val="0"/>`+
+		`<c:ser><c:idx val="0"/><c:order val="0"/><c:tx><c:strRef><c:f>Sheet1!$B$1</c:f></c:strRef></c:tx>`+
+		`<c:spPr><a:solidFill><a:srgbClr val="4472C4"/></a:solidFill></c:spPr><c:invertIfNegative val="0"/>`+
+		`<c:cat><c:strRef><c:f>Sheet1!$A$2:$A$5</c:f></c:strRef></c:cat><c:val><c:numRef><c:f>Sheet1!$B$2:$B$5</c:f></c:numRef></c:val></c:ser>`+
+		`<c:gapWidth val="150"/><c:axId val="500000001"/><c:axId val="500000002"/></c:barChart>`+
+		`<c:catAx><c:axId val="500000001"/><c:scaling><c:orientation val="minMax"/></c:scaling><c:delete val="0"/><c:axPos val="b"/>`+
+		`<c:majorTickMark val="out"/><c:minorTickMark val="none"/><c:tickLblPos val="nextTo"/><c:crossAx val="500000002"/><c:crosses val="autoZero"/>`+
+		`<c:auto val="1"/><c:lblAlgn val="ctr"/><c:lblOffset val="100"/><c:noMultiLvlLbl val="0"/></c:catAx>`+
+		`<c:valAx><c:axId val="500000002"/><c:scaling><c:orientation val="minMax"/></c:scaling><c:delete val="0"/><c:axPos val="l"/><c:majorGridlines/>`+
+		`<c:title><c:tx><c:rich><a:bodyPr/><a:p><a:r><a:t>Amount</a:t></a:r></a:p></c:rich></c:tx><c:overlay val="0"/></c:title>`+
+		`<c:numFmt formatCode="General" sourceLinked="1"/><c:majorTickMark val="out"/><c:minorTickMark val="none"/><c:tickLblPos val="nextTo"/><c:crossAx val="500000001"/><c:crosses val="autoZero"/>`+
+		`<c:crossBetween val="between"/></c:valAx></c:plotArea>`+
+		`<c:legend><c:legendPos val="b"/><c:overlay val="0"/></c:legend><c:plotVisOnly val="1"/><c:dispBlanksAs val="gap"/></c:chart></c:chartSpace>`)
+	c.Assert(parts["xl/drawings/_rels/drawing1.xml.rels"], Equals, `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Target="../charts/chart1.xml" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/chart"></Relationship></Relationships>`)
+	c.Assert(strings.Contains(parts["xl/drawings/drawing1.xml"],
+		`<xdr:graphicFrame macro=""><xdr:nvGraphicFramePr><xdr:cNvPr id="1" name="Chart 1"/><xdr:cNvGraphicFramePr/></xdr:nvGraphicFramePr>`+
+			`<xdr:xfrm><a:off x="0" y="0"/><a:ext cx="4572000" cy="2743200"/></xdr:xfrm>`+
+			`<a:graphic><a:graphicData uri="http://schemas.openxmlformats.org/drawingml/2006/chart"><c:chart xmlns:c="http://schemas.openxmlformats.org/drawingml/2006/chart" r:id="rId1"/></a:graphicData></a:graphic></xdr:graphicFrame>`), Equals, true)
+	c.Assert(strings.Contains(parts["[Content_Types].xml"],
+		`<Override PartName="/xl/charts/chart1.xml" ContentType="application/vnd.openxmlformats-officedocument.drawingml.chart+xml"></Override>`), Equals, true)
+}
+
+// Charts that can't be written are refused.
+func (s *ChartSuite) TestAddChartErrors(c *C) {
+	sheet := &Sheet{}
+	err := sheet.AddChart("A1", &Chart{Type: "radar", Series: []*ChartSeries{{Values: "Sheet1!$A$1:$A$2"}}}, nil)
+	c.Assert(err, NotNil)
+	err = sheet.AddChart("A1", &Chart{Type: ChartTypeLine}, nil)
+	c.Assert(err, NotNil)
+	err = sheet.AddChart("A1", &Chart{Type: ChartTypeLine, Series: []*ChartSeries{{Name: "No values"}}}, nil)
+	c.Assert(err, NotNil)
+	err = sheet.AddChart("A1", &Chart{Type: ChartTypeLine, Grouping: "clustered", Series: []*ChartSeries{{Values: "Sheet1!$A$1:$A$2"}}}, nil)
+	c.Assert(err, NotNil)
+	err = sheet.AddChart("A", &Chart{Type: ChartTypeLine, Series: []*ChartSeries{{Values: "Sheet1!$A$1:$A$2"}}}, nil)
+	c.Assert(err, NotNil)
+	c.Assert(sheet.Charts, HasLen, 0)
+}
+
+// Charts of every type survive writing a File and reading it back,
+// alongside pictures.
+func (s *ChartSuite) TestChartRoundTrip(c *C) {
+	f := NewFile()
+	sheet1, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	sheet2, err := f.AddSheet("Sheet2")
+	c.Assert(err, IsNil)
+	_, err = sheet1.AddPicture("A1", makeTestPNG(c, 20, 20), nil)
+	c.Assert(err, IsNil)
+
+	charts := []*Chart{
+		{
+			Type:     ChartTypeBar,
+			Grouping: ChartGroupingStacked,
+			Series: []*ChartSeries{
+				{Name: "First", Categories: "Sheet1!$A$2:$A$5", Values: "Sheet1!$B$2:$B$5"},
+				{Name: "Second", Categories: "Sheet1!$A$2:$A$5", Values: "Sheet1!$C$2:$C$5", Color: "FFED7D31"},
+			},
+			XAxis: ChartAxis{Title: "Quarter"},
+		},
+		{
+			Type:   ChartTypeLine,
+			Title:  "Trend",
+			Series: []*ChartSeries{{NameRef: "Sheet1!$B$1", Values: "Sheet1!$B$2:$B$5", Color: "FF70AD47"}},
+			YAxis:  ChartAxis{MajorGridlines: true, Hidden: true},
+		},
+		{
+			Type:   ChartTypePie,
+			Series: []*ChartSeries{{Categories: "Sheet1!$A$2:$A$5", Values: "Sheet1!$B$2:$B$5"}},
+			Legend: ChartLegend{Position: ChartLegendRight},
+		},
+		{
+			Type:   ChartTypeScatter,
+			Series: []*ChartSeries{{Categories: "Sheet1!$B$2:$B$5", Values: "Sheet1!$C$2:$C$5"}},
+			Legend: ChartLegend{Hidden: true},
+		},
+		{
+			Type:     ChartTypeArea,
+			Grouping: ChartGroupingPercentStacked,
+			Series:   []*ChartSeries{{Values: "Sheet1!$B$2:$B$5"}},
+			Legend:   ChartLegend{Position: ChartLegendTop},
+		},
+	}
+	for i, chart := range charts {
+		sheet := sheet1
+		if i%2 == 1 {
+			sheet = sheet2
+		}
+		c.Assert(sheet.AddChart("F1", chart, &ChartOptions{Width: 300, Height: 200}), IsNil)
+	}
+
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), IsNil)
+	read, err := OpenBinary(buf.Bytes())
+	c.Assert(err, IsNil)
+	c.Assert(read.Sheets[0].Pictures, HasLen, 1)
+	c.Assert(read.Sheets[0].Charts, HasLen, 3)
+	c.Assert(read.Sheets[1].Charts, HasLen, 2)
+	for i, chart := range charts {
+		sheet := read.Sheets[0]
+		if i%2 == 1 {
+			sheet = read.Sheets[1]
+		}
+		got := sheet.Charts[i/2]
+		c.Assert(got.Series, DeepEquals, chart.Series)
+		c.Assert(got.changed(), Equals, false)
+		got.Series, chart.Series = nil, nil
+		got.original, got.read = "", nil
+		if chart.Legend.Position == "" && !chart.Legend.Hidden {
+			chart.Legend.Position = ChartLegendRight
+		}
+		c.Assert(*got, DeepEquals, *chart)
+	}
+}
+
+// Charts read from a file are written back as they were read, even of
+// kinds that Chart can't make, until they are changed.  The shapes of
+// the drawing are kept alongside them.
+func (s *ChartSuite) TestChartWrittenAsRead(c *C) {
+	f, err := OpenBinary(makeDrawingFile(c, preservedDrawingXML, radarChartXML))
+	c.Assert(err, IsNil)
+	sheet := f.Sheets[0]
+	c.Assert(sheet.Charts, HasLen, 1)
+	chart := sheet.Charts[0]
+	c.Assert(chart.Type, Equals, ChartType("radar"))
+	c.Assert(chart.Name, Equals, "Chart 2")
+	c.Assert(chart.Series, DeepEquals, []*ChartSeries{{Values: "Sheet1!$A$1:$A$3"}})
+	parts, err := f.MarshallParts()
+	c.Assert(err, IsNil)
+	c.Assert(parts["xl/charts/chart1.xml"], Equals, radarChartXML)
+	drawing := parts["xl/drawings/drawing1.xml"]
+	c.Assert(strings.Contains(drawing, `<xdr:cNvPr id="3" name="Chart 2"/>`), Equals, true)
+	c.Assert(strings.Contains(drawing, `<xdr:sp macro="" textlink=""><xdr:nvSpPr><xdr:cNvPr id="2" name="TextBox 1"/>`), Equals, true)
+
+	// Moving the chart, or the cells it refers to, leaves the rest
+	// of it alone.
+	_, err = sheet.AddRowAtIndex(0)
+	c.Assert(err, IsNil)
+	parts, err = f.MarshallParts()
+	c.Assert(err, IsNil)
+	c.Assert(parts["xl/charts/chart1.xml"], Equals, strings.Replace(radarChartXML, "$A$1:$A$3", "$A$2:$A$4", 1))
+	c.Assert(strings.Count(parts["xl/drawings/drawing1.xml"], `<xdr:row>2</xdr:row>`), Equals, 2)
+
+	chart.Title = "Radar"
+	_, err = f.MarshallParts()
+	c.Assert(err, ErrorMatches, `invalid chart type "radar"`)
+}
+
+// The elements of a chart read from a file that refer to parts which
+// aren't kept are dropped, and a changed chart is made again.
+func (s *ChartSuite) TestChartWrittenWithoutRelationships(c *C) {
+	chartXML := strings.Replace(radarChartXML, "radar", "line", -1)
+	withData := strings.Replace(chartXML, `</c:chart>`, `</c:chart><c:externalData r:id="rId1"><c:autoUpdate val="0"/></c:externalData>`, 1)
+	f, err := OpenBinary(makeDrawingFile(c, preservedDrawingXML, withData))
+	c.Assert(err, IsNil)
+	parts, err := f.MarshallParts()
+	c.Assert(err, IsNil)
+	c.Assert(parts["xl/charts/chart1.xml"], Equals, chartXML)
+
+	chart := f.Sheets[0].Charts[0]
+	c.Assert(chart.Type, Equals, ChartTypeLine)
+	chart.Title = "Line"
+	parts, err = f.MarshallParts()
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(parts["xl/charts/chart1.xml"], "<a:t>Line</a:t>"), Equals, true)
+	c.Assert(strings.Contains(parts["xl/charts/chart1.xml"], "lineStyle"), Equals, false)
+}
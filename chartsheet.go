@@ -0,0 +1,76 @@
+package xlsx
+
+import "fmt"
+
+// SheetType is the kind of a sheet in a workbook.
+type SheetType int
+
+// These are the kinds of sheet that a File holds.
+const (
+	// SheetTypeWorksheet is a sheet of rows and cells.
+	SheetTypeWorksheet SheetType = iota
+	// SheetTypeChartsheet is a sheet that holds a single chart and
+	// no cells.  Chartsheets are kept as they were read, so that
+	// they keep their place among the tabs of the workbook; only
+	// their Name can be changed.
+	//
+	// Only chartsheets read from a file can be written: writing a
+	// File that holds a Sheet made with this Type returns an error.
+	// Sheet.Cell, Sheet.Row and Sheet.AddRow still add rows and
+	// cells to a chartsheet, but they are never written, and the
+	// methods that insert or remove rows and columns return an error.
+	SheetTypeChartsheet
+)
+
+const contentTypeChartsheet = "application/vnd.openxmlformats-officedocument.spreadsheetml.chartsheet+xml"
+
+// readChartsheetFromFile reads the chartsheet part of a workbook into
+// a Sheet, keeping its XML and the relationships that lead to its
+// drawing so they can be written back.
+func readChartsheetFromFile(sc chan *indexedSheet, index int, rsheet xlsxSheet, fi *File, partName string) error {
+	result := &indexedSheet{Index: index}
+	content, err := readZipFileBytes(fi.files[partName])
+	if err != nil {
+		result.Error = err
+		sc <- result
+		return err
+	}
+	rels, err := readPartRelations(fi.files, partName)
+	if err != nil {
+		result.Error = err
+		sc <- result
+		return err
+	}
+	sheet := &Sheet{
+		Name:          rsheet.Name,
+		File:          fi,
+		Type:          SheetTypeChartsheet,
+		Hidden:        rsheet.State == sheetStateHidden || rsheet.State == sheetStateVeryHidden,
+		chartsheet:    content,
+		preservedRels: unmodelledRelationships(rels, nil),
+	}
+	result.Sheet = sheet
+	sc <- result
+	return nil
+}
+
+// makeXLSXChartsheet returns the XML of a chartsheet, with the
+// relationships to its drawing added to rels.  A chartsheet that
+// wasn't read from a file has nothing to hold, and can't be written.
+func (s *Sheet) makeXLSXChartsheet(rels *xlsxWorkbookRels, partName string, carrier *partCarrier) (string, error) {
+	if len(s.chartsheet) == 0 {
+		return "", fmt.Errorf("chartsheet %q has no content", s.Name)
+	}
+	ids := carrier.addRelationships(rels, partName, s.preservedRels)
+	content, _ := remapRelationshipIDs(string(s.chartsheet), ids)
+	return content, nil
+}
+
+// errChartsheet returns the error for changing the rows or the columns
+// of a chartsheet, which has none, or nil if the sheet is a worksheet.
+func (s *Sheet) errChartsheet(method string) error {
+	if s.Type == SheetTypeChartsheet {
+		return fmt.Errorf("%s: %q is a chartsheet, which has no rows or columns", method, s.Name)
+	}
+	return nil
+}
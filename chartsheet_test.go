@@ -0,0 +1,73 @@
+package xlsx
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type ChartsheetSuite struct{}
+
+var _ = Suite(&ChartsheetSuite{})
+
+// Chartsheets keep their place among the sheets of a workbook.
+func (s *ChartsheetSuite) TestReadChartsheet(c *C) {
+	f, err := OpenFile("./testdocs/testchartsheet.xlsx")
+	c.Assert(err, IsNil)
+	c.Assert(f.Sheets, HasLen, 2)
+	c.Assert(f.Sheets[0].Name, Equals, "Chart1")
+	c.Assert(f.Sheets[0].Type, Equals, SheetTypeChartsheet)
+	c.Assert(f.Sheets[0].Rows, HasLen, 0)
+	c.Assert(f.Sheets[1].Name, Equals, "Sheet1")
+	c.Assert(f.Sheets[1].Type, Equals, SheetTypeWorksheet)
+	c.Assert(f.Sheet["Chart1"], Equals, f.Sheets[0])
+
+	// A chartsheet has no rows or columns to insert or remove.
+	chart := f.Sheets[0]
+	_, err = chart.AddRowAtIndex(0)
+	c.Assert(err, ErrorMatches, `AddRowAtIndex: "Chart1" is a chartsheet, which has no rows or columns`)
+	c.Assert(chart.RemoveRowAtIndex(0), NotNil)
+	_, err = chart.InsertColAtIndex(0)
+	c.Assert(err, NotNil)
+	c.Assert(chart.RemoveColAtIndex(0), NotNil)
+	c.Assert(chart.Rows, HasLen, 0)
+}
+
+// A chartsheet is written back along with its drawing and chart.
+func (s *ChartsheetSuite) TestWriteChartsheet(c *C) {
+	original, err := ioutil.ReadFile("./testdocs/testchartsheet.xlsx")
+	c.Assert(err, IsNil)
+	originalParts := readZipParts(c, original)
+
+	f, err := OpenBinary(original)
+	c.Assert(err, IsNil)
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), IsNil)
+	parts := readZipParts(c, buf.Bytes())
+
+	c.Assert(parts["xl/chartsheets/sheet1.xml"], Equals, originalParts["xl/chartsheets/sheet1.xml"])
+	c.Assert(parts["xl/drawings/drawing1.xml"], Equals, originalParts["xl/drawings/drawing1.xml"])
+	c.Assert(parts["xl/charts/chart1.xml"], Equals, originalParts["xl/charts/chart1.xml"])
+	c.Assert(strings.Contains(parts["xl/chartsheets/_rels/sheet1.xml.rels"], `Target="../drawings/drawing1.xml"`), Equals, true)
+	c.Assert(strings.Contains(parts["xl/_rels/workbook.xml.rels"], `<Relationship Id="rId1" Target="chartsheets/sheet1.xml" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/chartsheet"></Relationship>`), Equals, true)
+	c.Assert(strings.Contains(parts["docProps/app.xml"], `<vt:lpstr>Charts</vt:lpstr></vt:variant><vt:variant><vt:i4>1</vt:i4>`), Equals, true)
+	c.Assert(strings.Contains(parts["[Content_Types].xml"], `<Override PartName="/xl/chartsheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.chartsheet+xml">`), Equals, true)
+
+	read, err := OpenBinary(buf.Bytes())
+	c.Assert(err, IsNil)
+	c.Assert(read.Sheets, HasLen, 2)
+	c.Assert(read.Sheets[0].Type, Equals, SheetTypeChartsheet)
+	c.Assert(read.Sheets[1].Name, Equals, "Sheet1")
+}
+
+// A chartsheet that wasn't read from a file can't be written.
+func (s *ChartsheetSuite) TestWriteEmptyChartsheet(c *C) {
+	f := NewFile()
+	sheet, err := f.AddSheet("Chart1")
+	c.Assert(err, IsNil)
+	sheet.Type = SheetTypeChartsheet
+	_, err = f.MarshallParts()
+	c.Assert(err, ErrorMatches, `chartsheet "Chart1" has no content`)
+}
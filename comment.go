@@ -0,0 +1,271 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The default size of the box in which Excel shows a comment, in
+// columns and rows.
+const (
+	defaultCommentWidth  = 2
+	defaultCommentHeight = 4
+)
+
+// Comment is a note attached to a cell.  Excel shows the text of the
+// comment in a box when the mouse pointer rests over the cell.
+type Comment struct {
+	Author string
+	// Text is the plain text of the comment.  RichText is written in
+	// its place when Text is blank or is the plain text of the runs.
+	Text     string
+	RichText []RichTextRun
+	// Width and Height are the size of the box that holds the
+	// comment, as a number of columns and rows.  When they are zero
+	// the box is 2 columns wide and 4 rows high.
+	Width  int
+	Height int
+}
+
+// SetComment attaches a comment with the given author and text to the
+// cell, replacing any comment it already had.
+func (c *Cell) SetComment(author, text string) {
+	c.Comment = &Comment{Author: author, Text: text}
+}
+
+// size returns the width and height of the comment box, applying the
+// defaults for any dimension that is not set.
+func (cm *Comment) size() (int, int) {
+	width, height := cm.Width, cm.Height
+	if width <= 0 {
+		width = defaultCommentWidth
+	}
+	if height <= 0 {
+		height = defaultCommentHeight
+	}
+	return width, height
+}
+
+// commentAnchor returns the x:Anchor of the VML shape that displays
+// the comment of the cell at the given coordinates.  The anchor is a
+// list of column, offset, row, offset for the top left and the bottom
+// right corner of the box.
+func commentAnchor(col, row, width, height int) string {
+	top := row - 1
+	if top < 0 {
+		top = 0
+	}
+	return fmt.Sprintf("%d, 15, %d, 10, %d, 15, %d, 4", col+1, top, col+1+width, top+height)
+}
+
+// makeXLSXComments builds the comments part, and the VML drawing that
+// shows them, for all the cells of the sheet that have a comment.  It
+// returns a nil xlsxComments when the sheet has no comments at all.
+//
+// The ids of the VML shapes are unique across the workbook: they are
+// taken from blocks of 1024 ids, of which each drawing claims as many
+// as its comments need, starting with idBlock.  The first block that
+// is left free for the next drawing is returned.
+func (s *Sheet) makeXLSXComments(idBlock int) (*xlsxComments, string, int) {
+	var xComments *xlsxComments
+	var shapes bytes.Buffer
+	authors := make(map[string]int)
+	count := 0
+	for r, row := range s.Rows {
+		for c, cell := range row.Cells {
+			if cell.Comment == nil {
+				continue
+			}
+			if xComments == nil {
+				xComments = &xlsxComments{}
+			}
+			comment := cell.Comment
+			authorID, ok := authors[comment.Author]
+			if !ok {
+				authorID = len(xComments.Authors.Author)
+				authors[comment.Author] = authorID
+				xComments.Authors.Author = append(xComments.Authors.Author, comment.Author)
+			}
+			xComment := xlsxComment{
+				Ref:      GetCellIDStringFromCoords(c, r),
+				AuthorId: authorID,
+			}
+			if comment.Text == "" && len(comment.RichText) > 0 {
+				xComment.Text.R = makeXLSXRichText(comment.RichText)
+			} else if runs := richTextFor(comment.RichText, comment.Text); runs != nil {
+				xComment.Text.R = makeXLSXRichText(runs)
+			} else if strings.TrimSpace(comment.Text) != comment.Text {
+				// Only the text of a run can keep the spaces
+				// around it.
+				xComment.Text.R = makeXLSXRichText([]RichTextRun{{Text: comment.Text}})
+			} else {
+				xComment.Text.T = comment.Text
+			}
+			xComments.CommentList.Comment = append(xComments.CommentList.Comment, xComment)
+
+			// The first id of each block is left unused, as
+			// Excel does.
+			shapeID := (idBlock+count/1023)*1024 + count%1023 + 1
+			count++
+			width, height := comment.size()
+			fmt.Fprintf(&shapes, vmlCommentShape, shapeID, commentAnchor(c, r, width, height), r, c)
+		}
+	}
+	if xComments == nil {
+		return nil, "", idBlock
+	}
+	blocks := make([]string, (count+1022)/1023)
+	for i := range blocks {
+		blocks[i] = strconv.Itoa(idBlock + i)
+	}
+	return xComments, fmt.Sprintf(vmlDrawingTemplate, strings.Join(blocks, ","), shapes.String()), idBlock + len(blocks)
+}
+
+// readCommentsFromZipFile is an internal helper function that
+// attaches the comments from a comments part to the cells of a sheet.
+// The VML drawing of the sheet, when there is one, provides the size
+// of each comment box.  Comments outside of the rows and columns that
+// were read are ignored.
+func readCommentsFromZipFile(f *zip.File, vml *zip.File, sheet *Sheet, options OpenOptions) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	xComments := new(xlsxComments)
+	if err = xml.NewDecoder(rc).Decode(xComments); err != nil {
+		return err
+	}
+	var sizes map[string][2]int
+	if vml != nil {
+		// The VML drawing is only used for the size of the
+		// boxes, so a drawing we can't make sense of is not an
+		// error.
+		sizes, _ = readCommentSizesFromVML(vml)
+	}
+	for _, xComment := range xComments.CommentList.Comment {
+		col, row, err := GetCoordsFromCellIDString(xComment.Ref)
+		if err != nil {
+			return fmt.Errorf("comment %s", err.Error())
+		}
+		if !options.includesCell(col, row) {
+			continue
+		}
+		comment := &Comment{Text: xComment.Text.T}
+		if xComment.AuthorId >= 0 && xComment.AuthorId < len(xComments.Authors.Author) {
+			comment.Author = xComments.Authors.Author[xComment.AuthorId]
+		}
+		if len(xComment.Text.R) > 0 {
+			comment.RichText = makeRichTextFromXLSX(xComment.Text.R)
+			comment.Text = richTextToPlainString(comment.RichText)
+			if len(comment.RichText) == 1 && comment.RichText[0].Font == nil {
+				// A single run without a font is plain text.
+				comment.RichText = nil
+			}
+		}
+		if size, ok := sizes[xComment.Ref]; ok {
+			comment.Width, comment.Height = size[0], size[1]
+		}
+		sheet.Cell(row, col).Comment = comment
+	}
+	return nil
+}
+
+// readCommentSizesFromVML returns the size of the box of each comment
+// in a VML drawing, keyed by the cell the comment belongs to.  VML is
+// not always well formed XML, so it is read leniently.
+func readCommentSizesFromVML(f *zip.File) (map[string][2]int, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	decoder := xml.NewDecoder(rc)
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+
+	sizes := make(map[string][2]int)
+	var element, anchor string
+	var row, col int
+	var inNote bool
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			element = t.Name.Local
+			if element == "ClientData" {
+				inNote = false
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "ObjectType" && attr.Value == "Note" {
+						inNote = true
+					}
+				}
+				anchor, row, col = "", -1, -1
+			}
+		case xml.CharData:
+			if !inNote {
+				continue
+			}
+			text := strings.TrimSpace(string(t))
+			switch element {
+			case "Anchor":
+				anchor = text
+			case "Row":
+				row, _ = strconv.Atoi(text)
+			case "Column":
+				col, _ = strconv.Atoi(text)
+			}
+		case xml.EndElement:
+			element = ""
+			if t.Name.Local != "ClientData" || !inNote {
+				continue
+			}
+			inNote = false
+			parts := strings.Split(anchor, ",")
+			if len(parts) != 8 || row < 0 || col < 0 {
+				continue
+			}
+			values := make([]int, 8)
+			for i, part := range parts {
+				values[i], _ = strconv.Atoi(strings.TrimSpace(part))
+			}
+			sizes[GetCellIDStringFromCoords(col, row)] = [2]int{values[4] - values[0], values[6] - values[2]}
+		}
+	}
+	return sizes, nil
+}
+
+const vmlDrawingTemplate = `<xml xmlns:v="urn:schemas-microsoft-com:vml" xmlns:o="urn:schemas-microsoft-com:office:office" xmlns:x="urn:schemas-microsoft-com:office:excel">
+ <o:shapelayout v:ext="edit">
+  <o:idmap v:ext="edit" data="%s"/>
+ </o:shapelayout>
+ <v:shapetype id="_x0000_t202" coordsize="21600,21600" o:spt="202" path="m,l,21600r21600,l21600,xe">
+  <v:stroke joinstyle="miter"/>
+  <v:path gradientshapeok="t" o:connecttype="rect"/>
+ </v:shapetype>
+%s</xml>`
+
+const vmlCommentShape = ` <v:shape id="_x0000_s%d" type="#_x0000_t202" style="position:absolute;margin-left:59.25pt;margin-top:1.5pt;width:108pt;height:59.25pt;z-index:1;visibility:hidden" fillcolor="#ffffe1" o:insetmode="auto">
+  <v:fill color2="#ffffe1"/>
+  <v:shadow on="t" color="black" obscured="t"/>
+  <v:path o:connecttype="none"/>
+  <v:textbox style="mso-direction-alt:auto">
+   <div style="text-align:left"></div>
+  </v:textbox>
+  <x:ClientData ObjectType="Note">
+   <x:MoveWithCells/>
+   <x:SizeWithCells/>
+   <x:Anchor>%s</x:Anchor>
+   <x:AutoFill>False</x:AutoFill>
+   <x:Row>%d</x:Row>
+   <x:Column>%d</x:Column>
+  </x:ClientData>
+ </v:shape>
+`
@@ -0,0 +1,173 @@
+package xlsx
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type CommentSuite struct{}
+
+var _ = Suite(&CommentSuite{})
+
+// Comments produce a comments part, a VML drawing and the
+// relationships and content types that tie them to the sheet.
+func (s *CommentSuite) TestMarshalComments(c *C) {
+	f := NewFile()
+	sheet, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	sheet.Cell(0, 0).SetString("A1")
+	sheet.Cell(2, 1).SetComment("Joe", "Check this")
+
+	parts, err := f.MarshallParts()
+	c.Assert(err, IsNil)
+	c.Assert(parts["xl/comments1.xml"], Equals, `<?xml version="1.0" encoding="UTF-8"?>
+<comments xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><authors><author>Joe</author></authors><commentList><comment ref="B3" authorId="0"><text><t>Check this</t></text></comment></commentList></comments>`)
+	c.Assert(parts["xl/worksheets/_rels/sheet1.xml.rels"], Equals, `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Target="../comments1.xml" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/comments"></Relationship><Relationship Id="rId2" Target="../drawings/vmlDrawing1.vml" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/vmlDrawing"></Relationship></Relationships>`)
+
+	sheetXML := parts["xl/worksheets/sheet1.xml"]
+	c.Assert(strings.Contains(sheetXML, `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">`), Equals, true)
+	c.Assert(strings.Contains(sheetXML, `<legacyDrawing r:id="rId2"></legacyDrawing></worksheet>`), Equals, true)
+
+	vml := parts["xl/drawings/vmlDrawing1.vml"]
+	c.Assert(strings.Contains(vml, `<x:Anchor>2, 15, 1, 10, 4, 15, 5, 4</x:Anchor>`), Equals, true)
+	c.Assert(strings.Contains(vml, `<x:Row>2</x:Row>`), Equals, true)
+	c.Assert(strings.Contains(vml, `<x:Column>1</x:Column>`), Equals, true)
+
+	types := parts["[Content_Types].xml"]
+	c.Assert(strings.Contains(types, `<Override PartName="/xl/comments1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.comments+xml"></Override>`), Equals, true)
+	c.Assert(strings.Contains(types, `<Default Extension="vml" ContentType="application/vnd.openxmlformats-officedocument.vmlDrawing"></Default>`), Equals, true)
+}
+
+// A sheet without comments has no relationships part.
+func (s *CommentSuite) TestMarshalWithoutComments(c *C) {
+	f := NewFile()
+	sheet, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	sheet.Cell(0, 0).SetString("A1")
+
+	parts, err := f.MarshallParts()
+	c.Assert(err, IsNil)
+	_, ok := parts["xl/worksheets/_rels/sheet1.xml.rels"]
+	c.Assert(ok, Equals, false)
+	c.Assert(strings.Contains(parts["xl/worksheets/sheet1.xml"], "legacyDrawing"), Equals, false)
+}
+
+// Comments, including their rich text and the size of their box,
+// survive writing a File and reading it back.
+func (s *CommentSuite) TestCommentRoundTrip(c *C) {
+	f := NewFile()
+	sheet1, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	sheet1.Cell(0, 0).SetString("value")
+	sheet1.Cell(0, 0).SetComment("Alice", "plain note")
+	sheet1.Cell(4, 3).Comment = &Comment{
+		Author: "Bob",
+		RichText: []RichTextRun{
+			{Font: &RichTextFont{Bold: true}, Text: "Bob:"},
+			{Text: " rich note"},
+		},
+		Width:  3,
+		Height: 6,
+	}
+	sheet2, err := f.AddSheet("Sheet2")
+	c.Assert(err, IsNil)
+	sheet2.Cell(1, 1).SetComment("Alice", "second sheet")
+
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), IsNil)
+	f, err = OpenBinary(buf.Bytes())
+	c.Assert(err, IsNil)
+
+	comment := f.Sheets[0].Cell(0, 0).Comment
+	c.Assert(comment, NotNil)
+	c.Assert(comment.Author, Equals, "Alice")
+	c.Assert(comment.Text, Equals, "plain note")
+	c.Assert(comment.RichText, IsNil)
+	c.Assert(comment.Width, Equals, defaultCommentWidth)
+	c.Assert(comment.Height, Equals, defaultCommentHeight)
+
+	comment = f.Sheets[0].Cell(4, 3).Comment
+	c.Assert(comment, NotNil)
+	c.Assert(comment.Author, Equals, "Bob")
+	c.Assert(comment.Text, Equals, "Bob: rich note")
+	c.Assert(comment.RichText, HasLen, 2)
+	c.Assert(comment.RichText[0].Font.Bold, Equals, true)
+	c.Assert(comment.Width, Equals, 3)
+	c.Assert(comment.Height, Equals, 6)
+
+	c.Assert(f.Sheets[0].Cell(1, 1).Comment, IsNil)
+	comment = f.Sheets[1].Cell(1, 1).Comment
+	c.Assert(comment, NotNil)
+	c.Assert(comment.Text, Equals, "second sheet")
+}
+
+// Comments outside the rows that were read are dropped.
+func (s *CommentSuite) TestReadCommentsWithRowLimit(c *C) {
+	f := NewFile()
+	sheet, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	sheet.Cell(0, 0).SetComment("Alice", "kept")
+	sheet.Cell(5, 0).SetComment("Alice", "dropped")
+
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), IsNil)
+	f, err = OpenBinaryWithRowLimit(buf.Bytes(), 2)
+	c.Assert(err, IsNil)
+	c.Assert(f.Sheets[0].Cell(0, 0).Comment.Text, Equals, "kept")
+	c.Assert(len(f.Sheets[0].Rows) < 5, Equals, true)
+}
+
+// A sheet with more than 1023 comments claims more than one block of
+// shape ids, and the blocks of the next sheet follow on from them.
+func (s *CommentSuite) TestManyCommentsShapeIDs(c *C) {
+	f := NewFile()
+	for _, name := range []string{"Sheet1", "Sheet2"} {
+		sheet, err := f.AddSheet(name)
+		c.Assert(err, IsNil)
+		for i := 0; i < 1100; i++ {
+			sheet.Cell(i, 0).SetComment("Joe", "note")
+		}
+	}
+
+	parts, err := f.MarshallParts()
+	c.Assert(err, IsNil)
+	ids := make(map[string]bool)
+	for i, idmap := range []string{`data="1,2"`, `data="3,4"`} {
+		vml := parts[fmt.Sprintf("xl/drawings/vmlDrawing%d.vml", i+1)]
+		c.Assert(strings.Contains(vml, `<o:idmap v:ext="edit" `+idmap+`/>`), Equals, true)
+		for _, match := range regexp.MustCompile(`<v:shape id="_x0000_s(\d+)"`).FindAllStringSubmatch(vml, -1) {
+			c.Assert(ids[match[1]], Equals, false, Commentf("shape id %s is used twice", match[1]))
+			ids[match[1]] = true
+		}
+	}
+	c.Assert(ids, HasLen, 2200)
+	c.Assert(ids["1025"], Equals, true)
+	c.Assert(ids["2047"], Equals, true)
+	c.Assert(ids["2049"], Equals, true)
+	c.Assert(ids["3073"], Equals, true)
+}
+
+// The spaces around the text of a comment survive a round trip.
+func (s *CommentSuite) TestCommentKeepsSpaces(c *C) {
+	f := NewFile()
+	sheet, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	sheet.Cell(0, 0).SetComment("Joe", "  indented ")
+
+	parts, err := f.MarshallParts()
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(parts["xl/comments1.xml"], `<text><r><t xml:space="preserve">  indented </t></r></text>`), Equals, true, Commentf(parts["xl/comments1.xml"]))
+
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), IsNil)
+	f, err = OpenBinary(buf.Bytes())
+	c.Assert(err, IsNil)
+	comment := f.Sheets[0].Cell(0, 0).Comment
+	c.Assert(comment.Text, Equals, "  indented ")
+	c.Assert(comment.RichText, IsNil)
+}
@@ -0,0 +1,551 @@
+package xlsx
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ConditionalFormatType is the kind of test a conditional formatting
+// rule applies to the cells it covers.
+type ConditionalFormatType string
+
+// These are the conditional formatting rule types from the ST_CfType
+// spec that can be built with the New*Rule functions.
+const (
+	ConditionalFormatTypeCellIs          ConditionalFormatType = "cellIs"
+	ConditionalFormatTypeExpression      ConditionalFormatType = "expression"
+	ConditionalFormatTypeTop10           ConditionalFormatType = "top10"
+	ConditionalFormatTypeAboveAverage    ConditionalFormatType = "aboveAverage"
+	ConditionalFormatTypeDuplicateValues ConditionalFormatType = "duplicateValues"
+	ConditionalFormatTypeUniqueValues    ConditionalFormatType = "uniqueValues"
+	ConditionalFormatTypeContainsText    ConditionalFormatType = "containsText"
+	ConditionalFormatTypeNotContainsText ConditionalFormatType = "notContainsText"
+	ConditionalFormatTypeBeginsWith      ConditionalFormatType = "beginsWith"
+	ConditionalFormatTypeEndsWith        ConditionalFormatType = "endsWith"
+	ConditionalFormatTypeTimePeriod      ConditionalFormatType = "timePeriod"
+)
+
+// ConditionalFormatOperator compares the value of a cell with the
+// formulas of a cellIs rule.
+type ConditionalFormatOperator string
+
+// These are the operators from the ST_ConditionalFormattingOperator
+// spec that apply to cellIs rules.
+const (
+	ConditionalFormatOperatorLessThan           ConditionalFormatOperator = "lessThan"
+	ConditionalFormatOperatorLessThanOrEqual    ConditionalFormatOperator = "lessThanOrEqual"
+	ConditionalFormatOperatorEqual              ConditionalFormatOperator = "equal"
+	ConditionalFormatOperatorNotEqual           ConditionalFormatOperator = "notEqual"
+	ConditionalFormatOperatorGreaterThanOrEqual ConditionalFormatOperator = "greaterThanOrEqual"
+	ConditionalFormatOperatorGreaterThan        ConditionalFormatOperator = "greaterThan"
+	ConditionalFormatOperatorBetween            ConditionalFormatOperator = "between"
+	ConditionalFormatOperatorNotBetween         ConditionalFormatOperator = "notBetween"
+)
+
+// TimePeriod is the range of dates matched by a timePeriod rule,
+// relative to the current date.
+type TimePeriod string
+
+// These are the time periods from the ST_TimePeriod spec
+const (
+	TimePeriodToday     TimePeriod = "today"
+	TimePeriodYesterday TimePeriod = "yesterday"
+	TimePeriodTomorrow  TimePeriod = "tomorrow"
+	TimePeriodLast7Days TimePeriod = "last7Days"
+	TimePeriodThisMonth TimePeriod = "thisMonth"
+	TimePeriodLastMonth TimePeriod = "lastMonth"
+	TimePeriodNextMonth TimePeriod = "nextMonth"
+	TimePeriodThisWeek  TimePeriod = "thisWeek"
+	TimePeriodLastWeek  TimePeriod = "lastWeek"
+	TimePeriodNextWeek  TimePeriod = "nextWeek"
+)
+
+// timePeriodFormulas are the formulas Excel uses for each time
+// period, with %[1]s standing for the top left cell of the range.
+var timePeriodFormulas = map[TimePeriod]string{
+	TimePeriodToday:     "FLOOR(%[1]s,1)=TODAY()",
+	TimePeriodYesterday: "FLOOR(%[1]s,1)=TODAY()-1",
+	TimePeriodTomorrow:  "FLOOR(%[1]s,1)=TODAY()+1",
+	TimePeriodLast7Days: "AND(TODAY()-FLOOR(%[1]s,1)<=6,FLOOR(%[1]s,1)<=TODAY())",
+	TimePeriodThisMonth: "AND(MONTH(%[1]s)=MONTH(TODAY()),YEAR(%[1]s)=YEAR(TODAY()))",
+	TimePeriodLastMonth: "AND(MONTH(%[1]s)=MONTH(EDATE(TODAY(),0-1)),YEAR(%[1]s)=YEAR(EDATE(TODAY(),0-1)))",
+	TimePeriodNextMonth: "AND(MONTH(%[1]s)=MONTH(EDATE(TODAY(),0+1)),YEAR(%[1]s)=YEAR(EDATE(TODAY(),0+1)))",
+	TimePeriodThisWeek:  "AND(TODAY()-ROUNDDOWN(%[1]s,0)<=WEEKDAY(TODAY())-1,ROUNDDOWN(%[1]s,0)-TODAY()<=7-WEEKDAY(TODAY()))",
+	TimePeriodLastWeek:  "AND(TODAY()-ROUNDDOWN(%[1]s,0)>=(WEEKDAY(TODAY())),TODAY()-ROUNDDOWN(%[1]s,0)<(WEEKDAY(TODAY())+7))",
+	TimePeriodNextWeek:  "AND(ROUNDDOWN(%[1]s,0)-TODAY()>(7-WEEKDAY(TODAY())),ROUNDDOWN(%[1]s,0)-TODAY()<(15-WEEKDAY(TODAY())))",
+}
+
+// textRuleOperators are the operators Excel writes for each of the
+// rule types that look for text, along with their formulas, with
+// %[1]s standing for the top left cell of the range and %[2]s for the
+// quoted text.
+var textRuleOperators = map[ConditionalFormatType][2]string{
+	ConditionalFormatTypeContainsText:    {"containsText", "NOT(ISERROR(SEARCH(%[2]s,%[1]s)))"},
+	ConditionalFormatTypeNotContainsText: {"notContains", "ISERROR(SEARCH(%[2]s,%[1]s))"},
+	ConditionalFormatTypeBeginsWith:      {"beginsWith", "LEFT(%[1]s,LEN(%[2]s))=%[2]s"},
+	ConditionalFormatTypeEndsWith:        {"endsWith", "RIGHT(%[1]s,LEN(%[2]s))=%[2]s"},
+}
+
+// DifferentialStyle is the formatting a conditional formatting rule
+// applies on top of the style of a cell.  Only the parts that are set
+// are changed, so a nil Font leaves the font of the cell alone.
+type DifferentialStyle struct {
+	Font   *Font
+	Fill   *Fill
+	Border *Border
+	NumFmt string
+}
+
+// ConditionalFormat is a set of rules applied to one or more ranges
+// of cells of a Sheet.
+type ConditionalFormat struct {
+	// Ref is a space separated list of cells and ranges, for
+	// example "A1:A10 C1:C10".
+	Ref   string
+	Rules []*ConditionalFormatRule
+}
+
+// ConditionalFormatRule is a single test of a conditional format and
+// the style applied to the cells that pass it.  The fields that are
+// used depend on the Type of the rule; the New*Rule functions set the
+// right ones.
+type ConditionalFormatRule struct {
+	Type  ConditionalFormatType
+	Style *DifferentialStyle
+	// Priority orders the rules of a sheet, lowest first.  Rules
+	// left at zero are numbered after all other rules when the
+	// sheet is written.
+	Priority   int
+	StopIfTrue bool
+	// Operator and Formulas are used by cellIs and expression
+	// rules.  Formulas are given without a leading "=".  Rules
+	// that look for text, and timePeriod rules, have their
+	// formulas generated when they are left empty.
+	Operator ConditionalFormatOperator
+	Formulas []string
+	// Rank, Percent and Bottom are used by top10 rules.
+	Rank    int
+	Percent bool
+	Bottom  bool
+	// BelowAverage, EqualAverage and StdDev are used by
+	// aboveAverage rules.
+	BelowAverage bool
+	EqualAverage bool
+	StdDev       int
+	// Text is used by containsText, notContainsText, beginsWith
+	// and endsWith rules.
+	Text string
+	// TimePeriod is used by timePeriod rules.
+	TimePeriod TimePeriod
+	// ColorScale, DataBar and IconSet are used by colorScale,
+	// dataBar and iconSet rules, which take no Style.
+	ColorScale *ColorScale
+	DataBar    *DataBar
+	IconSet    *IconSet
+}
+
+// NewCellIsRule returns a rule that compares the value of each cell
+// with one formula, or two for the between and notBetween operators.
+func NewCellIsRule(operator ConditionalFormatOperator, style *DifferentialStyle, formulas ...string) *ConditionalFormatRule {
+	return &ConditionalFormatRule{
+		Type:     ConditionalFormatTypeCellIs,
+		Operator: operator,
+		Formulas: formulas,
+		Style:    style,
+	}
+}
+
+// NewExpressionRule returns a rule that formats each cell for which
+// the formula is true.  Relative references in the formula are
+// relative to the top left cell of the range.
+func NewExpressionRule(formula string, style *DifferentialStyle) *ConditionalFormatRule {
+	return &ConditionalFormatRule{
+		Type:     ConditionalFormatTypeExpression,
+		Formulas: []string{formula},
+		Style:    style,
+	}
+}
+
+// NewTop10Rule returns a rule that formats the rank highest values,
+// or the lowest if bottom is true.  When percent is true rank is a
+// percentage of the cells rather than a count.
+func NewTop10Rule(rank int, percent, bottom bool, style *DifferentialStyle) *ConditionalFormatRule {
+	return &ConditionalFormatRule{
+		Type:    ConditionalFormatTypeTop10,
+		Rank:    rank,
+		Percent: percent,
+		Bottom:  bottom,
+		Style:   style,
+	}
+}
+
+// NewAboveAverageRule returns a rule that formats the values above
+// the average of the range, or below it if below is true.
+func NewAboveAverageRule(below bool, style *DifferentialStyle) *ConditionalFormatRule {
+	return &ConditionalFormatRule{
+		Type:         ConditionalFormatTypeAboveAverage,
+		BelowAverage: below,
+		Style:        style,
+	}
+}
+
+// NewDuplicateValuesRule returns a rule that formats the values that
+// appear more than once in the range.
+func NewDuplicateValuesRule(style *DifferentialStyle) *ConditionalFormatRule {
+	return &ConditionalFormatRule{
+		Type:  ConditionalFormatTypeDuplicateValues,
+		Style: style,
+	}
+}
+
+// NewUniqueValuesRule returns a rule that formats the values that
+// appear only once in the range.
+func NewUniqueValuesRule(style *DifferentialStyle) *ConditionalFormatRule {
+	return &ConditionalFormatRule{
+		Type:  ConditionalFormatTypeUniqueValues,
+		Style: style,
+	}
+}
+
+// NewContainsTextRule returns a rule that formats the cells that
+// contain the given text, ignoring case.
+func NewContainsTextRule(text string, style *DifferentialStyle) *ConditionalFormatRule {
+	return &ConditionalFormatRule{
+		Type:  ConditionalFormatTypeContainsText,
+		Text:  text,
+		Style: style,
+	}
+}
+
+// NewTimePeriodRule returns a rule that formats the dates that fall
+// within the given period.
+func NewTimePeriodRule(period TimePeriod, style *DifferentialStyle) *ConditionalFormatRule {
+	return &ConditionalFormatRule{
+		Type:       ConditionalFormatTypeTimePeriod,
+		TimePeriod: period,
+		Style:      style,
+	}
+}
+
+// AddConditionalFormat applies rules to the cells of ref, which is a
+// space separated list of cells and ranges such as "A1:A10 C1:C10".
+func (s *Sheet) AddConditionalFormat(ref string, rules ...*ConditionalFormatRule) (*ConditionalFormat, error) {
+	if _, _, err := conditionalFormatTopLeft(ref); err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("conditional format %s has no rules", ref)
+	}
+	cf := &ConditionalFormat{Ref: ref, Rules: rules}
+	s.ConditionalFormats = append(s.ConditionalFormats, cf)
+	return cf, nil
+}
+
+// conditionalFormatTopLeft checks that ref is a valid list of cells
+// and ranges, and returns the coordinates of the top left cell of its
+// first range.
+func conditionalFormatTopLeft(ref string) (col, row int, err error) {
+	fields := strings.Fields(ref)
+	if len(fields) == 0 {
+		return 0, 0, fmt.Errorf("conditional format has no cell range")
+	}
+	for i, field := range fields {
+		parts := strings.Split(field, cellRangeChar)
+		if len(parts) > 2 {
+			return 0, 0, fmt.Errorf("invalid cell range %q", field)
+		}
+		for j, part := range parts {
+			x, y, err := GetCoordsFromCellIDString(part)
+			if err != nil || x < 0 || y < 0 {
+				return 0, 0, fmt.Errorf("invalid cell range %q", field)
+			}
+			if i == 0 && j == 0 {
+				col, row = x, y
+			}
+		}
+	}
+	return col, row, nil
+}
+
+// makeXLSXDxf converts a DifferentialStyle into a differential format.
+func (ds *DifferentialStyle) makeXLSXDxf(styles *xlsxStyleSheet) xlsxDxf {
+	xDxf := xlsxDxf{}
+	if ds.Font != nil {
+		xFont := &xlsxFont{}
+		if ds.Font.Size > 0 {
+			xFont.Sz.Val = strconv.Itoa(ds.Font.Size)
+		}
+		xFont.Name.Val = ds.Font.Name
+		xFont.Color.RGB = ds.Font.Color
+		if ds.Font.Bold {
+			xFont.B = &xlsxVal{}
+		}
+		if ds.Font.Italic {
+			xFont.I = &xlsxVal{}
+		}
+		if ds.Font.Underline {
+			xFont.U = &xlsxVal{}
+		}
+		xDxf.Font = xFont
+	}
+	if ds.NumFmt != "" {
+		xNumFmt := styles.newNumFmt(ds.NumFmt)
+		xDxf.NumFmt = &xNumFmt
+	}
+	if ds.Fill != nil {
+		xFill := &xlsxFill{}
+		xFill.PatternFill.PatternType = ds.Fill.PatternType
+		xFill.PatternFill.FgColor.RGB = ds.Fill.FgColor
+		xFill.PatternFill.BgColor.RGB = ds.Fill.BgColor
+		// Excel paints solid differential fills with the
+		// background color, so use the foreground color when that
+		// is the only one given.
+		if ds.Fill.PatternType == "solid" && ds.Fill.BgColor == "" {
+			xFill.PatternFill.BgColor.RGB = ds.Fill.FgColor
+		}
+		xDxf.Fill = xFill
+	}
+	if ds.Border != nil {
+		xDxf.Border = &xlsxBorder{
+			Left:   xlsxLine{Style: ds.Border.Left, Color: xlsxColor{RGB: ds.Border.LeftColor}},
+			Right:  xlsxLine{Style: ds.Border.Right, Color: xlsxColor{RGB: ds.Border.RightColor}},
+			Top:    xlsxLine{Style: ds.Border.Top, Color: xlsxColor{RGB: ds.Border.TopColor}},
+			Bottom: xlsxLine{Style: ds.Border.Bottom, Color: xlsxColor{RGB: ds.Border.BottomColor}},
+		}
+	}
+	return xDxf
+}
+
+// getDifferentialStyle converts the differential format at the given
+// index into a DifferentialStyle.
+func (styles *xlsxStyleSheet) getDifferentialStyle(dxfID int) *DifferentialStyle {
+	if styles.Dxfs == nil || dxfID < 0 || dxfID >= len(styles.Dxfs.Dxf) {
+		return nil
+	}
+	xDxf := styles.Dxfs.Dxf[dxfID]
+	ds := &DifferentialStyle{}
+	if xFont := xDxf.Font; xFont != nil {
+		font := &Font{Name: xFont.Name.Val, Color: styles.argbValue(xFont.Color)}
+		font.Size, _ = strconv.Atoi(xFont.Sz.Val)
+		font.Bold = xFont.B != nil && xFont.B.Val != "0"
+		font.Italic = xFont.I != nil && xFont.I.Val != "0"
+		font.Underline = xFont.U != nil && xFont.U.Val != "0" && xFont.U.Val != "none"
+		ds.Font = font
+	}
+	if xDxf.NumFmt != nil {
+		ds.NumFmt = xDxf.NumFmt.FormatCode
+		if ds.NumFmt == "" {
+			ds.NumFmt = getBuiltinNumberFormat(xDxf.NumFmt.NumFmtId)
+		}
+	}
+	if xFill := xDxf.Fill; xFill != nil {
+		ds.Fill = &Fill{
+			PatternType: xFill.PatternFill.PatternType,
+			FgColor:     styles.argbValue(xFill.PatternFill.FgColor),
+			BgColor:     styles.argbValue(xFill.PatternFill.BgColor),
+		}
+	}
+	if xBorder := xDxf.Border; xBorder != nil {
+		ds.Border = &Border{
+			Left:        xBorder.Left.Style,
+			LeftColor:   styles.argbValue(xBorder.Left.Color),
+			Right:       xBorder.Right.Style,
+			RightColor:  styles.argbValue(xBorder.Right.Color),
+			Top:         xBorder.Top.Style,
+			TopColor:    styles.argbValue(xBorder.Top.Color),
+			Bottom:      xBorder.Bottom.Style,
+			BottomColor: styles.argbValue(xBorder.Bottom.Color),
+		}
+	}
+	return ds
+}
+
+// quoteFormulaString returns s as a string literal for a formula.
+func quoteFormulaString(s string) string {
+	return `"` + strings.Replace(s, `"`, `""`, -1) + `"`
+}
+
+// makeXLSXConditionalFormatting converts the conditional formats of
+// the sheet into their XML form, adding the differential formats
+// they use to the style sheet.  Data bars also need the extLst of
+// the worksheet that is returned alongside them.
+func (s *Sheet) makeXLSXConditionalFormatting(styles *xlsxStyleSheet) ([]*xlsxConditionalFormatting, *xlsxInnerXML, error) {
+	if len(s.ConditionalFormats) == 0 {
+		return nil, nil, nil
+	}
+	nextPriority := 1
+	for _, cf := range s.ConditionalFormats {
+		for _, rule := range cf.Rules {
+			if rule.Priority >= nextPriority {
+				nextPriority = rule.Priority + 1
+			}
+		}
+	}
+	var result []*xlsxConditionalFormatting
+	var x14 bytes.Buffer
+	dataBars := 0
+	for _, cf := range s.ConditionalFormats {
+		col, row, err := conditionalFormatTopLeft(cf.Ref)
+		if err != nil {
+			return nil, nil, err
+		}
+		topLeft := GetCellIDStringFromCoords(col, row)
+		xCf := &xlsxConditionalFormatting{Sqref: cf.Ref}
+		for _, rule := range cf.Rules {
+			xRule := &xlsxCfRule{
+				Type:         string(rule.Type),
+				Priority:     rule.Priority,
+				StopIfTrue:   rule.StopIfTrue,
+				Operator:     string(rule.Operator),
+				Percent:      rule.Percent,
+				Bottom:       rule.Bottom,
+				Rank:         rule.Rank,
+				StdDev:       rule.StdDev,
+				EqualAverage: rule.EqualAverage,
+				Text:         rule.Text,
+				TimePeriod:   string(rule.TimePeriod),
+				Formula:      rule.Formulas,
+			}
+			if xRule.Priority == 0 {
+				xRule.Priority = nextPriority
+				nextPriority++
+			}
+			if rule.BelowAverage {
+				xRule.AboveAverage = new(bool)
+			}
+			if operator, ok := textRuleOperators[rule.Type]; ok {
+				if xRule.Operator == "" {
+					xRule.Operator = operator[0]
+				}
+				if len(xRule.Formula) == 0 {
+					xRule.Formula = []string{fmt.Sprintf(operator[1], topLeft, quoteFormulaString(rule.Text))}
+				}
+			}
+			if rule.Type == ConditionalFormatTypeTimePeriod && len(xRule.Formula) == 0 {
+				if formula, ok := timePeriodFormulas[rule.TimePeriod]; ok {
+					xRule.Formula = []string{fmt.Sprintf(formula, topLeft)}
+				}
+			}
+			if rule.Style != nil {
+				dxfID, err := styles.addDxf(rule.Style.makeXLSXDxf(styles))
+				if err != nil {
+					return nil, nil, err
+				}
+				xRule.DxfId = &dxfID
+			}
+			if rule.ColorScale != nil {
+				xRule.ColorScale, err = rule.ColorScale.makeXLSXColorScale()
+				if err != nil {
+					return nil, nil, err
+				}
+			}
+			if rule.DataBar != nil {
+				dataBars++
+				id, err := newDataBarExtID()
+				if err != nil {
+					return nil, nil, err
+				}
+				xRule.DataBar = rule.DataBar.makeXLSXDataBar()
+				xRule.ExtLst = makeCfRuleExtLst(id)
+				writeX14DataBar(&x14, id, cf.Ref, rule.DataBar)
+			}
+			if rule.IconSet != nil {
+				xRule.IconSet = rule.IconSet.makeXLSXIconSet()
+			}
+			xCf.CfRule = append(xCf.CfRule, xRule)
+		}
+		result = append(result, xCf)
+	}
+	if dataBars > 0 {
+		return result, makeConditionalFormattingExtLst(x14.String()), nil
+	}
+	return result, nil, nil
+}
+
+// readConditionalFormats converts the conditionalFormatting elements
+// of a worksheet into ConditionalFormats.  The extLst of the worksheet
+// provides the Excel 2010 settings of data bars.  styles may be nil,
+// in which case the rules have no Style.
+func readConditionalFormats(xCfs []*xlsxConditionalFormatting, extLst *xlsxInnerXML, styles *xlsxStyleSheet) ([]*ConditionalFormat, error) {
+	if len(xCfs) == 0 {
+		return nil, nil
+	}
+	x14DataBars, err := readX14DataBars(extLst)
+	if err != nil {
+		return nil, err
+	}
+	color := func(c xlsxColor) string {
+		if styles != nil {
+			return styles.argbValue(c)
+		}
+		return c.RGB
+	}
+	var result []*ConditionalFormat
+	for _, xCf := range xCfs {
+		cf := &ConditionalFormat{Ref: xCf.Sqref}
+		for _, xRule := range xCf.CfRule {
+			rule := &ConditionalFormatRule{
+				Type:         ConditionalFormatType(xRule.Type),
+				Priority:     xRule.Priority,
+				StopIfTrue:   xRule.StopIfTrue,
+				Operator:     ConditionalFormatOperator(xRule.Operator),
+				Formulas:     xRule.Formula,
+				Rank:         xRule.Rank,
+				Percent:      xRule.Percent,
+				Bottom:       xRule.Bottom,
+				BelowAverage: xRule.AboveAverage != nil && !*xRule.AboveAverage,
+				EqualAverage: xRule.EqualAverage,
+				StdDev:       xRule.StdDev,
+				Text:         xRule.Text,
+				TimePeriod:   TimePeriod(xRule.TimePeriod),
+			}
+			if xRule.DxfId != nil && styles != nil {
+				rule.Style = styles.getDifferentialStyle(*xRule.DxfId)
+			}
+			if xColorScale := xRule.ColorScale; xColorScale != nil {
+				rule.ColorScale = &ColorScale{Values: readCfvos(xColorScale.Cfvo)}
+				for _, c := range xColorScale.Color {
+					rule.ColorScale.Colors = append(rule.ColorScale.Colors, color(c))
+				}
+			}
+			if xDataBar := xRule.DataBar; xDataBar != nil {
+				dataBar := &DataBar{
+					Color:     color(xDataBar.Color),
+					HideValue: xDataBar.ShowValue != nil && !*xDataBar.ShowValue,
+					MinLength: xDataBar.MinLength,
+					MaxLength: xDataBar.MaxLength,
+				}
+				values := readCfvos(xDataBar.Cfvo)
+				if len(values) == 2 {
+					dataBar.Min, dataBar.Max = values[0], values[1]
+				}
+				ruleExt, err := readX14ExtLst(xRule.ExtLst)
+				if err != nil {
+					return nil, err
+				}
+				for _, ext := range ruleExt.Ext {
+					if x14, ok := x14DataBars[ext.ID]; ok {
+						dataBar.applyX14DataBar(x14, styles)
+					}
+				}
+				rule.DataBar = dataBar
+			}
+			if xIconSet := xRule.IconSet; xIconSet != nil {
+				rule.IconSet = &IconSet{
+					Style:     IconSetStyle(xIconSet.IconSet),
+					Values:    readCfvos(xIconSet.Cfvo),
+					Reverse:   xIconSet.Reverse,
+					HideValue: xIconSet.ShowValue != nil && !*xIconSet.ShowValue,
+				}
+				if rule.IconSet.Style == "" {
+					rule.IconSet.Style = IconSetStyle3TrafficLights1
+				}
+			}
+			cf.Rules = append(cf.Rules, rule)
+		}
+		result = append(result, cf)
+	}
+	return result, nil
+}
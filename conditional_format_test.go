@@ -0,0 +1,295 @@
+package xlsx
+
+import (
+	"bytes"
+	"encoding/xml"
+	"regexp"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type ConditionalFormatSuite struct{}
+
+var _ = Suite(&ConditionalFormatSuite{})
+
+// Rules are written in order, with generated priorities, formulas and
+// differential formats.
+func (s *ConditionalFormatSuite) TestMarshalConditionalFormatting(c *C) {
+	f := NewFile()
+	sheet, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	sheet.Cell(0, 0).SetInt(1)
+	red := &DifferentialStyle{
+		Font: &Font{Color: "FF9C0006"},
+		Fill: &Fill{PatternType: "solid", FgColor: "FFFFC7CE"},
+	}
+	_, err = sheet.AddConditionalFormat("A1:A10",
+		NewCellIsRule(ConditionalFormatOperatorBetween, red, "1", "5"),
+		NewAboveAverageRule(true, &DifferentialStyle{Font: &Font{Bold: true}}))
+	c.Assert(err, IsNil)
+	_, err = sheet.AddConditionalFormat("B2:B5 D2:D5",
+		NewContainsTextRule(`say "hi"`, red),
+		NewTimePeriodRule(TimePeriodYesterday, &DifferentialStyle{NumFmt: "0.0%", Border: &Border{Bottom: "thin", BottomColor: "FF000000"}}))
+	c.Assert(err, IsNil)
+
+	parts, err := f.MarshallParts()
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(parts["xl/worksheets/sheet1.xml"],
+		`<conditionalFormatting sqref="A1:A10">`+
+			`<cfRule type="cellIs" dxfId="0" priority="1" operator="between"><formula>1</formula><formula>5</formula></cfRule>`+
+			`<cfRule type="aboveAverage" dxfId="1" priority="2" aboveAverage="false"></cfRule>`+
+			`</conditionalFormatting>`+
+			`<conditionalFormatting sqref="B2:B5 D2:D5">`+
+			`<cfRule type="containsText" dxfId="0" priority="3" operator="containsText" text="say &#34;hi&#34;"><formula>NOT(ISERROR(SEARCH(&#34;say &#34;&#34;hi&#34;&#34;&#34;,B2)))</formula></cfRule>`+
+			`<cfRule type="timePeriod" dxfId="2" priority="4" timePeriod="yesterday"><formula>FLOOR(B2,1)=TODAY()-1</formula></cfRule>`+
+			`</conditionalFormatting>`), Equals, true)
+	c.Assert(strings.HasSuffix(parts["xl/styles.xml"],
+		`<dxfs count="3">`+
+			`<dxf><font><color rgb="FF9C0006"/></font><fill><patternFill patternType="solid"><fgColor rgb="FFFFC7CE"/><bgColor rgb="FFFFC7CE"/></patternFill></fill></dxf>`+
+			`<dxf><font><b/></font></dxf>`+
+			`<dxf><numFmt numFmtId="164" formatCode="0.0%"/><border><bottom style="thin"><color rgb="FF000000"/></bottom></border></dxf>`+
+			`</dxfs></styleSheet>`), Equals, true)
+}
+
+// Invalid ranges and empty rule lists are rejected.
+func (s *ConditionalFormatSuite) TestAddConditionalFormatErrors(c *C) {
+	sheet := &Sheet{}
+	_, err := sheet.AddConditionalFormat("", NewDuplicateValuesRule(nil))
+	c.Assert(err, NotNil)
+	_, err = sheet.AddConditionalFormat("A1:B2:C3", NewDuplicateValuesRule(nil))
+	c.Assert(err, NotNil)
+	_, err = sheet.AddConditionalFormat("A1:B2")
+	c.Assert(err, NotNil)
+	c.Assert(sheet.ConditionalFormats, HasLen, 0)
+}
+
+// Rules and their styles are read from the worksheet and the dxfs of
+// the style sheet.
+func (s *ConditionalFormatSuite) TestReadConditionalFormatting(c *C) {
+	var worksheet xlsxWorksheet
+	err := xml.Unmarshal([]byte(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+  <sheetData/>
+  <conditionalFormatting sqref="C1:C20">
+    <cfRule type="top10" dxfId="0" priority="2" percent="1" bottom="1" rank="10"/>
+    <cfRule type="expression" dxfId="1" priority="1" stopIfTrue="1"><formula>MOD(ROW(),2)=0</formula></cfRule>
+    <cfRule type="duplicateValues" priority="3"/>
+  </conditionalFormatting>
+</worksheet>`), &worksheet)
+	c.Assert(err, IsNil)
+	var styles xlsxStyleSheet
+	err = xml.Unmarshal([]byte(`<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+  <dxfs count="2">
+    <dxf><font><b/><i/><color rgb="FF006100"/></font><fill><patternFill><bgColor rgb="FFC6EFCE"/></patternFill></fill></dxf>
+    <dxf><numFmt numFmtId="10" formatCode="0.00%"/><border><left style="thin"/></border></dxf>
+  </dxfs>
+</styleSheet>`), &styles)
+	c.Assert(err, IsNil)
+
+	cfs, err := readConditionalFormats(worksheet.ConditionalFormatting, worksheet.ExtLst, &styles)
+	c.Assert(err, IsNil)
+	c.Assert(cfs, HasLen, 1)
+	c.Assert(cfs[0].Ref, Equals, "C1:C20")
+	c.Assert(cfs[0].Rules, HasLen, 3)
+
+	rule := cfs[0].Rules[0]
+	c.Assert(rule.Type, Equals, ConditionalFormatTypeTop10)
+	c.Assert(rule.Priority, Equals, 2)
+	c.Assert(rule.Rank, Equals, 10)
+	c.Assert(rule.Percent, Equals, true)
+	c.Assert(rule.Bottom, Equals, true)
+	c.Assert(*rule.Style.Font, DeepEquals, Font{Bold: true, Italic: true, Color: "FF006100"})
+	c.Assert(rule.Style.Fill.BgColor, Equals, "FFC6EFCE")
+	c.Assert(rule.Style.Border, IsNil)
+
+	rule = cfs[0].Rules[1]
+	c.Assert(rule.Type, Equals, ConditionalFormatTypeExpression)
+	c.Assert(rule.StopIfTrue, Equals, true)
+	c.Assert(rule.Formulas, DeepEquals, []string{"MOD(ROW(),2)=0"})
+	c.Assert(rule.Style.NumFmt, Equals, "0.00%")
+	c.Assert(rule.Style.Border.Left, Equals, "thin")
+	c.Assert(rule.Style.Font, IsNil)
+
+	c.Assert(cfs[0].Rules[2].Style, IsNil)
+}
+
+// Conditional formats survive writing a File and reading it back.
+func (s *ConditionalFormatSuite) TestConditionalFormatRoundTrip(c *C) {
+	f := NewFile()
+	sheet, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	sheet.Cell(0, 0).SetInt(1)
+	green := &DifferentialStyle{Fill: &Fill{PatternType: "solid", FgColor: "FFC6EFCE"}}
+	_, err = sheet.AddConditionalFormat("A1:A10",
+		NewTop10Rule(3, false, false, green),
+		NewCellIsRule(ConditionalFormatOperatorGreaterThan, green, "100"),
+		NewTimePeriodRule(TimePeriodLast7Days, green))
+	c.Assert(err, IsNil)
+
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), IsNil)
+	f, err = OpenBinary(buf.Bytes())
+	c.Assert(err, IsNil)
+
+	cfs := f.Sheets[0].ConditionalFormats
+	c.Assert(cfs, HasLen, 1)
+	c.Assert(cfs[0].Rules, HasLen, 3)
+	c.Assert(cfs[0].Rules[0].Rank, Equals, 3)
+	c.Assert(cfs[0].Rules[0].Style.Fill.BgColor, Equals, "FFC6EFCE")
+	c.Assert(cfs[0].Rules[1].Operator, Equals, ConditionalFormatOperatorGreaterThan)
+	c.Assert(cfs[0].Rules[1].Formulas, DeepEquals, []string{"100"})
+	c.Assert(cfs[0].Rules[2].TimePeriod, Equals, TimePeriodLast7Days)
+	c.Assert(cfs[0].Rules[2].Priority, Equals, 3)
+
+	// Writing the file again doesn't change the rules.
+	parts, err := f.MarshallParts()
+	c.Assert(err, IsNil)
+	c.Assert(strings.Count(parts["xl/styles.xml"], "<dxf>"), Equals, 1)
+	c.Assert(strings.Count(parts["xl/worksheets/sheet1.xml"], "<cfRule"), Equals, 3)
+}
+
+// Color scales, data bars and icon sets are written with their
+// thresholds, and data bars get an Excel 2010 extension.
+func (s *ConditionalFormatSuite) TestMarshalVisualRules(c *C) {
+	f := NewFile()
+	sheet, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	sheet.Cell(0, 0).SetInt(1)
+	_, err = sheet.AddColorScale("A1:A10", "FFF8696B", "FFFFEB84", "FF63BE7B")
+	c.Assert(err, IsNil)
+	_, err = sheet.AddDataBar("B1:B10", &DataBar{
+		Min:               ConditionalFormatValue{Type: ConditionalFormatValueTypeNum, Value: "0"},
+		Max:               ConditionalFormatValue{Type: ConditionalFormatValueTypeMax},
+		Color:             "FF638EC6",
+		Solid:             true,
+		NegativeFillColor: "FFC00000",
+	})
+	c.Assert(err, IsNil)
+	_, err = sheet.AddIconSet("C1:C10", IconSetStyle4Arrows)
+	c.Assert(err, IsNil)
+	_, err = sheet.AddColorScale("D1:D10", "FFFFFFFF")
+	c.Assert(err, NotNil)
+
+	parts, err := f.MarshallParts()
+	c.Assert(err, IsNil)
+	sheetXML := parts["xl/worksheets/sheet1.xml"]
+	// The data bar is tied to its extension by a random GUID.
+	id := regexp.MustCompile(`<x14:id>([^<]*)</x14:id>`).FindStringSubmatch(sheetXML)
+	c.Assert(id, HasLen, 2)
+	c.Assert(id[1], Matches, `\{[0-9A-F]{8}-[0-9A-F]{4}-4[0-9A-F]{3}-[89AB][0-9A-F]{3}-[0-9A-F]{12}\}`)
+	sheetXML = strings.Replace(sheetXML, id[1], "{ID}", -1)
+	c.Assert(strings.Contains(sheetXML,
+		`<conditionalFormatting sqref="A1:A10"><cfRule type="colorScale" priority="1"><colorScale>`+
+			`<cfvo type="min"></cfvo><cfvo type="percentile" val="50"></cfvo><cfvo type="max"></cfvo>`+
+			`<color rgb="FFF8696B"></color><color rgb="FFFFEB84"></color><color rgb="FF63BE7B"></color>`+
+			`</colorScale></cfRule></conditionalFormatting>`), Equals, true)
+	c.Assert(strings.Contains(sheetXML,
+		`<conditionalFormatting sqref="B1:B10"><cfRule type="dataBar" priority="2"><dataBar>`+
+			`<cfvo type="num" val="0"></cfvo><cfvo type="max"></cfvo><color rgb="FF638EC6"></color></dataBar>`+
+			`<extLst><ext uri="{B025F937-C7B1-47D3-B67F-A62EFF666E3E}" xmlns:x14="http://schemas.microsoft.com/office/spreadsheetml/2009/9/main">`+
+			`<x14:id>{ID}</x14:id></ext></extLst></cfRule></conditionalFormatting>`), Equals, true)
+	c.Assert(strings.Contains(sheetXML,
+		`<conditionalFormatting sqref="C1:C10"><cfRule type="iconSet" priority="3"><iconSet iconSet="4Arrows">`+
+			`<cfvo type="percent" val="0"></cfvo><cfvo type="percent" val="25"></cfvo><cfvo type="percent" val="50"></cfvo><cfvo type="percent" val="75"></cfvo>`+
+			`</iconSet></cfRule></conditionalFormatting>`), Equals, true)
+	c.Assert(strings.HasSuffix(sheetXML,
+		`<extLst><ext uri="{78C0D931-6437-407d-A8EE-F0AAD7539E65}" xmlns:x14="http://schemas.microsoft.com/office/spreadsheetml/2009/9/main"><x14:conditionalFormattings>`+
+			`<x14:conditionalFormatting xmlns:xm="http://schemas.microsoft.com/office/excel/2006/main"><x14:cfRule type="dataBar" id="{ID}">`+
+			`<x14:dataBar minLength="0" maxLength="100" gradient="0" axisPosition="automatic">`+
+			`<x14:cfvo type="num"><xm:f>0</xm:f></x14:cfvo><x14:cfvo type="autoMax"/>`+
+			`<x14:negativeFillColor rgb="FFC00000"/><x14:axisColor rgb="FF000000"/>`+
+			`</x14:dataBar></x14:cfRule><xm:sqref>B1:B10</xm:sqref></x14:conditionalFormatting>`+
+			`</x14:conditionalFormattings></ext></extLst></worksheet>`), Equals, true)
+}
+
+// Data bars written by Excel 2010, with their extension declared on
+// the worksheet, are read along with color scales and icon sets.
+func (s *ConditionalFormatSuite) TestReadVisualRules(c *C) {
+	var worksheet xlsxWorksheet
+	err := xml.Unmarshal([]byte(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:x14="http://schemas.microsoft.com/office/spreadsheetml/2009/9/main" xmlns:xm="http://schemas.microsoft.com/office/excel/2006/main">
+  <sheetData/>
+  <conditionalFormatting sqref="A1:A5">
+    <cfRule type="colorScale" priority="3"><colorScale><cfvo type="min"/><cfvo type="max"/><color rgb="FFFF7128"/><color rgb="FFFFEF9C"/></colorScale></cfRule>
+    <cfRule type="dataBar" priority="2"><dataBar showValue="0"><cfvo type="min"/><cfvo type="max"/><color rgb="FF5A8AC6"/></dataBar>
+      <extLst><ext uri="{B025F937-C7B1-47D3-B67F-A62EFF666E3E}"><x14:id>{8E1A4A4B-4B45-4F0A-9C6C-0D7B1D2E3F40}</x14:id></ext></extLst></cfRule>
+    <cfRule type="iconSet" priority="1"><iconSet iconSet="3Flags" reverse="1"><cfvo type="percent" val="0"/><cfvo type="num" val="10"/><cfvo type="num" val="20"/></iconSet></cfRule>
+  </conditionalFormatting>
+  <extLst>
+    <ext uri="{78C0D931-6437-407d-A8EE-F0AAD7539E65}">
+      <x14:conditionalFormattings>
+        <x14:conditionalFormatting>
+          <x14:cfRule type="dataBar" id="{8E1A4A4B-4B45-4F0A-9C6C-0D7B1D2E3F40}">
+            <x14:dataBar minLength="0" maxLength="100" border="1" gradient="0" direction="rightToLeft" negativeBarBorderColorSameAsPositive="0" axisPosition="middle">
+              <x14:cfvo type="autoMin"/><x14:cfvo type="autoMax"/>
+              <x14:borderColor rgb="FF5A8AC6"/><x14:negativeFillColor rgb="FFFF0000"/><x14:negativeBorderColor rgb="FFAA0000"/><x14:axisColor rgb="FF333333"/>
+            </x14:dataBar>
+          </x14:cfRule>
+          <xm:sqref>A1:A5</xm:sqref>
+        </x14:conditionalFormatting>
+      </x14:conditionalFormattings>
+    </ext>
+  </extLst>
+</worksheet>`), &worksheet)
+	c.Assert(err, IsNil)
+
+	cfs, err := readConditionalFormats(worksheet.ConditionalFormatting, worksheet.ExtLst, nil)
+	c.Assert(err, IsNil)
+	c.Assert(cfs, HasLen, 1)
+	rules := cfs[0].Rules
+	c.Assert(rules, HasLen, 3)
+
+	c.Assert(*rules[0].ColorScale, DeepEquals, ColorScale{
+		Values: []ConditionalFormatValue{{Type: ConditionalFormatValueTypeMin}, {Type: ConditionalFormatValueTypeMax}},
+		Colors: []string{"FFFF7128", "FFFFEF9C"},
+	})
+	c.Assert(*rules[1].DataBar, DeepEquals, DataBar{
+		Min:                 ConditionalFormatValue{Type: ConditionalFormatValueTypeMin},
+		Max:                 ConditionalFormatValue{Type: ConditionalFormatValueTypeMax},
+		Color:               "FF5A8AC6",
+		HideValue:           true,
+		MinLength:           0,
+		MaxLength:           100,
+		Solid:               true,
+		BorderColor:         "FF5A8AC6",
+		NegativeFillColor:   "FFFF0000",
+		NegativeBorderColor: "FFAA0000",
+		AxisColor:           "FF333333",
+		AxisPosition:        DataBarAxisPositionMiddle,
+		Direction:           DataBarDirectionRightToLeft,
+	})
+	c.Assert(rules[2].IconSet.Style, Equals, IconSetStyle3Flags)
+	c.Assert(rules[2].IconSet.Reverse, Equals, true)
+	c.Assert(rules[2].IconSet.Values[2], Equals, ConditionalFormatValue{Type: ConditionalFormatValueTypeNum, Value: "20"})
+}
+
+// Data bars keep their Excel 2010 settings through a round trip.
+func (s *ConditionalFormatSuite) TestDataBarRoundTrip(c *C) {
+	f := NewFile()
+	sheet, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	sheet.Cell(0, 0).SetInt(-1)
+	bar := NewDataBarRule("FF638EC6").DataBar
+	bar.BorderColor = "FF000080"
+	bar.NegativeBorderColor = "FF800000"
+	bar.Direction = DataBarDirectionLeftToRight
+	_, err = sheet.AddDataBar("A1:A3", bar)
+	c.Assert(err, IsNil)
+	_, err = sheet.AddDataBar("B1:B3", NewDataBarRule("FF00FF00").DataBar)
+	c.Assert(err, IsNil)
+
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), IsNil)
+	f, err = OpenBinary(buf.Bytes())
+	c.Assert(err, IsNil)
+	cfs := f.Sheets[0].ConditionalFormats
+	c.Assert(cfs, HasLen, 2)
+	read := cfs[0].Rules[0].DataBar
+	c.Assert(read.Color, Equals, "FF638EC6")
+	c.Assert(read.BorderColor, Equals, "FF000080")
+	c.Assert(read.NegativeBorderColor, Equals, "FF800000")
+	c.Assert(read.NegativeFillColor, Equals, "FFFF0000")
+	c.Assert(read.Direction, Equals, DataBarDirectionLeftToRight)
+	c.Assert(read.Solid, Equals, false)
+	c.Assert(cfs[1].Rules[0].DataBar.Color, Equals, "FF00FF00")
+	c.Assert(cfs[1].Rules[0].DataBar.BorderColor, Equals, "")
+}
@@ -0,0 +1,475 @@
+package xlsx
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// These are the conditional formatting rule types that draw on the
+// cells rather than applying a DifferentialStyle.
+const (
+	ConditionalFormatTypeColorScale ConditionalFormatType = "colorScale"
+	ConditionalFormatTypeDataBar    ConditionalFormatType = "dataBar"
+	ConditionalFormatTypeIconSet    ConditionalFormatType = "iconSet"
+)
+
+// ConditionalFormatValueType says how the Value of a
+// ConditionalFormatValue is interpreted.
+type ConditionalFormatValueType string
+
+// These are the value types from the ST_CfvoType spec
+const (
+	ConditionalFormatValueTypeNum        ConditionalFormatValueType = "num"
+	ConditionalFormatValueTypePercent    ConditionalFormatValueType = "percent"
+	ConditionalFormatValueTypeMax        ConditionalFormatValueType = "max"
+	ConditionalFormatValueTypeMin        ConditionalFormatValueType = "min"
+	ConditionalFormatValueTypeFormula    ConditionalFormatValueType = "formula"
+	ConditionalFormatValueTypePercentile ConditionalFormatValueType = "percentile"
+)
+
+// ConditionalFormatValue is a threshold of a color scale, data bar or
+// icon set.  Value is not used by the min and max types.
+type ConditionalFormatValue struct {
+	Type  ConditionalFormatValueType
+	Value string
+}
+
+// IconSetStyle is the name of a set of icons.
+type IconSetStyle string
+
+// These are the icon sets from the ST_IconSetType spec
+const (
+	IconSetStyle3Arrows         IconSetStyle = "3Arrows"
+	IconSetStyle3ArrowsGray     IconSetStyle = "3ArrowsGray"
+	IconSetStyle3Flags          IconSetStyle = "3Flags"
+	IconSetStyle3TrafficLights1 IconSetStyle = "3TrafficLights1"
+	IconSetStyle3TrafficLights2 IconSetStyle = "3TrafficLights2"
+	IconSetStyle3Signs          IconSetStyle = "3Signs"
+	IconSetStyle3Symbols        IconSetStyle = "3Symbols"
+	IconSetStyle3Symbols2       IconSetStyle = "3Symbols2"
+	IconSetStyle4Arrows         IconSetStyle = "4Arrows"
+	IconSetStyle4ArrowsGray     IconSetStyle = "4ArrowsGray"
+	IconSetStyle4RedToBlack     IconSetStyle = "4RedToBlack"
+	IconSetStyle4Rating         IconSetStyle = "4Rating"
+	IconSetStyle4TrafficLights  IconSetStyle = "4TrafficLights"
+	IconSetStyle5Arrows         IconSetStyle = "5Arrows"
+	IconSetStyle5ArrowsGray     IconSetStyle = "5ArrowsGray"
+	IconSetStyle5Rating         IconSetStyle = "5Rating"
+	IconSetStyle5Quarters       IconSetStyle = "5Quarters"
+)
+
+// DataBarAxisPosition is where the axis of a data bar with negative
+// values is drawn.
+type DataBarAxisPosition string
+
+// These are the axis positions from the ST_DataBarAxisPosition spec
+const (
+	DataBarAxisPositionAutomatic DataBarAxisPosition = "automatic"
+	DataBarAxisPositionMiddle    DataBarAxisPosition = "middle"
+	DataBarAxisPositionNone      DataBarAxisPosition = "none"
+)
+
+// DataBarDirection is the direction in which a data bar grows.
+type DataBarDirection string
+
+// These are the directions from the ST_DataBarDirection spec
+const (
+	DataBarDirectionContext     DataBarDirection = "context"
+	DataBarDirectionLeftToRight DataBarDirection = "leftToRight"
+	DataBarDirectionRightToLeft DataBarDirection = "rightToLeft"
+)
+
+// ColorScale shades each cell with a color between those of the
+// Values it falls between.  It has two or three Values, and a color,
+// as an ARGB string, for each of them.
+type ColorScale struct {
+	Values []ConditionalFormatValue
+	Colors []string
+}
+
+// DataBar draws a bar in each cell whose length depends on where the
+// value of the cell falls between Min and Max.
+type DataBar struct {
+	Min   ConditionalFormatValue
+	Max   ConditionalFormatValue
+	Color string
+	// HideValue shows only the bar, without the value of the cell.
+	HideValue bool
+	// MinLength and MaxLength are the shortest and longest bars,
+	// as a percentage of the width of the cell.  When both are
+	// zero Excel's defaults are used.
+	MinLength int
+	MaxLength int
+	// The remaining fields are only understood by Excel 2010 and
+	// later, which read them from the extLst of the worksheet.
+	Solid               bool
+	BorderColor         string
+	NegativeFillColor   string
+	NegativeBorderColor string
+	AxisColor           string
+	AxisPosition        DataBarAxisPosition
+	Direction           DataBarDirection
+}
+
+// IconSet shows an icon in each cell depending on which of the Values
+// the value of the cell reaches.  There is one Value for each icon in
+// the Style, the first of which is the lowest.
+type IconSet struct {
+	Style     IconSetStyle
+	Values    []ConditionalFormatValue
+	Reverse   bool
+	HideValue bool
+}
+
+// NewColorScaleRule returns a rule that shades the cells with a two
+// color scale from the lowest to the highest value, or a three color
+// scale with the middle color at the 50th percentile.
+func NewColorScaleRule(colors ...string) *ConditionalFormatRule {
+	values := []ConditionalFormatValue{{Type: ConditionalFormatValueTypeMin}}
+	if len(colors) == 3 {
+		values = append(values, ConditionalFormatValue{Type: ConditionalFormatValueTypePercentile, Value: "50"})
+	}
+	values = append(values, ConditionalFormatValue{Type: ConditionalFormatValueTypeMax})
+	return &ConditionalFormatRule{
+		Type:       ConditionalFormatTypeColorScale,
+		ColorScale: &ColorScale{Values: values, Colors: colors},
+	}
+}
+
+// NewDataBarRule returns a rule that draws bars of the given color,
+// from the lowest to the highest value of the range.
+func NewDataBarRule(color string) *ConditionalFormatRule {
+	return &ConditionalFormatRule{
+		Type: ConditionalFormatTypeDataBar,
+		DataBar: &DataBar{
+			Min:   ConditionalFormatValue{Type: ConditionalFormatValueTypeMin},
+			Max:   ConditionalFormatValue{Type: ConditionalFormatValueTypeMax},
+			Color: color,
+		},
+	}
+}
+
+// NewIconSetRule returns a rule that shows the icons of the given set,
+// with the range of values split into equal percentages.
+func NewIconSetRule(style IconSetStyle) *ConditionalFormatRule {
+	count := 3
+	if len(style) > 0 && style[0] >= '3' && style[0] <= '5' {
+		count = int(style[0] - '0')
+	}
+	values := make([]ConditionalFormatValue, count)
+	for i := range values {
+		values[i] = ConditionalFormatValue{
+			Type:  ConditionalFormatValueTypePercent,
+			Value: strconv.Itoa((i*100 + count/2) / count),
+		}
+	}
+	return &ConditionalFormatRule{
+		Type:    ConditionalFormatTypeIconSet,
+		IconSet: &IconSet{Style: style, Values: values},
+	}
+}
+
+// AddColorScale shades the cells of ref with a color scale made of two
+// or three colors.
+func (s *Sheet) AddColorScale(ref string, colors ...string) (*ConditionalFormat, error) {
+	if len(colors) < 2 || len(colors) > 3 {
+		return nil, fmt.Errorf("a color scale needs 2 or 3 colors, not %d", len(colors))
+	}
+	return s.AddConditionalFormat(ref, NewColorScaleRule(colors...))
+}
+
+// AddDataBar draws data bars in the cells of ref.
+func (s *Sheet) AddDataBar(ref string, dataBar *DataBar) (*ConditionalFormat, error) {
+	return s.AddConditionalFormat(ref, &ConditionalFormatRule{
+		Type:    ConditionalFormatTypeDataBar,
+		DataBar: dataBar,
+	})
+}
+
+// AddIconSet shows the icons of the given set in the cells of ref.
+func (s *Sheet) AddIconSet(ref string, style IconSetStyle) (*ConditionalFormat, error) {
+	return s.AddConditionalFormat(ref, NewIconSetRule(style))
+}
+
+func makeXLSXCfvos(values []ConditionalFormatValue) []xlsxCfvo {
+	cfvos := make([]xlsxCfvo, len(values))
+	for i, value := range values {
+		cfvos[i] = xlsxCfvo{Type: string(value.Type), Val: value.Value}
+	}
+	return cfvos
+}
+
+func readCfvos(cfvos []xlsxCfvo) []ConditionalFormatValue {
+	values := make([]ConditionalFormatValue, len(cfvos))
+	for i, cfvo := range cfvos {
+		values[i] = ConditionalFormatValue{Type: ConditionalFormatValueType(cfvo.Type), Value: cfvo.Val}
+	}
+	return values
+}
+
+// makeXLSXColorScale converts a ColorScale into its XML form.
+func (cs *ColorScale) makeXLSXColorScale() (*xlsxColorScale, error) {
+	if len(cs.Values) < 2 || len(cs.Values) > 3 || len(cs.Values) != len(cs.Colors) {
+		return nil, fmt.Errorf("a color scale needs 2 or 3 values with a color each")
+	}
+	xColorScale := &xlsxColorScale{Cfvo: makeXLSXCfvos(cs.Values)}
+	for _, color := range cs.Colors {
+		xColorScale.Color = append(xColorScale.Color, xlsxColor{RGB: color})
+	}
+	return xColorScale, nil
+}
+
+// makeXLSXDataBar converts a DataBar into its XML form.
+func (db *DataBar) makeXLSXDataBar() *xlsxDataBar {
+	xDataBar := &xlsxDataBar{
+		MinLength: db.MinLength,
+		MaxLength: db.MaxLength,
+		Cfvo:      makeXLSXCfvos([]ConditionalFormatValue{db.Min, db.Max}),
+		Color:     xlsxColor{RGB: db.Color},
+	}
+	if db.HideValue {
+		xDataBar.ShowValue = new(bool)
+	}
+	return xDataBar
+}
+
+// makeXLSXIconSet converts an IconSet into its XML form.
+func (is *IconSet) makeXLSXIconSet() *xlsxIconSet {
+	xIconSet := &xlsxIconSet{
+		IconSet: string(is.Style),
+		Reverse: is.Reverse,
+		Cfvo:    makeXLSXCfvos(is.Values),
+	}
+	if is.HideValue {
+		xIconSet.ShowValue = new(bool)
+	}
+	return xIconSet
+}
+
+// The uris that identify the extensions of Excel 2010 used for data
+// bars, and the namespaces they use.
+const (
+	extURIConditionalFormattings = "{78C0D931-6437-407d-A8EE-F0AAD7539E65}"
+	extURICfRuleID               = "{B025F937-C7B1-47D3-B67F-A62EFF666E3E}"
+	namespaceX14                 = "http://schemas.microsoft.com/office/spreadsheetml/2009/9/main"
+	namespaceXM                  = "http://schemas.microsoft.com/office/excel/2006/main"
+)
+
+// newDataBarExtID returns a new id to tie a data bar to its Excel 2010
+// extension.  Excel uses random, version 4, GUIDs.
+func newDataBarExtID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("{%X-%X-%X-%X-%X}", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// makeCfRuleExtLst returns the extLst of a cfRule that refers to the
+// Excel 2010 extension with the given id.
+func makeCfRuleExtLst(id string) *xlsxInnerXML {
+	return &xlsxInnerXML{Content: fmt.Sprintf(`<ext uri="%s" xmlns:x14="%s"><x14:id>%s</x14:id></ext>`, extURICfRuleID, namespaceX14, id)}
+}
+
+// writeX14Cfvo writes a threshold of an Excel 2010 data bar.  The min
+// and max types become autoMin and autoMax, which is what Excel 2010
+// uses for bars created with the defaults.
+func writeX14Cfvo(buf *bytes.Buffer, value ConditionalFormatValue) {
+	valueType := string(value.Type)
+	switch value.Type {
+	case ConditionalFormatValueTypeMin:
+		valueType = "autoMin"
+	case ConditionalFormatValueTypeMax:
+		valueType = "autoMax"
+	}
+	if value.Value == "" {
+		fmt.Fprintf(buf, `<x14:cfvo type="%s"/>`, valueType)
+		return
+	}
+	fmt.Fprintf(buf, `<x14:cfvo type="%s"><xm:f>`, valueType)
+	xml.EscapeText(buf, []byte(value.Value))
+	buf.WriteString(`</xm:f></x14:cfvo>`)
+}
+
+// writeX14DataBar writes the Excel 2010 extension of a data bar, that
+// holds the settings that the original dataBar element can't.
+func writeX14DataBar(buf *bytes.Buffer, id, sqref string, db *DataBar) {
+	minLength, maxLength := db.MinLength, db.MaxLength
+	if minLength == 0 && maxLength == 0 {
+		maxLength = 100
+	}
+	negativeFillColor := db.NegativeFillColor
+	if negativeFillColor == "" {
+		negativeFillColor = "FFFF0000"
+	}
+	axisColor := db.AxisColor
+	if axisColor == "" {
+		axisColor = "FF000000"
+	}
+	axisPosition := db.AxisPosition
+	if axisPosition == "" {
+		axisPosition = DataBarAxisPositionAutomatic
+	}
+
+	fmt.Fprintf(buf, `<x14:conditionalFormatting xmlns:xm="%s"><x14:cfRule type="dataBar" id="%s">`, namespaceXM, id)
+	fmt.Fprintf(buf, `<x14:dataBar minLength="%d" maxLength="%d" gradient="%d"`, minLength, maxLength, bool2Int(!db.Solid))
+	if db.BorderColor != "" {
+		buf.WriteString(` border="1"`)
+		if db.NegativeBorderColor != "" {
+			buf.WriteString(` negativeBarBorderColorSameAsPositive="0"`)
+		}
+	}
+	if db.Direction != "" {
+		fmt.Fprintf(buf, ` direction="%s"`, db.Direction)
+	}
+	fmt.Fprintf(buf, ` axisPosition="%s">`, axisPosition)
+	writeX14Cfvo(buf, db.Min)
+	writeX14Cfvo(buf, db.Max)
+	if db.BorderColor != "" {
+		fmt.Fprintf(buf, `<x14:borderColor rgb="%s"/>`, db.BorderColor)
+	}
+	fmt.Fprintf(buf, `<x14:negativeFillColor rgb="%s"/>`, negativeFillColor)
+	if db.BorderColor != "" && db.NegativeBorderColor != "" {
+		fmt.Fprintf(buf, `<x14:negativeBorderColor rgb="%s"/>`, db.NegativeBorderColor)
+	}
+	fmt.Fprintf(buf, `<x14:axisColor rgb="%s"/>`, axisColor)
+	buf.WriteString(`</x14:dataBar></x14:cfRule><xm:sqref>`)
+	xml.EscapeText(buf, []byte(sqref))
+	buf.WriteString(`</xm:sqref></x14:conditionalFormatting>`)
+}
+
+// makeConditionalFormattingExtLst wraps the Excel 2010 conditional
+// formattings of a sheet in the extLst of the worksheet.
+func makeConditionalFormattingExtLst(x14 string) *xlsxInnerXML {
+	return &xlsxInnerXML{Content: fmt.Sprintf(`<ext uri="%s" xmlns:x14="%s"><x14:conditionalFormattings>%s</x14:conditionalFormattings></ext>`,
+		extURIConditionalFormattings, namespaceX14, x14)}
+}
+
+// xlsxX14ExtLst maps the parts of the extLst of a worksheet, or of a
+// cfRule, that hold the Excel 2010 extensions of data bars.  The
+// prefixes of these elements are often declared on the worksheet, so
+// they are matched by their local name only.
+type xlsxX14ExtLst struct {
+	Ext []xlsxX14Ext `xml:"ext"`
+}
+
+type xlsxX14Ext struct {
+	URI                    string                         `xml:"uri,attr"`
+	ID                     string                         `xml:"id"`
+	ConditionalFormattings []xlsxX14ConditionalFormatting `xml:"conditionalFormattings>conditionalFormatting"`
+}
+
+type xlsxX14ConditionalFormatting struct {
+	CfRule []xlsxX14CfRule `xml:"cfRule"`
+}
+
+type xlsxX14CfRule struct {
+	Type    string          `xml:"type,attr"`
+	ID      string          `xml:"id,attr"`
+	DataBar *xlsxX14DataBar `xml:"dataBar"`
+}
+
+type xlsxX14DataBar struct {
+	MinLength           *int       `xml:"minLength,attr"`
+	MaxLength           *int       `xml:"maxLength,attr"`
+	Border              bool       `xml:"border,attr"`
+	Gradient            *bool      `xml:"gradient,attr"`
+	Direction           string     `xml:"direction,attr"`
+	AxisPosition        string     `xml:"axisPosition,attr"`
+	BorderColor         *xlsxColor `xml:"borderColor"`
+	NegativeFillColor   *xlsxColor `xml:"negativeFillColor"`
+	NegativeBorderColor *xlsxColor `xml:"negativeBorderColor"`
+	AxisColor           *xlsxColor `xml:"axisColor"`
+}
+
+// readX14ExtLst decodes the raw content of an extLst element.
+func readX14ExtLst(extLst *xlsxInnerXML) (*xlsxX14ExtLst, error) {
+	x14 := new(xlsxX14ExtLst)
+	if extLst == nil {
+		return x14, nil
+	}
+	decoder := xml.NewDecoder(strings.NewReader("<extLst>" + extLst.Content + "</extLst>"))
+	decoder.Strict = false
+	if err := decoder.Decode(x14); err != nil {
+		return nil, err
+	}
+	return x14, nil
+}
+
+// readX14DataBars returns the Excel 2010 data bar extensions found in
+// the extLst of a worksheet, keyed by their id.
+func readX14DataBars(extLst *xlsxInnerXML) (map[string]*xlsxX14DataBar, error) {
+	x14, err := readX14ExtLst(extLst)
+	if err != nil {
+		return nil, err
+	}
+	dataBars := make(map[string]*xlsxX14DataBar)
+	for _, ext := range x14.Ext {
+		for _, cf := range ext.ConditionalFormattings {
+			for _, rule := range cf.CfRule {
+				if rule.DataBar != nil && rule.ID != "" {
+					dataBars[rule.ID] = rule.DataBar
+				}
+			}
+		}
+	}
+	return dataBars, nil
+}
+
+// x14DataBarIDs returns the ids that tie the data bars of a worksheet
+// to their Excel 2010 extensions.
+func (w *xlsxWorksheet) x14DataBarIDs() (map[string]bool, error) {
+	ids := make(map[string]bool)
+	for _, xCf := range w.ConditionalFormatting {
+		for _, xRule := range xCf.CfRule {
+			if xRule.Type != string(ConditionalFormatTypeDataBar) || xRule.ExtLst == nil {
+				continue
+			}
+			x14, err := readX14ExtLst(xRule.ExtLst)
+			if err != nil {
+				return nil, err
+			}
+			for _, ext := range x14.Ext {
+				if ext.URI == extURICfRuleID && ext.ID != "" {
+					ids[ext.ID] = true
+				}
+			}
+		}
+	}
+	return ids, nil
+}
+
+// applyX14DataBar copies the settings of an Excel 2010 data bar
+// extension into a DataBar.
+func (db *DataBar) applyX14DataBar(x14 *xlsxX14DataBar, styles *xlsxStyleSheet) {
+	color := func(c *xlsxColor) string {
+		if c == nil {
+			return ""
+		}
+		if styles != nil {
+			return styles.argbValue(*c)
+		}
+		return c.RGB
+	}
+	if x14.MinLength != nil {
+		db.MinLength = *x14.MinLength
+	}
+	if x14.MaxLength != nil {
+		db.MaxLength = *x14.MaxLength
+	}
+	db.Solid = x14.Gradient != nil && !*x14.Gradient
+	db.Direction = DataBarDirection(x14.Direction)
+	db.AxisPosition = DataBarAxisPosition(x14.AxisPosition)
+	if x14.Border {
+		db.BorderColor = color(x14.BorderColor)
+	}
+	db.NegativeFillColor = color(x14.NegativeFillColor)
+	db.NegativeBorderColor = color(x14.NegativeBorderColor)
+	db.AxisColor = color(x14.AxisColor)
+}
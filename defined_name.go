@@ -0,0 +1,190 @@
+package xlsx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AddDefinedName gives a name to ref, which is a reference such as
+// "Sheet1!$A$1:$B$4" or any other formula.  When scopeSheet is nil the
+// name can be used throughout the workbook, otherwise only on that
+// sheet.  Names have to follow the same rules as in Excel, and be
+// unique within their scope.
+func (f *File) AddDefinedName(name, ref string, scopeSheet *Sheet) error {
+	if err := validateDefinedName(name); err != nil {
+		return err
+	}
+	ref = strings.TrimPrefix(ref, "=")
+	if ref == "" {
+		return fmt.Errorf("defined name %q does not refer to anything", name)
+	}
+	localSheetID, err := f.localSheetID(scopeSheet)
+	if err != nil {
+		return err
+	}
+	if f.findDefinedName(name, localSheetID) != nil {
+		return fmt.Errorf("duplicate defined name %q", name)
+	}
+	if f.Table(name) != nil {
+		return fmt.Errorf("defined name %q is already the name of a table", name)
+	}
+	dn := &xlsxDefinedName{Name: name, Data: ref}
+	if localSheetID != nil {
+		dn.LocalSheetID, dn.HasLocalSheetID = *localSheetID, true
+	}
+	f.DefinedNames = append(f.DefinedNames, dn)
+	return nil
+}
+
+// RemoveDefinedName removes the name from the given scope, which is
+// the whole workbook when scopeSheet is nil.  It returns false if there
+// was no such name.
+func (f *File) RemoveDefinedName(name string, scopeSheet *Sheet) bool {
+	localSheetID, err := f.localSheetID(scopeSheet)
+	if err != nil {
+		return false
+	}
+	for i, dn := range f.DefinedNames {
+		if strings.EqualFold(dn.Name, name) && dn.hasScope(localSheetID) {
+			f.DefinedNames = append(f.DefinedNames[:i], f.DefinedNames[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveDefinedName returns the sheet and the range of cells, such as
+// "A1:B4", that a name refers to.  As in Excel, a name defined for
+// scopeSheet hides a name defined for the whole workbook.  It is an
+// error if the name refers to anything other than a single range of
+// cells in the workbook.
+func (f *File) ResolveDefinedName(name string, scopeSheet *Sheet) (*Sheet, string, error) {
+	var dn *xlsxDefinedName
+	if scopeSheet != nil {
+		localSheetID, err := f.localSheetID(scopeSheet)
+		if err != nil {
+			return nil, "", err
+		}
+		dn = f.findDefinedName(name, localSheetID)
+	}
+	if dn == nil {
+		dn = f.findDefinedName(name, nil)
+	}
+	if dn == nil {
+		return nil, "", fmt.Errorf("defined name %q not found", name)
+	}
+	sheetName, cells, err := splitSheetRef(dn.Data)
+	if err != nil {
+		return nil, "", fmt.Errorf("defined name %q: %v", name, err)
+	}
+	var sheet *Sheet
+	if sheetName == "" {
+		sheet = scopeSheet
+	} else {
+		// Sheet names, like defined names, ignore case.
+		for _, s := range f.Sheets {
+			if strings.EqualFold(s.Name, sheetName) {
+				sheet = s
+				break
+			}
+		}
+	}
+	if sheet == nil {
+		return nil, "", fmt.Errorf("defined name %q refers to a sheet that doesn't exist", name)
+	}
+	return sheet, cells, nil
+}
+
+// findDefinedName returns the name with the given scope, or nil.
+func (f *File) findDefinedName(name string, localSheetID *int) *xlsxDefinedName {
+	for _, dn := range f.DefinedNames {
+		if strings.EqualFold(dn.Name, name) && dn.hasScope(localSheetID) {
+			return dn
+		}
+	}
+	return nil
+}
+
+// localSheetID returns the LocalSheetID of names that are local to the
+// sheet, which is nil for the whole workbook.
+func (f *File) localSheetID(sheet *Sheet) (*int, error) {
+	if sheet == nil {
+		return nil, nil
+	}
+	for i, s := range f.Sheets {
+		if s == sheet {
+			return &i, nil
+		}
+	}
+	return nil, fmt.Errorf("sheet %q is not part of the file", sheet.Name)
+}
+
+// hasScope reports whether the name has the scope given by
+// localSheetID, which is nil for the whole workbook.
+func (dn *xlsxDefinedName) hasScope(localSheetID *int) bool {
+	if localSheetID == nil {
+		return !dn.HasLocalSheetID
+	}
+	return dn.HasLocalSheetID && dn.LocalSheetID == *localSheetID
+}
+
+// moveDefinedNameScopes keeps the scope of the defined names in step
+// with the sheets of the file.  newIndex maps the old index of every
+// sheet to its new one, or to -1 for a sheet that has been removed,
+// whose names are removed along with it.
+func (f *File) moveDefinedNameScopes(newIndex func(int) int) {
+	names := f.DefinedNames[:0]
+	for _, dn := range f.DefinedNames {
+		if dn.HasLocalSheetID {
+			index := newIndex(dn.LocalSheetID)
+			if index < 0 {
+				continue
+			}
+			dn.LocalSheetID = index
+		}
+		names = append(names, dn)
+	}
+	f.DefinedNames = names
+}
+
+// validateDefinedName returns an error if Excel would not accept name
+// as a defined name.
+func validateDefinedName(name string) error {
+	if len(name) > 255 {
+		return fmt.Errorf("defined name %q is longer than 255 characters", name)
+	}
+	if !nameRegexp.MatchString(name) || cellNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid defined name %q", name)
+	}
+	return nil
+}
+
+// splitSheetRef splits a reference such as "'My Sheet'!$A$1:$B$2" into
+// the name of the sheet and the cells, without the dollar signs.  The
+// name of the sheet is "" for a reference without one.
+func splitSheetRef(ref string) (string, string, error) {
+	ref = strings.TrimPrefix(ref, "=")
+	sheetName := ""
+	bang := strings.LastIndex(ref, externalSheetBangChar)
+	if bang >= 0 {
+		sheetName = ref[:bang]
+		ref = ref[bang+1:]
+		if strings.HasPrefix(sheetName, "'") && strings.HasSuffix(sheetName, "'") && len(sheetName) > 1 {
+			sheetName = strings.Replace(sheetName[1:len(sheetName)-1], "''", "'", -1)
+		} else if strings.ContainsAny(sheetName, "'[]") {
+			return "", "", fmt.Errorf("invalid reference %q", ref)
+		}
+	}
+	cells := strings.Replace(ref, fixedCellRefChar, "", -1)
+	parts := strings.Split(cells, cellRangeChar)
+	if len(parts) > 2 {
+		return "", "", fmt.Errorf("%q is not a range of cells", ref)
+	}
+	for _, part := range parts {
+		x, y, err := GetCoordsFromCellIDString(part)
+		if err != nil || x < 0 || y < 0 || GetCellIDStringFromCoords(x, y) != strings.ToUpper(part) {
+			return "", "", fmt.Errorf("%q is not a range of cells", ref)
+		}
+	}
+	return sheetName, strings.ToUpper(cells), nil
+}
@@ -0,0 +1,191 @@
+package xlsx
+
+import (
+	"bytes"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type DefinedNameSuite struct{}
+
+var _ = Suite(&DefinedNameSuite{})
+
+// Names are checked against the rules of Excel, and are unique within
+// their scope.
+func (s *DefinedNameSuite) TestAddDefinedName(c *C) {
+	f := NewFile()
+	sheet1, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	sheet2, err := f.AddSheet("Sheet2")
+	c.Assert(err, IsNil)
+
+	c.Assert(f.AddDefinedName("Rate", "=Sheet1!$B$1", nil), IsNil)
+	c.Assert(f.AddDefinedName("rate", "Sheet1!$B$2", nil), NotNil)
+	c.Assert(f.AddDefinedName("Rate", "Sheet2!$B$1", sheet2), IsNil)
+	c.Assert(f.AddDefinedName("Total", "SUM(Sheet1!$A:$A)", sheet1), IsNil)
+	c.Assert(f.AddDefinedName("_xlnm.Print_Area", "Sheet1!$A$1:$D$20", sheet1), IsNil)
+	for _, name := range []string{"", "1st", "A1", "r1c1", "R", "Has Space", strings.Repeat("x", 256)} {
+		c.Assert(f.AddDefinedName(name, "Sheet1!$A$1", nil), NotNil, Commentf("name %q", name))
+	}
+	c.Assert(f.AddDefinedName("Empty", "", nil), NotNil)
+	c.Assert(f.AddDefinedName("Elsewhere", "Sheet1!$A$1", &Sheet{Name: "Other"}), NotNil)
+
+	c.Assert(f.DefinedNames, HasLen, 4)
+	c.Assert(f.DefinedNames[0].Data, Equals, "Sheet1!$B$1")
+	c.Assert(f.DefinedNames[0].HasLocalSheetID, Equals, false)
+	c.Assert(f.DefinedNames[1].HasLocalSheetID, Equals, true)
+	c.Assert(f.DefinedNames[1].LocalSheetID, Equals, 1)
+	c.Assert(f.DefinedNames[2].HasLocalSheetID, Equals, true)
+	c.Assert(f.DefinedNames[2].LocalSheetID, Equals, 0)
+
+	c.Assert(f.RemoveDefinedName("TOTAL", sheet1), Equals, true)
+	c.Assert(f.RemoveDefinedName("Total", sheet1), Equals, false)
+	c.Assert(f.DefinedNames, HasLen, 3)
+}
+
+// Resolving a name gives the sheet and range it refers to, preferring
+// a name local to the sheet.
+func (s *DefinedNameSuite) TestResolveDefinedName(c *C) {
+	f := NewFile()
+	sheet1, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	sheet2, err := f.AddSheet("It's data")
+	c.Assert(err, IsNil)
+	c.Assert(f.AddDefinedName("Data", "'It''s data'!$A$1:$C$10", nil), IsNil)
+	c.Assert(f.AddDefinedName("Data", "Sheet1!B2", sheet1), IsNil)
+	c.Assert(f.AddDefinedName("Formula", "Sheet1!$A$1*2", nil), IsNil)
+	c.Assert(f.AddDefinedName("Missing", "Sheet9!$A$1", nil), IsNil)
+
+	sheet, ref, err := f.ResolveDefinedName("data", nil)
+	c.Assert(err, IsNil)
+	c.Assert(sheet, Equals, sheet2)
+	c.Assert(ref, Equals, "A1:C10")
+	sheet, ref, err = f.ResolveDefinedName("Data", sheet2)
+	c.Assert(err, IsNil)
+	c.Assert(sheet, Equals, sheet2)
+	sheet, ref, err = f.ResolveDefinedName("Data", sheet1)
+	c.Assert(err, IsNil)
+	c.Assert(sheet, Equals, sheet1)
+	c.Assert(ref, Equals, "B2")
+
+	// Sheet names ignore case, as names do.
+	c.Assert(f.AddDefinedName("Lower", "sheet1!$D$4", nil), IsNil)
+	sheet, ref, err = f.ResolveDefinedName("Lower", nil)
+	c.Assert(err, IsNil)
+	c.Assert(sheet, Equals, sheet1)
+	c.Assert(ref, Equals, "D4")
+
+	_, _, err = f.ResolveDefinedName("Formula", nil)
+	c.Assert(err, NotNil)
+	_, _, err = f.ResolveDefinedName("Missing", nil)
+	c.Assert(err, NotNil)
+	_, _, err = f.ResolveDefinedName("Nothing", nil)
+	c.Assert(err, NotNil)
+}
+
+// The scope of names follows their sheet when sheets are moved or
+// removed.
+func (s *DefinedNameSuite) TestMoveAndRemoveSheets(c *C) {
+	f := NewFile()
+	var sheets []*Sheet
+	for _, name := range []string{"A", "B", "C", "D"} {
+		sheet, err := f.AddSheet(name)
+		c.Assert(err, IsNil)
+		sheets = append(sheets, sheet)
+		c.Assert(f.AddDefinedName("Local", name+"!$A$1", sheet), IsNil)
+	}
+	c.Assert(f.AddDefinedName("Global", "A!$A$1", nil), IsNil)
+	scopes := func() map[string]*Sheet {
+		m := make(map[string]*Sheet)
+		for _, dn := range f.DefinedNames {
+			if dn.HasLocalSheetID {
+				m[dn.Data] = f.Sheets[dn.LocalSheetID]
+			}
+		}
+		return m
+	}
+
+	c.Assert(f.MoveSheet("D", 0), IsNil)
+	c.Assert(f.MoveSheet("A", 2), IsNil)
+	c.Assert(f.Sheets, DeepEquals, []*Sheet{sheets[3], sheets[1], sheets[0], sheets[2]})
+	for i, name := range []string{"A", "B", "C", "D"} {
+		c.Assert(scopes()[name+"!$A$1"], Equals, sheets[i])
+	}
+
+	c.Assert(f.RemoveSheet("B"), IsNil)
+	c.Assert(f.Sheet["B"], IsNil)
+	c.Assert(f.Sheets, DeepEquals, []*Sheet{sheets[3], sheets[0], sheets[2]})
+	c.Assert(f.DefinedNames, HasLen, 4)
+	c.Assert(scopes()["B!$A$1"], IsNil)
+	for _, i := range []int{0, 2, 3} {
+		c.Assert(scopes()[sheets[i].Name+"!$A$1"], Equals, sheets[i])
+	}
+
+	c.Assert(f.RemoveSheet("B"), NotNil)
+	c.Assert(f.MoveSheet("A", 3), NotNil)
+}
+
+// References to a removed sheet, in the formulas, names, data
+// validations, hyperlinks and charts of the other sheets, become #REF!
+// errors.
+func (s *DefinedNameSuite) TestRemoveSheetReferences(c *C) {
+	f := NewFile()
+	kept, err := f.AddSheet("Kept")
+	c.Assert(err, IsNil)
+	_, err = f.AddSheet("Gone")
+	c.Assert(err, IsNil)
+	kept.Cell(0, 0).SetFormula("SUM(Gone!A1:B2)+A2")
+	kept.Cell(0, 1).SetFormula("'gone'!$C$3*2")
+	kept.Cell(0, 2).SetFormula("Kept!A2")
+	dd := NewXlsxCellDataValidation(true)
+	dd.Formula1 = "Gone!$A$1:$A$5"
+	kept.Cell(1, 0).SetDataValidation(dd)
+	kept.Cell(2, 0).SetHyperlinkLocation("Gone!A1", "", "There")
+	c.Assert(f.AddDefinedName("Elsewhere", "Gone!$A$1:$B$2", nil), IsNil)
+	c.Assert(f.AddDefinedName("Here", "Kept!$A$1", nil), IsNil)
+	chart := &Chart{Type: ChartTypeLine, Series: []*ChartSeries{{Values: "Gone!$B$1:$B$3"}}}
+	kept.Charts = append(kept.Charts, chart)
+
+	c.Assert(f.RemoveSheet("Gone"), IsNil)
+	c.Assert(kept.Cell(0, 0).Formula(), Equals, "SUM(#REF!)+A2")
+	c.Assert(kept.Cell(0, 1).Formula(), Equals, "#REF!*2")
+	c.Assert(kept.Cell(0, 2).Formula(), Equals, "Kept!A2")
+	c.Assert(dd.Formula1, Equals, "#REF!")
+	c.Assert(kept.Cell(2, 0).Hyperlink.Location, Equals, "#REF!")
+	c.Assert(f.DefinedNames[0].Data, Equals, "#REF!")
+	c.Assert(f.DefinedNames[1].Data, Equals, "Kept!$A$1")
+	c.Assert(chart.Series[0].Values, Equals, "#REF!")
+}
+
+// Defined names are written to the workbook and read back, keeping
+// their scope when only some of the sheets are read.
+func (s *DefinedNameSuite) TestDefinedNameRoundTrip(c *C) {
+	f := NewFile()
+	sheet1, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	sheet2, err := f.AddSheet("Sheet2")
+	c.Assert(err, IsNil)
+	c.Assert(f.AddDefinedName("Everywhere", "Sheet2!$A$1:$A$4", nil), IsNil)
+	c.Assert(f.AddDefinedName("First", "Sheet1!$A$1", sheet1), IsNil)
+	c.Assert(f.AddDefinedName("Second", "Sheet2!$B$1", sheet2), IsNil)
+
+	parts, err := f.MarshallParts()
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(parts["xl/workbook.xml"],
+		`<definedNames><definedName name="Everywhere">Sheet2!$A$1:$A$4</definedName>`+
+			`<definedName name="First" localSheetId="0">Sheet1!$A$1</definedName>`+
+			`<definedName name="Second" localSheetId="1">Sheet2!$B$1</definedName></definedNames>`), Equals, true)
+
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), IsNil)
+	read, err := OpenBinaryWithOptions(buf.Bytes(), OpenOptions{Sheets: []string{"Sheet2"}, RowLimit: NoRowLimit})
+	c.Assert(err, IsNil)
+	c.Assert(read.DefinedNames, HasLen, 2)
+	sheet, ref, err := read.ResolveDefinedName("Second", read.Sheets[0])
+	c.Assert(err, IsNil)
+	c.Assert(sheet, Equals, read.Sheets[0])
+	c.Assert(ref, Equals, "B1")
+	c.Assert(read.DefinedNames[1].HasLocalSheetID, Equals, true)
+	c.Assert(read.DefinedNames[1].LocalSheetID, Equals, 0)
+}
@@ -0,0 +1,603 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"path"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// EMUsPerPixel is the number of English Metric Units, the unit of
+// length used in drawings, in a pixel at 96 DPI.
+const EMUsPerPixel = 9525
+
+// These are the namespaces of the elements of a drawing part.
+const (
+	namespaceSpreadsheetDrawing = "http://schemas.openxmlformats.org/drawingml/2006/spreadsheetDrawing"
+	namespaceDrawingML          = "http://schemas.openxmlformats.org/drawingml/2006/main"
+	namespaceRelationships      = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+)
+
+// DrawingAnchorType says how a picture or chart is attached to the
+// cells of a sheet.
+type DrawingAnchorType string
+
+const (
+	// DrawingAnchorTwoCell attaches the top left corner and the
+	// bottom right corner to cells, so the drawing moves and resizes
+	// with those cells.
+	DrawingAnchorTwoCell DrawingAnchorType = "twoCell"
+	// DrawingAnchorOneCell attaches the top left corner to a cell, so
+	// the drawing moves with the cell but keeps its size.
+	DrawingAnchorOneCell DrawingAnchorType = "oneCell"
+	// DrawingAnchorAbsolute places the drawing at a fixed position
+	// on the sheet.
+	DrawingAnchorAbsolute DrawingAnchorType = "absolute"
+)
+
+// DrawingMarker is a position on a sheet, given as the zero based
+// column and row of a cell and the offset in EMUs from the top left
+// corner of that cell.
+type DrawingMarker struct {
+	Col       int
+	Row       int
+	ColOffset int64
+	RowOffset int64
+}
+
+// DrawingAnchor is the position and size of a picture or chart.
+type DrawingAnchor struct {
+	Type DrawingAnchorType
+	// From is the top left corner of a one cell or two cell anchor.
+	From DrawingMarker
+	// To is the bottom right corner of a two cell anchor.
+	To DrawingMarker
+	// X and Y are the position, in EMUs, of an absolute anchor.
+	X int64
+	Y int64
+	// Width and Height are the size in EMUs.  A two cell anchor gets
+	// its size from its cells, and only uses them as a hint.
+	Width  int64
+	Height int64
+}
+
+// colWidthPixels returns the width of a column in pixels, the way
+// Excel works it out from the width in characters.
+func (s *Sheet) colWidthPixels(col int) int64 {
+	width := 0.0
+	for _, c := range s.Cols {
+		if c != nil && c.Min <= col+1 && col+1 <= c.Max && c.Width > 0 {
+			width = c.Width
+			break
+		}
+	}
+	if width == 0 {
+		width = s.SheetFormat.DefaultColWidth
+	}
+	if width == 0 {
+		width = ColWidth
+	}
+	return int64(math.Floor((256*width + math.Floor(128.0/7)) / 256 * 7))
+}
+
+// rowHeightPixels returns the height of a row in pixels.
+func (s *Sheet) rowHeightPixels(row int) int64 {
+	height := 0.0
+	if row < len(s.Rows) && s.Rows[row] != nil {
+		height = s.Rows[row].Height
+	}
+	if height == 0 {
+		height = s.SheetFormat.DefaultRowHeight
+	}
+	if height == 0 {
+		height = 15
+	}
+	return int64(math.Floor(height*96/72 + 0.5))
+}
+
+// drawingMarker returns the marker for the point that is x and y
+// pixels to the right of and below the top left corner of a cell.
+// Columns and rows that are too narrow to have any pixels are skipped
+// over, and the point stays within the last column and row of the
+// sheet.
+func (s *Sheet) drawingMarker(col, row int, x, y int64) DrawingMarker {
+	for x < 0 && col > 0 {
+		col--
+		x += s.colWidthPixels(col)
+	}
+	for col < excel2006MaxColCount-1 {
+		width := s.colWidthPixels(col)
+		if x < width {
+			break
+		}
+		x -= width
+		col++
+	}
+	for y < 0 && row > 0 {
+		row--
+		y += s.rowHeightPixels(row)
+	}
+	for row < Excel2006MaxRowIndex {
+		height := s.rowHeightPixels(row)
+		if y < height {
+			break
+		}
+		y -= height
+		row++
+	}
+	if x < 0 {
+		x = 0
+	}
+	if y < 0 {
+		y = 0
+	}
+	return DrawingMarker{Col: col, Row: row, ColOffset: x * EMUsPerPixel, RowOffset: y * EMUsPerPixel}
+}
+
+// makeDrawingAnchor returns an anchor of the given type for a drawing
+// of width by height pixels, whose top left corner is x and y pixels
+// from the top left corner of the named cell.
+func (s *Sheet) makeDrawingAnchor(anchorType DrawingAnchorType, cell string, x, y, width, height int64) (DrawingAnchor, error) {
+	col, row, err := GetCoordsFromCellIDString(cell)
+	if err != nil || col < 0 || row < 0 {
+		return DrawingAnchor{}, fmt.Errorf("invalid cell reference %q", cell)
+	}
+	anchor := DrawingAnchor{
+		Type:   anchorType,
+		From:   s.drawingMarker(col, row, x, y),
+		Width:  width * EMUsPerPixel,
+		Height: height * EMUsPerPixel,
+	}
+	switch anchorType {
+	case "", DrawingAnchorTwoCell:
+		anchor.Type = DrawingAnchorTwoCell
+		anchor.To = s.drawingMarker(col, row, x+width, y+height)
+	case DrawingAnchorOneCell:
+	case DrawingAnchorAbsolute:
+		for c := 0; c < col; c++ {
+			x += s.colWidthPixels(c)
+		}
+		for r := 0; r < row; r++ {
+			y += s.rowHeightPixels(r)
+		}
+		anchor.From = DrawingMarker{}
+		anchor.X, anchor.Y = x*EMUsPerPixel, y*EMUsPerPixel
+	default:
+		return DrawingAnchor{}, fmt.Errorf("invalid anchor type %q", anchorType)
+	}
+	return anchor, nil
+}
+
+// writeDrawingMarker writes a marker as the from or to element of an
+// anchor.
+func writeDrawingMarker(buf *bytes.Buffer, name string, m DrawingMarker) {
+	fmt.Fprintf(buf, `<xdr:%s><xdr:col>%d</xdr:col><xdr:colOff>%d</xdr:colOff><xdr:row>%d</xdr:row><xdr:rowOff>%d</xdr:rowOff></xdr:%s>`,
+		name, m.Col, m.ColOffset, m.Row, m.RowOffset, name)
+}
+
+// writeDrawingAnchor writes the anchor element around a shape, which
+// body writes.
+func writeDrawingAnchor(buf *bytes.Buffer, anchor DrawingAnchor, body func()) {
+	switch anchor.Type {
+	case DrawingAnchorOneCell:
+		buf.WriteString(`<xdr:oneCellAnchor>`)
+		writeDrawingMarker(buf, "from", anchor.From)
+		fmt.Fprintf(buf, `<xdr:ext cx="%d" cy="%d"/>`, anchor.Width, anchor.Height)
+		body()
+		buf.WriteString(`<xdr:clientData/></xdr:oneCellAnchor>`)
+	case DrawingAnchorAbsolute:
+		buf.WriteString(`<xdr:absoluteAnchor>`)
+		fmt.Fprintf(buf, `<xdr:pos x="%d" y="%d"/><xdr:ext cx="%d" cy="%d"/>`, anchor.X, anchor.Y, anchor.Width, anchor.Height)
+		body()
+		buf.WriteString(`<xdr:clientData/></xdr:absoluteAnchor>`)
+	default:
+		buf.WriteString(`<xdr:twoCellAnchor>`)
+		writeDrawingMarker(buf, "from", anchor.From)
+		writeDrawingMarker(buf, "to", anchor.To)
+		body()
+		buf.WriteString(`<xdr:clientData/></xdr:twoCellAnchor>`)
+	}
+}
+
+// writeDrawingCNvPr writes the id, name and description of a shape.
+func writeDrawingCNvPr(buf *bytes.Buffer, id int, name, descr string) {
+	fmt.Fprintf(buf, `<xdr:cNvPr id="%d" name="`, id)
+	xml.EscapeText(buf, []byte(name))
+	buf.WriteString(`"`)
+	if descr != "" {
+		buf.WriteString(` descr="`)
+		xml.EscapeText(buf, []byte(descr))
+		buf.WriteString(`"`)
+	}
+	buf.WriteString(`/>`)
+}
+
+// drawingShapes are the anchors of the drawing part that a worksheet
+// was read with that hold something other than a picture or a chart,
+// such as a shape, a group of shapes or a connector.  They are kept as
+// raw XML, and written after the pictures and charts whenever the
+// drawing is made again.
+type drawingShapes struct {
+	// namespaces are the namespaces declared by the drawing, other
+	// than those that makeXLSXDrawing declares itself.
+	namespaces []xml.Attr
+	anchors    []drawingShape
+	// maxID is the largest id of the shapes, above which the
+	// pictures and charts are numbered.
+	maxID int
+}
+
+// drawingShape is an anchor of a drawingShapes, along with the
+// relationships of the drawing that it refers to.
+type drawingShape struct {
+	content string
+	rels    []xlsxWorkbookRelation
+}
+
+// drawingShapeID matches the ids of the shapes of a drawing.
+var drawingShapeID = regexp.MustCompile(`<(?:\w+:)?cNvPr\b[^>]*?\sid="(\d+)"`)
+
+// makeXLSXDrawing builds the drawing part, named partName, that holds
+// the pictures, charts and shapes of the sheet.  The images and charts
+// are added to their own parts through drawingParts, and the
+// relationships of the drawing to them are added to rels.  Shapes that
+// refer to parts which aren't kept are left out.  It returns "" when
+// the sheet has nothing to draw.
+func (s *Sheet) makeXLSXDrawing(rels *xlsxWorkbookRels, partName string, drawingParts *drawingParts) (string, error) {
+	shapes := s.shapes
+	if shapes == nil {
+		shapes = &drawingShapes{}
+	}
+	if len(s.Pictures) == 0 && len(s.Charts) == 0 && len(shapes.anchors) == 0 {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	fmt.Fprintf(&buf, `<xdr:wsDr xmlns:xdr="%s" xmlns:a="%s" xmlns:r="%s"`,
+		namespaceSpreadsheetDrawing, namespaceDrawingML, namespaceRelationships)
+	for _, ns := range shapes.namespaces {
+		fmt.Fprintf(&buf, ` xmlns:%s="`, ns.Name.Local)
+		xml.EscapeText(&buf, []byte(ns.Value))
+		buf.WriteString(`"`)
+	}
+	buf.WriteString(`>`)
+	id := shapes.maxID + 1
+	for _, picture := range s.Pictures {
+		target := drawingParts.addImage(picture.Data, picture.Format)
+		rID := rels.addRelationship(relationshipTypeImage, "../"+strings.TrimPrefix(target, "xl/"), "")
+		writeDrawingAnchor(&buf, picture.Anchor, func() {
+			picture.writeXLSXPic(&buf, id, rID)
+		})
+		id++
+	}
+	for _, chart := range s.Charts {
+		var target string
+		if chart.changed() {
+			content, err := chart.makeXLSXChartSpace()
+			if err != nil {
+				return "", err
+			}
+			target = drawingParts.addChart(content, nil)
+		} else {
+			target = drawingParts.addChart(chart.original, chart.rels)
+		}
+		rID := rels.addRelationship(relationshipTypeChart, "../"+strings.TrimPrefix(target, "xl/"), "")
+		writeDrawingAnchor(&buf, chart.Anchor, func() {
+			chart.writeXLSXGraphicFrame(&buf, id, rID)
+		})
+		id++
+	}
+	for _, shape := range shapes.anchors {
+		if !drawingParts.carrier.keeps(shape.rels) {
+			continue
+		}
+		ids := drawingParts.carrier.addRelationships(rels, partName, shape.rels)
+		content, _ := remapRelationshipIDs(shape.content, ids)
+		buf.WriteString(content)
+	}
+	buf.WriteString(`</xdr:wsDr>`)
+	return buf.String(), nil
+}
+
+// originalDrawing is the drawing part that a worksheet was read with,
+// when the file was opened with the PreserveUnknownParts option.  The
+// part, with the shapes the library doesn't model, and the images and
+// charts it leads to are written back as they were for as long as the
+// pictures and charts of the sheet are the ones read from it.
+type originalDrawing struct {
+	// rel is the relationship of the worksheet to the drawing.
+	rel      xlsxWorkbookRelation
+	pictures []*Picture
+	charts   []*Chart
+	// readPictures and readCharts are copies of the pictures and
+	// charts as they were read, which tell whether they have been
+	// moved or changed since.
+	readPictures []Picture
+	readCharts   []Chart
+}
+
+// newOriginalDrawing keeps the drawing that rel leads to, along with
+// the pictures and charts that have just been read from it.
+func newOriginalDrawing(rel xlsxWorkbookRelation, s *Sheet) *originalDrawing {
+	d := &originalDrawing{
+		rel:      rel,
+		pictures: append([]*Picture(nil), s.Pictures...),
+		charts:   append([]*Chart(nil), s.Charts...),
+	}
+	for _, picture := range s.Pictures {
+		read := *picture
+		read.Data = append([]byte(nil), picture.Data...)
+		d.readPictures = append(d.readPictures, read)
+	}
+	for _, chart := range s.Charts {
+		d.readCharts = append(d.readCharts, chart.clone())
+	}
+	return d
+}
+
+// changed reports whether pictures or charts have been added to the
+// sheet, removed from it or changed since the drawing was read.
+func (d *originalDrawing) changed(s *Sheet) bool {
+	if len(s.Pictures) != len(d.pictures) || len(s.Charts) != len(d.charts) {
+		return true
+	}
+	for i, picture := range s.Pictures {
+		if picture != d.pictures[i] || !reflect.DeepEqual(*picture, d.readPictures[i]) {
+			return true
+		}
+	}
+	for i, chart := range s.Charts {
+		read := d.readCharts[i]
+		if chart != d.charts[i] || chart.changed() || chart.Name != read.Name || chart.Anchor != read.Anchor {
+			return true
+		}
+	}
+	return false
+}
+
+// readDrawingFromZipFile reads the pictures and charts from a drawing
+// part into the sheet it belongs to, and keeps the rest of its anchors
+// as the shapes of the sheet.
+func readDrawingFromZipFile(files map[string]*zip.File, partName string, sheet *Sheet) error {
+	f, ok := files[partName]
+	if !ok {
+		return fmt.Errorf("drawing %q not found", partName)
+	}
+	rels, err := readPartRelations(files, partName)
+	if err != nil {
+		return err
+	}
+	content, err := readZipFileBytes(f)
+	if err != nil {
+		return err
+	}
+	shapes := &drawingShapes{}
+	d := xml.NewDecoder(bytes.NewReader(content))
+	root := true
+	for {
+		offset := d.InputOffset()
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if root {
+			for _, attr := range start.Attr {
+				switch {
+				case attr.Name.Space != "xmlns":
+				case attr.Name.Local == "xdr", attr.Name.Local == "a", attr.Name.Local == "r":
+				default:
+					shapes.namespaces = append(shapes.namespaces, attr)
+				}
+			}
+			root = false
+			continue
+		}
+		// Every other element that starts is a child of the root, as
+		// each is decoded as a whole.
+		var xAnchor xlsxDrawingAnchor
+		if err = d.DecodeElement(&xAnchor, &start); err != nil {
+			return err
+		}
+		read, err := readDrawingAnchorContent(files, rels, xAnchor, sheet)
+		if err != nil {
+			return err
+		}
+		if !read {
+			shapes.add(string(content[offset:d.InputOffset()]), rels)
+		}
+	}
+	if len(shapes.anchors) > 0 {
+		sheet.shapes = shapes
+	}
+	return nil
+}
+
+// readDrawingAnchorContent reads the picture or chart of an anchor into
+// the sheet.  It returns false when the anchor holds neither.
+func readDrawingAnchorContent(files map[string]*zip.File, rels map[string]xlsxWorkbookRelation, xAnchor xlsxDrawingAnchor, sheet *Sheet) (bool, error) {
+	anchor, ok := readDrawingAnchor(xAnchor)
+	if !ok {
+		return false, nil
+	}
+	switch {
+	case xAnchor.Pic != nil:
+		picture, err := readPicture(files, rels, xAnchor.Pic, anchor)
+		if err != nil || picture == nil {
+			return false, err
+		}
+		sheet.Pictures = append(sheet.Pictures, picture)
+	case xAnchor.GraphicFrame != nil:
+		chart, err := readChart(files, rels, xAnchor.GraphicFrame, anchor)
+		if err != nil || chart == nil {
+			return false, err
+		}
+		sheet.Charts = append(sheet.Charts, chart)
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// add keeps an anchor of a drawing, with the relationships of the
+// drawing that it refers to.  An anchor that refers to a relationship
+// the drawing doesn't have is dropped.
+func (shapes *drawingShapes) add(content string, rels map[string]xlsxWorkbookRelation) {
+	shape := drawingShape{content: content}
+	seen := make(map[string]bool)
+	for _, m := range relationshipIDAttr.FindAllStringSubmatch(content, -1) {
+		rel, ok := rels[m[2]]
+		if !ok {
+			return
+		}
+		if !seen[rel.Id] {
+			seen[rel.Id] = true
+			shape.rels = append(shape.rels, rel)
+		}
+	}
+	for _, m := range drawingShapeID.FindAllStringSubmatch(content, -1) {
+		if id, err := strconv.Atoi(m[1]); err == nil && id > shapes.maxID {
+			shapes.maxID = id
+		}
+	}
+	shapes.anchors = append(shapes.anchors, shape)
+}
+
+// readDrawingAnchor converts an anchor of a drawing part.  It returns
+// false for elements that are not anchors.
+func readDrawingAnchor(xAnchor xlsxDrawingAnchor) (DrawingAnchor, bool) {
+	var anchor DrawingAnchor
+	switch xAnchor.XMLName.Local {
+	case "twoCellAnchor":
+		anchor.Type = DrawingAnchorTwoCell
+	case "oneCellAnchor":
+		anchor.Type = DrawingAnchorOneCell
+	case "absoluteAnchor":
+		anchor.Type = DrawingAnchorAbsolute
+	default:
+		return anchor, false
+	}
+	if m := xAnchor.From; m != nil {
+		anchor.From = DrawingMarker{Col: m.Col, Row: m.Row, ColOffset: m.ColOff, RowOffset: m.RowOff}
+	}
+	if m := xAnchor.To; m != nil {
+		anchor.To = DrawingMarker{Col: m.Col, Row: m.Row, ColOffset: m.ColOff, RowOffset: m.RowOff}
+	}
+	if p := xAnchor.Pos; p != nil {
+		anchor.X, anchor.Y = p.X, p.Y
+	}
+	if e := xAnchor.Ext; e != nil {
+		anchor.Width, anchor.Height = e.Cx, e.Cy
+	}
+	return anchor, true
+}
+
+// readZipFileBytes returns the whole content of a file in the package.
+func readZipFileBytes(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
+
+// drawingParts collects the images and charts of the drawings of a
+// workbook while it is written, so that they get names that are unique
+// in the workbook, and an image used more than once is only stored
+// once.  The parts that the charts and shapes read from a file refer
+// to go through carrier, and the relationships of the charts to them
+// are added to relsParts.
+type drawingParts struct {
+	parts     map[string]string
+	types     *xlsxTypes
+	carrier   *partCarrier
+	relsParts map[string]*xlsxWorkbookRels
+	images    map[string]string
+	charts    int
+}
+
+func newDrawingParts(parts map[string]string, types *xlsxTypes, carrier *partCarrier, relsParts map[string]*xlsxWorkbookRels) *drawingParts {
+	return &drawingParts{parts: parts, types: types, carrier: carrier, relsParts: relsParts, images: make(map[string]string)}
+}
+
+// addImage stores an image in the media folder of the package and
+// returns the name of its part.
+func (d *drawingParts) addImage(data []byte, format string) string {
+	key := format + "\x00" + string(data)
+	if name, ok := d.images[key]; ok {
+		return name
+	}
+	extension := strings.ToLower(format)
+	name := fmt.Sprintf("xl/media/image%d.%s", len(d.images)+1, extension)
+	d.images[key] = name
+	d.parts[name] = string(data)
+	d.types.addDefault(extension, imageContentType(extension))
+	return name
+}
+
+// addChart stores a chart part and returns its name.  The
+// relationships of a chart part read from a file are carried along
+// with it when the parts they lead to are kept; otherwise the elements
+// of the chart that refer to them are dropped.
+func (d *drawingParts) addChart(content string, rels []xlsxWorkbookRelation) string {
+	d.charts++
+	name := fmt.Sprintf("xl/charts/chart%d.xml", d.charts)
+	if len(rels) > 0 && d.carrier.keeps(rels) {
+		chartRels := &xlsxWorkbookRels{}
+		ids := d.carrier.addRelationships(chartRels, name, rels)
+		content, _ = remapRelationshipIDs(content, ids)
+		d.relsParts[relsNameForPart(name)] = chartRels
+	} else {
+		content = dropRelationshipElements(content)
+	}
+	d.parts[name] = content
+	d.types.Overrides = append(
+		d.types.Overrides,
+		xlsxOverride{
+			PartName:    "/" + name,
+			ContentType: contentTypeChart})
+	return name
+}
+
+// imageContentType returns the content type of images with the given
+// file extension.
+func imageContentType(extension string) string {
+	switch extension {
+	case "jpg", "jpeg":
+		return "image/jpeg"
+	case "tif", "tiff":
+		return "image/tiff"
+	case "emf":
+		return "image/x-emf"
+	case "wmf":
+		return "image/x-wmf"
+	case "svg":
+		return "image/svg+xml"
+	}
+	return "image/" + extension
+}
+
+// imageFormatFromPartName returns the format of an image from the
+// extension of the name of its part.
+func imageFormatFromPartName(partName string) string {
+	extension := strings.ToLower(strings.TrimPrefix(path.Ext(partName), "."))
+	if extension == "jpg" {
+		return "jpeg"
+	}
+	return extension
+}
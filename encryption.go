@@ -0,0 +1,581 @@
+package xlsx
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"strings"
+	"unicode/utf16"
+)
+
+// A workbook that is encrypted with a password is a compound file that
+// holds the encrypted zip package in its EncryptedPackage stream, and
+// the way it has been encrypted in its EncryptionInfo stream.  The
+// formats are described in [MS-OFFCRYPTO].  Workbooks are written with
+// Agile encryption, and read with either Agile or Standard encryption.
+
+// ErrIncorrectPassword is returned when an encrypted workbook is opened
+// with the wrong password.
+var ErrIncorrectPassword = errors.New("incorrect password")
+
+const (
+	encryptedPackageSegmentSize = 4096
+	agileSpinCount              = 100000
+	agileSaltSize               = 16
+	agileKeyBits                = 256
+	standardSpinCount           = 50000
+	// maxSpinCount is the most times that [MS-OFFCRYPTO] allows the
+	// hash of a password to be hashed again.
+	maxSpinCount = 10000000
+
+	passwordKeyEncryptorURI = "http://schemas.microsoft.com/office/2006/keyEncryptor/password"
+)
+
+// The block keys of Agile encryption, which turn the hash of the
+// password into a different key for each of its uses.
+var (
+	agileVerifierHashInputBlockKey = []byte{0xfe, 0xa7, 0xd2, 0x76, 0x3b, 0x4b, 0x9e, 0x79}
+	agileVerifierHashValueBlockKey = []byte{0xd7, 0xaa, 0x0f, 0x6d, 0x30, 0x61, 0x34, 0x4e}
+	agileKeyValueBlockKey          = []byte{0x14, 0x6e, 0x0b, 0xe7, 0xab, 0xac, 0xd0, 0xd6}
+	agileHmacKeyBlockKey           = []byte{0x5f, 0xb2, 0xad, 0x01, 0x0c, 0xb9, 0xe1, 0xf6}
+	agileHmacValueBlockKey         = []byte{0xa0, 0x67, 0x7f, 0x02, 0xb2, 0x2c, 0x84, 0x33}
+)
+
+// OpenFileWithPassword() opens an XLSX file that has been encrypted
+// with a password.  A file that isn't encrypted is opened as it is.
+func OpenFileWithPassword(fileName, password string) (*File, error) {
+	bs, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	r := bytes.NewReader(bs)
+	return OpenReaderAtWithPassword(r, int64(r.Len()), password)
+}
+
+// OpenReaderAtWithPassword() take io.ReaderAt of an XLSX file that has
+// been encrypted with a password and returns a populated xlsx.File
+// struct for it.  A file that isn't encrypted is opened as it is.
+func OpenReaderAtWithPassword(r io.ReaderAt, size int64, password string) (*File, error) {
+	if !isCompoundFile(r, size) {
+		return OpenReaderAt(r, size)
+	}
+	bs, err := decryptPackage(r, size, password)
+	if err != nil {
+		return nil, err
+	}
+	return OpenBinary(bs)
+}
+
+// WriteEncrypted saves the File to an io.Writer, encrypted with Agile
+// encryption so that it can only be opened with the password.
+func (f *File) WriteEncrypted(writer io.Writer, password string) error {
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		return err
+	}
+	encryptionInfo, encryptedPackage, err := encryptAgilePackage(buf.Bytes(), password)
+	if err != nil {
+		return err
+	}
+	return writeCompoundFile(writer,
+		makeDataSpacesStorage(),
+		cfbStream("EncryptionInfo", encryptionInfo),
+		cfbStream("EncryptedPackage", encryptedPackage),
+	)
+}
+
+// decryptPackage returns the zip package held by an encrypted
+// workbook.
+func decryptPackage(r io.ReaderAt, size int64, password string) ([]byte, error) {
+	cf, err := readCompoundFile(r, size)
+	if err != nil {
+		return nil, err
+	}
+	info, err := cf.stream("EncryptionInfo")
+	if err != nil {
+		return nil, err
+	}
+	encryptedPackage, err := cf.stream("EncryptedPackage")
+	if err != nil {
+		return nil, err
+	}
+	if len(info) < 8 || len(encryptedPackage) < 8 {
+		return nil, errors.New("invalid encrypted workbook")
+	}
+	major := binary.LittleEndian.Uint16(info[0:])
+	minor := binary.LittleEndian.Uint16(info[2:])
+	switch {
+	case major == 4 && minor == 4:
+		return decryptAgilePackage(info[8:], encryptedPackage, password)
+	case (major == 2 || major == 3 || major == 4) && minor == 2:
+		return decryptStandardPackage(info[8:], encryptedPackage, password)
+	}
+	return nil, fmt.Errorf("unsupported encryption version %d.%d", major, minor)
+}
+
+// decryptAgilePackage checks the password against the verifier of an
+// Agile EncryptionInfo stream, and decrypts the package with the key
+// that the password unlocks.
+func decryptAgilePackage(info, encryptedPackage []byte, password string) ([]byte, error) {
+	var encryption xlsxEncryption
+	if err := xml.Unmarshal(info, &encryption); err != nil {
+		return nil, err
+	}
+	var key *xlsxEncryptedKey
+	for _, keyEncryptor := range encryption.KeyEncryptors {
+		if keyEncryptor.URI == passwordKeyEncryptorURI && keyEncryptor.EncryptedKey != nil {
+			key = keyEncryptor.EncryptedKey
+		}
+	}
+	if key == nil {
+		return nil, errors.New("workbook is not encrypted with a password")
+	}
+	keyData := encryption.KeyData
+	newKeyHash, keySalt, err := checkAgileCipher("encryptedKey", key.xlsxEncryptionKeyData)
+	if err != nil {
+		return nil, err
+	}
+	newDataHash, dataSalt, err := checkAgileCipher("keyData", keyData)
+	if err != nil {
+		return nil, err
+	}
+	if key.SpinCount < 0 || key.SpinCount > maxSpinCount {
+		return nil, fmt.Errorf("invalid encryptedKey spinCount %d", key.SpinCount)
+	}
+	values := make(map[string][]byte)
+	for name, value := range map[string]string{
+		"encryptedVerifierHashInput": key.EncryptedVerifierHashInput,
+		"encryptedVerifierHashValue": key.EncryptedVerifierHashValue,
+		"encryptedKeyValue":          key.EncryptedKeyValue,
+	} {
+		if values[name], err = base64.StdEncoding.DecodeString(value); err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", name, err)
+		}
+	}
+
+	passwordHash := agilePasswordHash(newKeyHash, password, keySalt, key.SpinCount)
+	iv := fixLength(keySalt, key.BlockSize, 0x36)
+	decrypt := func(blockKey, data []byte) ([]byte, error) {
+		return aesCBC(false, agileKey(newKeyHash, passwordHash, blockKey, key.KeyBits), iv, data)
+	}
+	verifierHashInput, err := decrypt(agileVerifierHashInputBlockKey, values["encryptedVerifierHashInput"])
+	if err != nil {
+		return nil, err
+	}
+	verifierHashValue, err := decrypt(agileVerifierHashValueBlockKey, values["encryptedVerifierHashValue"])
+	if err != nil {
+		return nil, err
+	}
+	h := newKeyHash()
+	h.Write(fixLength(verifierHashInput, key.SaltSize, 0))
+	if !bytes.Equal(h.Sum(nil), fixLength(verifierHashValue, h.Size(), 0)) {
+		return nil, ErrIncorrectPassword
+	}
+	secretKey, err := decrypt(agileKeyValueBlockKey, values["encryptedKeyValue"])
+	if err != nil {
+		return nil, err
+	}
+	secretKey = fixLength(secretKey, keyData.KeyBits/8, 0)
+	return cryptAgileSegments(false, newDataHash, secretKey, dataSalt, keyData.BlockSize, encryptedPackage)
+}
+
+// checkAgileCipher returns an error unless the cipher described by the
+// keyData or encryptedKey element of an Agile EncryptionInfo stream is
+// AES in CBC mode, with sizes that match the algorithms.  It returns
+// the hash function and the salt of the cipher.
+func checkAgileCipher(element string, data xlsxEncryptionKeyData) (func() hash.Hash, []byte, error) {
+	if data.CipherAlgorithm != "AES" || data.CipherChaining != "ChainingModeCBC" {
+		return nil, nil, fmt.Errorf("unsupported cipher %s %s", data.CipherAlgorithm, data.CipherChaining)
+	}
+	if data.BlockSize != aes.BlockSize {
+		return nil, nil, fmt.Errorf("invalid %s blockSize %d", element, data.BlockSize)
+	}
+	if !validAESKeyBits(data.KeyBits) {
+		return nil, nil, fmt.Errorf("invalid %s keyBits %d", element, data.KeyBits)
+	}
+	newHash, err := newEncryptionHash(data.HashAlgorithm)
+	if err != nil {
+		return nil, nil, err
+	}
+	if data.HashSize != newHash().Size() {
+		return nil, nil, fmt.Errorf("invalid %s hashSize %d for %s", element, data.HashSize, data.HashAlgorithm)
+	}
+	salt, err := base64.StdEncoding.DecodeString(data.SaltValue)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid %s saltValue: %v", element, err)
+	}
+	if len(salt) == 0 || data.SaltSize != len(salt) {
+		return nil, nil, fmt.Errorf("invalid %s saltSize %d for a salt of %d bytes", element, data.SaltSize, len(salt))
+	}
+	return newHash, salt, nil
+}
+
+// validAESKeyBits reports whether AES has keys of the given size.
+func validAESKeyBits(keyBits int) bool {
+	return keyBits == 128 || keyBits == 192 || keyBits == 256
+}
+
+// encryptAgilePackage encrypts a zip package with a random key, and
+// returns the EncryptionInfo and EncryptedPackage streams.
+func encryptAgilePackage(data []byte, password string) ([]byte, []byte, error) {
+	random := func(n int) ([]byte, error) {
+		b := make([]byte, n)
+		_, err := rand.Read(b)
+		return b, err
+	}
+	var values [5][]byte
+	for i, size := range []int{agileSaltSize, agileSaltSize, agileKeyBits / 8, agileSaltSize, sha512.Size} {
+		var err error
+		if values[i], err = random(size); err != nil {
+			return nil, nil, err
+		}
+	}
+	keyDataSalt, keySalt, secretKey, verifierHashInput, hmacKey := values[0], values[1], values[2], values[3], values[4]
+
+	sizePrefix := make([]byte, 8)
+	binary.LittleEndian.PutUint64(sizePrefix, uint64(len(data)))
+	segments, err := cryptAgileSegments(true, sha512.New, secretKey, keyDataSalt, aes.BlockSize, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	encryptedPackage := append(sizePrefix, segments...)
+
+	// The HMAC of the encrypted package lets Excel detect changes
+	// to it.
+	mac := hmac.New(sha512.New, hmacKey)
+	mac.Write(encryptedPackage)
+	encryptWithData := func(blockKey, data []byte) ([]byte, error) {
+		h := sha512.New()
+		h.Write(keyDataSalt)
+		h.Write(blockKey)
+		return aesCBC(true, secretKey, h.Sum(nil)[:aes.BlockSize], data)
+	}
+	encryptedHmacKey, err := encryptWithData(agileHmacKeyBlockKey, hmacKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	encryptedHmacValue, err := encryptWithData(agileHmacValueBlockKey, mac.Sum(nil))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	passwordHash := agilePasswordHash(sha512.New, password, keySalt, agileSpinCount)
+	encryptWithPassword := func(blockKey, data []byte) ([]byte, error) {
+		return aesCBC(true, agileKey(sha512.New, passwordHash, blockKey, agileKeyBits), keySalt, data)
+	}
+	verifierHashValue := sha512.Sum512(verifierHashInput)
+	encryptedVerifierHashInput, err := encryptWithPassword(agileVerifierHashInputBlockKey, verifierHashInput)
+	if err != nil {
+		return nil, nil, err
+	}
+	encryptedVerifierHashValue, err := encryptWithPassword(agileVerifierHashValueBlockKey, verifierHashValue[:])
+	if err != nil {
+		return nil, nil, err
+	}
+	encryptedKeyValue, err := encryptWithPassword(agileKeyValueBlockKey, secretKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b64 := base64.StdEncoding.EncodeToString
+	var info bytes.Buffer
+	info.Write([]byte{4, 0, 4, 0, 0x40, 0, 0, 0})
+	info.WriteString(xml.Header[:len(xml.Header)-1] + "\r\n")
+	cipherAttrs := fmt.Sprintf(`saltSize="%d" blockSize="%d" keyBits="%d" hashSize="%d" cipherAlgorithm="AES" cipherChaining="ChainingModeCBC" hashAlgorithm="SHA512"`,
+		agileSaltSize, aes.BlockSize, agileKeyBits, sha512.Size)
+	fmt.Fprintf(&info, `<encryption xmlns="http://schemas.microsoft.com/office/2006/encryption" xmlns:p="%s">`, passwordKeyEncryptorURI)
+	fmt.Fprintf(&info, `<keyData %s saltValue="%s"/>`, cipherAttrs, b64(keyDataSalt))
+	fmt.Fprintf(&info, `<dataIntegrity encryptedHmacKey="%s" encryptedHmacValue="%s"/>`, b64(encryptedHmacKey), b64(encryptedHmacValue))
+	fmt.Fprintf(&info, `<keyEncryptors><keyEncryptor uri="%s">`, passwordKeyEncryptorURI)
+	fmt.Fprintf(&info, `<p:encryptedKey spinCount="%d" %s saltValue="%s" encryptedVerifierHashInput="%s" encryptedVerifierHashValue="%s" encryptedKeyValue="%s"/>`,
+		agileSpinCount, cipherAttrs, b64(keySalt), b64(encryptedVerifierHashInput), b64(encryptedVerifierHashValue), b64(encryptedKeyValue))
+	info.WriteString(`</keyEncryptor></keyEncryptors></encryption>`)
+	return info.Bytes(), encryptedPackage, nil
+}
+
+// cryptAgileSegments encrypts data, or decrypts an EncryptedPackage
+// stream, in segments of 4096 bytes that each have their own IV.
+func cryptAgileSegments(encrypt bool, newHash func() hash.Hash, key, salt []byte, blockSize int, data []byte) ([]byte, error) {
+	size := uint64(len(data))
+	if !encrypt {
+		size = binary.LittleEndian.Uint64(data)
+		data = data[8:]
+	}
+	var out bytes.Buffer
+	index := make([]byte, 4)
+	for i := 0; len(data) > 0; i++ {
+		segment := data
+		if len(segment) > encryptedPackageSegmentSize {
+			segment = segment[:encryptedPackageSegmentSize]
+		}
+		data = data[len(segment):]
+		binary.LittleEndian.PutUint32(index, uint32(i))
+		h := newHash()
+		h.Write(salt)
+		h.Write(index)
+		iv := fixLength(h.Sum(nil), blockSize, 0x36)
+		if !encrypt {
+			segment = segment[:len(segment)-len(segment)%aes.BlockSize]
+		}
+		crypted, err := aesCBC(encrypt, key, iv, segment)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(crypted)
+	}
+	if encrypt {
+		return out.Bytes(), nil
+	}
+	if uint64(out.Len()) < size {
+		return nil, errors.New("encrypted package is shorter than its size")
+	}
+	return out.Bytes()[:size], nil
+}
+
+// agilePasswordHash hashes the salt and the password, then hashes the
+// number of each iteration followed by the previous hash spinCount
+// times.
+func agilePasswordHash(newHash func() hash.Hash, password string, salt []byte, spinCount int) []byte {
+	h := newHash()
+	h.Write(salt)
+	h.Write(utf16LE(password))
+	sum := h.Sum(nil)
+	iteration := make([]byte, 4)
+	for i := 0; i < spinCount; i++ {
+		binary.LittleEndian.PutUint32(iteration, uint32(i))
+		h.Reset()
+		h.Write(iteration)
+		h.Write(sum)
+		sum = h.Sum(sum[:0])
+	}
+	return sum
+}
+
+// agileKey derives the key for one of the uses of the password from
+// its hash.
+func agileKey(newHash func() hash.Hash, passwordHash, blockKey []byte, keyBits int) []byte {
+	h := newHash()
+	h.Write(passwordHash)
+	h.Write(blockKey)
+	return fixLength(h.Sum(nil), keyBits/8, 0x36)
+}
+
+// decryptStandardPackage checks the password against the verifier of a
+// Standard EncryptionInfo stream, and decrypts the package with AES in
+// ECB mode.
+func decryptStandardPackage(info, encryptedPackage []byte, password string) ([]byte, error) {
+	le := binary.LittleEndian
+	if len(info) < 4 {
+		return nil, errors.New("invalid encryption info")
+	}
+	headerSize := int(le.Uint32(info))
+	if headerSize < 32 || len(info) < 4+headerSize+4 {
+		return nil, errors.New("invalid encryption info")
+	}
+	header := info[4 : 4+headerSize]
+	algID, algIDHash, keySize := le.Uint32(header[8:]), le.Uint32(header[12:]), int(le.Uint32(header[16:]))
+	keyBits, ok := map[uint32]int{0x660E: 128, 0x660F: 192, 0x6610: 256}[algID]
+	if !ok {
+		return nil, fmt.Errorf("unsupported encryption algorithm 0x%04X", algID)
+	}
+	if keySize != keyBits {
+		return nil, fmt.Errorf("invalid key size %d for encryption algorithm 0x%04X", keySize, algID)
+	}
+	if algIDHash != 0 && algIDHash != 0x8004 {
+		return nil, fmt.Errorf("unsupported hash algorithm 0x%04X", algIDHash)
+	}
+	verifier := info[4+headerSize:]
+	saltSize := int(le.Uint32(verifier))
+	if saltSize != 16 || len(verifier) < 4+saltSize+16+4+32 {
+		return nil, errors.New("invalid encryption verifier")
+	}
+	salt := verifier[4 : 4+saltSize]
+	encryptedVerifier := verifier[4+saltSize : 4+saltSize+16]
+	encryptedVerifierHash := verifier[4+saltSize+16+4 : 4+saltSize+16+4+32]
+
+	key := standardKey(password, salt, keySize)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	plainVerifier := aesECBDecrypt(block, encryptedVerifier)
+	verifierHash := aesECBDecrypt(block, encryptedVerifierHash)
+	sum := sha1.Sum(plainVerifier)
+	if !bytes.Equal(sum[:], verifierHash[:sha1.Size]) {
+		return nil, ErrIncorrectPassword
+	}
+
+	size := le.Uint64(encryptedPackage)
+	data := encryptedPackage[8:]
+	data = aesECBDecrypt(block, data[:len(data)-len(data)%aes.BlockSize])
+	if uint64(len(data)) < size {
+		return nil, errors.New("encrypted package is shorter than its size")
+	}
+	return data[:size], nil
+}
+
+// standardKey derives the key of Standard encryption from the password.
+// keySize is the size of the key in bits, which is at most 256.
+func standardKey(password string, salt []byte, keySize int) []byte {
+	h := sha1.New()
+	h.Write(salt)
+	h.Write(utf16LE(password))
+	sum := h.Sum(nil)
+	iteration := make([]byte, 4)
+	for i := 0; i < standardSpinCount; i++ {
+		binary.LittleEndian.PutUint32(iteration, uint32(i))
+		h.Reset()
+		h.Write(iteration)
+		h.Write(sum)
+		sum = h.Sum(sum[:0])
+	}
+	h.Reset()
+	h.Write(sum)
+	h.Write([]byte{0, 0, 0, 0})
+	sum = h.Sum(nil)
+
+	derive := func(fill byte) []byte {
+		buf := bytes.Repeat([]byte{fill}, 64)
+		for i, b := range sum {
+			buf[i] ^= b
+		}
+		derived := sha1.Sum(buf)
+		return derived[:]
+	}
+	derived := append(derive(0x36), derive(0x5c)...)
+	return derived[:keySize/8]
+}
+
+// newEncryptionHash returns the hash function with the name used in
+// an EncryptionInfo stream.
+func newEncryptionHash(name string) (func() hash.Hash, error) {
+	switch strings.Replace(strings.ToUpper(name), "-", "", -1) {
+	case "SHA1":
+		return sha1.New, nil
+	case "SHA256":
+		return sha256.New, nil
+	case "SHA384":
+		return sha512.New384, nil
+	case "SHA512":
+		return sha512.New, nil
+	}
+	return nil, fmt.Errorf("unsupported hash algorithm %q", name)
+}
+
+// aesCBC encrypts or decrypts data with AES in CBC mode.  Data that is
+// encrypted is padded with zeros to a whole number of blocks.
+func aesCBC(encrypt bool, key, iv, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%aes.BlockSize != 0 {
+		if !encrypt {
+			return nil, errors.New("encrypted data is not a whole number of blocks")
+		}
+		data = padTo(data, aes.BlockSize)
+	}
+	out := make([]byte, len(data))
+	if encrypt {
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, data)
+	} else {
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+	}
+	return out, nil
+}
+
+// aesECBDecrypt decrypts data, which is a whole number of blocks, with
+// AES in ECB mode.
+func aesECBDecrypt(block cipher.Block, data []byte) []byte {
+	out := make([]byte, len(data))
+	for i := 0; i+aes.BlockSize <= len(data); i += aes.BlockSize {
+		block.Decrypt(out[i:i+aes.BlockSize], data[i:i+aes.BlockSize])
+	}
+	return out
+}
+
+// fixLength truncates b to length, or pads it with pad.
+func fixLength(b []byte, length int, pad byte) []byte {
+	if len(b) >= length {
+		return b[:length]
+	}
+	return append(append([]byte(nil), b...), bytes.Repeat([]byte{pad}, length-len(b))...)
+}
+
+// utf16LE returns s encoded as UTF-16 little endian, which is how
+// passwords are hashed.
+func utf16LE(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(units))
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(b[2*i:], u)
+	}
+	return b
+}
+
+// makeDataSpacesStorage returns the \x06DataSpaces storage that tells
+// Excel that the EncryptedPackage stream is encrypted.
+func makeDataSpacesStorage() *cfbEntry {
+	var version, dataSpaceMap, dataSpace, transform bytes.Buffer
+	le := binary.LittleEndian
+	putUint32 := func(b *bytes.Buffer, values ...uint32) {
+		for _, v := range values {
+			binary.Write(b, le, v)
+		}
+	}
+	putString := func(b *bytes.Buffer, s string) {
+		encoded := utf16LE(s)
+		putUint32(b, uint32(len(encoded)))
+		b.Write(padTo(encoded, 4))
+	}
+	// Reader, updater and writer versions, all 1.0.
+	putVersions := func(b *bytes.Buffer) {
+		putUint32(b, 1, 1, 1)
+	}
+
+	putString(&version, "Microsoft.Container.DataSpaces")
+	putVersions(&version)
+
+	var entry bytes.Buffer
+	putUint32(&entry, 1, 0)
+	putString(&entry, "EncryptedPackage")
+	putString(&entry, "StrongEncryptionDataSpace")
+	putUint32(&dataSpaceMap, 8, 1, uint32(4+entry.Len()))
+	dataSpaceMap.Write(entry.Bytes())
+
+	putUint32(&dataSpace, 8, 1)
+	putString(&dataSpace, "StrongEncryptionTransform")
+
+	var transformID bytes.Buffer
+	putString(&transformID, "{FF9A3F03-56EF-4613-BDD5-5A41C1D07246}")
+	putUint32(&transform, uint32(8+transformID.Len()), 1)
+	transform.Write(transformID.Bytes())
+	putString(&transform, "Microsoft.Container.EncryptionTransform")
+	putVersions(&transform)
+	// An empty name, then the block size, the cipher mode and a
+	// reserved value of the EncryptionTransformInfo.
+	putUint32(&transform, 0, 0, 0, 4)
+
+	return cfbStorage("\x06DataSpaces",
+		cfbStream("Version", version.Bytes()),
+		cfbStream("DataSpaceMap", dataSpaceMap.Bytes()),
+		cfbStorage("DataSpaceInfo",
+			cfbStream("StrongEncryptionDataSpace", dataSpace.Bytes())),
+		cfbStorage("TransformInfo",
+			cfbStorage("StrongEncryptionTransform",
+				cfbStream("\x06Primary", transform.Bytes()))),
+	)
+}
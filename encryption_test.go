@@ -0,0 +1,206 @@
+package xlsx
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/sha1"
+	"encoding/binary"
+
+	. "gopkg.in/check.v1"
+)
+
+type EncryptionSuite struct{}
+
+var _ = Suite(&EncryptionSuite{})
+
+func makeEncryptionTestFile(c *C) *File {
+	f := NewFile()
+	sheet, err := f.AddSheet("Secret")
+	c.Assert(err, IsNil)
+	for i := 0; i < 500; i++ {
+		sheet.Cell(i, 0).SetInt(i)
+		sheet.Cell(i, 1).SetString("row data that makes the package span several segments")
+	}
+	return f
+}
+
+// A workbook written with a password can only be opened with it.
+func (s *EncryptionSuite) TestAgileRoundTrip(c *C) {
+	f := makeEncryptionTestFile(c)
+	var buf bytes.Buffer
+	c.Assert(f.WriteEncrypted(&buf, "Pa55wörd"), IsNil)
+
+	r := bytes.NewReader(buf.Bytes())
+	cf, err := readCompoundFile(r, r.Size())
+	c.Assert(err, IsNil)
+	for _, path := range [][]string{
+		{"EncryptionInfo"},
+		{"\x06DataSpaces", "DataSpaceMap"},
+		{"\x06DataSpaces", "TransformInfo", "StrongEncryptionTransform", "\x06Primary"},
+	} {
+		_, err = cf.stream(path...)
+		c.Assert(err, IsNil, Commentf("%q", path))
+	}
+	info, err := cf.stream("EncryptionInfo")
+	c.Assert(err, IsNil)
+	c.Assert(info[:8], DeepEquals, []byte{4, 0, 4, 0, 0x40, 0, 0, 0})
+
+	_, err = OpenReaderAtWithPassword(r, r.Size(), "password")
+	c.Assert(err, Equals, ErrIncorrectPassword)
+	read, err := OpenReaderAtWithPassword(r, r.Size(), "Pa55wörd")
+	c.Assert(err, IsNil)
+	c.Assert(read.Sheets, HasLen, 1)
+	c.Assert(read.Sheets[0].Name, Equals, "Secret")
+	c.Assert(read.Sheets[0].MaxRow, Equals, 500)
+	c.Assert(read.Sheets[0].Cell(499, 0).Value, Equals, "499")
+}
+
+// A workbook that isn't encrypted opens whatever the password.
+func (s *EncryptionSuite) TestOpenUnencryptedWithPassword(c *C) {
+	f := makeEncryptionTestFile(c)
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), IsNil)
+	r := bytes.NewReader(buf.Bytes())
+	read, err := OpenReaderAtWithPassword(r, r.Size(), "anything")
+	c.Assert(err, IsNil)
+	c.Assert(read.Sheets[0].Name, Equals, "Secret")
+}
+
+// Older workbooks that use Standard encryption can be opened too.
+func (s *EncryptionSuite) TestStandardDecryption(c *C) {
+	f := makeEncryptionTestFile(c)
+	var plain bytes.Buffer
+	c.Assert(f.Write(&plain), IsNil)
+
+	password := "legacy"
+	salt := []byte("0123456789abcdef")
+	key := standardKey(password, salt, 128)
+	block, err := aes.NewCipher(key)
+	c.Assert(err, IsNil)
+	encryptECB := func(data []byte) []byte {
+		data = padTo(data, aes.BlockSize)
+		out := make([]byte, len(data))
+		for i := 0; i < len(data); i += aes.BlockSize {
+			block.Encrypt(out[i:i+aes.BlockSize], data[i:i+aes.BlockSize])
+		}
+		return out
+	}
+
+	le := binary.LittleEndian
+	var info bytes.Buffer
+	info.Write([]byte{4, 0, 2, 0, 0x24, 0, 0, 0})
+	csp := utf16LE("Microsoft Enhanced RSA and AES Cryptographic Provider\x00")
+	binary.Write(&info, le, uint32(32+len(csp)))
+	for _, v := range []uint32{0x24, 0, 0x660E, 0x8004, 128, 0x18, 0, 0} {
+		binary.Write(&info, le, v)
+	}
+	info.Write(csp)
+	verifier := []byte("verifier 16bytes")
+	verifierHash := sha1.Sum(verifier)
+	binary.Write(&info, le, uint32(len(salt)))
+	info.Write(salt)
+	info.Write(encryptECB(verifier))
+	binary.Write(&info, le, uint32(sha1.Size))
+	info.Write(encryptECB(verifierHash[:]))
+
+	encryptedPackage := make([]byte, 8)
+	le.PutUint64(encryptedPackage, uint64(plain.Len()))
+	encryptedPackage = append(encryptedPackage, encryptECB(plain.Bytes())...)
+
+	var buf bytes.Buffer
+	c.Assert(writeCompoundFile(&buf,
+		cfbStream("EncryptionInfo", info.Bytes()),
+		cfbStream("EncryptedPackage", encryptedPackage),
+	), IsNil)
+	r := bytes.NewReader(buf.Bytes())
+	_, err = OpenReaderAtWithPassword(r, r.Size(), "wrong")
+	c.Assert(err, Equals, ErrIncorrectPassword)
+	read, err := OpenReaderAtWithPassword(r, r.Size(), password)
+	c.Assert(err, IsNil)
+	c.Assert(read.Sheets[0].Cell(10, 0).Value, Equals, "10")
+}
+
+// An Agile EncryptionInfo stream whose cipher parameters don't fit
+// together is an error rather than a panic.
+func (s *EncryptionSuite) TestCorruptAgileEncryptionInfo(c *C) {
+	f := NewFile()
+	_, err := f.AddSheet("Secret")
+	c.Assert(err, IsNil)
+	var buf bytes.Buffer
+	c.Assert(f.WriteEncrypted(&buf, "password"), IsNil)
+	r := bytes.NewReader(buf.Bytes())
+	cf, err := readCompoundFile(r, r.Size())
+	c.Assert(err, IsNil)
+	info, err := cf.stream("EncryptionInfo")
+	c.Assert(err, IsNil)
+	encryptedPackage, err := cf.stream("EncryptedPackage")
+	c.Assert(err, IsNil)
+
+	for _, t := range []struct{ old, new, expected string }{
+		{`blockSize="16"`, `blockSize="8"`, `invalid keyData blockSize 8`},
+		{`keyBits="256"`, `keyBits="100"`, `invalid keyData keyBits 100`},
+		{`keyBits="256"`, `keyBits="-8"`, `invalid keyData keyBits -8`},
+		{`hashSize="64"`, `hashSize="20"`, `invalid keyData hashSize 20 for SHA512`},
+		{`saltSize="16"`, `saltSize="-1"`, `invalid keyData saltSize -1 for a salt of 16 bytes`},
+		{`hashAlgorithm="SHA512"`, `hashAlgorithm="MD5"`, `unsupported hash algorithm "MD5"`},
+		{`spinCount="100000"`, `spinCount="2000000000"`, `invalid encryptedKey spinCount 2000000000`},
+	} {
+		// The keyData element comes before the encryptedKey one.
+		corrupt := bytes.Replace(info, []byte(t.old), []byte(t.new), 1)
+		var corrupted bytes.Buffer
+		c.Assert(writeCompoundFile(&corrupted,
+			cfbStream("EncryptionInfo", corrupt),
+			cfbStream("EncryptedPackage", encryptedPackage),
+		), IsNil)
+		r := bytes.NewReader(corrupted.Bytes())
+		_, err = OpenReaderAtWithPassword(r, r.Size(), "password")
+		c.Assert(err, ErrorMatches, t.expected, Commentf("%s", t.new))
+	}
+
+	// The cipher of the encryptedKey element is checked in the same
+	// way.
+	corrupt := bytes.Replace(info, []byte(`blockSize="16"`), []byte(`blockSize="32"`), 2)
+	corrupt = bytes.Replace(corrupt, []byte(`blockSize="32"`), []byte(`blockSize="16"`), 1)
+	var corrupted bytes.Buffer
+	c.Assert(writeCompoundFile(&corrupted,
+		cfbStream("EncryptionInfo", corrupt),
+		cfbStream("EncryptedPackage", encryptedPackage),
+	), IsNil)
+	r = bytes.NewReader(corrupted.Bytes())
+	_, err = OpenReaderAtWithPassword(r, r.Size(), "password")
+	c.Assert(err, ErrorMatches, `invalid encryptedKey blockSize 32`)
+}
+
+// A Standard EncryptionInfo stream whose key size doesn't match its
+// algorithm is an error rather than a panic.
+func (s *EncryptionSuite) TestCorruptStandardEncryptionInfo(c *C) {
+	le := binary.LittleEndian
+	for _, t := range []struct {
+		algID, keySize uint32
+		expected       string
+	}{
+		{0x660E, 512, `invalid key size 512 for encryption algorithm 0x660E`},
+		{0x6610, 128, `invalid key size 128 for encryption algorithm 0x6610`},
+		{0x6801, 128, `unsupported encryption algorithm 0x6801`},
+	} {
+		var info bytes.Buffer
+		info.Write([]byte{4, 0, 2, 0, 0x24, 0, 0, 0})
+		binary.Write(&info, le, uint32(32))
+		for _, v := range []uint32{0x24, 0, t.algID, 0x8004, t.keySize, 0x18, 0, 0} {
+			binary.Write(&info, le, v)
+		}
+		binary.Write(&info, le, uint32(16))
+		info.Write(make([]byte, 16+16))
+		binary.Write(&info, le, uint32(sha1.Size))
+		info.Write(make([]byte, 32))
+
+		var buf bytes.Buffer
+		c.Assert(writeCompoundFile(&buf,
+			cfbStream("EncryptionInfo", info.Bytes()),
+			cfbStream("EncryptedPackage", make([]byte, 8+aes.BlockSize)),
+		), IsNil)
+		r := bytes.NewReader(buf.Bytes())
+		_, err := OpenReaderAtWithPassword(r, r.Size(), "password")
+		c.Assert(err, ErrorMatches, t.expected)
+	}
+}
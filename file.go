@@ -17,6 +17,7 @@ import (
 // to the user.
 type File struct {
 	worksheets     map[string]*zip.File
+	files          map[string]*zip.File
 	referenceTable *RefTable
 	Date1904       bool
 	styles         *xlsxStyleSheet
@@ -24,6 +25,19 @@ type File struct {
 	Sheet          map[string]*Sheet
 	theme          *theme
 	DefinedNames   []*xlsxDefinedName
+	Protection     *WorkbookProtection
+	Properties     DocumentProperties
+	// CustomProperties are the properties that users define for a
+	// workbook, in the order that they are written.
+	CustomProperties []*CustomProperty
+	// vbaProject is the content of the vbaProject.bin part of a
+	// macro-enabled workbook, and codeName the name by which its
+	// macros refer to the workbook.
+	vbaProject []byte
+	codeName   string
+	// preserved holds the parts that the library doesn't model,
+	// when the file was opened with PreserveUnknownParts.
+	preserved *preservedParts
 }
 
 const NoRowLimit int = -1
@@ -83,6 +97,98 @@ func OpenReaderAtWithRowLimit(r io.ReaderAt, size int64, rowLimit int) (*File, e
 	return ReadZipReaderWithRowLimit(file, rowLimit)
 }
 
+// OpenOptions controls which parts of an XLSX file are parsed when
+// it is opened with one of the *WithOptions functions.  The zero
+// value reads everything, just like OpenFile.
+//
+// If you save a File that was opened with options that restrict what
+// is read, anything that was not read will be missing from the saved
+// file.
+type OpenOptions struct {
+	// RowLimit is the number of rows that should be read from
+	// each sheet.  Zero, or NoRowLimit, reads every row.
+	RowLimit int
+	// Sheets, when not empty, restricts parsing to the named
+	// sheets.  The other worksheets in the file are never
+	// decoded.
+	Sheets []string
+	// Columns, when set, restricts the cells that are read to a
+	// range of columns given as letters, for example "B:D".  A
+	// single column, such as "C", may also be given.  Cells keep
+	// their position in Row.Cells, cells left of the range are
+	// empty.
+	Columns string
+	// SkipStyles prevents styles.xml and the theme from being
+	// read.  Cells will have no style or number format.
+	SkipStyles bool
+	// SkipDataValidations prevents data validations from being
+	// attached to cells and columns.
+	SkipDataValidations bool
+	// PreserveUnknownParts keeps the parts of the file that the
+	// library doesn't model, such as pivot tables, external links
+	// and printer settings, along with their relationships, so
+	// that saving the File writes them back unchanged.
+	PreserveUnknownParts bool
+}
+
+// includesSheet reports whether the named sheet should be parsed.
+func (o OpenOptions) includesSheet(name string) bool {
+	if len(o.Sheets) == 0 {
+		return true
+	}
+	for _, sheet := range o.Sheets {
+		if sheet == name {
+			return true
+		}
+	}
+	return false
+}
+
+// includesCell reports whether the cell at the given zero based
+// coordinates is within the rows and columns that should be read.
+func (o OpenOptions) includesCell(col, row int) bool {
+	if o.RowLimit != NoRowLimit && row >= o.RowLimit {
+		return false
+	}
+	if o.Columns != "" {
+		minCol, maxCol, err := getColRangeFromString(o.Columns)
+		if err == nil && (col < minCol || col > maxCol) {
+			return false
+		}
+	}
+	return true
+}
+
+// OpenFileWithOptions() will open the file, but will only read the
+// parts of it selected by the provided OpenOptions.
+func OpenFileWithOptions(fileName string, options OpenOptions) (*File, error) {
+	z, err := zip.OpenReader(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+	return ReadZipReaderWithOptions(&z.Reader, options)
+}
+
+// OpenBinaryWithOptions() take bytes of an XLSX file and returns a
+// xlsx.File struct populated with the parts selected by the provided
+// OpenOptions.
+func OpenBinaryWithOptions(bs []byte, options OpenOptions) (*File, error) {
+	r := bytes.NewReader(bs)
+	return OpenReaderAtWithOptions(r, int64(r.Len()), options)
+}
+
+// OpenReaderAtWithOptions() take io.ReaderAt of an XLSX file and
+// returns a xlsx.File struct populated with the parts selected by the
+// provided OpenOptions.
+func OpenReaderAtWithOptions(r io.ReaderAt, size int64, options OpenOptions) (*File, error) {
+	file, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return ReadZipReaderWithOptions(file, options)
+}
+
 // A convenient wrapper around File.ToSlice, FileToSlice will
 // return the raw data contained in an Excel XLSX file as three
 // dimensional slice.  The first index represents the sheet number,
@@ -177,6 +283,71 @@ func (f *File) AddSheet(sheetName string) (*Sheet, error) {
 	return sheet, nil
 }
 
+// RemoveSheet removes the named sheet from the File, along with the
+// names that are defined for it alone.  As in Excel, references to the
+// sheet elsewhere in the workbook become #REF! errors.  The references
+// of a formula that can't be parsed stay as they are, and the error for
+// it is returned once the sheet has been removed.
+func (f *File) RemoveSheet(sheetName string) error {
+	index := f.sheetIndex(sheetName)
+	if index < 0 {
+		return fmt.Errorf("sheet '%s' not found", sheetName)
+	}
+	removed := f.Sheets[index]
+	f.Sheets = append(f.Sheets[:index], f.Sheets[index+1:]...)
+	delete(f.Sheet, sheetName)
+	if removed.Selected && len(f.Sheets) > 0 {
+		f.Sheets[0].Selected = true
+	}
+	f.moveDefinedNameScopes(func(i int) int {
+		switch {
+		case i == index:
+			return -1
+		case i > index:
+			return i - 1
+		}
+		return i
+	})
+	return f.removeSheetReferences(removed)
+}
+
+// MoveSheet moves the named sheet to the given zero based position
+// among the sheets of the File.
+func (f *File) MoveSheet(sheetName string, position int) error {
+	index := f.sheetIndex(sheetName)
+	if index < 0 {
+		return fmt.Errorf("sheet '%s' not found", sheetName)
+	}
+	if position < 0 || position >= len(f.Sheets) {
+		return fmt.Errorf("invalid sheet position %d", position)
+	}
+	sheet := f.Sheets[index]
+	f.Sheets = append(f.Sheets[:index], f.Sheets[index+1:]...)
+	f.Sheets = append(f.Sheets[:position], append([]*Sheet{sheet}, f.Sheets[position:]...)...)
+	f.moveDefinedNameScopes(func(i int) int {
+		switch {
+		case i == index:
+			return position
+		case index < i && i <= position:
+			return i - 1
+		case position <= i && i < index:
+			return i + 1
+		}
+		return i
+	})
+	return nil
+}
+
+// sheetIndex returns the position of the named sheet, or -1.
+func (f *File) sheetIndex(sheetName string) int {
+	for i, sheet := range f.Sheets {
+		if sheet.Name == sheetName {
+			return i
+		}
+	}
+	return -1
+}
+
 // Appends an existing Sheet, with the provided name, to a File
 func (f *File) AppendSheet(sheet Sheet, sheetName string) (*Sheet, error) {
 	if _, exists := f.Sheet[sheetName]; exists {
@@ -192,8 +363,9 @@ func (f *File) AppendSheet(sheet Sheet, sheetName string) (*Sheet, error) {
 
 func (f *File) makeWorkbook() xlsxWorkbook {
 	return xlsxWorkbook{
-		FileVersion: xlsxFileVersion{AppName: "Go XLSX"},
-		WorkbookPr:  xlsxWorkbookPr{ShowObjects: "all"},
+		FileVersion:        xlsxFileVersion{AppName: "Go XLSX"},
+		WorkbookPr:         xlsxWorkbookPr{ShowObjects: "all", CodeName: f.codeName},
+		WorkbookProtection: f.Protection.makeXLSXWorkbookProtection(),
 		BookViews: xlsxBookViews{
 			WorkBookView: []xlsxWorkBookView{
 				{
@@ -208,7 +380,8 @@ func (f *File) makeWorkbook() xlsxWorkbook {
 				},
 			},
 		},
-		Sheets: xlsxSheets{Sheet: make([]xlsxSheet, len(f.Sheets))},
+		Sheets:       xlsxSheets{Sheet: make([]xlsxSheet, len(f.Sheets))},
+		DefinedNames: f.makeXLSXDefinedNames(),
 		CalcPr: xlsxCalcPr{
 			IterateCount: 100,
 			RefMode:      "A1",
@@ -218,6 +391,16 @@ func (f *File) makeWorkbook() xlsxWorkbook {
 	}
 }
 
+// makeXLSXDefinedNames returns the definedNames element of the
+// workbook.
+func (f *File) makeXLSXDefinedNames() xlsxDefinedNames {
+	var names xlsxDefinedNames
+	for _, dn := range f.DefinedNames {
+		names.DefinedName = append(names.DefinedName, *dn)
+	}
+	return names
+}
+
 // Some tools that read XLSX files have very strict requirements about
 // the structure of the input XML.  In particular both Numbers on the Mac
 // and SAS dislike inline XML namespace declarations, or namespace
@@ -258,6 +441,12 @@ func (f *File) MarshallParts() (map[string]string, error) {
 	parts = make(map[string]string)
 	workbook = f.makeWorkbook()
 	sheetIndex := 1
+	tableID := 1
+	vmlIDBlock := 1
+	tableNames := make(map[string]bool)
+	carrier := partCarrier{preserved: f.preserved}
+	relsParts := make(map[string]*xlsxWorkbookRels)
+	drawings := newDrawingParts(parts, &types, &carrier, relsParts)
 
 	if f.styles == nil {
 		f.styles = newXlsxStyleSheet(f.theme)
@@ -268,9 +457,34 @@ func (f *File) MarshallParts() (map[string]string, error) {
 		return nil, err
 	}
 	for _, sheet := range f.Sheets {
-		xSheet := sheet.makeXLSXSheet(refTable, f.styles)
 		rId := fmt.Sprintf("rId%d", sheetIndex)
 		sheetId := strconv.Itoa(sheetIndex)
+		if sheet.Type == SheetTypeChartsheet {
+			sheetPath := fmt.Sprintf("chartsheets/sheet%d.xml", sheetIndex)
+			partName := "xl/" + sheetPath
+			types.Overrides = append(
+				types.Overrides,
+				xlsxOverride{
+					PartName:    "/" + partName,
+					ContentType: contentTypeChartsheet})
+			workbookRels[rId] = sheetPath
+			workbook.Sheets.Sheet[sheetIndex-1] = xlsxSheet{
+				Name:    sheet.Name,
+				SheetId: sheetId,
+				Id:      rId,
+				State:   "visible"}
+			sheetRels := xlsxWorkbookRels{}
+			parts[partName], err = sheet.makeXLSXChartsheet(&sheetRels, partName, &carrier)
+			if err != nil {
+				return parts, err
+			}
+			if len(sheetRels.Relationships) > 0 {
+				relsParts[relsNameForPart(partName)] = &sheetRels
+			}
+			sheetIndex++
+			continue
+		}
+		xSheet := sheet.makeXLSXSheet(refTable, f.styles)
 		sheetPath := fmt.Sprintf("worksheets/sheet%d.xml", sheetIndex)
 		partName := "xl/" + sheetPath
 		types.Overrides = append(
@@ -284,13 +498,132 @@ func (f *File) MarshallParts() (map[string]string, error) {
 			SheetId: sheetId,
 			Id:      rId,
 			State:   "visible"}
+		xSheet.ConditionalFormatting, xSheet.ExtLst, err = sheet.makeXLSXConditionalFormatting(f.styles)
+		if err != nil {
+			return parts, err
+		}
+		sheetRels := xlsxWorkbookRels{}
+		var xComments *xlsxComments
+		var vml string
+		xComments, vml, vmlIDBlock = sheet.makeXLSXComments(vmlIDBlock)
+		if xComments != nil {
+			commentsPath := fmt.Sprintf("comments%d.xml", sheetIndex)
+			vmlPath := fmt.Sprintf("drawings/vmlDrawing%d.vml", sheetIndex)
+			sheetRels.addRelationship(relationshipTypeComments, "../"+commentsPath, "")
+			xSheet.LegacyDrawing = &xlsxLegacyDrawing{
+				Id: sheetRels.addRelationship(relationshipTypeVMLDrawing, "../"+vmlPath, ""),
+			}
+			parts["xl/"+commentsPath], err = marshal(xComments)
+			if err != nil {
+				return parts, err
+			}
+			parts["xl/"+vmlPath] = vml
+			types.Overrides = append(
+				types.Overrides,
+				xlsxOverride{
+					PartName:    "/xl/" + commentsPath,
+					ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.comments+xml"})
+			types.addDefault("vml", "application/vnd.openxmlformats-officedocument.vmlDrawing")
+		}
+		if sheet.drawing != nil && !sheet.drawing.changed(sheet) {
+			// The drawing is written back as it was read.
+			rel := sheet.drawing.rel
+			ids := carrier.addRelationships(&sheetRels, partName, []xlsxWorkbookRelation{rel})
+			xSheet.Drawing = &xlsxDrawing{Id: ids[rel.Id]}
+		} else {
+			drawingPath := fmt.Sprintf("drawings/drawing%d.xml", sheetIndex)
+			drawingRels := &xlsxWorkbookRels{}
+			drawing, err := sheet.makeXLSXDrawing(drawingRels, "xl/"+drawingPath, drawings)
+			if err != nil {
+				return parts, err
+			}
+			if drawing != "" {
+				xSheet.Drawing = &xlsxDrawing{
+					Id: sheetRels.addRelationship(relationshipTypeDrawing, "../"+drawingPath, ""),
+				}
+				parts["xl/"+drawingPath] = drawing
+				relsParts[relsNameForPart("xl/"+drawingPath)] = drawingRels
+				types.Overrides = append(
+					types.Overrides,
+					xlsxOverride{
+						PartName:    "/xl/" + drawingPath,
+						ContentType: "application/vnd.openxmlformats-officedocument.drawing+xml"})
+			}
+		}
+		xSheet.Hyperlinks = sheet.makeXLSXHyperlinks(&sheetRels)
+		for _, table := range sheet.Tables {
+			if tableNames[strings.ToLower(table.Name)] {
+				return parts, fmt.Errorf("duplicate table name %q", table.Name)
+			}
+			tableNames[strings.ToLower(table.Name)] = true
+			xTable, err := table.makeXLSXTable(tableID)
+			if err != nil {
+				return parts, err
+			}
+			tablePath := fmt.Sprintf("tables/table%d.xml", tableID)
+			parts["xl/"+tablePath], err = marshal(xTable)
+			if err != nil {
+				return parts, err
+			}
+			if xSheet.TableParts == nil {
+				xSheet.TableParts = &xlsxTableParts{}
+			}
+			xSheet.TableParts.TablePart = append(xSheet.TableParts.TablePart, xlsxTablePart{
+				Id: sheetRels.addRelationship(relationshipTypeTable, "../"+tablePath, ""),
+			})
+			xSheet.TableParts.Count++
+			types.Overrides = append(
+				types.Overrides,
+				xlsxOverride{
+					PartName:    "/xl/" + tablePath,
+					ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.table+xml"})
+			tableID++
+		}
+		ids := carrier.addRelationships(&sheetRels, partName, sheet.preservedRels)
+		xSheet.remapRawRelationships(ids)
+		if sheet.unmodelled != nil {
+			dataBarIDs, err := sheet.unmodelled.x14DataBarIDs()
+			if err != nil {
+				return parts, err
+			}
+			xSheet.ExtLst, err = mergeWorksheetExtLst(sheet.unmodelled.ExtLst, xSheet.ExtLst, ids, dataBarIDs)
+			if err != nil {
+				return parts, err
+			}
+		}
+		if len(sheetRels.Relationships) > 0 {
+			relsParts[relsNameForPart(partName)] = &sheetRels
+		}
 		parts[partName], err = marshal(xSheet)
 		if err != nil {
 			return parts, err
 		}
+		parts[partName] = replaceWorksheetRelationshipsNameSpace(parts[partName])
+		if sheet.unmodelled != nil {
+			parts[partName] = addWorksheetRootAttrs(parts[partName], sheet.unmodelled.Attrs)
+		}
 		sheetIndex++
 	}
 
+	xWRel := workbookRels.MakeXLSXWorkbookRels()
+	if f.vbaProject != nil {
+		xWRel.addRelationship(relationshipTypeVBAProject, "vbaProject.bin", "")
+		parts["xl/vbaProject.bin"] = string(f.vbaProject)
+		types.makeMacroEnabled()
+	}
+	if f.preserved != nil {
+		ids := carrier.addRelationships(&xWRel, "xl/workbook.xml", f.preserved.workbook)
+		if raw := f.preserved.externalReferences; raw != nil {
+			content, _ := remapRelationshipIDs(raw.Content, ids)
+			workbook.ExternalReferences = &xlsxInnerXML{Content: content}
+		}
+		if raw := f.preserved.pivotCaches; raw != nil {
+			content, _ := remapRelationshipIDs(raw.Content, ids)
+			workbook.PivotCaches = &xlsxInnerXML{Content: content}
+		}
+	}
+	relsParts["xl/_rels/workbook.xml.rels"] = &xWRel
+
 	workbookMarshal, err := marshal(workbook)
 	if err != nil {
 		return parts, err
@@ -301,10 +634,33 @@ func (f *File) MarshallParts() (map[string]string, error) {
 		return parts, err
 	}
 
+	// The relationships of the package are the template's, unless
+	// there are custom properties or preserved parts to add to them.
 	parts["_rels/.rels"] = TEMPLATE__RELS_DOT_RELS
-	parts["docProps/app.xml"] = TEMPLATE_DOCPROPS_APP
-	// TODO - do this properly, modification and revision information
-	parts["docProps/core.xml"] = TEMPLATE_DOCPROPS_CORE
+	hasPreservedRoot := f.preserved != nil && len(f.preserved.root) > 0
+	if len(f.CustomProperties) > 0 || hasPreservedRoot {
+		rootRels := &xlsxWorkbookRels{}
+		if err = xml.Unmarshal([]byte(TEMPLATE__RELS_DOT_RELS), rootRels); err != nil {
+			return parts, err
+		}
+		if len(f.CustomProperties) > 0 {
+			parts["docProps/custom.xml"], err = makeCustomXML(f.CustomProperties)
+			if err != nil {
+				return parts, err
+			}
+			rootRels.addRelationship(relationshipTypeCustomProperties, "docProps/custom.xml", "")
+			types.Overrides = append(types.Overrides, xlsxOverride{
+				PartName:    "/docProps/custom.xml",
+				ContentType: "application/vnd.openxmlformats-officedocument.custom-properties+xml",
+			})
+		}
+		if hasPreservedRoot {
+			carrier.addRelationships(rootRels, "", f.preserved.root)
+		}
+		relsParts["_rels/.rels"] = rootRels
+	}
+	parts["docProps/app.xml"] = f.Properties.makeAppXML(f.Sheets)
+	parts["docProps/core.xml"] = f.Properties.makeCoreXML()
 	parts["xl/theme/theme1.xml"] = TEMPLATE_XL_THEME_THEME
 
 	xSST := refTable.makeXLSXSST()
@@ -313,19 +669,22 @@ func (f *File) MarshallParts() (map[string]string, error) {
 		return parts, err
 	}
 
-	xWRel := workbookRels.MakeXLSXWorkbookRels()
-
-	parts["xl/_rels/workbook.xml.rels"], err = marshal(xWRel)
+	parts["xl/styles.xml"], err = f.styles.Marshal()
 	if err != nil {
 		return parts, err
 	}
 
-	parts["[Content_Types].xml"], err = marshal(types)
-	if err != nil {
+	if err = carrier.finish(parts, &types); err != nil {
 		return parts, err
 	}
+	for name, rels := range relsParts {
+		parts[name], err = marshal(rels)
+		if err != nil {
+			return parts, err
+		}
+	}
 
-	parts["xl/styles.xml"], err = f.styles.Marshal()
+	parts["[Content_Types].xml"], err = marshal(types)
 	if err != nil {
 		return parts, err
 	}
@@ -1,6 +1,7 @@
 package xlsx
 
 import (
+	"bytes"
 	"encoding/xml"
 	"io"
 	"os"
@@ -298,6 +299,62 @@ func (l *FileSuite) TestGetStyleFromZipFile(c *C) {
 	c.Assert(cellBar.GetStyle().Fill.BgColor, Equals, "")
 }
 
+// OpenFileWithOptions only parses the sheets that were asked for.
+func (l *FileSuite) TestOpenFileWithOptionsSheets(c *C) {
+	xlsxFile, err := OpenFileWithOptions("./testdocs/testfile.xlsx", OpenOptions{Sheets: []string{"Tabelle1"}})
+	c.Assert(err, IsNil)
+	c.Assert(len(xlsxFile.Sheets), Equals, 1)
+	sheet, ok := xlsxFile.Sheet["Tabelle1"]
+	c.Assert(ok, Equals, true)
+	c.Assert(sheet.Rows[0].Cells[0].Value, Equals, "Foo")
+
+	_, err = OpenFileWithOptions("./testdocs/testfile.xlsx", OpenOptions{Sheets: []string{"NoSuchSheet"}})
+	c.Assert(err, NotNil)
+}
+
+// OpenFileWithOptions can restrict the cells read to a range of columns.
+func (l *FileSuite) TestOpenFileWithOptionsColumns(c *C) {
+	xlsxFile, err := OpenFileWithOptions("./testdocs/testfile.xlsx", OpenOptions{Columns: "B"})
+	c.Assert(err, IsNil)
+	sheet := xlsxFile.Sheet["Tabelle1"]
+	c.Assert(len(sheet.Rows), Equals, 2)
+	row := sheet.Rows[0]
+	c.Assert(len(row.Cells), Equals, 2)
+	c.Assert(row.Cells[0].Value, Equals, "")
+	c.Assert(row.Cells[1].Value, Equals, "Bar")
+
+	_, err = OpenFileWithOptions("./testdocs/testfile.xlsx", OpenOptions{Columns: "1:2"})
+	c.Assert(err, NotNil)
+}
+
+// OpenFileWithOptions can skip styles and data validations.
+func (l *FileSuite) TestOpenFileWithOptionsSkip(c *C) {
+	f := NewFile()
+	sheet, _ := f.AddSheet("Sheet1")
+	cell := sheet.Cell(0, 0)
+	cell.SetString("Foo")
+	cell.GetStyle().Font.Bold = true
+	dd := NewXlsxCellDataValidation(true)
+	c.Assert(dd.SetDropList([]string{"a", "b"}), IsNil)
+	cell.SetDataValidation(dd)
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), IsNil)
+
+	xlsxFile, err := OpenBinaryWithOptions(buf.Bytes(), OpenOptions{})
+	c.Assert(err, IsNil)
+	cell = xlsxFile.Sheets[0].Cell(0, 0)
+	c.Assert(cell.GetStyle().Font.Bold, Equals, true)
+	c.Assert(cell.DataValidation, NotNil)
+
+	xlsxFile, err = OpenBinaryWithOptions(buf.Bytes(), OpenOptions{SkipStyles: true, SkipDataValidations: true})
+	c.Assert(err, IsNil)
+	c.Assert(xlsxFile.styles, IsNil)
+	cell = xlsxFile.Sheets[0].Cell(0, 0)
+	c.Assert(cell.Value, Equals, "Foo")
+	c.Assert(cell.GetStyle().Font.Bold, Equals, false)
+	c.Assert(cell.DataValidation, IsNil)
+}
+
 // Test we can create a File object from scratch
 func (l *FileSuite) TestCreateFile(c *C) {
 	var xlsxFile *File
@@ -483,6 +540,8 @@ func (l *FileSuite) TestMarshalFile(c *C) {
 <Properties xmlns="http://schemas.openxmlformats.org/officeDocument/2006/extended-properties" xmlns:vt="http://schemas.openxmlformats.org/officeDocument/2006/docPropsVTypes">
   <TotalTime>0</TotalTime>
   <Application>Go XLSX</Application>
+  <HeadingPairs><vt:vector size="2" baseType="variant"><vt:variant><vt:lpstr>Worksheets</vt:lpstr></vt:variant><vt:variant><vt:i4>2</vt:i4></vt:variant></vt:vector></HeadingPairs>
+  <TitlesOfParts><vt:vector size="2" baseType="lpstr"><vt:lpstr>MySheet</vt:lpstr><vt:lpstr>AnotherSheet</vt:lpstr></vt:vector></TitlesOfParts>
 </Properties>`
 	c.Assert(parts["docProps/app.xml"], Equals, expectedApp)
 
@@ -0,0 +1,1020 @@
+package xlsx
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// excel2006MaxColCount is the number of columns in a worksheet, as
+// Excel2006MaxRowCount is the number of rows.
+const excel2006MaxColCount = 16384
+
+// These are the error values of formulas.
+const (
+	formulaErrorNull  = "#NULL!"
+	formulaErrorDiv0  = "#DIV/0!"
+	formulaErrorValue = "#VALUE!"
+	formulaErrorRef   = "#REF!"
+	formulaErrorName  = "#NAME?"
+	formulaErrorNum   = "#NUM!"
+	formulaErrorNA    = "#N/A"
+)
+
+var formulaErrors = []string{
+	formulaErrorNull, formulaErrorDiv0, formulaErrorValue, formulaErrorRef,
+	formulaErrorName, formulaErrorNum, formulaErrorNA, "#GETTING_DATA",
+}
+
+// FormulaTokenType is the kind of a FormulaToken.
+type FormulaTokenType int
+
+// These are the kinds of token that a formula is made of.
+const (
+	FormulaTokenNumber FormulaTokenType = iota
+	FormulaTokenText
+	FormulaTokenBool
+	// FormulaTokenError is an error value such as "#N/A", which may
+	// be qualified with a sheet, as in "Sheet1!#REF!".
+	FormulaTokenError
+	// FormulaTokenRef is a reference to a cell or a range of cells,
+	// such as "A1", "'My Sheet'!$A$1:$B$2", "A:C" or "1:3".
+	FormulaTokenRef
+	// FormulaTokenStructuredRef is a reference to the parts of a
+	// table, such as "Table1[Sales]" or "[@Sales]".
+	FormulaTokenStructuredRef
+	// FormulaTokenName is a defined name, which may be qualified
+	// with a sheet.
+	FormulaTokenName
+	// FormulaTokenFunction is the name of a function along with the
+	// parenthesis that opens its arguments, which isn't part of its
+	// Text.
+	FormulaTokenFunction
+	// FormulaTokenOperator is an operator, which may be the " " that
+	// intersects the references on either side of it.
+	FormulaTokenOperator
+	FormulaTokenOpen
+	FormulaTokenClose
+	// FormulaTokenSeparator separates the arguments of a function,
+	// and the values in a row of an array constant.
+	FormulaTokenSeparator
+	FormulaTokenArrayOpen
+	FormulaTokenArrayClose
+	// FormulaTokenArrayRowSeparator separates the rows of an array
+	// constant.
+	FormulaTokenArrayRowSeparator
+)
+
+// FormulaToken is one of the tokens of a formula.  Text is the text of
+// the token as it appears in the formula, except for text, whose
+// quotes are removed.
+type FormulaToken struct {
+	Type FormulaTokenType
+	Text string
+}
+
+var (
+	formulaSheetRegexp  = regexp.MustCompile(`^(?:'(?:[^']|'')+'|(?:\[[0-9]+\])?[\p{L}_\\][\p{L}\p{N}_.]*(?::[\p{L}_\\][\p{L}\p{N}_.]*)?|\[[0-9]+\])!`)
+	formulaRefRegexp    = regexp.MustCompile(`^(?:\$?[A-Za-z]{1,3}\$?[0-9]+(?::\$?[A-Za-z]{1,3}\$?[0-9]+)?|\$?[A-Za-z]{1,3}:\$?[A-Za-z]{1,3}|\$?[0-9]+:\$?[0-9]+)`)
+	formulaNameRegexp   = regexp.MustCompile(`^[\p{L}_\\][\p{L}\p{N}_.\\?]*`)
+	formulaNumberRegexp = regexp.MustCompile(`^(?:[0-9]+\.?[0-9]*|\.[0-9]+)(?:[eE][+-]?[0-9]+)?`)
+)
+
+// formulaPunctuation maps the characters that are tokens by themselves
+// to their kind.  FormulaTokenNumber, the zero kind, isn't one of them.
+var formulaPunctuation = map[byte]FormulaTokenType{
+	'(': FormulaTokenOpen,
+	')': FormulaTokenClose,
+	',': FormulaTokenSeparator,
+	'{': FormulaTokenArrayOpen,
+	'}': FormulaTokenArrayClose,
+	';': FormulaTokenArrayRowSeparator,
+}
+
+// TokenizeFormula splits a formula, with or without its leading "=",
+// into tokens.  Whitespace between the tokens is dropped, except for a
+// space between two references, which is the operator that intersects
+// them.
+func TokenizeFormula(formula string) ([]FormulaToken, error) {
+	var tokens []FormulaToken
+	spaced := false
+	add := func(typ FormulaTokenType, text string) {
+		if spaced && len(tokens) > 0 && endsFormulaReference(tokens[len(tokens)-1].Type) && startsFormulaReference(typ) {
+			tokens = append(tokens, FormulaToken{FormulaTokenOperator, " "})
+		}
+		spaced = false
+		tokens = append(tokens, FormulaToken{typ, text})
+	}
+	s := strings.TrimPrefix(strings.TrimSpace(formula), "=")
+	for len(s) > 0 {
+		c := s[0]
+		n := 0
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			spaced = spaced || c == ' '
+			n = 1
+		case c == '"':
+			text, length, err := readFormulaText(s)
+			if err != nil {
+				return nil, err
+			}
+			add(FormulaTokenText, text)
+			n = length
+		case c == '#':
+			code := formulaErrorAt(s)
+			if code == "" {
+				return nil, fmt.Errorf("invalid error value in formula %q", formula)
+			}
+			add(FormulaTokenError, code)
+			n = len(code)
+		case c == '[' && formulaSheetRegexp.FindString(s) == "":
+			n = formulaBracketsLength(s)
+			if n == 0 {
+				return nil, fmt.Errorf("unterminated structured reference in formula %q", formula)
+			}
+			add(FormulaTokenStructuredRef, s[:n])
+		case formulaPunctuation[c] != 0:
+			n = 1
+			add(formulaPunctuation[c], s[:1])
+		}
+		if n > 0 {
+			s = s[n:]
+			continue
+		}
+
+		if sheet := formulaSheetRegexp.FindString(s); sheet != "" {
+			rest := s[len(sheet):]
+			if ref := formulaRefRegexp.FindString(rest); ref != "" && !continuesFormulaName(rest[len(ref):]) {
+				add(FormulaTokenRef, sheet+ref)
+				s = rest[len(ref):]
+				continue
+			}
+			if strings.HasPrefix(strings.ToUpper(rest), formulaErrorRef) {
+				add(FormulaTokenError, sheet+formulaErrorRef)
+				s = rest[len(formulaErrorRef):]
+				continue
+			}
+			if name := formulaNameRegexp.FindString(rest); name != "" && !strings.HasPrefix(rest[len(name):], "(") {
+				add(FormulaTokenName, sheet+name)
+				s = rest[len(name):]
+				continue
+			}
+			return nil, fmt.Errorf("unexpected %q in formula %q", sheet, formula)
+		}
+		if ref := formulaRefRegexp.FindString(s); ref != "" && !continuesFormulaName(s[len(ref):]) {
+			add(FormulaTokenRef, ref)
+			s = s[len(ref):]
+			continue
+		}
+		if number := formulaNumberRegexp.FindString(s); number != "" {
+			add(FormulaTokenNumber, number)
+			s = s[len(number):]
+			continue
+		}
+		if name := formulaNameRegexp.FindString(s); name != "" {
+			s = s[len(name):]
+			switch {
+			case strings.HasPrefix(s, "("):
+				add(FormulaTokenFunction, name)
+				s = s[1:]
+			case strings.HasPrefix(s, "["):
+				n := formulaBracketsLength(s)
+				if n == 0 {
+					return nil, fmt.Errorf("unterminated structured reference in formula %q", formula)
+				}
+				add(FormulaTokenStructuredRef, name+s[:n])
+				s = s[n:]
+			case strings.EqualFold(name, "TRUE") || strings.EqualFold(name, "FALSE"):
+				add(FormulaTokenBool, strings.ToUpper(name))
+			default:
+				add(FormulaTokenName, name)
+			}
+			continue
+		}
+		if len(s) > 1 && (s[:2] == "<=" || s[:2] == ">=" || s[:2] == "<>") {
+			add(FormulaTokenOperator, s[:2])
+			s = s[2:]
+			continue
+		}
+		if strings.IndexByte("+-*/^&=<>%:", c) >= 0 {
+			add(FormulaTokenOperator, s[:1])
+			s = s[1:]
+			continue
+		}
+		return nil, fmt.Errorf("unexpected %q in formula %q", s[:1], formula)
+	}
+	return tokens, nil
+}
+
+// endsFormulaReference reports whether a token of the type can end a
+// reference, and startsFormulaReference whether one can start it, for
+// a space between them to be the intersection operator.
+func endsFormulaReference(typ FormulaTokenType) bool {
+	switch typ {
+	case FormulaTokenRef, FormulaTokenStructuredRef, FormulaTokenName, FormulaTokenClose:
+		return true
+	}
+	return false
+}
+
+func startsFormulaReference(typ FormulaTokenType) bool {
+	switch typ {
+	case FormulaTokenRef, FormulaTokenStructuredRef, FormulaTokenName, FormulaTokenFunction, FormulaTokenOpen:
+		return true
+	}
+	return false
+}
+
+// formulaErrorAt returns the error value at the start of s, or "".
+func formulaErrorAt(s string) string {
+	upper := strings.ToUpper(s)
+	for _, code := range formulaErrors {
+		if strings.HasPrefix(upper, code) {
+			return code
+		}
+	}
+	return ""
+}
+
+// readFormulaText reads the quoted string at the start of s, and
+// returns it along with the number of bytes it took.
+func readFormulaText(s string) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		if s[i] != '"' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == '"' {
+			b.WriteByte('"')
+			i++
+			continue
+		}
+		return b.String(), i + 1, nil
+	}
+	return "", 0, fmt.Errorf("unterminated string in formula %q", s)
+}
+
+// formulaBracketsLength returns the length of the brackets at the
+// start of s, along with the brackets nested within them, or 0 if they
+// aren't closed.  A "'" escapes the bracket, "#" or "'" after it.
+func formulaBracketsLength(s string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\'':
+			if i+1 < len(s) && strings.IndexByte("[]#'", s[i+1]) >= 0 {
+				i++
+			}
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return 0
+}
+
+// continuesFormulaName reports whether s carries on the name or
+// function whose start looked like a reference, as in "LOG10(".
+func continuesFormulaName(s string) bool {
+	if s == "" {
+		return false
+	}
+	r := []rune(s)[0]
+	return r == '(' || r == '[' || r == '_' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// FormulaNodeType is the kind of a FormulaNode.
+type FormulaNodeType int
+
+// These are the kinds of node that a parsed formula is made of.
+const (
+	FormulaNodeNumber FormulaNodeType = iota
+	FormulaNodeText
+	FormulaNodeBool
+	FormulaNodeError
+	FormulaNodeRef
+	FormulaNodeStructuredRef
+	FormulaNodeName
+	FormulaNodeFunction
+	// FormulaNodeArray is an array constant such as {1,2;3,4}.
+	FormulaNodeArray
+	// FormulaNodeParen is an expression in parentheses, which is
+	// its only argument.
+	FormulaNodeParen
+	// FormulaNodeUnary is a prefix "-" or "+" applied to its only
+	// argument, and FormulaNodePercent the postfix "%".
+	FormulaNodeUnary
+	FormulaNodePercent
+	FormulaNodeBinary
+	// FormulaNodeEmpty is an argument that has been left out, as
+	// the second one in IF(A1,,1).
+	FormulaNodeEmpty
+)
+
+// FormulaNode is a node of a parsed formula.
+type FormulaNode struct {
+	Type FormulaNodeType
+	// Text is the number, text, TRUE or FALSE, or error value of a
+	// literal, the operator of an operation, or the name of a
+	// function or defined name.
+	Text string
+	// Sheet is the sheet that a reference, name or #REF! error is
+	// qualified with, or "" for none.  LastSheet is the last sheet of
+	// a 3-D reference, which is to the same cells on each of the
+	// sheets from Sheet to LastSheet, as in "Sheet1:Sheet3!A1".
+	Sheet, LastSheet string
+	// Workbook is the number of the external workbook that a
+	// reference, name or #REF! error is to, as the 1 of
+	// "[1]Sheet1!A1", or "" for the workbook of the formula.
+	Workbook string
+	// Ref is the range of cells of a FormulaNodeRef, and
+	// StructuredRef the parts of the table of a
+	// FormulaNodeStructuredRef.
+	Ref           FormulaRef
+	StructuredRef FormulaStructuredRef
+	// Args are the arguments of a function, or the operands of an
+	// operation.
+	Args []*FormulaNode
+	// Rows are the rows of the values of an array constant.
+	Rows [][]*FormulaNode
+}
+
+// FormulaRef is a reference to a cell or a range of cells, with zero
+// based coordinates.  The Abs fields are set for coordinates that are
+// absolute, as the row of "A$1" is.
+type FormulaRef struct {
+	MinCol, MinRow, MaxCol, MaxRow             int
+	AbsMinCol, AbsMinRow, AbsMaxCol, AbsMaxRow bool
+	// WholeColumns is set for a range of columns such as "A:C", and
+	// WholeRows for a range of rows such as "1:3".  They span all of
+	// the rows or columns of a sheet.
+	WholeColumns, WholeRows bool
+}
+
+// FormulaStructuredRef is a reference to the parts of a table, such as
+// "Table1[[#Headers],[Q1]:[Q4]]".
+type FormulaStructuredRef struct {
+	// Table is the name of the table, or "" for the table that the
+	// formula is in.
+	Table string
+	// Items are the special items of the reference, such as
+	// "#Headers", "#Data", "#Totals", "#All" and "#This Row", which
+	// is written "@" for short.  There are none for the data of the
+	// table.
+	Items []string
+	// FirstColumn and LastColumn are the names of the columns of the
+	// reference, which are "" for all of them.  LastColumn is the
+	// same as FirstColumn for a single column.
+	FirstColumn, LastColumn string
+}
+
+// ParseFormulaRef parses a reference to cells such as "A1",
+// "$A$1:$B$2", "A:C" or "1:3", without a sheet.
+func ParseFormulaRef(text string) (FormulaRef, error) {
+	var ref FormulaRef
+	parts := strings.SplitN(text, cellRangeChar, 2)
+	single := len(parts) == 1
+	if single {
+		parts = append(parts, parts[0])
+	}
+	parsePart := func(part string) (col, row int, absCol, absRow bool, err error) {
+		col, row = -1, -1
+		if strings.HasPrefix(part, fixedCellRefChar) {
+			part = part[1:]
+			absCol = true
+		}
+		letters := strings.IndexFunc(part, func(r rune) bool { return !unicode.IsLetter(r) })
+		if letters < 0 {
+			letters = len(part)
+		}
+		if letters > 0 {
+			col = ColLettersToIndex(strings.ToUpper(part[:letters]))
+			part = part[letters:]
+		} else if absCol {
+			absRow, absCol = true, false
+		}
+		if strings.HasPrefix(part, fixedCellRefChar) {
+			part = part[1:]
+			absRow = true
+		}
+		if part != "" {
+			if row, err = strconv.Atoi(part); err != nil {
+				return
+			}
+			row--
+		}
+		return
+	}
+	var err error
+	var minCol, minRow, maxCol, maxRow int
+	var absMinCol, absMinRow, absMaxCol, absMaxRow bool
+	if minCol, minRow, absMinCol, absMinRow, err = parsePart(parts[0]); err != nil {
+		return ref, fmt.Errorf("invalid reference %q", text)
+	}
+	if maxCol, maxRow, absMaxCol, absMaxRow, err = parsePart(parts[1]); err != nil {
+		return ref, fmt.Errorf("invalid reference %q", text)
+	}
+	switch {
+	case single && (minCol < 0 || minRow < 0):
+		return ref, fmt.Errorf("invalid reference %q", text)
+	case minRow < 0 && maxRow < 0 && minCol >= 0 && maxCol >= 0:
+		ref.WholeColumns = true
+		minRow, maxRow = 0, Excel2006MaxRowCount-1
+	case minCol < 0 && maxCol < 0 && minRow >= 0 && maxRow >= 0:
+		ref.WholeRows = true
+		minCol, maxCol = 0, excel2006MaxColCount-1
+	case minCol < 0 || maxCol < 0 || minRow < 0 || maxRow < 0:
+		return ref, fmt.Errorf("invalid reference %q", text)
+	}
+	if minCol > maxCol {
+		minCol, maxCol, absMinCol, absMaxCol = maxCol, minCol, absMaxCol, absMinCol
+	}
+	if minRow > maxRow {
+		minRow, maxRow, absMinRow, absMaxRow = maxRow, minRow, absMaxRow, absMinRow
+	}
+	if maxCol >= excel2006MaxColCount || maxRow >= Excel2006MaxRowCount {
+		return ref, fmt.Errorf("reference %q is outside of the sheet", text)
+	}
+	ref.MinCol, ref.MinRow, ref.MaxCol, ref.MaxRow = minCol, minRow, maxCol, maxRow
+	ref.AbsMinCol, ref.AbsMinRow, ref.AbsMaxCol, ref.AbsMaxRow = absMinCol, absMinRow, absMaxCol, absMaxRow
+	return ref, nil
+}
+
+// String returns the reference as it is written in a formula.
+func (r FormulaRef) String() string {
+	col := func(col int, abs bool) string {
+		if abs {
+			return fixedCellRefChar + ColIndexToLetters(col)
+		}
+		return ColIndexToLetters(col)
+	}
+	row := func(row int, abs bool) string {
+		if abs {
+			return fixedCellRefChar + RowIndexToString(row)
+		}
+		return RowIndexToString(row)
+	}
+	switch {
+	case r.WholeColumns:
+		return col(r.MinCol, r.AbsMinCol) + cellRangeChar + col(r.MaxCol, r.AbsMaxCol)
+	case r.WholeRows:
+		return row(r.MinRow, r.AbsMinRow) + cellRangeChar + row(r.MaxRow, r.AbsMaxRow)
+	}
+	first := col(r.MinCol, r.AbsMinCol) + row(r.MinRow, r.AbsMinRow)
+	last := col(r.MaxCol, r.AbsMaxCol) + row(r.MaxRow, r.AbsMaxRow)
+	if first == last {
+		return first
+	}
+	return first + cellRangeChar + last
+}
+
+// parseStructuredRef parses a structured reference such as
+// "Table1[[#This Row],[Sales]]".
+func parseStructuredRef(text string) (FormulaStructuredRef, error) {
+	var ref FormulaStructuredRef
+	open := strings.IndexByte(text, '[')
+	ref.Table = text[:open]
+	inner := text[open+1 : len(text)-1]
+	invalid := fmt.Errorf("invalid structured reference %q", text)
+	addColumn := func(name string, last bool) {
+		if last {
+			ref.LastColumn = name
+		} else {
+			ref.FirstColumn, ref.LastColumn = name, name
+		}
+	}
+	// simple parses what is inside a single pair of brackets.
+	simple := func(s string, last bool) error {
+		s = strings.TrimSpace(s)
+		switch {
+		case strings.HasPrefix(s, "#"):
+			if last {
+				return invalid
+			}
+			ref.Items = append(ref.Items, s)
+		case strings.HasPrefix(s, "@"):
+			ref.Items = append(ref.Items, "#This Row")
+			s = strings.TrimSpace(s[1:])
+			if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+				s = s[1 : len(s)-1]
+			}
+			if s != "" {
+				addColumn(unescapeTableColumnName(s), last)
+			}
+		case s != "":
+			addColumn(unescapeTableColumnName(s), last)
+		}
+		return nil
+	}
+	if !strings.HasPrefix(strings.TrimSpace(inner), "[") {
+		return ref, simple(inner, false)
+	}
+	s := strings.TrimSpace(inner)
+	afterColon := false
+	for s != "" {
+		n := formulaBracketsLength(s)
+		if n == 0 {
+			return ref, invalid
+		}
+		if err := simple(s[1:n-1], afterColon); err != nil {
+			return ref, err
+		}
+		s = strings.TrimSpace(s[n:])
+		afterColon = false
+		switch {
+		case s == "":
+		case s[0] == ',':
+			s = strings.TrimSpace(s[1:])
+		case s[0] == ':':
+			afterColon = true
+			s = strings.TrimSpace(s[1:])
+		default:
+			return ref, invalid
+		}
+	}
+	return ref, nil
+}
+
+func unescapeTableColumnName(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\'' && i+1 < len(s) && strings.IndexByte("[]#'", s[i+1]) >= 0 {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// String returns the structured reference as it is written in a
+// formula in a file, where "@" is written "[#This Row]".
+func (r FormulaStructuredRef) String() string {
+	columns := ""
+	if r.FirstColumn != "" {
+		columns = "[" + escapeTableColumnName(r.FirstColumn) + "]"
+		if r.LastColumn != "" && r.LastColumn != r.FirstColumn {
+			columns += cellRangeChar + "[" + escapeTableColumnName(r.LastColumn) + "]"
+		}
+	}
+	if len(r.Items) == 0 && (r.LastColumn == "" || r.LastColumn == r.FirstColumn) {
+		return r.Table + "[" + strings.Trim(columns, "[]") + "]"
+	}
+	parts := make([]string, 0, len(r.Items)+1)
+	for _, item := range r.Items {
+		parts = append(parts, "["+item+"]")
+	}
+	if columns != "" {
+		parts = append(parts, columns)
+	}
+	return r.Table + "[" + strings.Join(parts, ",") + "]"
+}
+
+// ParseFormula parses a formula, with or without its leading "=", into
+// a tree of nodes.  It returns an error if the formula isn't valid.
+func ParseFormula(formula string) (*FormulaNode, error) {
+	return parseFormula(formula, false)
+}
+
+// parseFormula parses a formula in which, when union is set, the ","
+// that joins references into a union can also be outside of
+// parentheses, as it is in defined names such as print titles.
+func parseFormula(formula string, union bool) (*FormulaNode, error) {
+	tokens, err := TokenizeFormula(formula)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty formula %q", formula)
+	}
+	p := &formulaParser{formula: formula, tokens: tokens}
+	parse := p.parseComparison
+	if union {
+		parse = p.parseUnion
+	}
+	node, err := parse()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, p.unexpected()
+	}
+	return node, nil
+}
+
+// String returns the formula that the node is parsed from, without its
+// leading "=" or any whitespace.
+func (n *FormulaNode) String() string {
+	qualify := func(s string) string {
+		if n.Sheet == "" && n.Workbook == "" {
+			return s
+		}
+		return formulaSheetPrefix(n.Workbook, n.Sheet, n.LastSheet) + s
+	}
+	join := func(nodes []*FormulaNode, sep string) string {
+		parts := make([]string, len(nodes))
+		for i, node := range nodes {
+			parts[i] = node.String()
+		}
+		return strings.Join(parts, sep)
+	}
+	switch n.Type {
+	case FormulaNodeText:
+		return `"` + strings.Replace(n.Text, `"`, `""`, -1) + `"`
+	case FormulaNodeError, FormulaNodeName:
+		return qualify(n.Text)
+	case FormulaNodeRef:
+		return qualify(n.Ref.String())
+	case FormulaNodeStructuredRef:
+		return n.StructuredRef.String()
+	case FormulaNodeFunction:
+		return n.Text + "(" + join(n.Args, ",") + ")"
+	case FormulaNodeArray:
+		rows := make([]string, len(n.Rows))
+		for i, row := range n.Rows {
+			rows[i] = join(row, ",")
+		}
+		return "{" + strings.Join(rows, ";") + "}"
+	case FormulaNodeParen:
+		return "(" + n.Args[0].String() + ")"
+	case FormulaNodeUnary:
+		return n.Text + n.Args[0].String()
+	case FormulaNodePercent:
+		return n.Args[0].String() + "%"
+	case FormulaNodeBinary:
+		return n.Args[0].String() + n.Text + n.Args[1].String()
+	case FormulaNodeEmpty:
+		return ""
+	}
+	return n.Text
+}
+
+// Walk calls fn with the node and then, for as long as fn returns
+// true, with each of the nodes within it.
+func (n *FormulaNode) Walk(fn func(node *FormulaNode) bool) {
+	if !fn(n) {
+		return
+	}
+	for _, arg := range n.Args {
+		arg.Walk(fn)
+	}
+	for _, row := range n.Rows {
+		for _, value := range row {
+			value.Walk(fn)
+		}
+	}
+}
+
+// References returns the nodes of the formula that refer to cells,
+// tables or defined names, in the order that they appear.
+func (n *FormulaNode) References() []*FormulaNode {
+	var refs []*FormulaNode
+	n.Walk(func(node *FormulaNode) bool {
+		switch node.Type {
+		case FormulaNodeRef, FormulaNodeStructuredRef, FormulaNodeName:
+			refs = append(refs, node)
+		}
+		return true
+	})
+	return refs
+}
+
+// quoteSheetName returns the name of a sheet as it is written in a
+// reference, quoted when it has to be.
+func quoteSheetName(name string) string {
+	if formulaNameRegexp.FindString(name) == name && formulaRefRegexp.FindString(name) != name &&
+		!strings.EqualFold(name, "TRUE") && !strings.EqualFold(name, "FALSE") {
+		return name
+	}
+	return "'" + strings.Replace(name, "'", "''", -1) + "'"
+}
+
+// formulaSheetPrefix returns the workbook and sheets that qualify a
+// reference, as they are written before its "!".  The sheets are
+// quoted, along with the workbook, when either of them has to be.
+func formulaSheetPrefix(workbook, sheet, lastSheet string) string {
+	prefix := sheet
+	quote := sheet != "" && quoteSheetName(sheet) != sheet
+	if lastSheet != "" {
+		prefix += cellRangeChar + lastSheet
+		quote = quote || quoteSheetName(lastSheet) != lastSheet
+	}
+	if workbook != "" {
+		prefix = "[" + workbook + "]" + prefix
+	}
+	if quote {
+		prefix = "'" + strings.Replace(prefix, "'", "''", -1) + "'"
+	}
+	return prefix + externalSheetBangChar
+}
+
+// splitFormulaSheet splits the workbook and the sheets from the text of
+// a token, removing their quotes.
+func splitFormulaSheet(text string) (workbook, sheet, lastSheet, rest string) {
+	prefix := formulaSheetRegexp.FindString(text)
+	if prefix == "" {
+		return "", "", "", text
+	}
+	sheets := strings.TrimSuffix(prefix, externalSheetBangChar)
+	if strings.HasPrefix(sheets, "'") {
+		sheets = strings.Replace(sheets[1:len(sheets)-1], "''", "'", -1)
+	}
+	// Names of sheets can't hold brackets or colons.
+	if end := strings.IndexByte(sheets, ']'); strings.HasPrefix(sheets, "[") && end > 0 {
+		workbook, sheets = sheets[1:end], sheets[end+1:]
+	}
+	sheet = sheets
+	if colon := strings.Index(sheets, cellRangeChar); colon >= 0 {
+		sheet, lastSheet = sheets[:colon], sheets[colon+1:]
+	}
+	return workbook, sheet, lastSheet, text[len(prefix):]
+}
+
+// formulaParser parses the tokens of a formula by the precedence of
+// Excel's operators, which from the highest are ":", the " " that
+// intersects references, the prefix "-" and "+", "%", "^", "*" and
+// "/", "+" and "-", "&", and then the comparisons.  The "," that joins
+// references into a union is only an operator within parentheses,
+// where it is the lowest of all.
+type formulaParser struct {
+	formula string
+	tokens  []FormulaToken
+	pos     int
+}
+
+func (p *formulaParser) peek() (FormulaToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return FormulaToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+// operator consumes the next token if it is one of the operators.
+func (p *formulaParser) operator(ops ...string) (string, bool) {
+	t, ok := p.peek()
+	if !ok || t.Type != FormulaTokenOperator {
+		return "", false
+	}
+	for _, op := range ops {
+		if t.Text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *formulaParser) unexpected() error {
+	if t, ok := p.peek(); ok {
+		return fmt.Errorf("unexpected %q in formula %q", t.Text, p.formula)
+	}
+	return fmt.Errorf("unexpected end of formula %q", p.formula)
+}
+
+// binary parses the operations of one level of precedence, whose
+// operands are parsed by next.
+func (p *formulaParser) binary(next func() (*FormulaNode, error), ops ...string) (*FormulaNode, error) {
+	left, err := next()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.operator(ops...)
+		if !ok {
+			return left, nil
+		}
+		right, err := next()
+		if err != nil {
+			return nil, err
+		}
+		left = &FormulaNode{Type: FormulaNodeBinary, Text: op, Args: []*FormulaNode{left, right}}
+	}
+}
+
+// parseUnion parses expressions joined by the "," that unions them.
+func (p *formulaParser) parseUnion() (*FormulaNode, error) {
+	node, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if t, ok := p.peek(); !ok || t.Type != FormulaTokenSeparator {
+			return node, nil
+		}
+		p.pos++
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		node = &FormulaNode{Type: FormulaNodeBinary, Text: ",", Args: []*FormulaNode{node, right}}
+	}
+}
+
+func (p *formulaParser) parseComparison() (*FormulaNode, error) {
+	return p.binary(p.parseConcatenation, "=", "<>", "<", ">", "<=", ">=")
+}
+
+func (p *formulaParser) parseConcatenation() (*FormulaNode, error) {
+	return p.binary(p.parseAddition, "&")
+}
+
+func (p *formulaParser) parseAddition() (*FormulaNode, error) {
+	return p.binary(p.parseMultiplication, "+", "-")
+}
+
+func (p *formulaParser) parseMultiplication() (*FormulaNode, error) {
+	return p.binary(p.parsePower, "*", "/")
+}
+
+func (p *formulaParser) parsePower() (*FormulaNode, error) {
+	return p.binary(p.parseUnary, "^")
+}
+
+func (p *formulaParser) parseUnary() (*FormulaNode, error) {
+	if op, ok := p.operator("-", "+"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &FormulaNode{Type: FormulaNodeUnary, Text: op, Args: []*FormulaNode{operand}}, nil
+	}
+	return p.parsePercent()
+}
+
+func (p *formulaParser) parsePercent() (*FormulaNode, error) {
+	node, err := p.binary(p.parseRange, " ")
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.operator("%"); !ok {
+			return node, nil
+		}
+		node = &FormulaNode{Type: FormulaNodePercent, Text: "%", Args: []*FormulaNode{node}}
+	}
+}
+
+func (p *formulaParser) parseRange() (*FormulaNode, error) {
+	return p.binary(p.parsePrimary, ":")
+}
+
+func (p *formulaParser) parsePrimary() (*FormulaNode, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, p.unexpected()
+	}
+	p.pos++
+	switch t.Type {
+	case FormulaTokenNumber:
+		if _, err := strconv.ParseFloat(t.Text, 64); err != nil {
+			return nil, fmt.Errorf("invalid number %q in formula %q", t.Text, p.formula)
+		}
+		return &FormulaNode{Type: FormulaNodeNumber, Text: t.Text}, nil
+	case FormulaTokenText:
+		return &FormulaNode{Type: FormulaNodeText, Text: t.Text}, nil
+	case FormulaTokenBool:
+		return &FormulaNode{Type: FormulaNodeBool, Text: t.Text}, nil
+	case FormulaTokenError:
+		workbook, sheet, lastSheet, code := splitFormulaSheet(t.Text)
+		return &FormulaNode{Type: FormulaNodeError, Text: strings.ToUpper(code), Sheet: sheet, LastSheet: lastSheet, Workbook: workbook}, nil
+	case FormulaTokenRef:
+		workbook, sheet, lastSheet, cells := splitFormulaSheet(t.Text)
+		ref, err := ParseFormulaRef(cells)
+		if err != nil {
+			return nil, err
+		}
+		return &FormulaNode{Type: FormulaNodeRef, Sheet: sheet, LastSheet: lastSheet, Workbook: workbook, Ref: ref}, nil
+	case FormulaTokenStructuredRef:
+		ref, err := parseStructuredRef(t.Text)
+		if err != nil {
+			return nil, err
+		}
+		return &FormulaNode{Type: FormulaNodeStructuredRef, StructuredRef: ref}, nil
+	case FormulaTokenName:
+		workbook, sheet, lastSheet, name := splitFormulaSheet(t.Text)
+		if lastSheet != "" {
+			p.pos--
+			return nil, p.unexpected()
+		}
+		return &FormulaNode{Type: FormulaNodeName, Text: name, Sheet: sheet, Workbook: workbook}, nil
+	case FormulaTokenFunction:
+		return p.parseArguments(&FormulaNode{Type: FormulaNodeFunction, Text: t.Text})
+	case FormulaTokenArrayOpen:
+		return p.parseArray()
+	case FormulaTokenOpen:
+		node, err := p.parseUnion()
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := p.peek(); !ok || t.Type != FormulaTokenClose {
+			return nil, p.unexpected()
+		}
+		p.pos++
+		return &FormulaNode{Type: FormulaNodeParen, Args: []*FormulaNode{node}}, nil
+	}
+	p.pos--
+	return nil, p.unexpected()
+}
+
+// parseArguments parses the arguments of a function up to the closing
+// parenthesis.
+func (p *formulaParser) parseArguments(fn *FormulaNode) (*FormulaNode, error) {
+	if t, ok := p.peek(); ok && t.Type == FormulaTokenClose {
+		p.pos++
+		return fn, nil
+	}
+	for {
+		t, ok := p.peek()
+		if !ok {
+			return nil, p.unexpected()
+		}
+		if t.Type == FormulaTokenSeparator || t.Type == FormulaTokenClose {
+			fn.Args = append(fn.Args, &FormulaNode{Type: FormulaNodeEmpty})
+		} else {
+			arg, err := p.parseComparison()
+			if err != nil {
+				return nil, err
+			}
+			fn.Args = append(fn.Args, arg)
+		}
+		t, ok = p.peek()
+		if !ok {
+			return nil, p.unexpected()
+		}
+		switch t.Type {
+		case FormulaTokenClose:
+			p.pos++
+			return fn, nil
+		case FormulaTokenSeparator:
+			p.pos++
+		default:
+			return nil, p.unexpected()
+		}
+	}
+}
+
+// parseArray parses the values of an array constant up to its closing
+// brace.  The values can only be literals.
+func (p *formulaParser) parseArray() (*FormulaNode, error) {
+	array := &FormulaNode{Type: FormulaNodeArray, Rows: [][]*FormulaNode{nil}}
+	for {
+		negative := false
+		if _, ok := p.operator("-"); ok {
+			negative = true
+		}
+		t, ok := p.peek()
+		if !ok {
+			return nil, p.unexpected()
+		}
+		var value *FormulaNode
+		switch t.Type {
+		case FormulaTokenNumber:
+			value = &FormulaNode{Type: FormulaNodeNumber, Text: t.Text}
+			if negative {
+				value.Text = "-" + t.Text
+			}
+		case FormulaTokenText, FormulaTokenBool, FormulaTokenError:
+			if !negative {
+				value = &FormulaNode{Type: FormulaNodeText, Text: t.Text}
+				if t.Type == FormulaTokenBool {
+					value.Type = FormulaNodeBool
+				} else if t.Type == FormulaTokenError {
+					value.Type = FormulaNodeError
+				}
+			}
+		}
+		if value == nil {
+			return nil, p.unexpected()
+		}
+		p.pos++
+		row := len(array.Rows) - 1
+		array.Rows[row] = append(array.Rows[row], value)
+
+		t, ok = p.peek()
+		if !ok {
+			return nil, p.unexpected()
+		}
+		p.pos++
+		switch t.Type {
+		case FormulaTokenSeparator:
+		case FormulaTokenArrayRowSeparator:
+			array.Rows = append(array.Rows, nil)
+		case FormulaTokenArrayClose:
+			for _, row := range array.Rows {
+				if len(row) != len(array.Rows[0]) {
+					return nil, fmt.Errorf("rows of different lengths in array in formula %q", p.formula)
+				}
+			}
+			return array, nil
+		default:
+			p.pos--
+			return nil, p.unexpected()
+		}
+	}
+}
@@ -0,0 +1,1032 @@
+package xlsx
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// formulaValueType is the kind of a value that a formula works with.
+type formulaValueType int
+
+const (
+	formulaValueBlank formulaValueType = iota
+	formulaValueNumber
+	formulaValueText
+	formulaValueBool
+	formulaValueError
+	// formulaValueArea is a reference to a range of cells, whose
+	// values are only read as they are needed.
+	formulaValueArea
+	// formulaValueArray is an array constant.
+	formulaValueArray
+)
+
+// formulaValue is a value that a formula works with.  Text holds the
+// text of a text value and the code of an error.
+type formulaValue struct {
+	typ    formulaValueType
+	number float64
+	text   string
+	bool   bool
+	area   formulaArea
+	array  [][]formulaValue
+}
+
+// formulaArea is a range of cells of a sheet, with zero based
+// coordinates.
+type formulaArea struct {
+	sheet                          *Sheet
+	minCol, minRow, maxCol, maxRow int
+}
+
+func numberValue(n float64) formulaValue {
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return errorValue(formulaErrorNum)
+	}
+	return formulaValue{typ: formulaValueNumber, number: n}
+}
+
+func textValue(s string) formulaValue {
+	return formulaValue{typ: formulaValueText, text: s}
+}
+
+func boolValue(b bool) formulaValue {
+	return formulaValue{typ: formulaValueBool, bool: b}
+}
+
+func errorValue(code string) formulaValue {
+	return formulaValue{typ: formulaValueError, text: code}
+}
+
+func areaValue(area formulaArea) formulaValue {
+	return formulaValue{typ: formulaValueArea, area: area}
+}
+
+func arrayValue(rows [][]formulaValue) formulaValue {
+	return formulaValue{typ: formulaValueArray, array: rows}
+}
+
+// rows and cols return the size of the area.
+func (a formulaArea) rows() int { return a.maxRow - a.minRow + 1 }
+func (a formulaArea) cols() int { return a.maxCol - a.minCol + 1 }
+
+// used returns the part of the area that lies within the rows and
+// columns of its sheet that have cells, so that references to whole
+// columns or rows don't have to visit a million empty cells.
+func (a formulaArea) used() formulaArea {
+	if a.maxRow >= len(a.sheet.Rows) {
+		a.maxRow = len(a.sheet.Rows) - 1
+	}
+	if a.maxCol >= a.sheet.MaxCol {
+		a.maxCol = a.sheet.MaxCol - 1
+	}
+	return a
+}
+
+// Recalculate evaluates the formula of every cell in the File, and
+// sets the value of each cell to its result, as Excel does when it
+// recalculates a workbook.  Formulas that refer to the results of
+// other formulas, on any sheet, are evaluated after them.
+//
+// A formula that can't be evaluated, because it uses a function that
+// isn't supported or because it refers to itself, keeps the value that
+// the cell already had.  Recalculate evaluates all of the other
+// formulas, and then returns an error describing the first formula it
+// couldn't evaluate.
+func (f *File) Recalculate() error {
+	e := newFormulaEvaluator(f)
+	for _, sheet := range f.Sheets {
+		if sheet.Type != SheetTypeWorksheet {
+			continue
+		}
+		for r, row := range sheet.Rows {
+			if row == nil {
+				continue
+			}
+			for c, cell := range row.Cells {
+				if cell != nil && cell.formula != "" {
+					e.evaluateCell(cell, sheet, r, c)
+				}
+			}
+		}
+	}
+	return e.err
+}
+
+// Evaluate evaluates the formula of the cell, along with the formulas
+// of any cells it refers to, and sets the value of each of those cells
+// to its result.  A cell without a formula is left alone.  As with
+// File.Recalculate, a cell whose formula can't be evaluated keeps its
+// value, and an error describing why is returned.
+func (c *Cell) Evaluate() error {
+	if c.formula == "" {
+		return nil
+	}
+	if c.Row == nil || c.Row.Sheet == nil {
+		return fmt.Errorf("cell is not part of a sheet")
+	}
+	sheet := c.Row.Sheet
+	for r, row := range sheet.Rows {
+		if row != c.Row {
+			continue
+		}
+		for col, cell := range row.Cells {
+			if cell == c {
+				e := newFormulaEvaluator(sheet.File)
+				e.evaluateCell(c, sheet, r, col)
+				return e.err
+			}
+		}
+	}
+	return fmt.Errorf("cell is not part of sheet %q", sheet.Name)
+}
+
+// formulaEvaluator evaluates formulas, remembering the result of each
+// cell so that every formula is only evaluated once.  Before a formula
+// is evaluated, the formulas of the cells it refers to are sorted into
+// the order of their dependencies and evaluated first, so that long
+// chains of formulas don't have to be followed by recursion.
+type formulaEvaluator struct {
+	file     *File
+	date1904 bool
+	parsed   map[string]*FormulaNode
+	results  map[*Cell]formulaValue
+	// inProgress holds the cells whose formulas are being evaluated,
+	// and evaluating the same cells innermost last, to catch formulas
+	// that refer to themselves.  circular holds the cells found to do
+	// so.
+	inProgress map[*Cell]bool
+	evaluating []*Cell
+	circular   map[*Cell]bool
+	names      map[string]bool
+	// sheet, row and col are the position of the cell being
+	// evaluated, and failed why its formula can't be evaluated.
+	sheet    *Sheet
+	row, col int
+	failed   error
+	// err is the first formula that couldn't be evaluated.
+	err error
+}
+
+// formulaCell is a cell with a formula, along with its position.
+type formulaCell struct {
+	cell     *Cell
+	sheet    *Sheet
+	row, col int
+}
+
+func newFormulaEvaluator(f *File) *formulaEvaluator {
+	e := &formulaEvaluator{
+		file:       f,
+		parsed:     make(map[string]*FormulaNode),
+		results:    make(map[*Cell]formulaValue),
+		inProgress: make(map[*Cell]bool),
+		circular:   make(map[*Cell]bool),
+		names:      make(map[string]bool),
+	}
+	if f != nil {
+		e.date1904 = f.Date1904
+	}
+	return e
+}
+
+// evaluateCell returns the result of the formula of the cell at the
+// given position, evaluating it and setting the cell's value to the
+// result if that hasn't been done yet.  The formulas it depends on are
+// evaluated first.
+func (e *formulaEvaluator) evaluateCell(cell *Cell, sheet *Sheet, row, col int) formulaValue {
+	if v, ok := e.results[cell]; ok {
+		return v
+	}
+	if e.inProgress[cell] {
+		for i := len(e.evaluating) - 1; i >= 0; i-- {
+			e.circular[e.evaluating[i]] = true
+			if e.evaluating[i] == cell {
+				break
+			}
+		}
+		return cellValue(cell)
+	}
+	if e.circular[cell] {
+		return cellValue(cell)
+	}
+	for _, fc := range e.dependencyOrder(formulaCell{cell, sheet, row, col}) {
+		e.evaluateFormula(fc)
+	}
+	return e.results[cell]
+}
+
+// dependencyOrder returns the formula cells that the cell depends on,
+// directly or through other formulas, that haven't been evaluated yet,
+// followed by the cell itself, in an order in which each comes after
+// those it depends on.  The cells that depend on themselves are marked
+// as circular.
+func (e *formulaEvaluator) dependencyOrder(root formulaCell) []formulaCell {
+	type frame struct {
+		fc   formulaCell
+		deps []formulaCell
+		next int
+	}
+	var order []formulaCell
+	// onStack holds the position in stack of each cell on it.
+	onStack := map[*Cell]int{root.cell: 0}
+	visited := map[*Cell]bool{root.cell: true}
+	stack := []*frame{{fc: root, deps: e.dependencies(root)}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		if top.next == len(top.deps) {
+			order = append(order, top.fc)
+			delete(onStack, top.fc.cell)
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		dep := top.deps[top.next]
+		top.next++
+		if i, ok := onStack[dep.cell]; ok {
+			for _, f := range stack[i:] {
+				e.circular[f.fc.cell] = true
+			}
+			continue
+		}
+		if visited[dep.cell] || e.inProgress[dep.cell] {
+			continue
+		}
+		if _, ok := e.results[dep.cell]; ok {
+			continue
+		}
+		visited[dep.cell] = true
+		onStack[dep.cell] = len(stack)
+		stack = append(stack, &frame{fc: dep, deps: e.dependencies(dep)})
+	}
+	return order
+}
+
+// dependencies returns the cells with formulas that the formula of a
+// cell refers to, through references, structured references and
+// defined names.  References that are only worked out as the formula
+// is evaluated, such as those of OFFSET or INDIRECT, are left out;
+// their cells are evaluated when they are reached instead.
+func (e *formulaEvaluator) dependencies(fc formulaCell) []formulaCell {
+	node, err := e.parse(fc.cell.formula)
+	if err != nil {
+		return nil
+	}
+	outerSheet, outerRow, outerCol := e.sheet, e.row, e.col
+	e.sheet, e.row, e.col = fc.sheet, fc.row, fc.col
+	defer func() { e.sheet, e.row, e.col = outerSheet, outerRow, outerCol }()
+
+	var deps []formulaCell
+	seen := make(map[*Cell]bool)
+	add := func(v formulaValue) {
+		if v.typ != formulaValueArea {
+			return
+		}
+		u := v.area.used()
+		for r := u.minRow; r <= u.maxRow; r++ {
+			for c := u.minCol; c <= u.maxCol; c++ {
+				if cell := cellAt(u.sheet, r, c); cell != nil && cell.formula != "" && !seen[cell] {
+					seen[cell] = true
+					deps = append(deps, formulaCell{cell, u.sheet, r, c})
+				}
+			}
+		}
+	}
+	names := make(map[*xlsxDefinedName]bool)
+	nodes := []*FormulaNode{node}
+	for len(nodes) > 0 {
+		n := nodes[len(nodes)-1]
+		nodes = nodes[:len(nodes)-1]
+		n.Walk(func(n *FormulaNode) bool {
+			switch n.Type {
+			case FormulaNodeRef:
+				if n.Workbook == "" && n.LastSheet == "" {
+					add(e.eval(n))
+				}
+			case FormulaNodeStructuredRef:
+				add(e.evalStructuredRef(n.StructuredRef))
+			case FormulaNodeName:
+				if dn := e.definedName(n.Text, n.Sheet); dn != nil && !names[dn] {
+					names[dn] = true
+					if node, err := e.parse(dn.Data); err == nil {
+						nodes = append(nodes, node)
+					}
+				}
+			case FormulaNodeBinary:
+				if n.Text == ":" && n.Args[0].Type == FormulaNodeRef && n.Args[1].Type == FormulaNodeRef {
+					add(e.evalBinary(n))
+				}
+			}
+			return true
+		})
+	}
+	return deps
+}
+
+// evaluateFormula evaluates the formula of a cell, setting its value
+// to the result, unless that has been done already.
+func (e *formulaEvaluator) evaluateFormula(fc formulaCell) {
+	cell, sheet, row, col := fc.cell, fc.sheet, fc.row, fc.col
+	if _, ok := e.results[cell]; ok {
+		return
+	}
+	node, err := e.parse(cell.formula)
+	if err != nil {
+		e.record(sheet, row, col, err)
+		e.results[cell] = cellValue(cell)
+		return
+	}
+
+	e.inProgress[cell] = true
+	e.evaluating = append(e.evaluating, cell)
+	outerSheet, outerRow, outerCol, outerFailed := e.sheet, e.row, e.col, e.failed
+	e.sheet, e.row, e.col, e.failed = sheet, row, col, nil
+	v := e.scalar(e.eval(node))
+	failed := e.failed
+	e.sheet, e.row, e.col, e.failed = outerSheet, outerRow, outerCol, outerFailed
+	e.evaluating = e.evaluating[:len(e.evaluating)-1]
+	delete(e.inProgress, cell)
+
+	if e.circular[cell] {
+		failed = fmt.Errorf("circular reference")
+	}
+	if failed != nil {
+		e.record(sheet, row, col, failed)
+		v = cellValue(cell)
+	} else {
+		setFormulaResult(cell, v)
+	}
+	e.results[cell] = v
+}
+
+func (e *formulaEvaluator) parse(formula string) (*FormulaNode, error) {
+	if node, ok := e.parsed[formula]; ok {
+		return node, nil
+	}
+	node, err := ParseFormula(formula)
+	if err != nil {
+		return nil, err
+	}
+	e.parsed[formula] = node
+	return node, nil
+}
+
+// fail notes why the formula being evaluated can't be evaluated.
+func (e *formulaEvaluator) fail(err error) {
+	if e.failed == nil {
+		e.failed = err
+	}
+}
+
+// record keeps the first formula that couldn't be evaluated.
+func (e *formulaEvaluator) record(sheet *Sheet, row, col int, err error) {
+	if e.err == nil {
+		e.err = fmt.Errorf("%s!%s: %v", sheet.Name, GetCellIDStringFromCoords(col, row), err)
+	}
+}
+
+// setFormulaResult sets the value of a formula cell to its result,
+// keeping its formula.
+func setFormulaResult(cell *Cell, v formulaValue) {
+	switch v.typ {
+	case formulaValueBlank:
+		cell.Value = "0"
+		cell.cellType = CellTypeNumeric
+	case formulaValueNumber:
+		cell.Value = strconv.FormatFloat(roundSignificant(v.number), 'f', -1, 64)
+		cell.cellType = CellTypeNumeric
+	case formulaValueText:
+		cell.Value = v.text
+		cell.cellType = CellTypeStringFormula
+	case formulaValueBool:
+		cell.Value = "0"
+		if v.bool {
+			cell.Value = "1"
+		}
+		cell.cellType = CellTypeBool
+	case formulaValueError:
+		cell.Value = v.text
+		cell.cellType = CellTypeError
+	}
+	cell.RichText = nil
+}
+
+// roundSignificant rounds n to the 15 significant digits that Excel
+// keeps, so that 0.1+0.2 is 0.3.
+func roundSignificant(n float64) float64 {
+	r, err := strconv.ParseFloat(strconv.FormatFloat(n, 'g', 15, 64), 64)
+	if err != nil {
+		return n
+	}
+	return r
+}
+
+// cellValue returns the value that a cell holds, which for a formula
+// is the result it was last given.
+func cellValue(cell *Cell) formulaValue {
+	if cell == nil {
+		return formulaValue{}
+	}
+	switch cell.cellType {
+	case CellTypeNumeric, CellTypeDate:
+		if cell.Value == "" {
+			return formulaValue{}
+		}
+		if cell.cellType == CellTypeDate {
+			if t, err := parseDateCellValue(cell.Value); err == nil {
+				return numberValue(formulaTimeToSerial(t, cell.date1904))
+			}
+		}
+		if n, err := strconv.ParseFloat(cell.Value, 64); err == nil {
+			return numberValue(n)
+		}
+		return textValue(cell.Value)
+	case CellTypeBool:
+		return boolValue(cell.Value == "1" || strings.EqualFold(cell.Value, "TRUE"))
+	case CellTypeError:
+		return errorValue(cell.Value)
+	}
+	if cell.Value == "" && cell.formula == "" {
+		return formulaValue{}
+	}
+	return textValue(cell.Value)
+}
+
+// cellAt returns the cell at the position in the sheet, without adding
+// it, or nil if there is none.
+func cellAt(sheet *Sheet, row, col int) *Cell {
+	if row < 0 || row >= len(sheet.Rows) || sheet.Rows[row] == nil {
+		return nil
+	}
+	cells := sheet.Rows[row].Cells
+	if col < 0 || col >= len(cells) {
+		return nil
+	}
+	return cells[col]
+}
+
+// result returns the value of the cell at the position in the sheet,
+// evaluating its formula first if it has one.
+func (e *formulaEvaluator) result(sheet *Sheet, row, col int) formulaValue {
+	cell := cellAt(sheet, row, col)
+	if cell != nil && cell.formula != "" {
+		return e.evaluateCell(cell, sheet, row, col)
+	}
+	return cellValue(cell)
+}
+
+// resultAt returns the value of the cell at the offset from the top
+// left of the area.
+func (e *formulaEvaluator) resultAt(a formulaArea, row, col int) formulaValue {
+	return e.result(a.sheet, a.minRow+row, a.minCol+col)
+}
+
+// each calls fn with the value of every used cell in the area, row by
+// row, until it returns false.
+func (e *formulaEvaluator) each(a formulaArea, fn func(v formulaValue) bool) {
+	u := a.used()
+	for r := u.minRow; r <= u.maxRow; r++ {
+		for c := u.minCol; c <= u.maxCol; c++ {
+			if !fn(e.result(a.sheet, r, c)) {
+				return
+			}
+		}
+	}
+}
+
+// eachOf calls fn with every value of an area, as each does, or of an
+// array, until it returns false.
+func (e *formulaEvaluator) eachOf(v formulaValue, fn func(v formulaValue) bool) {
+	if v.typ == formulaValueArea {
+		e.each(v.area, fn)
+		return
+	}
+	for _, row := range v.array {
+		for _, value := range row {
+			if !fn(value) {
+				return
+			}
+		}
+	}
+}
+
+// scalar turns a reference into the value of a single cell.  A range
+// of cells gives the cell in the same row or column as the formula, as
+// Excel does when a range is used where one value is expected.  An
+// array gives its first value.
+func (e *formulaEvaluator) scalar(v formulaValue) formulaValue {
+	if v.typ == formulaValueArray {
+		return v.array[0][0]
+	}
+	if v.typ != formulaValueArea {
+		return v
+	}
+	a := v.area
+	switch {
+	case a.rows() == 1 && a.cols() == 1:
+		return e.resultAt(a, 0, 0)
+	case a.cols() == 1 && a.sheet == e.sheet && e.row >= a.minRow && e.row <= a.maxRow:
+		return e.result(a.sheet, e.row, a.minCol)
+	case a.rows() == 1 && a.sheet == e.sheet && e.col >= a.minCol && e.col <= a.maxCol:
+		return e.result(a.sheet, a.minRow, e.col)
+	}
+	return errorValue(formulaErrorValue)
+}
+
+// sheetNamed returns the sheet of a reference, which is the sheet of
+// the formula when it doesn't name one.
+func (e *formulaEvaluator) sheetNamed(name string) *Sheet {
+	if name == "" {
+		return e.sheet
+	}
+	if e.file != nil {
+		if sheet, ok := e.file.Sheet[name]; ok {
+			return sheet
+		}
+		for _, sheet := range e.file.Sheets {
+			if strings.EqualFold(sheet.Name, name) {
+				return sheet
+			}
+		}
+	} else if strings.EqualFold(e.sheet.Name, name) {
+		return e.sheet
+	}
+	return nil
+}
+
+// eval evaluates a node of a formula.  The result may be a reference,
+// which functions that work with ranges of cells use as it is.
+func (e *formulaEvaluator) eval(node *FormulaNode) formulaValue {
+	switch node.Type {
+	case FormulaNodeNumber:
+		n, err := strconv.ParseFloat(node.Text, 64)
+		if err != nil {
+			return errorValue(formulaErrorValue)
+		}
+		return numberValue(n)
+	case FormulaNodeText:
+		return textValue(node.Text)
+	case FormulaNodeBool:
+		return boolValue(node.Text == "TRUE")
+	case FormulaNodeError:
+		return errorValue(node.Text)
+	case FormulaNodeEmpty:
+		return formulaValue{}
+	case FormulaNodeRef:
+		if node.Workbook != "" || node.LastSheet != "" {
+			e.fail(fmt.Errorf("unsupported reference %s", node))
+			return errorValue(formulaErrorRef)
+		}
+		sheet := e.sheetNamed(node.Sheet)
+		if sheet == nil {
+			return errorValue(formulaErrorRef)
+		}
+		return areaValue(formulaArea{
+			sheet:  sheet,
+			minCol: node.Ref.MinCol,
+			minRow: node.Ref.MinRow,
+			maxCol: node.Ref.MaxCol,
+			maxRow: node.Ref.MaxRow,
+		})
+	case FormulaNodeStructuredRef:
+		return e.evalStructuredRef(node.StructuredRef)
+	case FormulaNodeName:
+		if node.Workbook != "" {
+			e.fail(fmt.Errorf("unsupported reference %s", node))
+			return errorValue(formulaErrorRef)
+		}
+		return e.evalName(node.Text, node.Sheet)
+	case FormulaNodeArray:
+		rows := make([][]formulaValue, len(node.Rows))
+		for i, row := range node.Rows {
+			rows[i] = make([]formulaValue, len(row))
+			for j, value := range row {
+				rows[i][j] = e.eval(value)
+			}
+		}
+		return arrayValue(rows)
+	case FormulaNodeParen:
+		return e.eval(node.Args[0])
+	case FormulaNodeFunction:
+		return e.evalFunction(node)
+	case FormulaNodeUnary:
+		n, code := e.toNumber(e.scalar(e.eval(node.Args[0])))
+		if code != "" {
+			return errorValue(code)
+		}
+		if node.Text == "-" {
+			n = -n
+		}
+		return numberValue(n)
+	case FormulaNodePercent:
+		n, code := e.toNumber(e.scalar(e.eval(node.Args[0])))
+		if code != "" {
+			return errorValue(code)
+		}
+		return numberValue(n / 100)
+	case FormulaNodeBinary:
+		return e.evalBinary(node)
+	}
+	e.fail(fmt.Errorf("unsupported formula"))
+	return errorValue(formulaErrorValue)
+}
+
+// definedName returns the defined name that a name in a formula refers
+// to, or nil if there is none.  A name defined for the sheet of the
+// formula, or for the sheet that qualifies the name, hides one defined
+// for the workbook.
+func (e *formulaEvaluator) definedName(name, sheetName string) *xlsxDefinedName {
+	if e.file == nil {
+		return nil
+	}
+	sheet := e.sheetNamed(sheetName)
+	if sheet == nil {
+		return nil
+	}
+	if localSheetID, err := e.file.localSheetID(sheet); err == nil {
+		if dn := e.file.findDefinedName(name, localSheetID); dn != nil {
+			return dn
+		}
+	}
+	return e.file.findDefinedName(name, nil)
+}
+
+// evalName evaluates what a defined name refers to.
+func (e *formulaEvaluator) evalName(name, sheetName string) formulaValue {
+	if e.file != nil && e.sheetNamed(sheetName) == nil {
+		return errorValue(formulaErrorRef)
+	}
+	dn := e.definedName(name, sheetName)
+	if dn == nil {
+		return errorValue(formulaErrorName)
+	}
+	key := strings.ToLower(name)
+	if e.names[key] {
+		e.fail(fmt.Errorf("defined name %q refers to itself", name))
+		return errorValue(formulaErrorName)
+	}
+	node, err := e.parse(dn.Data)
+	if err != nil {
+		e.fail(fmt.Errorf("defined name %q: %v", name, err))
+		return errorValue(formulaErrorName)
+	}
+	e.names[key] = true
+	v := e.eval(node)
+	delete(e.names, key)
+	return v
+}
+
+// evalStructuredRef evaluates a reference to the parts of a table.  A
+// reference without the name of a table is to the table that the
+// formula is in.
+func (e *formulaEvaluator) evalStructuredRef(ref FormulaStructuredRef) formulaValue {
+	var table *Table
+	switch {
+	case ref.Table != "" && e.file != nil:
+		table = e.file.Table(ref.Table)
+	case ref.Table == "":
+		for _, t := range e.sheet.Tables {
+			if bounds, err := ParseFormulaRef(t.Ref); err == nil &&
+				e.row >= bounds.MinRow && e.row <= bounds.MaxRow && e.col >= bounds.MinCol && e.col <= bounds.MaxCol {
+				table = t
+				break
+			}
+		}
+	}
+	if table == nil || table.sheet == nil {
+		return errorValue(formulaErrorRef)
+	}
+	bounds, err := ParseFormulaRef(table.Ref)
+	if err != nil {
+		return errorValue(formulaErrorRef)
+	}
+	header, last := bounds.MinRow, bounds.MaxRow
+	firstData, lastData := header+1, last
+	if table.TotalsRow {
+		lastData--
+	}
+	area := formulaArea{sheet: table.sheet, minCol: bounds.MinCol, maxCol: bounds.MaxCol, minRow: firstData, maxRow: lastData}
+	for i, item := range ref.Items {
+		var minRow, maxRow int
+		switch strings.ToLower(item) {
+		case "#all":
+			minRow, maxRow = header, last
+		case "#data":
+			minRow, maxRow = firstData, lastData
+		case "#headers":
+			minRow, maxRow = header, header
+		case "#totals":
+			if !table.TotalsRow {
+				return errorValue(formulaErrorRef)
+			}
+			minRow, maxRow = last, last
+		case "#this row":
+			if e.sheet != table.sheet || e.row < firstData || e.row > lastData {
+				return errorValue(formulaErrorValue)
+			}
+			minRow, maxRow = e.row, e.row
+		default:
+			return errorValue(formulaErrorRef)
+		}
+		if i == 0 {
+			area.minRow, area.maxRow = minRow, maxRow
+		} else {
+			area.minRow, area.maxRow = minInt(area.minRow, minRow), maxInt(area.maxRow, maxRow)
+		}
+	}
+	if ref.FirstColumn != "" {
+		first, last := tableColumnIndex(table, ref.FirstColumn), tableColumnIndex(table, ref.LastColumn)
+		if first < 0 || last < 0 {
+			return errorValue(formulaErrorRef)
+		}
+		area.minCol, area.maxCol = bounds.MinCol+minInt(first, last), bounds.MinCol+maxInt(first, last)
+	}
+	if area.minRow > area.maxRow {
+		return errorValue(formulaErrorRef)
+	}
+	return areaValue(area)
+}
+
+// tableColumnIndex returns the index of the column of the table with
+// the name, or -1 if there is none.
+func tableColumnIndex(table *Table, name string) int {
+	for i, column := range table.Columns {
+		if strings.EqualFold(column.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (e *formulaEvaluator) evalBinary(node *FormulaNode) formulaValue {
+	switch node.Text {
+	case " ":
+		left, right := e.eval(node.Args[0]), e.eval(node.Args[1])
+		if left.typ != formulaValueArea || right.typ != formulaValueArea {
+			return errorValue(formulaErrorValue)
+		}
+		a, b := left.area, right.area
+		if a.sheet != b.sheet {
+			return errorValue(formulaErrorNull)
+		}
+		area := formulaArea{
+			sheet:  a.sheet,
+			minCol: maxInt(a.minCol, b.minCol),
+			minRow: maxInt(a.minRow, b.minRow),
+			maxCol: minInt(a.maxCol, b.maxCol),
+			maxRow: minInt(a.maxRow, b.maxRow),
+		}
+		if area.minCol > area.maxCol || area.minRow > area.maxRow {
+			return errorValue(formulaErrorNull)
+		}
+		return areaValue(area)
+	case ",":
+		e.fail(fmt.Errorf("unsupported union of references %s", node))
+		return errorValue(formulaErrorValue)
+	case ":":
+		left, right := e.eval(node.Args[0]), e.eval(node.Args[1])
+		if left.typ != formulaValueArea || right.typ != formulaValueArea || left.area.sheet != right.area.sheet {
+			return errorValue(formulaErrorValue)
+		}
+		a, b := left.area, right.area
+		return areaValue(formulaArea{
+			sheet:  a.sheet,
+			minCol: minInt(a.minCol, b.minCol),
+			minRow: minInt(a.minRow, b.minRow),
+			maxCol: maxInt(a.maxCol, b.maxCol),
+			maxRow: maxInt(a.maxRow, b.maxRow),
+		})
+	}
+	left := e.scalar(e.eval(node.Args[0]))
+	right := e.scalar(e.eval(node.Args[1]))
+	if left.typ == formulaValueError {
+		return left
+	}
+	if right.typ == formulaValueError {
+		return right
+	}
+	switch node.Text {
+	case "&":
+		return textValue(e.toText(left) + e.toText(right))
+	case "=", "<>", "<", ">", "<=", ">=":
+		cmp := compareFormulaValues(left, right)
+		switch node.Text {
+		case "=":
+			return boolValue(cmp == 0)
+		case "<>":
+			return boolValue(cmp != 0)
+		case "<":
+			return boolValue(cmp < 0)
+		case ">":
+			return boolValue(cmp > 0)
+		case "<=":
+			return boolValue(cmp <= 0)
+		}
+		return boolValue(cmp >= 0)
+	}
+	a, code := e.toNumber(left)
+	if code != "" {
+		return errorValue(code)
+	}
+	b, code := e.toNumber(right)
+	if code != "" {
+		return errorValue(code)
+	}
+	switch node.Text {
+	case "+":
+		return numberValue(a + b)
+	case "-":
+		return numberValue(a - b)
+	case "*":
+		return numberValue(a * b)
+	case "/":
+		if b == 0 {
+			return errorValue(formulaErrorDiv0)
+		}
+		return numberValue(a / b)
+	}
+	if a == 0 && b == 0 {
+		return errorValue(formulaErrorNum)
+	}
+	return numberValue(math.Pow(a, b))
+}
+
+// evalFunction calls the function of a node with its arguments.
+func (e *formulaEvaluator) evalFunction(node *FormulaNode) formulaValue {
+	name := strings.ToUpper(node.Text)
+	name = strings.TrimPrefix(name, "_XLFN.")
+	name = strings.TrimPrefix(name, "_XLWS.")
+	fn, ok := formulaFunctions[name]
+	if !ok {
+		e.fail(fmt.Errorf("unsupported function %s", name))
+		return errorValue(formulaErrorName)
+	}
+	if len(node.Args) < fn.minArgs || (fn.maxArgs >= 0 && len(node.Args) > fn.maxArgs) {
+		e.fail(fmt.Errorf("wrong number of arguments to %s", name))
+		return errorValue(formulaErrorValue)
+	}
+	return fn.call(e, node.Args)
+}
+
+// toNumber converts a value to a number, returning the code of the
+// error to give instead when it can't be.
+func (e *formulaEvaluator) toNumber(v formulaValue) (float64, string) {
+	switch v.typ {
+	case formulaValueBlank:
+		return 0, ""
+	case formulaValueNumber:
+		return v.number, ""
+	case formulaValueBool:
+		if v.bool {
+			return 1, ""
+		}
+		return 0, ""
+	case formulaValueText:
+		if n, ok := parseFormulaNumber(v.text); ok {
+			return n, ""
+		}
+		return 0, formulaErrorValue
+	case formulaValueError:
+		return 0, v.text
+	}
+	return e.toNumber(e.scalar(v))
+}
+
+// parseFormulaNumber parses text that holds a number, such as "12",
+// "1.5e3" or "50%".
+func parseFormulaNumber(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	percent := strings.HasSuffix(s, "%")
+	s = strings.TrimSuffix(s, "%")
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || s == "" || strings.ContainsAny(s, "xXpPnN") {
+		return 0, false
+	}
+	if percent {
+		n /= 100
+	}
+	return n, true
+}
+
+// toText converts a value to text, as the "&" operator does.
+func (e *formulaEvaluator) toText(v formulaValue) string {
+	switch v.typ {
+	case formulaValueNumber:
+		return formatFormulaNumber(v.number)
+	case formulaValueText, formulaValueError:
+		return v.text
+	case formulaValueBool:
+		if v.bool {
+			return "TRUE"
+		}
+		return "FALSE"
+	case formulaValueArea:
+		return e.toText(e.scalar(v))
+	}
+	return ""
+}
+
+// toBool converts a value to a boolean, returning the code of the
+// error to give instead when it can't be.
+func (e *formulaEvaluator) toBool(v formulaValue) (bool, string) {
+	switch v.typ {
+	case formulaValueBlank:
+		return false, ""
+	case formulaValueNumber:
+		return v.number != 0, ""
+	case formulaValueBool:
+		return v.bool, ""
+	case formulaValueText:
+		switch strings.ToUpper(v.text) {
+		case "TRUE":
+			return true, ""
+		case "FALSE":
+			return false, ""
+		}
+		return false, formulaErrorValue
+	case formulaValueError:
+		return false, v.text
+	}
+	return e.toBool(e.scalar(v))
+}
+
+// formatFormulaNumber formats a number as Excel's General format does
+// when a number is turned into text.
+func formatFormulaNumber(n float64) string {
+	n = roundSignificant(n)
+	abs := math.Abs(n)
+	if abs != 0 && (abs < 1e-9 || abs >= 1e15) {
+		return strings.Replace(strconv.FormatFloat(n, 'E', -1, 64), "E+0", "E+", 1)
+	}
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// compareFormulaValues compares two values as Excel's comparison
+// operators do: numbers come before text, which comes before booleans,
+// text is compared without regard to case, and an empty cell is equal
+// to zero, the empty string and FALSE.
+func compareFormulaValues(a, b formulaValue) int {
+	if a.typ == formulaValueBlank {
+		a = blankLike(b)
+	}
+	if b.typ == formulaValueBlank {
+		b = blankLike(a)
+	}
+	rank := func(v formulaValue) int {
+		switch v.typ {
+		case formulaValueNumber:
+			return 0
+		case formulaValueText:
+			return 1
+		}
+		return 2
+	}
+	if rank(a) != rank(b) {
+		return rank(a) - rank(b)
+	}
+	switch a.typ {
+	case formulaValueNumber:
+		x, y := roundSignificant(a.number), roundSignificant(b.number)
+		if x < y {
+			return -1
+		} else if x > y {
+			return 1
+		}
+		return 0
+	case formulaValueText:
+		return strings.Compare(strings.ToLower(a.text), strings.ToLower(b.text))
+	}
+	if a.bool == b.bool {
+		return 0
+	} else if b.bool {
+		return -1
+	}
+	return 1
+}
+
+// blankLike returns the value that an empty cell is equal to when it
+// is compared with v.
+func blankLike(v formulaValue) formulaValue {
+	switch v.typ {
+	case formulaValueText:
+		return textValue("")
+	case formulaValueBool:
+		return boolValue(false)
+	}
+	return numberValue(0)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
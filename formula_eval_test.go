@@ -0,0 +1,420 @@
+package xlsx
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type FormulaEvalSuite struct{}
+
+var _ = Suite(&FormulaEvalSuite{})
+
+// makeFormulaTestFile returns a file with a sheet of data for formulas
+// to work with, and an empty sheet to put them in.
+func makeFormulaTestFile(c *C) *File {
+	f := NewFile()
+	data, err := f.AddSheet("Data")
+	c.Assert(err, IsNil)
+	_, err = f.AddSheet("Calc")
+	c.Assert(err, IsNil)
+	for i, n := range []int{1, 2, 3, 4, 5} {
+		data.Cell(i, 0).SetInt(n)
+	}
+	for i, s := range []string{"apple", "banana", "cherry", "apple pie"} {
+		data.Cell(i, 1).SetString(s)
+	}
+	data.Cell(0, 2).SetBool(true)
+	data.Cell(1, 2).SetString("7")
+	for i, n := range []int{10, 20, 30} {
+		data.Cell(i, 4).SetInt(n)
+	}
+	for i, s := range []string{"ten", "twenty", "thirty"} {
+		data.Cell(i, 5).SetString(s)
+	}
+	return f
+}
+
+// evaluateFormula evaluates a formula in the first cell of the Calc
+// sheet.
+func evaluateFormula(c *C, f *File, formula string) *Cell {
+	cell := f.Sheet["Calc"].Cell(0, 0)
+	cell.SetFormula(formula)
+	c.Assert(cell.Evaluate(), IsNil, Commentf(formula))
+	return cell
+}
+
+func (s *FormulaEvalSuite) TestOperators(c *C) {
+	f := makeFormulaTestFile(c)
+	for formula, expected := range map[string]string{
+		"1+2*3":                  "7",
+		"-2^2":                   "4",
+		"0.1+0.2":                "0.3",
+		"10/4":                   "2.5",
+		"50%":                    "0.5",
+		"1/0":                    "#DIV/0!",
+		`"a"&1.5&TRUE`:           "a1.5TRUE",
+		`"abc"="ABC"`:            "1",
+		`2<"1"`:                  "1",
+		"Data!A1+Data!A2":        "3",
+		"Data!C1+1":              "2",
+		"Data!C2*2":              "14",
+		"Data!B1+1":              "#VALUE!",
+		"Data!Z99=0":             "1",
+		`Data!Z99=""`:            "1",
+		"Missing!A1":             "#REF!",
+		"#N/A+1":                 "#N/A",
+		"SUM(Data!A1:Data!A3)":   "6",
+		"SUM(Data!A:A)":          "15",
+		"SUM(Data!1:2)":          "33",
+		"Data!A1:A5":             "#VALUE!",
+		"UNKNOWNNAME":            "#NAME?",
+		"ROUND(2/3,2)":           "0.67",
+		"-Data!A5":               "-5",
+		`"x"&Data!Z99&"y"`:       "xy",
+		"TRUE+TRUE":              "2",
+		`IF(Data!C1,"yes","no")`: "yes",
+	} {
+		c.Check(evaluateFormula(c, f, formula).Value, Equals, expected, Commentf(formula))
+	}
+
+	// A space intersects the references on either side of it.
+	c.Assert(evaluateFormula(c, f, "SUM(Data!A1:B5 Data!A3:E4)").Value, Equals, "7")
+	c.Assert(evaluateFormula(c, f, "Data!A1:A2 Data!A4:A5").Value, Equals, "#NULL!")
+}
+
+func (s *FormulaEvalSuite) TestFunctions(c *C) {
+	f := makeFormulaTestFile(c)
+	formulaNow = func() time.Time { return time.Date(2024, 2, 29, 13, 30, 0, 0, time.UTC) }
+	defer func() { formulaNow = time.Now }()
+	for formula, expected := range map[string]string{
+		// Maths
+		"SUM(Data!A1:A5, 10, Data!B1:B5)":                             "25",
+		`SUM("3", TRUE)`:                                              "4",
+		"AVERAGE(Data!A1:A5)":                                         "3",
+		"AVERAGE(Data!B1:B5)":                                         "#DIV/0!",
+		"MIN(Data!A1:A5)":                                             "1",
+		"MAX(Data!A1:A5, 7)":                                          "7",
+		"MEDIAN(Data!A1:A4)":                                          "2.5",
+		"PRODUCT(Data!A1:A4)":                                         "24",
+		"COUNT(Data!A1:C5)":                                           "5",
+		"COUNTA(Data!A1:C5)":                                          "11",
+		"COUNTBLANK(Data!A1:C5)":                                      "4",
+		"COUNTIF(Data!A1:A5, \">2\")":                                 "3",
+		"COUNTIF(Data!B1:B5, \"apple*\")":                             "2",
+		"COUNTIF(Data!B1:B5, \"<>\")":                                 "4",
+		"COUNTIF(Data!B1:B5, \"\")":                                   "1",
+		"COUNTIFS(Data!A1:A5, \">1\", Data!B1:B5, \"*an*\")":          "1",
+		"SUMIF(Data!B1:B5, \"apple*\", Data!A1:A5)":                   "5",
+		"SUMIF(Data!A1:A5, \"<=2\")":                                  "3",
+		"SUMIFS(Data!A1:A5, Data!A1:A5, \">=2\", Data!A1:A5, \"<5\")": "9",
+		"SUMIFS(Data!A1:A5, Data!A1:A4, \">1\")":                      "#VALUE!",
+		"AVERAGEIF(Data!A1:A5, \">3\")":                               "4.5",
+		"AVERAGEIFS(Data!A1:A5, Data!B1:B5, \"apple\")":               "1",
+		"SUMPRODUCT(Data!A1:A3, Data!E1:E3)":                          "140",
+		"ABS(-3)":                                                     "3",
+		"ROUND(2.5, 0)":                                               "3",
+		"ROUND(-2.5, 0)":                                              "-3",
+		"ROUND(1234.5678, -2)":                                        "1200",
+		"ROUND(2.675, 2)":                                             "2.68",
+		"ROUNDUP(1.21, 1)":                                            "1.3",
+		"ROUNDDOWN(-1.29, 1)":                                         "-1.2",
+		"INT(-1.5)":                                                   "-2",
+		"TRUNC(-1.57, 1)":                                             "-1.5",
+		"MOD(-3, 2)":                                                  "1",
+		"MOD(1, 0)":                                                   "#DIV/0!",
+		"POWER(2, 10)":                                                "1024",
+		"SQRT(-1)":                                                    "#NUM!",
+		"CEILING(2.1, 0.5)":                                           "2.5",
+		"FLOOR(-2.5, 2)":                                              "-4",
+		"LOG(8, 2)":                                                   "3",
+		"LOG10(1000)":                                                 "3",
+		"SIGN(-0.5)":                                                  "-1",
+
+		// Logic and information
+		"IF(Data!A1>1, 1, 2)":                     "2",
+		"IF(FALSE, 1)":                            "0",
+		"IF(TRUE, 1/0, 1)":                        "#DIV/0!",
+		"IF(FALSE, 1/0, 1)":                       "1",
+		"IFS(Data!A1=2, \"a\", Data!A1=1, \"b\")": "b",
+		"IFS(FALSE, 1)":                           "#N/A",
+		"IFERROR(1/0, \"oops\")":                  "oops",
+		"IFNA(NA(), 0)":                           "0",
+		"IFNA(1/0, 0)":                            "#DIV/0!",
+		"AND(Data!A1:A5)":                         "1",
+		"AND(TRUE, 0)":                            "0",
+		"OR(FALSE, Data!Z1:Z2)":                   "0",
+		"XOR(TRUE, TRUE, TRUE)":                   "1",
+		"NOT(1)":                                  "0",
+		"ISBLANK(Data!Z1)":                        "1",
+		"ISBLANK(Data!A1)":                        "0",
+		"ISNUMBER(Data!C2)":                       "0",
+		"ISTEXT(Data!C2)":                         "1",
+		"ISLOGICAL(Data!C1)":                      "1",
+		"ISERROR(1/0)":                            "1",
+		"ISERR(NA())":                             "0",
+		"ISNA(NA())":                              "1",
+
+		// Text
+		`CONCATENATE("a", 1, TRUE)`:            "a1TRUE",
+		`CONCAT(Data!B1:B2, "!")`:              "applebanana!",
+		`TEXTJOIN(", ", TRUE, Data!B1:B5)`:     "apple, banana, cherry, apple pie",
+		`TEXTJOIN("-", FALSE, "a", "", "b")`:   "a--b",
+		`LEFT("héllo", 2)`:                     "hé",
+		`LEFT("abc")`:                          "a",
+		`RIGHT("abc", 5)`:                      "abc",
+		`MID("abcdef", 2, 3)`:                  "bcd",
+		`MID("abc", 5, 1)`:                     "",
+		`LEN("héllo")`:                         "5",
+		`LOWER("ABC")`:                         "abc",
+		`UPPER("abc")`:                         "ABC",
+		`PROPER("hello wORLD")`:                "Hello World",
+		`TRIM("  a   b ")`:                     "a b",
+		`SUBSTITUTE("a-b-c", "-", "+")`:        "a+b+c",
+		`SUBSTITUTE("a-b-c", "-", "+", 2)`:     "a-b+c",
+		`REPLACE("abcdef", 2, 3, "X")`:         "aXef",
+		`REPT("ab", 3)`:                        "ababab",
+		`FIND("b", "abcb", 3)`:                 "4",
+		`FIND("B", "abc")`:                     "#VALUE!",
+		`SEARCH("B?", "abcd")`:                 "2",
+		`EXACT("a", "A")`:                      "0",
+		`TEXT(1234.5, "0.00")`:                 "1234.50",
+		`TEXT(1234.5, "#,##0.00")`:             "1,234.50",
+		`TEXT(-1234567, "#,##0")`:              "-1,234,567",
+		`TEXT(999, "#,##0")`:                   "999",
+		`TEXT(0.25, "0%")`:                     "25%",
+		`TEXT(DATE(2024, 3, 5), "yyyy-mm-dd")`: "2024-03-05",
+		`VALUE("12.5")`:                        "12.5",
+		`VALUE("abc")`:                         "#VALUE!",
+
+		// Dates and times
+		"DATE(1900, 1, 1)":                         "1",
+		"DATE(1900, 3, 1)":                         "61",
+		"DATE(2024, 1, 1)":                         "45292",
+		"DATE(2023, 14, 1)":                        "45323",
+		"DATE(124, 1, 1)":                          "45292",
+		"YEAR(45292)":                              "2024",
+		"MONTH(DATE(2024, 2, 29))":                 "2",
+		"DAY(DATE(2024, 2, 29))":                   "29",
+		"TIME(12, 0, 0)":                           "0.5",
+		"HOUR(0.75)":                               "18",
+		"MINUTE(TIME(1, 2, 3))":                    "2",
+		"SECOND(TIME(1, 2, 3))":                    "3",
+		"WEEKDAY(DATE(2024, 1, 1))":                "2",
+		"WEEKDAY(DATE(2024, 1, 1), 2)":             "1",
+		"WEEKDAY(DATE(2024, 1, 1), 3)":             "0",
+		"EDATE(DATE(2024, 1, 31), 1)":              "45351",
+		"EOMONTH(DATE(2024, 1, 15), 1)":            "45351",
+		"DAYS(DATE(2024, 3, 1), DATE(2024, 2, 1))": "29",
+		"TODAY()":                                  "45351",
+		"NOW()":                                    "45351.5625",
+		"YEAR(-1)":                                 "#NUM!",
+		"YEAR(0)":                                  "1900",
+		"MONTH(0)":                                 "1",
+		"DAY(0)":                                   "0",
+		"HOUR(0.5)":                                "12",
+
+		// Lookup and reference
+		`VLOOKUP(20, Data!E1:F3, 2, FALSE)`:          "twenty",
+		`VLOOKUP(25, Data!E1:F3, 2)`:                 "twenty",
+		`VLOOKUP(5, Data!E1:F3, 2)`:                  "#N/A",
+		`VLOOKUP(20, Data!E1:F3, 3, FALSE)`:          "#REF!",
+		`VLOOKUP("TW*", Data!F1:F3, 1, FALSE)`:       "twenty",
+		`HLOOKUP(2, Data!A1:A5, 1, FALSE)`:           "#N/A",
+		`HLOOKUP(10, Data!E1:F3, 3, FALSE)`:          "30",
+		`MATCH(3, Data!A1:A5, 0)`:                    "3",
+		`MATCH(3.5, Data!A1:A5)`:                     "3",
+		`MATCH("cherry", Data!B:B, 0)`:               "3",
+		`MATCH(0, Data!A1:A5, 0)`:                    "#N/A",
+		`MATCH(30, Data!E1:F1, 0)`:                   "#N/A",
+		`INDEX(Data!E1:F3, 2, 2)`:                    "twenty",
+		`INDEX(Data!A1:A5, MATCH(4, Data!A1:A5, 0))`: "4",
+		`INDEX(Data!E1:F1, 2)`:                       "ten",
+		`SUM(INDEX(Data!E1:F3, 0, 1))`:               "60",
+		`INDEX(Data!E1:F3, 4, 1)`:                    "#REF!",
+		`CHOOSE(2, "a", "b", "c")`:                   "b",
+		`CHOOSE(4, "a", "b", "c")`:                   "#VALUE!",
+		`ROW()`:                                      "1",
+		`ROW(Data!C7)`:                               "7",
+		`COLUMN(Data!C7)`:                            "3",
+		`ROWS(Data!A1:C5)`:                           "5",
+		`COLUMNS(Data!A:C)`:                          "3",
+		`_xlfn.CONCAT("a", "b")`:                     "ab",
+	} {
+		c.Check(evaluateFormula(c, f, formula).Value, Equals, expected, Commentf(formula))
+	}
+}
+
+// The result of a formula gives the cell its type.
+func (s *FormulaEvalSuite) TestResultTypes(c *C) {
+	f := makeFormulaTestFile(c)
+	cell := evaluateFormula(c, f, `"a"&"b"`)
+	c.Assert(cell.Type(), Equals, CellTypeStringFormula)
+	c.Assert(cell.Formula(), Equals, `"a"&"b"`)
+	cell = evaluateFormula(c, f, "1<2")
+	c.Assert(cell.Type(), Equals, CellTypeBool)
+	c.Assert(cell.Bool(), Equals, true)
+	cell = evaluateFormula(c, f, "1/0")
+	c.Assert(cell.Type(), Equals, CellTypeError)
+	cell = evaluateFormula(c, f, "Data!Z1")
+	c.Assert(cell.Type(), Equals, CellTypeNumeric)
+	c.Assert(cell.Value, Equals, "0")
+}
+
+// Formulas are evaluated after the formulas they refer to, whichever
+// sheet those are on, and the results are written with the file.
+func (s *FormulaEvalSuite) TestRecalculate(c *C) {
+	f := makeFormulaTestFile(c)
+	calc := f.Sheet["Calc"]
+	data := f.Sheet["Data"]
+	calc.Cell(0, 0).SetFormula("A2*2")
+	calc.Cell(1, 0).SetFormula("Data!G1+1")
+	data.Cell(0, 6).SetFormula("SUM(A1:A5)")
+	c.Assert(f.AddDefinedName("Total", "Data!$G$1", nil), IsNil)
+	calc.Cell(2, 0).SetFormula("Total/5")
+	calc.Cell(3, 0).SetStringFormula(`TEXT(A1, "0.0")`)
+
+	c.Assert(f.Recalculate(), IsNil)
+	c.Assert(data.Cell(0, 6).Value, Equals, "15")
+	c.Assert(calc.Cell(1, 0).Value, Equals, "16")
+	c.Assert(calc.Cell(0, 0).Value, Equals, "32")
+	c.Assert(calc.Cell(2, 0).Value, Equals, "3")
+	c.Assert(calc.Cell(3, 0).Value, Equals, "32.0")
+
+	rows, err := f.ToSlice()
+	c.Assert(err, IsNil)
+	c.Assert(rows[1][0][0], Equals, "32")
+
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), IsNil)
+	read, err := OpenBinary(buf.Bytes())
+	c.Assert(err, IsNil)
+	cell := read.Sheet["Calc"].Cell(0, 0)
+	c.Assert(cell.Value, Equals, "32")
+	c.Assert(cell.Formula(), Equals, "A2*2")
+}
+
+// Formulas that can't be evaluated keep their values, and the first of
+// them is reported once the others have been evaluated.
+func (s *FormulaEvalSuite) TestRecalculateErrors(c *C) {
+	f := makeFormulaTestFile(c)
+	calc := f.Sheet["Calc"]
+	calc.Cell(0, 0).SetFormula("B1+1")
+	calc.Cell(0, 1).SetFormula("A1+1")
+	calc.Cell(1, 0).SetFormula("NOSUCHFUNCTION(1)")
+	calc.Cell(1, 0).Value = "42"
+	calc.Cell(2, 0).SetFormula("A2*2")
+
+	err := f.Recalculate()
+	c.Assert(err, ErrorMatches, `Calc!B1: circular reference`)
+	c.Assert(calc.Cell(0, 0).Value, Equals, "")
+	c.Assert(calc.Cell(0, 1).Value, Equals, "")
+	c.Assert(calc.Cell(1, 0).Value, Equals, "42")
+	c.Assert(calc.Cell(2, 0).Value, Equals, "84")
+
+	err = calc.Cell(1, 0).Evaluate()
+	c.Assert(err, ErrorMatches, `Calc!A2: unsupported function NOSUCHFUNCTION`)
+
+	calc.Cell(3, 0).SetFormula("SUM((Data!A1,Data!A2))")
+	c.Assert(calc.Cell(3, 0).Evaluate(), ErrorMatches, `Calc!A4: unsupported union of references Data!A1,Data!A2`)
+	calc.Cell(3, 0).SetFormula("SUM(Data:Calc!A1)")
+	c.Assert(calc.Cell(3, 0).Evaluate(), ErrorMatches, `Calc!A4: unsupported reference Data:Calc!A1`)
+	calc.Cell(3, 0).SetFormula("[1]Data!A1")
+	c.Assert(calc.Cell(3, 0).Evaluate(), ErrorMatches, `Calc!A4: unsupported reference \[1\]Data!A1`)
+}
+
+// Long chains of formulas that each refer to the next are evaluated in
+// order without following them by recursion, as are long cycles.
+func (s *FormulaEvalSuite) TestLongChains(c *C) {
+	const length = 20000
+	f := NewFile()
+	sheet, err := f.AddSheet("Chain")
+	c.Assert(err, IsNil)
+	for i := 0; i < length-1; i++ {
+		sheet.Cell(i, 0).SetFormula(fmt.Sprintf("A%d+1", i+2))
+		sheet.Cell(i, 1).SetFormula(fmt.Sprintf("B%d+1", i+2))
+	}
+	sheet.Cell(length-1, 0).SetInt(1)
+	sheet.Cell(length-1, 1).SetFormula("B1")
+
+	c.Assert(sheet.Cell(0, 0).Evaluate(), IsNil)
+	c.Assert(sheet.Cell(0, 0).Value, Equals, strconv.Itoa(length))
+	c.Assert(sheet.Cell(length/2, 0).Value, Equals, strconv.Itoa(length/2))
+
+	c.Assert(f.Recalculate(), ErrorMatches, `Chain!B20000: circular reference`)
+	c.Assert(sheet.Cell(0, 1).Value, Equals, "")
+	c.Assert(sheet.Cell(length-1, 1).Value, Equals, "")
+}
+
+// Structured references evaluate to the parts of their table, and
+// array constants to their values.
+func (s *FormulaEvalSuite) TestStructuredRefsAndArrays(c *C) {
+	f := makeFormulaTestFile(c)
+	calc := f.Sheet["Calc"]
+	for i, row := range [][]interface{}{{"Item", "Price", "Qty"}, {"a", 2, 3}, {"b", 5, 1}, {"Total", nil, nil}} {
+		for j, value := range row {
+			if value != nil {
+				calc.Cell(i+2, j+1).SetValue(value)
+			}
+		}
+	}
+	table, err := calc.AddTable("B3:D6", "Orders", []string{"Item", "Price", "Qty"}, "")
+	c.Assert(err, IsNil)
+	table.TotalsRow = true
+	calc.Cell(5, 3).SetInt(4)
+	calc.Cell(3, 4).SetFormula("Orders[@Price]*Orders[@Qty]")
+	calc.Cell(4, 3).SetFormula("[@Price]-4")
+
+	for formula, expected := range map[string]string{
+		"SUM(Orders[Price])":                     "7",
+		"ROWS(Orders[#All])":                     "4",
+		"ROWS(Orders)":                           "#NAME?",
+		"COLUMNS(Orders[[#Data],[Price]:[Qty]])": "2",
+		"INDEX(Orders[#Headers],1,3)":            "Qty",
+		"Orders[[#Totals],[Qty]]":                "4",
+		"Orders[Missing]":                        "#REF!",
+		"Orders[@Price]":                         "#VALUE!",
+		"SUM({1,2;3,4})":                         "10",
+		"{5,6}+1":                                "6",
+		`COUNTA({"a",1,TRUE})`:                   "3",
+	} {
+		c.Check(evaluateFormula(c, f, formula).Value, Equals, expected, Commentf(formula))
+	}
+
+	c.Assert(calc.Cell(3, 4).Evaluate(), IsNil)
+	c.Assert(calc.Cell(3, 4).Value, Equals, "6")
+	c.Assert(calc.Cell(4, 3).Evaluate(), IsNil)
+	c.Assert(calc.Cell(4, 3).Value, Equals, "1")
+}
+
+// Evaluating a cell evaluates the cells that it refers to.
+func (s *FormulaEvalSuite) TestEvaluate(c *C) {
+	f := makeFormulaTestFile(c)
+	calc := f.Sheet["Calc"]
+	calc.Cell(0, 0).SetFormula("A2+1")
+	calc.Cell(1, 0).SetFormula("Data!A5*2")
+	c.Assert(calc.Cell(0, 0).Evaluate(), IsNil)
+	c.Assert(calc.Cell(0, 0).Value, Equals, "11")
+	c.Assert(calc.Cell(1, 0).Value, Equals, "10")
+
+	calc.Cell(2, 0).SetInt(3)
+	c.Assert(calc.Cell(2, 0).Evaluate(), IsNil)
+	c.Assert(calc.Cell(2, 0).Value, Equals, "3")
+}
+
+// Recalculating a file read from Excel gives the values that Excel
+// saved with it.
+func (s *FormulaEvalSuite) TestRecalculateReadFile(c *C) {
+	f, err := OpenFile("./testdocs/testcelltypes.xlsx")
+	c.Assert(err, IsNil)
+	before, err := f.ToSlice()
+	c.Assert(err, IsNil)
+	c.Assert(f.Recalculate(), IsNil)
+	after, err := f.ToSlice()
+	c.Assert(err, IsNil)
+	c.Assert(after, DeepEquals, before)
+	c.Assert(f.Sheets[0].Cell(7, 0).Type(), Equals, CellTypeError)
+}
@@ -0,0 +1,1813 @@
+package xlsx
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// formulaFunction is a function that formulas can call.  Its
+// arguments are passed unevaluated, so that functions such as IF only
+// evaluate the ones they need, and functions such as ROW can use the
+// references themselves.  MaxArgs is -1 for functions that take any
+// number of arguments.
+type formulaFunction struct {
+	minArgs, maxArgs int
+	call             func(e *formulaEvaluator, args []*FormulaNode) formulaValue
+}
+
+// formulaFunctions are the functions that formulas can call, by name.
+var formulaFunctions map[string]formulaFunction
+
+// formulaNow returns the time that TODAY and NOW give.
+var formulaNow = time.Now
+
+func init() {
+	formulaFunctions = map[string]formulaFunction{
+		// Maths
+		"ABS":        {1, 1, mathFunction(math.Abs)},
+		"AVERAGE":    {1, -1, formulaAverage},
+		"AVERAGEIF":  {2, 3, formulaAverageIf},
+		"AVERAGEIFS": {3, -1, formulaAverageIfs},
+		"CEILING":    {1, 2, formulaCeiling},
+		"COUNT":      {1, -1, formulaCount},
+		"COUNTA":     {1, -1, formulaCountA},
+		"COUNTBLANK": {1, 1, formulaCountBlank},
+		"COUNTIF":    {2, 2, formulaCountIf},
+		"COUNTIFS":   {2, -1, formulaCountIfs},
+		"EXP":        {1, 1, mathFunction(math.Exp)},
+		"FLOOR":      {2, 2, formulaFloor},
+		"INT":        {1, 1, mathFunction(math.Floor)},
+		"LN":         {1, 1, formulaLn},
+		"LOG":        {1, 2, formulaLog},
+		"LOG10":      {1, 1, formulaLog10},
+		"MAX":        {1, -1, formulaMax},
+		"MEDIAN":     {1, -1, formulaMedian},
+		"MIN":        {1, -1, formulaMin},
+		"MOD":        {2, 2, formulaMod},
+		"PI":         {0, 0, formulaPi},
+		"POWER":      {2, 2, formulaPower},
+		"PRODUCT":    {1, -1, formulaProduct},
+		"ROUND":      {2, 2, roundFunction(math.Round)},
+		"ROUNDDOWN":  {2, 2, roundFunction(math.Trunc)},
+		"ROUNDUP":    {2, 2, roundFunction(roundAwayFromZero)},
+		"SIGN":       {1, 1, formulaSign},
+		"SQRT":       {1, 1, formulaSqrt},
+		"SUM":        {1, -1, formulaSum},
+		"SUMIF":      {2, 3, formulaSumIf},
+		"SUMIFS":     {3, -1, formulaSumIfs},
+		"SUMPRODUCT": {1, -1, formulaSumProduct},
+		"TRUNC":      {1, 2, formulaTrunc},
+
+		// Logic and information
+		"AND":       {1, -1, formulaAnd},
+		"FALSE":     {0, 0, formulaFalse},
+		"IF":        {1, 3, formulaIf},
+		"IFERROR":   {2, 2, formulaIfError},
+		"IFNA":      {2, 2, formulaIfNA},
+		"IFS":       {2, -1, formulaIfs},
+		"ISBLANK":   {1, 1, isFunction(func(v formulaValue) bool { return v.typ == formulaValueBlank })},
+		"ISERR":     {1, 1, isFunction(func(v formulaValue) bool { return v.typ == formulaValueError && v.text != formulaErrorNA })},
+		"ISERROR":   {1, 1, isFunction(func(v formulaValue) bool { return v.typ == formulaValueError })},
+		"ISLOGICAL": {1, 1, isFunction(func(v formulaValue) bool { return v.typ == formulaValueBool })},
+		"ISNA":      {1, 1, isFunction(func(v formulaValue) bool { return v.typ == formulaValueError && v.text == formulaErrorNA })},
+		"ISNUMBER":  {1, 1, isFunction(func(v formulaValue) bool { return v.typ == formulaValueNumber })},
+		"ISTEXT":    {1, 1, isFunction(func(v formulaValue) bool { return v.typ == formulaValueText })},
+		"NA":        {0, 0, formulaNA},
+		"NOT":       {1, 1, formulaNot},
+		"OR":        {1, -1, formulaOr},
+		"TRUE":      {0, 0, formulaTrue},
+		"XOR":       {1, -1, formulaXor},
+
+		// Text
+		"CONCAT":      {1, -1, formulaConcat},
+		"CONCATENATE": {1, -1, formulaConcatenate},
+		"EXACT":       {2, 2, formulaExact},
+		"FIND":        {2, 3, formulaFind},
+		"LEFT":        {1, 2, formulaLeft},
+		"LEN":         {1, 1, formulaLen},
+		"LOWER":       {1, 1, textFunction(strings.ToLower)},
+		"MID":         {3, 3, formulaMid},
+		"PROPER":      {1, 1, textFunction(properCase)},
+		"REPLACE":     {4, 4, formulaReplace},
+		"REPT":        {2, 2, formulaRept},
+		"RIGHT":       {1, 2, formulaRight},
+		"SEARCH":      {2, 3, formulaSearch},
+		"SUBSTITUTE":  {3, 4, formulaSubstitute},
+		"TEXT":        {2, 2, formulaText},
+		"TEXTJOIN":    {3, -1, formulaTextJoin},
+		"TRIM":        {1, 1, textFunction(func(s string) string { return strings.Join(strings.Fields(s), " ") })},
+		"UPPER":       {1, 1, textFunction(strings.ToUpper)},
+		"VALUE":       {1, 1, formulaValueOf},
+
+		// Dates and times
+		"DATE":    {3, 3, formulaDate},
+		"DAY":     {1, 1, formulaDay},
+		"DAYS":    {2, 2, formulaDays},
+		"EDATE":   {2, 2, formulaEDate},
+		"EOMONTH": {2, 2, formulaEOMonth},
+		"HOUR":    {1, 1, dateFunction(func(t time.Time) int { return t.Hour() })},
+		"MINUTE":  {1, 1, dateFunction(func(t time.Time) int { return t.Minute() })},
+		"MONTH":   {1, 1, dateFunction(func(t time.Time) int { return int(t.Month()) })},
+		"NOW":     {0, 0, formulaNowFunction},
+		"SECOND":  {1, 1, dateFunction(func(t time.Time) int { return t.Second() })},
+		"TIME":    {3, 3, formulaTime},
+		"TODAY":   {0, 0, formulaToday},
+		"WEEKDAY": {1, 2, formulaWeekday},
+		"YEAR":    {1, 1, dateFunction(func(t time.Time) int { return t.Year() })},
+
+		// Lookup and reference
+		"CHOOSE":  {2, -1, formulaChoose},
+		"COLUMN":  {0, 1, formulaColumn},
+		"COLUMNS": {1, 1, formulaColumns},
+		"HLOOKUP": {3, 4, formulaHLookup},
+		"INDEX":   {2, 3, formulaIndex},
+		"MATCH":   {2, 3, formulaMatch},
+		"ROW":     {0, 1, formulaRow},
+		"ROWS":    {1, 1, formulaRows},
+		"VLOOKUP": {3, 4, formulaVLookup},
+	}
+}
+
+// value evaluates an argument to a single value.
+func (e *formulaEvaluator) value(arg *FormulaNode) formulaValue {
+	return e.scalar(e.eval(arg))
+}
+
+// number evaluates an argument to a number, returning the code of the
+// error to give instead when it can't be.
+func (e *formulaEvaluator) number(arg *FormulaNode) (float64, string) {
+	return e.toNumber(e.value(arg))
+}
+
+// text evaluates an argument to text, returning the code of the error
+// to give instead when it is an error.
+func (e *formulaEvaluator) text(arg *FormulaNode) (string, string) {
+	v := e.value(arg)
+	if v.typ == formulaValueError {
+		return "", v.text
+	}
+	return e.toText(v), ""
+}
+
+// integer evaluates an argument to a number, truncated to an integer.
+func (e *formulaEvaluator) integer(arg *FormulaNode) (int, string) {
+	n, code := e.number(arg)
+	return int(n), code
+}
+
+// area evaluates an argument that has to be a reference.
+func (e *formulaEvaluator) area(arg *FormulaNode) (formulaArea, string) {
+	v := e.eval(arg)
+	switch v.typ {
+	case formulaValueArea:
+		return v.area, ""
+	case formulaValueError:
+		return formulaArea{}, v.text
+	}
+	return formulaArea{}, formulaErrorValue
+}
+
+// numbers returns the numbers that the arguments of a function such as
+// SUM add up.  Cells in references and values in arrays only count if
+// they are numbers,
+// while values given directly are converted to numbers.
+func (e *formulaEvaluator) numbers(args []*FormulaNode) ([]float64, string) {
+	var numbers []float64
+	for _, arg := range args {
+		v := e.eval(arg)
+		switch v.typ {
+		case formulaValueArea, formulaValueArray:
+			code := ""
+			e.eachOf(v, func(v formulaValue) bool {
+				switch v.typ {
+				case formulaValueNumber:
+					numbers = append(numbers, v.number)
+				case formulaValueError:
+					code = v.text
+					return false
+				}
+				return true
+			})
+			if code != "" {
+				return nil, code
+			}
+		case formulaValueBlank:
+		default:
+			n, code := e.toNumber(v)
+			if code != "" {
+				return nil, code
+			}
+			numbers = append(numbers, n)
+		}
+	}
+	return numbers, ""
+}
+
+// values calls fn with every value of the arguments, going through
+// the cells of references and the values of arrays.
+func (e *formulaEvaluator) values(args []*FormulaNode, fn func(v formulaValue, inArea bool) bool) {
+	for _, arg := range args {
+		v := e.eval(arg)
+		if v.typ == formulaValueArea || v.typ == formulaValueArray {
+			stopped := false
+			e.eachOf(v, func(v formulaValue) bool {
+				stopped = !fn(v, true)
+				return !stopped
+			})
+			if stopped {
+				return
+			}
+			continue
+		}
+		if arg.Type == FormulaNodeEmpty {
+			continue
+		}
+		if !fn(v, false) {
+			return
+		}
+	}
+}
+
+func mathFunction(fn func(float64) float64) func(*formulaEvaluator, []*FormulaNode) formulaValue {
+	return func(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+		n, code := e.number(args[0])
+		if code != "" {
+			return errorValue(code)
+		}
+		return numberValue(fn(n))
+	}
+}
+
+func formulaSum(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	numbers, code := e.numbers(args)
+	if code != "" {
+		return errorValue(code)
+	}
+	sum := 0.0
+	for _, n := range numbers {
+		sum += n
+	}
+	return numberValue(sum)
+}
+
+func formulaProduct(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	numbers, code := e.numbers(args)
+	if code != "" {
+		return errorValue(code)
+	}
+	if len(numbers) == 0 {
+		return numberValue(0)
+	}
+	product := 1.0
+	for _, n := range numbers {
+		product *= n
+	}
+	return numberValue(product)
+}
+
+func formulaAverage(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	numbers, code := e.numbers(args)
+	if code != "" {
+		return errorValue(code)
+	}
+	return average(numbers)
+}
+
+func average(numbers []float64) formulaValue {
+	if len(numbers) == 0 {
+		return errorValue(formulaErrorDiv0)
+	}
+	sum := 0.0
+	for _, n := range numbers {
+		sum += n
+	}
+	return numberValue(sum / float64(len(numbers)))
+}
+
+func formulaMin(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	numbers, code := e.numbers(args)
+	if code != "" {
+		return errorValue(code)
+	}
+	if len(numbers) == 0 {
+		return numberValue(0)
+	}
+	min := numbers[0]
+	for _, n := range numbers[1:] {
+		min = math.Min(min, n)
+	}
+	return numberValue(min)
+}
+
+func formulaMax(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	numbers, code := e.numbers(args)
+	if code != "" {
+		return errorValue(code)
+	}
+	if len(numbers) == 0 {
+		return numberValue(0)
+	}
+	max := numbers[0]
+	for _, n := range numbers[1:] {
+		max = math.Max(max, n)
+	}
+	return numberValue(max)
+}
+
+func formulaMedian(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	numbers, code := e.numbers(args)
+	if code != "" {
+		return errorValue(code)
+	}
+	if len(numbers) == 0 {
+		return errorValue(formulaErrorNum)
+	}
+	sort.Float64s(numbers)
+	mid := len(numbers) / 2
+	if len(numbers)%2 == 1 {
+		return numberValue(numbers[mid])
+	}
+	return numberValue((numbers[mid-1] + numbers[mid]) / 2)
+}
+
+// formulaCount counts the numbers among its arguments, leaving out
+// errors and anything else that isn't a number.
+func formulaCount(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	count := 0
+	e.values(args, func(v formulaValue, inArea bool) bool {
+		if v.typ == formulaValueNumber {
+			count++
+		} else if !inArea && v.typ != formulaValueError && v.typ != formulaValueBlank {
+			if _, code := e.toNumber(v); code == "" {
+				count++
+			}
+		}
+		return true
+	})
+	return numberValue(float64(count))
+}
+
+func formulaCountA(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	count := 0
+	e.values(args, func(v formulaValue, inArea bool) bool {
+		if v.typ != formulaValueBlank {
+			count++
+		}
+		return true
+	})
+	return numberValue(float64(count))
+}
+
+func formulaCountBlank(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	a, code := e.area(args[0])
+	if code != "" {
+		return errorValue(code)
+	}
+	filled := 0
+	e.each(a, func(v formulaValue) bool {
+		if v.typ != formulaValueBlank && !(v.typ == formulaValueText && v.text == "") {
+			filled++
+		}
+		return true
+	})
+	return numberValue(float64(a.rows()*a.cols() - filled))
+}
+
+func formulaLn(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	n, code := e.number(args[0])
+	if code != "" {
+		return errorValue(code)
+	}
+	if n <= 0 {
+		return errorValue(formulaErrorNum)
+	}
+	return numberValue(math.Log(n))
+}
+
+func formulaLog(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	n, code := e.number(args[0])
+	if code != "" {
+		return errorValue(code)
+	}
+	base := 10.0
+	if len(args) > 1 {
+		if base, code = e.number(args[1]); code != "" {
+			return errorValue(code)
+		}
+	}
+	if n <= 0 || base <= 0 {
+		return errorValue(formulaErrorNum)
+	}
+	if base == 1 {
+		return errorValue(formulaErrorDiv0)
+	}
+	return numberValue(math.Log(n) / math.Log(base))
+}
+
+func formulaLog10(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	n, code := e.number(args[0])
+	if code != "" {
+		return errorValue(code)
+	}
+	if n <= 0 {
+		return errorValue(formulaErrorNum)
+	}
+	return numberValue(math.Log10(n))
+}
+
+func formulaSqrt(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	n, code := e.number(args[0])
+	if code != "" {
+		return errorValue(code)
+	}
+	if n < 0 {
+		return errorValue(formulaErrorNum)
+	}
+	return numberValue(math.Sqrt(n))
+}
+
+func formulaSign(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	n, code := e.number(args[0])
+	if code != "" {
+		return errorValue(code)
+	}
+	switch {
+	case n > 0:
+		return numberValue(1)
+	case n < 0:
+		return numberValue(-1)
+	}
+	return numberValue(0)
+}
+
+func formulaPi(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	return numberValue(math.Pi)
+}
+
+func formulaPower(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	a, code := e.number(args[0])
+	if code != "" {
+		return errorValue(code)
+	}
+	b, code := e.number(args[1])
+	if code != "" {
+		return errorValue(code)
+	}
+	if a == 0 && b == 0 {
+		return errorValue(formulaErrorNum)
+	}
+	return numberValue(math.Pow(a, b))
+}
+
+func formulaMod(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	a, code := e.number(args[0])
+	if code != "" {
+		return errorValue(code)
+	}
+	b, code := e.number(args[1])
+	if code != "" {
+		return errorValue(code)
+	}
+	if b == 0 {
+		return errorValue(formulaErrorDiv0)
+	}
+	return numberValue(a - b*math.Floor(a/b))
+}
+
+// roundFunction makes ROUND and its kin, which round to a number of
+// digits with fn.
+func roundFunction(fn func(float64) float64) func(*formulaEvaluator, []*FormulaNode) formulaValue {
+	return func(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+		n, code := e.number(args[0])
+		if code != "" {
+			return errorValue(code)
+		}
+		digits, code := e.integer(args[1])
+		if code != "" {
+			return errorValue(code)
+		}
+		return numberValue(roundDigits(n, digits, fn))
+	}
+}
+
+// roundDigits rounds n to a number of digits after the decimal point,
+// or before it when digits is negative.
+func roundDigits(n float64, digits int, fn func(float64) float64) float64 {
+	scale := math.Pow(10, float64(digits))
+	return fn(roundSignificant(n*scale)) / scale
+}
+
+func roundAwayFromZero(n float64) float64 {
+	if n < 0 {
+		return math.Floor(n)
+	}
+	return math.Ceil(n)
+}
+
+func formulaTrunc(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	n, code := e.number(args[0])
+	if code != "" {
+		return errorValue(code)
+	}
+	digits := 0
+	if len(args) > 1 {
+		if digits, code = e.integer(args[1]); code != "" {
+			return errorValue(code)
+		}
+	}
+	return numberValue(roundDigits(n, digits, math.Trunc))
+}
+
+func formulaCeiling(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	n, code := e.number(args[0])
+	if code != "" {
+		return errorValue(code)
+	}
+	significance := 1.0
+	if len(args) > 1 {
+		if significance, code = e.number(args[1]); code != "" {
+			return errorValue(code)
+		}
+	}
+	if significance == 0 {
+		return numberValue(0)
+	}
+	if n > 0 && significance < 0 {
+		return errorValue(formulaErrorNum)
+	}
+	return numberValue(math.Ceil(roundSignificant(n/significance)) * significance)
+}
+
+func formulaFloor(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	n, code := e.number(args[0])
+	if code != "" {
+		return errorValue(code)
+	}
+	significance, code := e.number(args[1])
+	if code != "" {
+		return errorValue(code)
+	}
+	if significance == 0 {
+		return errorValue(formulaErrorDiv0)
+	}
+	if n > 0 && significance < 0 {
+		return errorValue(formulaErrorNum)
+	}
+	return numberValue(math.Floor(roundSignificant(n/significance)) * significance)
+}
+
+// formulaSumProduct multiplies the cells at the same place in each of
+// its ranges, which have to be the same size, and adds up the products.
+// Cells that aren't numbers count as zero.
+func formulaSumProduct(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	var areas []formulaArea
+	for _, arg := range args {
+		a, code := e.area(arg)
+		if code != "" {
+			return errorValue(code)
+		}
+		if len(areas) > 0 && (a.rows() != areas[0].rows() || a.cols() != areas[0].cols()) {
+			return errorValue(formulaErrorValue)
+		}
+		areas = append(areas, a)
+	}
+	used := areas[0].used()
+	sum := 0.0
+	for r := 0; r <= used.maxRow-used.minRow; r++ {
+		for c := 0; c <= used.maxCol-used.minCol; c++ {
+			product := 1.0
+			for _, a := range areas {
+				v := e.resultAt(a, r, c)
+				switch v.typ {
+				case formulaValueError:
+					return v
+				case formulaValueNumber:
+					product *= v.number
+				default:
+					product = 0
+				}
+			}
+			sum += product
+		}
+	}
+	return numberValue(sum)
+}
+
+// formulaCriterion is the condition that SUMIF and its kin test cells
+// against, such as 5, ">=10", "<>" or "app*".
+type formulaCriterion struct {
+	op      string
+	value   formulaValue
+	pattern *regexp.Regexp
+}
+
+func (e *formulaEvaluator) criterion(arg *FormulaNode) (formulaCriterion, string) {
+	v := e.value(arg)
+	switch v.typ {
+	case formulaValueError:
+		return formulaCriterion{}, v.text
+	case formulaValueText:
+	case formulaValueBlank:
+		return formulaCriterion{op: "=", value: numberValue(0)}, ""
+	default:
+		return formulaCriterion{op: "=", value: v}, ""
+	}
+	c := formulaCriterion{op: "="}
+	operand := v.text
+	for _, op := range []string{"<=", ">=", "<>", "<", ">", "="} {
+		if strings.HasPrefix(operand, op) {
+			c.op = op
+			operand = operand[len(op):]
+			break
+		}
+	}
+	if n, ok := parseFormulaNumber(operand); ok {
+		c.value = numberValue(n)
+	} else if strings.EqualFold(operand, "TRUE") || strings.EqualFold(operand, "FALSE") {
+		c.value = boolValue(strings.EqualFold(operand, "TRUE"))
+	} else {
+		c.value = textValue(operand)
+		if c.op == "=" || c.op == "<>" {
+			c.pattern = wildcardRegexp(operand)
+		}
+	}
+	return c, ""
+}
+
+// matches reports whether a value meets the criterion.
+func (c formulaCriterion) matches(v formulaValue) bool {
+	if c.value.typ == formulaValueText && c.value.text == "" && (c.op == "=" || c.op == "<>") {
+		empty := v.typ == formulaValueBlank || (v.typ == formulaValueText && v.text == "")
+		return empty == (c.op == "=")
+	}
+	if v.typ == formulaValueBlank {
+		return c.op == "<>"
+	}
+	if c.pattern != nil {
+		matched := v.typ == formulaValueText && c.pattern.MatchString(v.text)
+		return matched == (c.op == "=")
+	}
+	if v.typ != c.value.typ {
+		return c.op == "<>"
+	}
+	cmp := compareFormulaValues(v, c.value)
+	switch c.op {
+	case "=":
+		return cmp == 0
+	case "<>":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case ">":
+		return cmp > 0
+	case "<=":
+		return cmp <= 0
+	}
+	return cmp >= 0
+}
+
+// wildcardRegexp returns the regexp that matches text as Excel's
+// wildcards do, where "*" is any text, "?" any character and "~"
+// escapes either of them.
+func wildcardRegexp(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("(?is)^")
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '~':
+			escaped = true
+		case r == '*':
+			b.WriteString(".*")
+		case r == '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	if escaped {
+		b.WriteString("~")
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// conditional calls fn with the offset of every cell in the used part
+// of the first of the ranges that meets the criterion given after each
+// range.  The ranges have to be the same size.
+func (e *formulaEvaluator) conditional(args []*FormulaNode, fn func(r, c int)) string {
+	var areas []formulaArea
+	var criteria []formulaCriterion
+	for i := 0; i+1 < len(args); i += 2 {
+		a, code := e.area(args[i])
+		if code != "" {
+			return code
+		}
+		if len(areas) > 0 && (a.rows() != areas[0].rows() || a.cols() != areas[0].cols()) {
+			return formulaErrorValue
+		}
+		c, code := e.criterion(args[i+1])
+		if code != "" {
+			return code
+		}
+		areas = append(areas, a)
+		criteria = append(criteria, c)
+	}
+	used := areas[0].used()
+	for r := 0; r <= used.maxRow-used.minRow; r++ {
+		for c := 0; c <= used.maxCol-used.minCol; c++ {
+			matched := true
+			for i, a := range areas {
+				if !criteria[i].matches(e.resultAt(a, r, c)) {
+					matched = false
+					break
+				}
+			}
+			if matched {
+				fn(r, c)
+			}
+		}
+	}
+	return ""
+}
+
+// conditionalNumbers returns the numbers in the cells of target whose
+// counterparts in the ranges meet the criteria, as SUMIFS does.  When
+// sameSize is set, target has to be the same size as the ranges, as it
+// does for SUMIFS but not for SUMIF.
+func (e *formulaEvaluator) conditionalNumbers(target *FormulaNode, args []*FormulaNode, sameSize bool) ([]float64, string) {
+	a, code := e.area(target)
+	if code != "" {
+		return nil, code
+	}
+	if sameSize {
+		first, code := e.area(args[0])
+		if code != "" {
+			return nil, code
+		}
+		if first.rows() != a.rows() || first.cols() != a.cols() {
+			return nil, formulaErrorValue
+		}
+	}
+	var numbers []float64
+	code = e.conditional(args, func(r, c int) {
+		v := e.resultAt(a, r, c)
+		switch v.typ {
+		case formulaValueNumber:
+			numbers = append(numbers, v.number)
+		case formulaValueError:
+			if code == "" {
+				code = v.text
+			}
+		}
+	})
+	return numbers, code
+}
+
+// ifArgs returns the arguments of SUMIF or AVERAGEIF as a range and a
+// criterion, along with the range whose cells are used.
+func ifArgs(args []*FormulaNode) (*FormulaNode, []*FormulaNode) {
+	if len(args) > 2 && args[2].Type != FormulaNodeEmpty {
+		return args[2], args[:2]
+	}
+	return args[0], args[:2]
+}
+
+func formulaSumIf(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	target, conditions := ifArgs(args)
+	return sumConditional(e, target, conditions, false)
+}
+
+func formulaSumIfs(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	if len(args)%2 == 0 {
+		return errorValue(formulaErrorValue)
+	}
+	return sumConditional(e, args[0], args[1:], true)
+}
+
+func sumConditional(e *formulaEvaluator, target *FormulaNode, conditions []*FormulaNode, sameSize bool) formulaValue {
+	numbers, code := e.conditionalNumbers(target, conditions, sameSize)
+	if code != "" {
+		return errorValue(code)
+	}
+	sum := 0.0
+	for _, n := range numbers {
+		sum += n
+	}
+	return numberValue(sum)
+}
+
+func formulaAverageIf(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	target, conditions := ifArgs(args)
+	numbers, code := e.conditionalNumbers(target, conditions, false)
+	if code != "" {
+		return errorValue(code)
+	}
+	return average(numbers)
+}
+
+func formulaAverageIfs(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	if len(args)%2 == 0 {
+		return errorValue(formulaErrorValue)
+	}
+	numbers, code := e.conditionalNumbers(args[0], args[1:], true)
+	if code != "" {
+		return errorValue(code)
+	}
+	return average(numbers)
+}
+
+func formulaCountIf(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	return formulaCountIfs(e, args)
+}
+
+func formulaCountIfs(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	if len(args)%2 == 1 {
+		return errorValue(formulaErrorValue)
+	}
+	count := 0
+	if code := e.conditional(args, func(r, c int) { count++ }); code != "" {
+		return errorValue(code)
+	}
+	return numberValue(float64(count))
+}
+
+func formulaTrue(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	return boolValue(true)
+}
+
+func formulaFalse(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	return boolValue(false)
+}
+
+func formulaNA(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	return errorValue(formulaErrorNA)
+}
+
+func formulaIf(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	condition, code := e.toBool(e.value(args[0]))
+	if code != "" {
+		return errorValue(code)
+	}
+	if condition {
+		if len(args) < 2 {
+			return boolValue(true)
+		}
+		return e.eval(args[1])
+	}
+	if len(args) < 3 {
+		return boolValue(false)
+	}
+	return e.eval(args[2])
+}
+
+func formulaIfs(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	if len(args)%2 == 1 {
+		return errorValue(formulaErrorValue)
+	}
+	for i := 0; i < len(args); i += 2 {
+		condition, code := e.toBool(e.value(args[i]))
+		if code != "" {
+			return errorValue(code)
+		}
+		if condition {
+			return e.eval(args[i+1])
+		}
+	}
+	return errorValue(formulaErrorNA)
+}
+
+func formulaIfError(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	if v := e.value(args[0]); v.typ != formulaValueError {
+		return v
+	}
+	return e.eval(args[1])
+}
+
+func formulaIfNA(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	if v := e.value(args[0]); v.typ != formulaValueError || v.text != formulaErrorNA {
+		return v
+	}
+	return e.eval(args[1])
+}
+
+// isFunction makes ISBLANK and its kin, which test the type of a
+// value.
+func isFunction(test func(formulaValue) bool) func(*formulaEvaluator, []*FormulaNode) formulaValue {
+	return func(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+		return boolValue(test(e.value(args[0])))
+	}
+}
+
+func formulaNot(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	b, code := e.toBool(e.value(args[0]))
+	if code != "" {
+		return errorValue(code)
+	}
+	return boolValue(!b)
+}
+
+// logical calls fn with the boolean values of the arguments of AND
+// and its kin.  Text in references is left out.
+func (e *formulaEvaluator) logical(args []*FormulaNode, fn func(b bool)) formulaValue {
+	code := ""
+	found := false
+	e.values(args, func(v formulaValue, inArea bool) bool {
+		if inArea && (v.typ == formulaValueText || v.typ == formulaValueBlank) {
+			return true
+		}
+		var b bool
+		if b, code = e.toBool(v); code != "" {
+			return false
+		}
+		found = true
+		fn(b)
+		return true
+	})
+	switch {
+	case code != "":
+		return errorValue(code)
+	case !found:
+		return errorValue(formulaErrorValue)
+	}
+	return formulaValue{}
+}
+
+func formulaAnd(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	result := true
+	if v := e.logical(args, func(b bool) { result = result && b }); v.typ == formulaValueError {
+		return v
+	}
+	return boolValue(result)
+}
+
+func formulaOr(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	result := false
+	if v := e.logical(args, func(b bool) { result = result || b }); v.typ == formulaValueError {
+		return v
+	}
+	return boolValue(result)
+}
+
+func formulaXor(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	result := false
+	if v := e.logical(args, func(b bool) { result = result != b }); v.typ == formulaValueError {
+		return v
+	}
+	return boolValue(result)
+}
+
+// textFunction makes functions such as UPPER, which change text.
+func textFunction(fn func(string) string) func(*formulaEvaluator, []*FormulaNode) formulaValue {
+	return func(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+		s, code := e.text(args[0])
+		if code != "" {
+			return errorValue(code)
+		}
+		return textValue(fn(s))
+	}
+}
+
+// properCase capitalises the first letter of every word and lowers the
+// others, as PROPER does.
+func properCase(s string) string {
+	runes := []rune(s)
+	start := true
+	for i, r := range runes {
+		if unicode.IsLetter(r) {
+			if start {
+				runes[i] = unicode.ToUpper(r)
+			} else {
+				runes[i] = unicode.ToLower(r)
+			}
+			start = false
+		} else {
+			start = true
+		}
+	}
+	return string(runes)
+}
+
+func formulaConcatenate(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	var b strings.Builder
+	for _, arg := range args {
+		s, code := e.text(arg)
+		if code != "" {
+			return errorValue(code)
+		}
+		b.WriteString(s)
+	}
+	return textValue(b.String())
+}
+
+func formulaConcat(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	var parts []string
+	code := ""
+	e.values(args, func(v formulaValue, inArea bool) bool {
+		if v.typ == formulaValueError {
+			code = v.text
+			return false
+		}
+		parts = append(parts, e.toText(v))
+		return true
+	})
+	if code != "" {
+		return errorValue(code)
+	}
+	return textValue(strings.Join(parts, ""))
+}
+
+func formulaTextJoin(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	delimiter, code := e.text(args[0])
+	if code != "" {
+		return errorValue(code)
+	}
+	ignoreEmpty, code := e.toBool(e.value(args[1]))
+	if code != "" {
+		return errorValue(code)
+	}
+	var parts []string
+	e.values(args[2:], func(v formulaValue, inArea bool) bool {
+		if v.typ == formulaValueError {
+			code = v.text
+			return false
+		}
+		if s := e.toText(v); s != "" || !ignoreEmpty {
+			parts = append(parts, s)
+		}
+		return true
+	})
+	if code != "" {
+		return errorValue(code)
+	}
+	return textValue(strings.Join(parts, delimiter))
+}
+
+func formulaExact(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	a, code := e.text(args[0])
+	if code != "" {
+		return errorValue(code)
+	}
+	b, code := e.text(args[1])
+	if code != "" {
+		return errorValue(code)
+	}
+	return boolValue(a == b)
+}
+
+func formulaLen(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	s, code := e.text(args[0])
+	if code != "" {
+		return errorValue(code)
+	}
+	return numberValue(float64(len([]rune(s))))
+}
+
+// textAndCount returns the text and the number of characters given to
+// LEFT and RIGHT, which is one when it is left out.
+func (e *formulaEvaluator) textAndCount(args []*FormulaNode) ([]rune, int, string) {
+	s, code := e.text(args[0])
+	if code != "" {
+		return nil, 0, code
+	}
+	n := 1
+	if len(args) > 1 {
+		if n, code = e.integer(args[1]); code != "" {
+			return nil, 0, code
+		}
+	}
+	if n < 0 {
+		return nil, 0, formulaErrorValue
+	}
+	runes := []rune(s)
+	if n > len(runes) {
+		n = len(runes)
+	}
+	return runes, n, ""
+}
+
+func formulaLeft(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	runes, n, code := e.textAndCount(args)
+	if code != "" {
+		return errorValue(code)
+	}
+	return textValue(string(runes[:n]))
+}
+
+func formulaRight(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	runes, n, code := e.textAndCount(args)
+	if code != "" {
+		return errorValue(code)
+	}
+	return textValue(string(runes[len(runes)-n:]))
+}
+
+func formulaMid(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	s, code := e.text(args[0])
+	if code != "" {
+		return errorValue(code)
+	}
+	start, code := e.integer(args[1])
+	if code != "" {
+		return errorValue(code)
+	}
+	n, code := e.integer(args[2])
+	if code != "" {
+		return errorValue(code)
+	}
+	if start < 1 || n < 0 {
+		return errorValue(formulaErrorValue)
+	}
+	runes := []rune(s)
+	if start > len(runes) {
+		return textValue("")
+	}
+	end := start - 1 + n
+	if end > len(runes) {
+		end = len(runes)
+	}
+	return textValue(string(runes[start-1 : end]))
+}
+
+func formulaReplace(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	s, code := e.text(args[0])
+	if code != "" {
+		return errorValue(code)
+	}
+	start, code := e.integer(args[1])
+	if code != "" {
+		return errorValue(code)
+	}
+	n, code := e.integer(args[2])
+	if code != "" {
+		return errorValue(code)
+	}
+	replacement, code := e.text(args[3])
+	if code != "" {
+		return errorValue(code)
+	}
+	if start < 1 || n < 0 {
+		return errorValue(formulaErrorValue)
+	}
+	runes := []rune(s)
+	if start > len(runes)+1 {
+		start = len(runes) + 1
+	}
+	end := start - 1 + n
+	if end > len(runes) {
+		end = len(runes)
+	}
+	return textValue(string(runes[:start-1]) + replacement + string(runes[end:]))
+}
+
+func formulaRept(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	s, code := e.text(args[0])
+	if code != "" {
+		return errorValue(code)
+	}
+	n, code := e.integer(args[1])
+	if code != "" {
+		return errorValue(code)
+	}
+	if n < 0 || len(s)*n > 32767 {
+		return errorValue(formulaErrorValue)
+	}
+	return textValue(strings.Repeat(s, n))
+}
+
+func formulaSubstitute(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	s, code := e.text(args[0])
+	if code != "" {
+		return errorValue(code)
+	}
+	old, code := e.text(args[1])
+	if code != "" {
+		return errorValue(code)
+	}
+	replacement, code := e.text(args[2])
+	if code != "" {
+		return errorValue(code)
+	}
+	if old == "" {
+		return textValue(s)
+	}
+	if len(args) < 4 {
+		return textValue(strings.Replace(s, old, replacement, -1))
+	}
+	instance, code := e.integer(args[3])
+	if code != "" {
+		return errorValue(code)
+	}
+	if instance < 1 {
+		return errorValue(formulaErrorValue)
+	}
+	offset := 0
+	for i := 1; ; i++ {
+		index := strings.Index(s[offset:], old)
+		if index < 0 {
+			return textValue(s)
+		}
+		offset += index
+		if i == instance {
+			return textValue(s[:offset] + replacement + s[offset+len(old):])
+		}
+		offset += len(old)
+	}
+}
+
+// position returns the text to look in and the position to start at,
+// counting from zero, of FIND and SEARCH.
+func (e *formulaEvaluator) position(args []*FormulaNode) ([]rune, int, string) {
+	within, code := e.text(args[1])
+	if code != "" {
+		return nil, 0, code
+	}
+	start := 1
+	if len(args) > 2 {
+		if start, code = e.integer(args[2]); code != "" {
+			return nil, 0, code
+		}
+	}
+	runes := []rune(within)
+	if start < 1 || start > len(runes)+1 {
+		return nil, 0, formulaErrorValue
+	}
+	return runes, start - 1, ""
+}
+
+func formulaFind(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	find, code := e.text(args[0])
+	if code != "" {
+		return errorValue(code)
+	}
+	within, start, code := e.position(args)
+	if code != "" {
+		return errorValue(code)
+	}
+	index := strings.Index(string(within[start:]), find)
+	if index < 0 {
+		return errorValue(formulaErrorValue)
+	}
+	return numberValue(float64(start + len([]rune(string(within[start:])[:index])) + 1))
+}
+
+// formulaSearch finds text as FIND does, but without regard to case
+// and with wildcards.
+func formulaSearch(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	find, code := e.text(args[0])
+	if code != "" {
+		return errorValue(code)
+	}
+	within, start, code := e.position(args)
+	if code != "" {
+		return errorValue(code)
+	}
+	pattern := wildcardRegexp(find).String()
+	pattern = strings.TrimSuffix(strings.Replace(pattern, "^", "", 1), "$")
+	re := regexp.MustCompile(pattern)
+	loc := re.FindStringIndex(string(within[start:]))
+	if loc == nil {
+		return errorValue(formulaErrorValue)
+	}
+	return numberValue(float64(start + len([]rune(string(within[start:])[:loc[0]])) + 1))
+}
+
+// formulaText formats a number with a number format, as a cell with
+// that format would show it, but with the commas between thousands
+// that the format asks for.
+func formulaText(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	v := e.value(args[0])
+	if v.typ == formulaValueError {
+		return v
+	}
+	format, code := e.text(args[1])
+	if code != "" {
+		return errorValue(code)
+	}
+	n, code := e.toNumber(v)
+	if code != "" {
+		return textValue(e.toText(v))
+	}
+	cell := &Cell{
+		Value:    formatFormulaNumber(n),
+		NumFmt:   format,
+		cellType: CellTypeNumeric,
+		date1904: e.date1904,
+	}
+	s, err := cell.FormattedValue()
+	if err != nil {
+		return errorValue(formulaErrorValue)
+	}
+	if thousandsSeparator.MatchString(format) {
+		s = groupThousands(s)
+	}
+	return textValue(s)
+}
+
+// thousandsSeparator matches a number format, such as "#,##0.00", that
+// separates the thousands of the numbers it shows with commas.
+var thousandsSeparator = regexp.MustCompile(`[#0?],[#0?]`)
+
+// groupThousands puts commas between the thousands of the whole part
+// of the first number in s, which cell formatting leaves out.
+func groupThousands(s string) string {
+	start := strings.IndexFunc(s, unicode.IsDigit)
+	if start < 0 {
+		return s
+	}
+	end := start
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	digits := s[start:end]
+	var grouped strings.Builder
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			grouped.WriteByte(',')
+		}
+		grouped.WriteRune(digit)
+	}
+	return s[:start] + grouped.String() + s[end:]
+}
+
+func formulaValueOf(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	v := e.value(args[0])
+	switch v.typ {
+	case formulaValueError, formulaValueNumber:
+		return v
+	case formulaValueBlank:
+		return numberValue(0)
+	case formulaValueText:
+		if n, ok := parseFormulaNumber(v.text); ok {
+			return numberValue(n)
+		}
+	}
+	return errorValue(formulaErrorValue)
+}
+
+var (
+	formulaEpoch1900 = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	formulaEpoch1904 = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// formulaTimeToSerial returns the serial number of a time, taking its
+// date and time of day as they are, whatever its location.  In the
+// 1900 date system, serial numbers from 1 March 1900 are one more than
+// the days since the epoch, as Excel counts a 29 February 1900 that
+// didn't happen.
+func formulaTimeToSerial(t time.Time, date1904 bool) float64 {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	seconds := t.Hour()*3600 + t.Minute()*60 + t.Second()
+	fraction := (float64(seconds) + float64(t.Nanosecond())/1e9) / secondsInADay
+	if date1904 {
+		return math.Round(day.Sub(formulaEpoch1904).Hours()/24) + fraction
+	}
+	days := math.Round(day.Sub(formulaEpoch1900).Hours() / 24)
+	if days < 61 {
+		days--
+	}
+	return days + fraction
+}
+
+// formulaSerialToTime returns the time of a serial number, to the
+// nearest second.
+func formulaSerialToTime(serial float64, date1904 bool) time.Time {
+	days := math.Floor(serial)
+	seconds := math.Round((serial - days) * secondsInADay)
+	epoch := formulaEpoch1904
+	if !date1904 {
+		epoch = formulaEpoch1900
+		if days < 61 {
+			days++
+		}
+	}
+	return epoch.AddDate(0, 0, int(days)).Add(time.Duration(seconds) * time.Second)
+}
+
+// parseDateCellValue parses the ISO 8601 value of a date cell.
+func parseDateCellValue(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// serial evaluates an argument to the serial number of a date.
+func (e *formulaEvaluator) serial(arg *FormulaNode) (time.Time, string) {
+	n, code := e.number(arg)
+	if code != "" {
+		return time.Time{}, code
+	}
+	if n < 0 {
+		return time.Time{}, formulaErrorNum
+	}
+	return formulaSerialToTime(n, e.date1904), ""
+}
+
+// isDayZero reports whether a time is on the day of serial number 0,
+// which in the 1900 date system Excel calls 0 January 1900.
+func (e *formulaEvaluator) isDayZero(t time.Time) bool {
+	return !e.date1904 && t.Year() < 1900
+}
+
+// dateFunction makes YEAR and its kin, which return a part of a date.
+// They treat 0 January 1900 as being in January 1900.
+func dateFunction(fn func(time.Time) int) func(*formulaEvaluator, []*FormulaNode) formulaValue {
+	return func(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+		t, code := e.serial(args[0])
+		if code != "" {
+			return errorValue(code)
+		}
+		if e.isDayZero(t) {
+			t = t.AddDate(0, 0, 1)
+		}
+		return numberValue(float64(fn(t)))
+	}
+}
+
+// formulaDay returns the day of the month of a date, which is 0 for
+// serial number 0.
+func formulaDay(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	t, code := e.serial(args[0])
+	if code != "" {
+		return errorValue(code)
+	}
+	if e.isDayZero(t) {
+		return numberValue(0)
+	}
+	return numberValue(float64(t.Day()))
+}
+
+// dateSerial returns the serial number of a date, or #NUM! when it is
+// before the epoch or after the year 9999.
+func (e *formulaEvaluator) dateSerial(t time.Time) formulaValue {
+	serial := formulaTimeToSerial(t, e.date1904)
+	if serial < 0 || t.Year() > 9999 {
+		return errorValue(formulaErrorNum)
+	}
+	return numberValue(serial)
+}
+
+// formulaDate returns the serial number of a date.  As in Excel, years
+// before 1900 count from 1900, and months and days outside of their
+// range carry over.
+func formulaDate(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	var parts [3]int
+	for i, arg := range args {
+		n, code := e.integer(arg)
+		if code != "" {
+			return errorValue(code)
+		}
+		parts[i] = n
+	}
+	year := parts[0]
+	if year >= 0 && year < 1900 {
+		year += 1900
+	}
+	if year < 0 {
+		return errorValue(formulaErrorNum)
+	}
+	return e.dateSerial(time.Date(year, time.Month(parts[1]), parts[2], 0, 0, 0, 0, time.UTC))
+}
+
+func formulaTime(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	var parts [3]int
+	for i, arg := range args {
+		n, code := e.integer(arg)
+		if code != "" {
+			return errorValue(code)
+		}
+		parts[i] = n
+	}
+	seconds := parts[0]*3600 + parts[1]*60 + parts[2]
+	if seconds < 0 {
+		return errorValue(formulaErrorNum)
+	}
+	return numberValue(float64(seconds%86400) / secondsInADay)
+}
+
+func formulaToday(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	now := formulaNow()
+	return e.dateSerial(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC))
+}
+
+func formulaNowFunction(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	return e.dateSerial(formulaNow())
+}
+
+func formulaDays(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	end, code := e.number(args[0])
+	if code != "" {
+		return errorValue(code)
+	}
+	start, code := e.number(args[1])
+	if code != "" {
+		return errorValue(code)
+	}
+	return numberValue(math.Floor(end) - math.Floor(start))
+}
+
+// addMonths returns the date a number of months after t, on the same
+// day or the last day of the month when it has fewer days.
+func addMonths(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, 0, 0, 0, 0, time.UTC)
+	last := first.AddDate(0, 1, -1).Day()
+	day := t.Day()
+	if day > last {
+		day = last
+	}
+	return time.Date(first.Year(), first.Month(), day, 0, 0, 0, 0, time.UTC)
+}
+
+func formulaEDate(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	t, code := e.serial(args[0])
+	if code != "" {
+		return errorValue(code)
+	}
+	months, code := e.integer(args[1])
+	if code != "" {
+		return errorValue(code)
+	}
+	return e.dateSerial(addMonths(t, months))
+}
+
+func formulaEOMonth(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	t, code := e.serial(args[0])
+	if code != "" {
+		return errorValue(code)
+	}
+	months, code := e.integer(args[1])
+	if code != "" {
+		return errorValue(code)
+	}
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, 0, 0, 0, 0, time.UTC)
+	return e.dateSerial(first.AddDate(0, 1, -1))
+}
+
+// formulaWeekday returns the day of the week, counting from Sunday as
+// 1 by default, from Monday as 1 for type 2 and from Monday as 0 for
+// type 3.
+func formulaWeekday(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	t, code := e.serial(args[0])
+	if code != "" {
+		return errorValue(code)
+	}
+	kind := 1
+	if len(args) > 1 {
+		if kind, code = e.integer(args[1]); code != "" {
+			return errorValue(code)
+		}
+	}
+	day := int(t.Weekday())
+	switch kind {
+	case 1:
+		return numberValue(float64(day + 1))
+	case 2:
+		return numberValue(float64((day+6)%7 + 1))
+	case 3:
+		return numberValue(float64((day + 6) % 7))
+	}
+	return errorValue(formulaErrorNum)
+}
+
+func formulaChoose(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	index, code := e.integer(args[0])
+	if code != "" {
+		return errorValue(code)
+	}
+	if index < 1 || index >= len(args) {
+		return errorValue(formulaErrorValue)
+	}
+	return e.eval(args[index])
+}
+
+func formulaRow(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	if len(args) == 0 {
+		return numberValue(float64(e.row + 1))
+	}
+	a, code := e.area(args[0])
+	if code != "" {
+		return errorValue(code)
+	}
+	return numberValue(float64(a.minRow + 1))
+}
+
+func formulaColumn(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	if len(args) == 0 {
+		return numberValue(float64(e.col + 1))
+	}
+	a, code := e.area(args[0])
+	if code != "" {
+		return errorValue(code)
+	}
+	return numberValue(float64(a.minCol + 1))
+}
+
+func formulaRows(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	a, code := e.area(args[0])
+	if code != "" {
+		return errorValue(code)
+	}
+	return numberValue(float64(a.rows()))
+}
+
+func formulaColumns(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	a, code := e.area(args[0])
+	if code != "" {
+		return errorValue(code)
+	}
+	return numberValue(float64(a.cols()))
+}
+
+// lookup returns the offset of the value in a row or column of n
+// cells, or -1 if it isn't there.  A matchType of 0 looks for the
+// value itself, with wildcards for text.  Otherwise the cells are taken
+// to be sorted, ascending for 1, where the largest value that is not
+// greater than the one looked up is found, and descending for -1, where
+// the smallest value that is not less than it is.
+func (e *formulaEvaluator) lookup(value formulaValue, n int, get func(i int) formulaValue, matchType int) int {
+	var pattern *regexp.Regexp
+	if matchType == 0 && value.typ == formulaValueText && strings.ContainsAny(value.text, "*?~") {
+		pattern = wildcardRegexp(value.text)
+	}
+	found := -1
+	for i := 0; i < n; i++ {
+		v := get(i)
+		if v.typ == formulaValueBlank || v.typ == formulaValueError {
+			continue
+		}
+		if pattern != nil {
+			if v.typ == formulaValueText && pattern.MatchString(v.text) {
+				return i
+			}
+			continue
+		}
+		if (v.typ == formulaValueNumber) != (value.typ == formulaValueNumber) || (v.typ == formulaValueBool) != (value.typ == formulaValueBool) {
+			continue
+		}
+		cmp := compareFormulaValues(v, value)
+		switch {
+		case matchType == 0:
+			if cmp == 0 {
+				return i
+			}
+		case cmp == 0:
+			return i
+		case (matchType > 0) == (cmp < 0):
+			found = i
+		default:
+			return found
+		}
+	}
+	return found
+}
+
+// lookupValue evaluates the value that VLOOKUP and its kin look for.
+func (e *formulaEvaluator) lookupValue(arg *FormulaNode) (formulaValue, string) {
+	v := e.value(arg)
+	switch v.typ {
+	case formulaValueError:
+		return v, v.text
+	case formulaValueBlank:
+		return numberValue(0), ""
+	}
+	return v, ""
+}
+
+// tableLookup looks up a value in the first column of a table for
+// VLOOKUP, or its first row for HLOOKUP, and returns the value in
+// the same row or column that is index cells along.
+func (e *formulaEvaluator) tableLookup(args []*FormulaNode, vertical bool) formulaValue {
+	value, code := e.lookupValue(args[0])
+	if code != "" {
+		return errorValue(code)
+	}
+	table, code := e.area(args[1])
+	if code != "" {
+		return errorValue(code)
+	}
+	index, code := e.integer(args[2])
+	if code != "" {
+		return errorValue(code)
+	}
+	sorted := true
+	if len(args) > 3 {
+		if sorted, code = e.toBool(e.value(args[3])); code != "" {
+			return errorValue(code)
+		}
+	}
+	matchType := 0
+	if sorted {
+		matchType = 1
+	}
+	used := table.used()
+	if vertical {
+		if index < 1 {
+			return errorValue(formulaErrorValue)
+		} else if index > table.cols() {
+			return errorValue(formulaErrorRef)
+		}
+		row := e.lookup(value, used.maxRow-used.minRow+1, func(i int) formulaValue {
+			return e.resultAt(table, i, 0)
+		}, matchType)
+		if row < 0 {
+			return errorValue(formulaErrorNA)
+		}
+		return e.resultAt(table, row, index-1)
+	}
+	if index < 1 {
+		return errorValue(formulaErrorValue)
+	} else if index > table.rows() {
+		return errorValue(formulaErrorRef)
+	}
+	col := e.lookup(value, used.maxCol-used.minCol+1, func(i int) formulaValue {
+		return e.resultAt(table, 0, i)
+	}, matchType)
+	if col < 0 {
+		return errorValue(formulaErrorNA)
+	}
+	return e.resultAt(table, index-1, col)
+}
+
+func formulaVLookup(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	return e.tableLookup(args, true)
+}
+
+func formulaHLookup(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	return e.tableLookup(args, false)
+}
+
+func formulaMatch(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	value, code := e.lookupValue(args[0])
+	if code != "" {
+		return errorValue(code)
+	}
+	a, code := e.area(args[1])
+	if code != "" {
+		return errorValue(code)
+	}
+	matchType := 1
+	if len(args) > 2 {
+		if matchType, code = e.integer(args[2]); code != "" {
+			return errorValue(code)
+		}
+	}
+	if a.rows() > 1 && a.cols() > 1 {
+		return errorValue(formulaErrorNA)
+	}
+	used := a.used()
+	get := func(i int) formulaValue { return e.resultAt(a, i, 0) }
+	n := used.maxRow - used.minRow + 1
+	if a.rows() == 1 {
+		get = func(i int) formulaValue { return e.resultAt(a, 0, i) }
+		n = used.maxCol - used.minCol + 1
+	}
+	i := e.lookup(value, n, get, matchType)
+	if i < 0 {
+		return errorValue(formulaErrorNA)
+	}
+	return numberValue(float64(i + 1))
+}
+
+// formulaIndex returns the reference to the cell at a row and column
+// of a range, counting from 1.  A row or column of 0 gives the whole
+// column or row.
+func formulaIndex(e *formulaEvaluator, args []*FormulaNode) formulaValue {
+	a, code := e.area(args[0])
+	if code != "" {
+		return errorValue(code)
+	}
+	row, code := e.integer(args[1])
+	if code != "" {
+		return errorValue(code)
+	}
+	col := 0
+	if len(args) > 2 {
+		if col, code = e.integer(args[2]); code != "" {
+			return errorValue(code)
+		}
+	} else if a.rows() == 1 {
+		row, col = 0, row
+	}
+	if row < 0 || col < 0 || row > a.rows() || col > a.cols() {
+		return errorValue(formulaErrorRef)
+	}
+	if row > 0 {
+		a.minRow += row - 1
+		a.maxRow = a.minRow
+	}
+	if col > 0 {
+		a.minCol += col - 1
+		a.maxCol = a.minCol
+	}
+	return areaValue(a)
+}
@@ -0,0 +1,266 @@
+package xlsx
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type FormulaSuite struct{}
+
+var _ = Suite(&FormulaSuite{})
+
+func (s *FormulaSuite) TestTokenizeFormula(c *C) {
+	tokens, err := TokenizeFormula(`=SUM('My Sheet'!$A$1:B2, 1.5e2)&"a""b"<>#N/A`)
+	c.Assert(err, IsNil)
+	c.Assert(tokens, DeepEquals, []FormulaToken{
+		{FormulaTokenFunction, "SUM"},
+		{FormulaTokenRef, "'My Sheet'!$A$1:B2"},
+		{FormulaTokenSeparator, ","},
+		{FormulaTokenNumber, "1.5e2"},
+		{FormulaTokenClose, ")"},
+		{FormulaTokenOperator, "&"},
+		{FormulaTokenText, `a"b`},
+		{FormulaTokenOperator, "<>"},
+		{FormulaTokenError, "#N/A"},
+	})
+
+	tokens, err = TokenizeFormula("LOG10(A:A)+Rate*TRUE")
+	c.Assert(err, IsNil)
+	c.Assert(tokens, DeepEquals, []FormulaToken{
+		{FormulaTokenFunction, "LOG10"},
+		{FormulaTokenRef, "A:A"},
+		{FormulaTokenClose, ")"},
+		{FormulaTokenOperator, "+"},
+		{FormulaTokenName, "Rate"},
+		{FormulaTokenOperator, "*"},
+		{FormulaTokenBool, "TRUE"},
+	})
+
+	_, err = TokenizeFormula(`"unterminated`)
+	c.Assert(err, NotNil)
+	_, err = TokenizeFormula(`1+#BOGUS`)
+	c.Assert(err, NotNil)
+}
+
+func (s *FormulaSuite) TestTokenizeFormulaReferences(c *C) {
+	tokens, err := TokenizeFormula(`Sales[[#This Row],[Q1]:[Q4]]+[@Amount]*'It''s'!Rate+Data!#REF!`)
+	c.Assert(err, IsNil)
+	c.Assert(tokens, DeepEquals, []FormulaToken{
+		{FormulaTokenStructuredRef, "Sales[[#This Row],[Q1]:[Q4]]"},
+		{FormulaTokenOperator, "+"},
+		{FormulaTokenStructuredRef, "[@Amount]"},
+		{FormulaTokenOperator, "*"},
+		{FormulaTokenName, "'It''s'!Rate"},
+		{FormulaTokenOperator, "+"},
+		{FormulaTokenError, "Data!#REF!"},
+	})
+
+	tokens, err = TokenizeFormula(`{1,-2;"a",#N/A}`)
+	c.Assert(err, IsNil)
+	c.Assert(tokens, DeepEquals, []FormulaToken{
+		{FormulaTokenArrayOpen, "{"},
+		{FormulaTokenNumber, "1"},
+		{FormulaTokenSeparator, ","},
+		{FormulaTokenOperator, "-"},
+		{FormulaTokenNumber, "2"},
+		{FormulaTokenArrayRowSeparator, ";"},
+		{FormulaTokenText, "a"},
+		{FormulaTokenSeparator, ","},
+		{FormulaTokenError, "#N/A"},
+		{FormulaTokenArrayClose, "}"},
+	})
+
+	_, err = TokenizeFormula("Sales[[Q1]")
+	c.Assert(err, NotNil)
+
+	// A space between two references intersects them, and the sheets
+	// can be a range of sheets or be in another workbook.
+	tokens, err = TokenizeFormula(`SUM(A1:B2 B1:C4, Sheet1:Sheet3!A1) + [1]Sheet1!A1*'[2]My Sheet'!#REF!/[1]!Rate`)
+	c.Assert(err, IsNil)
+	c.Assert(tokens, DeepEquals, []FormulaToken{
+		{FormulaTokenFunction, "SUM"},
+		{FormulaTokenRef, "A1:B2"},
+		{FormulaTokenOperator, " "},
+		{FormulaTokenRef, "B1:C4"},
+		{FormulaTokenSeparator, ","},
+		{FormulaTokenRef, "Sheet1:Sheet3!A1"},
+		{FormulaTokenClose, ")"},
+		{FormulaTokenOperator, "+"},
+		{FormulaTokenRef, "[1]Sheet1!A1"},
+		{FormulaTokenOperator, "*"},
+		{FormulaTokenError, "'[2]My Sheet'!#REF!"},
+		{FormulaTokenOperator, "/"},
+		{FormulaTokenName, "[1]!Rate"},
+	})
+}
+
+func (s *FormulaSuite) TestParseFormulaRef(c *C) {
+	ref, err := ParseFormulaRef("$B$3:A1")
+	c.Assert(err, IsNil)
+	c.Assert(ref, Equals, FormulaRef{MinCol: 0, MinRow: 0, MaxCol: 1, MaxRow: 2, AbsMaxCol: true, AbsMaxRow: true})
+	c.Assert(ref.String(), Equals, "A1:$B$3")
+
+	ref, err = ParseFormulaRef("B:$C")
+	c.Assert(err, IsNil)
+	c.Assert(ref, Equals, FormulaRef{MinCol: 1, MaxCol: 2, MaxRow: Excel2006MaxRowCount - 1, AbsMaxCol: true, WholeColumns: true})
+	c.Assert(ref.String(), Equals, "B:$C")
+
+	ref, err = ParseFormulaRef("2:$4")
+	c.Assert(err, IsNil)
+	c.Assert(ref, Equals, FormulaRef{MinRow: 1, MaxRow: 3, MaxCol: excel2006MaxColCount - 1, AbsMaxRow: true, WholeRows: true})
+	c.Assert(ref.String(), Equals, "2:$4")
+
+	ref, err = ParseFormulaRef("c$7")
+	c.Assert(err, IsNil)
+	c.Assert(ref.String(), Equals, "C$7")
+
+	for _, text := range []string{"ZZZ1", "A", "A1:B", "1A"} {
+		_, err = ParseFormulaRef(text)
+		c.Assert(err, NotNil, Commentf(text))
+	}
+}
+
+func (s *FormulaSuite) TestParseFormulaNodes(c *C) {
+	node, err := ParseFormula(`='My Sheet'!A1+Data!Rate+Data!#REF!`)
+	c.Assert(err, IsNil)
+	refs := node.References()
+	c.Assert(refs, HasLen, 2)
+	c.Assert(refs[0].Type, Equals, FormulaNodeRef)
+	c.Assert(refs[0].Sheet, Equals, "My Sheet")
+	c.Assert(refs[0].Ref, Equals, FormulaRef{})
+	c.Assert(refs[1].Type, Equals, FormulaNodeName)
+	c.Assert(refs[1].Sheet, Equals, "Data")
+	c.Assert(refs[1].Text, Equals, "Rate")
+	c.Assert(node.Args[1].Type, Equals, FormulaNodeError)
+	c.Assert(node.Args[1].Sheet, Equals, "Data")
+
+	node, err = ParseFormula("SUM(Sales[[#Headers],[#Data],[Q1]:[Q4]])+Sales[@Amount]+Sales[]+Sales[Tax '#]")
+	c.Assert(err, IsNil)
+	refs = node.References()
+	c.Assert(refs, HasLen, 4)
+	c.Assert(refs[0].StructuredRef, DeepEquals, FormulaStructuredRef{
+		Table: "Sales", Items: []string{"#Headers", "#Data"}, FirstColumn: "Q1", LastColumn: "Q4",
+	})
+	c.Assert(refs[1].StructuredRef, DeepEquals, FormulaStructuredRef{
+		Table: "Sales", Items: []string{"#This Row"}, FirstColumn: "Amount", LastColumn: "Amount",
+	})
+	c.Assert(refs[2].StructuredRef, DeepEquals, FormulaStructuredRef{Table: "Sales"})
+	c.Assert(refs[3].StructuredRef.FirstColumn, Equals, "Tax #")
+	c.Assert(refs[3].String(), Equals, "Sales[Tax '#]")
+
+	node, err = ParseFormula(`{1,-2.5;"a",TRUE}`)
+	c.Assert(err, IsNil)
+	c.Assert(node.Type, Equals, FormulaNodeArray)
+	c.Assert(node.Rows, HasLen, 2)
+	c.Assert(node.Rows[0][1].Text, Equals, "-2.5")
+	c.Assert(node.Rows[1][0].Type, Equals, FormulaNodeText)
+	c.Assert(node.Rows[1][1].Type, Equals, FormulaNodeBool)
+
+	node, err = ParseFormula(`SUM(Sheet1:Sheet3!A1,'Jan 1:Mar 1'!B2)+[1]Sheet1!$C$3+'[2]My Sheet'!#REF!+[1]!Rate`)
+	c.Assert(err, IsNil)
+	refs = node.References()
+	c.Assert(refs, HasLen, 4)
+	c.Assert([]string{refs[0].Workbook, refs[0].Sheet, refs[0].LastSheet}, DeepEquals, []string{"", "Sheet1", "Sheet3"})
+	c.Assert([]string{refs[1].Workbook, refs[1].Sheet, refs[1].LastSheet}, DeepEquals, []string{"", "Jan 1", "Mar 1"})
+	c.Assert([]string{refs[2].Workbook, refs[2].Sheet, refs[2].LastSheet}, DeepEquals, []string{"1", "Sheet1", ""})
+	c.Assert(refs[2].Ref.String(), Equals, "$C$3")
+	c.Assert([]string{refs[3].Workbook, refs[3].Sheet, refs[3].Text}, DeepEquals, []string{"1", "", "Rate"})
+	refError := node.Args[0].Args[1]
+	c.Assert(refError.Type, Equals, FormulaNodeError)
+	c.Assert([]string{refError.Workbook, refError.Sheet}, DeepEquals, []string{"2", "My Sheet"})
+
+	for _, formula := range []string{"{1,2;3}", "{A1}", "{-\"a\"}", "Sales[[Q1],#Data]", "Sheet1:Sheet3!Rate"} {
+		_, err := ParseFormula(formula)
+		c.Assert(err, NotNil, Commentf(formula))
+	}
+}
+
+// A parsed formula gives back the formula it was parsed from, which
+// is what lets references be rewritten.
+func (s *FormulaSuite) TestFormulaString(c *C) {
+	for formula, expected := range map[string]string{
+		"=SUM( A1:$B$2 , 3 )":          "SUM(A1:$B$2,3)",
+		"-(1+2)%*'My Sheet'!C:C":       "-(1+2)%*'My Sheet'!C:C",
+		`"say ""hi"""&Data!$3:$3`:      `"say ""hi"""&Data!$3:$3`,
+		"IF(A1,,{1,2;3,4})":            "IF(A1,,{1,2;3,4})",
+		"Sales[@Amount]*[Tax]":         "Sales[[#This Row],[Amount]]*[Tax]",
+		"Sales[[#All],[Q1]:[Q4]]":      "Sales[[#All],[Q1]:[Q4]]",
+		"'It''s'!Rate+'TRUE'!A1":       "'It''s'!Rate+'TRUE'!A1",
+		"'A1'!B2+'Sheet 2'!#REF!":      "'A1'!B2+'Sheet 2'!#REF!",
+		"_xlfn.CONCAT(\"a\",b1)<>#n/a": "_xlfn.CONCAT(\"a\",B1)<>#N/A",
+		"SUM(Sheet1:Sheet3!A1)":        "SUM(Sheet1:Sheet3!A1)",
+		"'Jan 1:Mar'!A1+'[1]Q 1'!B2":   "'Jan 1:Mar'!A1+'[1]Q 1'!B2",
+		"[1]Sheet1!A1+[2]!Rate":        "[1]Sheet1!A1+[2]!Rate",
+		"SUM( A1:B2  B1:C4 )":          "SUM(A1:B2 B1:C4)",
+		"SUM(Rate Sales[Q1])":          "SUM(Rate Sales[Q1])",
+		"SUM((A1, B1),C1)":             "SUM((A1,B1),C1)",
+	} {
+		node, err := ParseFormula(formula)
+		c.Assert(err, IsNil, Commentf(formula))
+		c.Check(node.String(), Equals, expected, Commentf(formula))
+	}
+
+	node, err := ParseFormula("SUM(A1:B2)+Other!A1")
+	c.Assert(err, IsNil)
+	node.Walk(func(n *FormulaNode) bool {
+		if n.Type == FormulaNodeRef && n.Sheet == "" {
+			n.Ref.MaxRow += 10
+			n.Sheet = "New Sheet"
+		}
+		return n.Type != FormulaNodeRef
+	})
+	c.Assert(node.String(), Equals, "SUM('New Sheet'!A1:B12)+Other!A1")
+}
+
+// The operators of a formula are applied in the order of their
+// precedence in Excel, where the prefix "-" comes before "^".
+func (s *FormulaSuite) TestParseFormulaPrecedence(c *C) {
+	var describe func(n *FormulaNode) string
+	describe = func(n *FormulaNode) string {
+		switch n.Type {
+		case FormulaNodeBinary:
+			return "(" + describe(n.Args[0]) + n.Text + describe(n.Args[1]) + ")"
+		case FormulaNodeUnary:
+			return "(" + n.Text + describe(n.Args[0]) + ")"
+		case FormulaNodePercent:
+			return "(" + describe(n.Args[0]) + "%)"
+		case FormulaNodeParen:
+			return describe(n.Args[0])
+		case FormulaNodeFunction:
+			s := n.Text + "("
+			for i, arg := range n.Args {
+				if i > 0 {
+					s += ","
+				}
+				s += describe(arg)
+			}
+			return s + ")"
+		case FormulaNodeEmpty:
+			return "_"
+		}
+		return n.String()
+	}
+	for formula, expected := range map[string]string{
+		"1+2*3":           "(1+(2*3))",
+		"-2^2":            "((-2)^2)",
+		"2^3^2":           "((2^3)^2)",
+		"A1&B1=C1":        "((A1&B1)=C1)",
+		"50%*2":           "((50%)*2)",
+		"(1+2)*3":         "((1+2)*3)",
+		"IF(A1>0,,-1)":    "IF((A1>0),_,(-1))",
+		"SUM()":           "SUM()",
+		"A1:INDEX(B:B,2)": "(A1:INDEX(B:B,2))",
+		"A1:B2 B1:C4":     "(A1:B2 B1:C4)",
+		"-A1 B1%":         "(-((A1 B1)%))",
+		"(A1,B1 C1,D1)":   "((A1,(B1 C1)),D1)",
+		"SUM((A1,B1))":    "SUM((A1,B1))",
+	} {
+		node, err := ParseFormula(formula)
+		c.Assert(err, IsNil, Commentf(formula))
+		c.Assert(describe(node), Equals, expected, Commentf(formula))
+	}
+
+	for _, formula := range []string{"", "1+", "SUM(1", "(1", "1)", "1 2", "A1,B1", "(A1,)"} {
+		_, err := ParseFormula(formula)
+		c.Assert(err, NotNil, Commentf(formula))
+	}
+}
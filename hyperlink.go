@@ -0,0 +1,108 @@
+package xlsx
+
+import "fmt"
+
+// Hyperlink is a link attached to a cell.  A hyperlink either points
+// outside of the workbook, in which case URL is set, or to a place
+// inside it, such as "Sheet2!A1", in which case Location is set.
+type Hyperlink struct {
+	URL      string
+	Location string
+	// Tooltip is shown when the mouse pointer rests over the cell.
+	Tooltip string
+	// Display is the text shown for the link.
+	Display string
+	// Ref is the range of cells, such as "A1:C3" or "A:A", of a
+	// hyperlink in the Hyperlinks of a Sheet.  It is blank for the
+	// hyperlink of a Cell.
+	Ref string
+}
+
+// SetHyperlink makes the cell a link to the given URL.  If the cell
+// has no value yet, display is also used as its value.
+func (c *Cell) SetHyperlink(url, tooltip, display string) {
+	c.setHyperlink(&Hyperlink{URL: url, Tooltip: tooltip, Display: display})
+}
+
+// SetHyperlinkLocation makes the cell a link to a location within the
+// workbook, for example "Sheet2!A1" or the name of a defined name.  If
+// the cell has no value yet, display is also used as its value.
+func (c *Cell) SetHyperlinkLocation(location, tooltip, display string) {
+	c.setHyperlink(&Hyperlink{Location: location, Tooltip: tooltip, Display: display})
+}
+
+func (c *Cell) setHyperlink(link *Hyperlink) {
+	c.Hyperlink = link
+	if c.Value == "" && link.Display != "" {
+		c.SetString(link.Display)
+	}
+}
+
+// makeXLSXHyperlinks builds the hyperlinks element for all the cells
+// of the sheet that have a hyperlink, followed by the hyperlinks over
+// ranges of cells.  Links to URLs are added to the relationships of
+// the sheet.  It returns nil when the sheet has no hyperlinks at all.
+func (s *Sheet) makeXLSXHyperlinks(rels *xlsxWorkbookRels) *xlsxHyperlinks {
+	var xHyperlinks *xlsxHyperlinks
+	add := func(ref string, link *Hyperlink) {
+		if xHyperlinks == nil {
+			xHyperlinks = &xlsxHyperlinks{}
+		}
+		xHyperlink := xlsxHyperlink{
+			Ref:      ref,
+			Location: link.Location,
+			Tooltip:  link.Tooltip,
+			Display:  link.Display,
+		}
+		if link.URL != "" {
+			xHyperlink.Id = rels.addRelationship(relationshipTypeHyperlink, link.URL, relationshipTargetModeExternal)
+		}
+		xHyperlinks.Hyperlink = append(xHyperlinks.Hyperlink, xHyperlink)
+	}
+	for r, row := range s.Rows {
+		for c, cell := range row.Cells {
+			if cell.Hyperlink != nil {
+				add(GetCellIDStringFromCoords(c, r), cell.Hyperlink)
+			}
+		}
+	}
+	for _, link := range s.Hyperlinks {
+		add(link.Ref, link)
+	}
+	return xHyperlinks
+}
+
+// readHyperlinks is an internal helper function that attaches the
+// hyperlinks of a worksheet to the cells of a sheet.  A hyperlink over
+// a range of cells is added to the Hyperlinks of the sheet instead,
+// however large the range is.
+func readHyperlinks(xHyperlinks *xlsxHyperlinks, rels map[string]xlsxWorkbookRelation, sheet *Sheet, options OpenOptions) error {
+	for _, xHyperlink := range xHyperlinks.Hyperlink {
+		link := &Hyperlink{
+			Location: xHyperlink.Location,
+			Tooltip:  xHyperlink.Tooltip,
+			Display:  xHyperlink.Display,
+		}
+		if xHyperlink.Id != "" {
+			rel, ok := rels[xHyperlink.Id]
+			if !ok {
+				return fmt.Errorf("hyperlink %s refers to unknown relationship %s", xHyperlink.Ref, xHyperlink.Id)
+			}
+			link.URL = rel.Target
+		}
+		ref, err := ParseFormulaRef(xHyperlink.Ref)
+		if err != nil {
+			return fmt.Errorf("hyperlink %s", err.Error())
+		}
+		if !options.includesCell(ref.MinCol, ref.MinRow) {
+			continue
+		}
+		if ref.MinCol == ref.MaxCol && ref.MinRow == ref.MaxRow && !ref.WholeColumns && !ref.WholeRows {
+			sheet.Cell(ref.MinRow, ref.MinCol).Hyperlink = link
+			continue
+		}
+		link.Ref = xHyperlink.Ref
+		sheet.Hyperlinks = append(sheet.Hyperlinks, link)
+	}
+	return nil
+}
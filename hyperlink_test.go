@@ -0,0 +1,125 @@
+package xlsx
+
+import (
+	"bytes"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type HyperlinkSuite struct{}
+
+var _ = Suite(&HyperlinkSuite{})
+
+// Links to URLs get an external relationship, links to locations
+// within the workbook don't.
+func (s *HyperlinkSuite) TestMarshalHyperlinks(c *C) {
+	f := NewFile()
+	sheet, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	sheet.Cell(0, 0).SetHyperlink("https://example.com/?a=1&b=2", "Go there", "Example")
+	sheet.Cell(1, 0).SetHyperlinkLocation("Sheet2!A1", "", "Next sheet")
+
+	c.Assert(sheet.Cell(0, 0).Value, Equals, "Example")
+	c.Assert(sheet.Cell(1, 0).Value, Equals, "Next sheet")
+
+	parts, err := f.MarshallParts()
+	c.Assert(err, IsNil)
+	c.Assert(parts["xl/worksheets/_rels/sheet1.xml.rels"], Equals, `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Target="https://example.com/?a=1&amp;b=2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/hyperlink" TargetMode="External"></Relationship></Relationships>`)
+	c.Assert(strings.Contains(parts["xl/worksheets/sheet1.xml"],
+		`<hyperlinks><hyperlink ref="A1" r:id="rId1" tooltip="Go there" display="Example"></hyperlink>`+
+			`<hyperlink ref="A2" location="Sheet2!A1" display="Next sheet"></hyperlink></hyperlinks>`), Equals, true)
+}
+
+// Setting a hyperlink doesn't replace the value of a cell.
+func (s *HyperlinkSuite) TestSetHyperlinkKeepsValue(c *C) {
+	cell := &Cell{}
+	cell.SetInt(42)
+	cell.SetHyperlink("https://example.com", "", "Example")
+	c.Assert(cell.Value, Equals, "42")
+	c.Assert(cell.Type(), Equals, CellTypeNumeric)
+	c.Assert(cell.Hyperlink.URL, Equals, "https://example.com")
+}
+
+// Hyperlinks survive writing a File and reading it back.
+func (s *HyperlinkSuite) TestHyperlinkRoundTrip(c *C) {
+	f := NewFile()
+	sheet1, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	sheet2, err := f.AddSheet("Sheet2")
+	c.Assert(err, IsNil)
+	sheet1.Cell(0, 0).SetHyperlink("https://example.com", "tip", "Example")
+	sheet1.Cell(0, 0).SetComment("Alice", "with a comment too")
+	sheet1.Cell(3, 2).SetHyperlinkLocation("'Sheet2'!B2", "", "Back")
+	sheet2.Cell(1, 1).SetHyperlink("mailto:someone@example.com", "", "Mail")
+
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), IsNil)
+	f, err = OpenBinary(buf.Bytes())
+	c.Assert(err, IsNil)
+
+	link := f.Sheets[0].Cell(0, 0).Hyperlink
+	c.Assert(link, NotNil)
+	c.Assert(*link, Equals, Hyperlink{URL: "https://example.com", Tooltip: "tip", Display: "Example"})
+	c.Assert(f.Sheets[0].Cell(0, 0).Comment, NotNil)
+	link = f.Sheets[0].Cell(3, 2).Hyperlink
+	c.Assert(link, NotNil)
+	c.Assert(*link, Equals, Hyperlink{Location: "'Sheet2'!B2", Display: "Back"})
+	link = f.Sheets[1].Cell(1, 1).Hyperlink
+	c.Assert(link, NotNil)
+	c.Assert(link.URL, Equals, "mailto:someone@example.com")
+}
+
+// A hyperlink over a range of cells is added to the sheet, rather than
+// to every cell.
+func (s *HyperlinkSuite) TestReadHyperlinkRange(c *C) {
+	sheet := &Sheet{}
+	xHyperlinks := &xlsxHyperlinks{Hyperlink: []xlsxHyperlink{
+		{Ref: "B2:C3", Id: "rId3"},
+		{Ref: "A1", Location: "Elsewhere"},
+	}}
+	rels := map[string]xlsxWorkbookRelation{
+		"rId3": {Id: "rId3", Target: "http://example.com", TargetMode: "External"},
+	}
+	err := readHyperlinks(xHyperlinks, rels, sheet, OpenOptions{RowLimit: NoRowLimit})
+	c.Assert(err, IsNil)
+	c.Assert(sheet.Hyperlinks, DeepEquals, []*Hyperlink{{URL: "http://example.com", Ref: "B2:C3"}})
+	c.Assert(sheet.Cell(0, 0).Hyperlink.Location, Equals, "Elsewhere")
+	c.Assert(sheet.MaxRow, Equals, 1)
+
+	xHyperlinks.Hyperlink[0].Id = "rId4"
+	err = readHyperlinks(xHyperlinks, rels, &Sheet{}, OpenOptions{RowLimit: NoRowLimit})
+	c.Assert(err, NotNil)
+}
+
+// A hyperlink over whole columns doesn't make a cell for every row, and
+// is written back as the one hyperlink it was read as, moving with the
+// columns.
+func (s *HyperlinkSuite) TestHyperlinkOverColumns(c *C) {
+	f := NewFile()
+	sheet, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	sheet.Cell(0, 0).SetString("links")
+	sheet.Cell(0, 1).SetString("more")
+	sheet.Hyperlinks = append(sheet.Hyperlinks, &Hyperlink{URL: "https://example.com", Ref: "B:B"})
+
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), IsNil)
+	f, err = OpenBinary(buf.Bytes())
+	c.Assert(err, IsNil)
+	sheet = f.Sheets[0]
+	c.Assert(sheet.MaxRow, Equals, 1)
+	c.Assert(sheet.Hyperlinks, DeepEquals, []*Hyperlink{{URL: "https://example.com", Ref: "B:B"}})
+
+	_, err = sheet.InsertColAtIndex(0)
+	c.Assert(err, IsNil)
+	c.Assert(sheet.Hyperlinks[0].Ref, Equals, "C:C")
+	parts, err := f.MarshallParts()
+	c.Assert(err, IsNil)
+	c.Assert(strings.Count(parts["xl/worksheets/sheet1.xml"], "<hyperlink "), Equals, 1)
+	c.Assert(strings.Contains(parts["xl/worksheets/sheet1.xml"], `<hyperlink ref="C:C" r:id="rId1">`), Equals, true, Commentf(parts["xl/worksheets/sheet1.xml"]))
+
+	c.Assert(sheet.RemoveColAtIndex(2), IsNil)
+	c.Assert(sheet.Hyperlinks, HasLen, 0)
+}
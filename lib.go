@@ -54,6 +54,28 @@ func getRangeFromString(rangeString string) (lower int, upper int, error error)
 	return lower, upper, error
 }
 
+// getColRangeFromString is an internal helper function that converts
+// a range of column letters, such as "B:D", to a pair of zero based
+// column indices.  A single column, such as "C", yields the same
+// lower and upper index.
+func getColRangeFromString(rangeString string) (lower int, upper int, err error) {
+	parts := strings.SplitN(rangeString, cellRangeChar, 2)
+	if len(parts) == 1 {
+		parts = append(parts, parts[0])
+	}
+	for _, part := range parts {
+		if part == "" || strings.Map(letterOnlyMapF, part) != strings.ToUpper(part) {
+			return -1, -1, fmt.Errorf("Invalid column range '%s'", rangeString)
+		}
+	}
+	lower = ColLettersToIndex(parts[0])
+	upper = ColLettersToIndex(parts[1])
+	if lower > upper {
+		lower, upper = upper, lower
+	}
+	return lower, upper, nil
+}
+
 // ColLettersToIndex is used to convert a character based column
 // reference to a zero based numeric column identifier.
 func ColLettersToIndex(letters string) int {
@@ -477,6 +499,7 @@ func fillCellData(rawCell xlsxC, refTable *RefTable, sharedFormulas map[int]shar
 				panic(err)
 			}
 			cell.Value = refTable.ResolveSharedString(ref)
+			cell.RichText = refTable.ResolveRichText(ref)
 		}
 	case "inlineStr":
 		cell.cellType = CellTypeInline
@@ -513,8 +536,9 @@ func fillCellDataFromInlineString(rawcell xlsxC, cell *Cell) {
 			cell.Value = strings.Trim(rawcell.Is.T, " \t\n\r")
 		} else {
 			for _, r := range rawcell.Is.R {
-				cell.Value += r.T
+				cell.Value += r.T.Text
 			}
+			cell.RichText = makeRichTextFromXLSX(rawcell.Is.R)
 		}
 	}
 }
@@ -657,6 +681,50 @@ func readRowsFromSheet(Worksheet *xlsxWorksheet, file *File, sheet *Sheet, rowLi
 	return rows, cols, colCount, rowCount
 }
 
+// projectWorksheetColumns drops every cell outside of the zero based
+// column range minCol to maxCol from a raw worksheet, so that
+// readRowsFromSheet never builds them.
+func projectWorksheetColumns(worksheet *xlsxWorksheet, minCol, maxCol int) error {
+	for i := range worksheet.SheetData.Row {
+		rawrow := &worksheet.SheetData.Row[i]
+		cells := rawrow.C[:0]
+		x := -1
+		for _, rawcell := range rawrow.C {
+			if rawcell.R != "" {
+				var err error
+				x, _, err = GetCoordsFromCellIDString(rawcell.R)
+				if err != nil {
+					return err
+				}
+			} else {
+				x++
+				rawcell.R = GetCellIDStringFromCoords(x, rawrow.R-1)
+			}
+			if x >= minCol && x <= maxCol {
+				cells = append(cells, rawcell)
+			}
+		}
+		rawrow.C = cells
+		// The spans describe the unprojected row.
+		rawrow.Spans = ""
+	}
+	parts := strings.Split(worksheet.Dimension.Ref, cellRangeChar)
+	if len(parts) == 2 {
+		minx, miny, maxx, maxy, err := getMaxMinFromDimensionRef(worksheet.Dimension.Ref)
+		if err != nil {
+			return err
+		}
+		if maxx > maxCol {
+			maxx = maxCol
+		}
+		if minx > maxx {
+			minx = maxx
+		}
+		worksheet.Dimension.Ref = GetCellIDStringFromCoords(minx, miny) + cellRangeChar + GetCellIDStringFromCoords(maxx, maxy)
+	}
+	return nil
+}
+
 type indexedSheet struct {
 	Index int
 	Sheet *Sheet
@@ -689,7 +757,7 @@ func readSheetViews(xSheetViews xlsxSheetViews) []SheetView {
 // into a Sheet struct.  This work can be done in parallel and so
 // readSheetsFromZipFile will spawn an instance of this function per
 // sheet and get the results back on the provided channel.
-func readSheetFromFile(sc chan *indexedSheet, index int, rsheet xlsxSheet, fi *File, sheetXMLMap map[string]string, rowLimit int) (errRes error) {
+func readSheetFromFile(sc chan *indexedSheet, index int, rsheet xlsxSheet, fi *File, sheetXMLMap map[string]string, options OpenOptions) (errRes error) {
 	result := &indexedSheet{Index: index, Sheet: nil, Error: nil}
 	defer func() {
 		if e := recover(); e != nil {
@@ -705,23 +773,41 @@ func readSheetFromFile(sc chan *indexedSheet, index int, rsheet xlsxSheet, fi *F
 		}
 	}()
 
-	worksheet, err := getWorksheetFromSheet(rsheet, fi.worksheets, sheetXMLMap, rowLimit)
+	worksheet, err := getWorksheetFromSheet(rsheet, fi.worksheets, sheetXMLMap, options.RowLimit)
 	if err != nil {
 		result.Error = err
 		sc <- result
 		return err
 	}
+	if options.Columns != "" {
+		minCol, maxCol, err := getColRangeFromString(options.Columns)
+		if err == nil {
+			err = projectWorksheetColumns(worksheet, minCol, maxCol)
+		}
+		if err != nil {
+			result.Error = err
+			sc <- result
+			return err
+		}
+	}
 	sheet := new(Sheet)
 	sheet.File = fi
-	sheet.Rows, sheet.Cols, sheet.MaxCol, sheet.MaxRow = readRowsFromSheet(worksheet, fi, sheet, rowLimit)
+	sheet.Rows, sheet.Cols, sheet.MaxCol, sheet.MaxRow = readRowsFromSheet(worksheet, fi, sheet, options.RowLimit)
 	sheet.Hidden = rsheet.State == sheetStateHidden || rsheet.State == sheetStateVeryHidden
 	sheet.SheetViews = readSheetViews(worksheet.SheetViews)
+	sheet.Protection = readSheetProtection(worksheet.SheetProtection)
 
 	sheet.SheetFormat.DefaultColWidth = worksheet.SheetFormatPr.DefaultColWidth
 	sheet.SheetFormat.DefaultRowHeight = worksheet.SheetFormatPr.DefaultRowHeight
 	sheet.SheetFormat.OutlineLevelCol = worksheet.SheetFormatPr.OutlineLevelCol
 	sheet.SheetFormat.OutlineLevelRow = worksheet.SheetFormatPr.OutlineLevelRow
-	if nil != worksheet.DataValidations {
+	sheet.ConditionalFormats, err = readConditionalFormats(worksheet.ConditionalFormatting, worksheet.ExtLst, fi.styles)
+	if err != nil {
+		result.Error = err
+		sc <- result
+		return err
+	}
+	if nil != worksheet.DataValidations && !options.SkipDataValidations {
 		for _, dd := range worksheet.DataValidations.DataValidattion {
 			sqrefArr := strings.Split(dd.Sqref, " ")
 			for _, sqref := range sqrefArr {
@@ -766,15 +852,93 @@ func readSheetFromFile(sc chan *indexedSheet, index int, rsheet xlsxSheet, fi *F
 
 	}
 
+	if sheetFile := worksheetFileForSheet(rsheet, fi.worksheets, sheetXMLMap); sheetFile != nil {
+		if err := readSheetRelations(fi, sheetFile.Name, worksheet, sheet, options); err != nil {
+			result.Error = err
+			sc <- result
+			return err
+		}
+	}
+
+	// The worksheet is kept, without its rows, for the XML that the
+	// library doesn't model.
+	worksheet.qualifyRawNames()
+	worksheet.SheetData = xlsxSheetData{}
+	sheet.unmodelled = worksheet
+
 	result.Sheet = sheet
 	sc <- result
 	return nil
 }
 
+// readSheetRelations is an internal helper function that reads the
+// parts a worksheet refers to through its relationships, such as its
+// comments and hyperlinks, into the Sheet.
+func readSheetRelations(fi *File, sheetPartName string, worksheet *xlsxWorksheet, sheet *Sheet, options OpenOptions) error {
+	rels, err := readPartRelations(fi.files, sheetPartName)
+	if err != nil {
+		return err
+	}
+	if options.PreserveUnknownParts {
+		sheet.preservedRels = unmodelledRelationships(rels, worksheetRelationshipTypes)
+	}
+	var vml *zip.File
+	if worksheet.LegacyDrawing != nil {
+		if rel, ok := rels[worksheet.LegacyDrawing.Id]; ok {
+			vml = fi.files[rel.Target]
+		}
+	}
+	if worksheet.Hyperlinks != nil {
+		if err := readHyperlinks(worksheet.Hyperlinks, rels, sheet, options); err != nil {
+			return err
+		}
+	}
+	if worksheet.Drawing != nil {
+		rel, ok := rels[worksheet.Drawing.Id]
+		if !ok {
+			return fmt.Errorf("drawing refers to unknown relationship %q", worksheet.Drawing.Id)
+		}
+		if err := readDrawingFromZipFile(fi.files, rel.Target, sheet); err != nil {
+			return err
+		}
+		if options.PreserveUnknownParts {
+			sheet.drawing = newOriginalDrawing(rel, sheet)
+		}
+	}
+	if worksheet.TableParts != nil {
+		for _, tablePart := range worksheet.TableParts.TablePart {
+			rel, ok := rels[tablePart.Id]
+			if !ok {
+				return fmt.Errorf("table part refers to unknown relationship %q", tablePart.Id)
+			}
+			f, ok := fi.files[rel.Target]
+			if !ok {
+				return fmt.Errorf("table part %q not found", rel.Target)
+			}
+			table, err := readTableFromZipFile(f, sheet)
+			if err != nil {
+				return err
+			}
+			sheet.Tables = append(sheet.Tables, table)
+		}
+	}
+	for _, rel := range rels {
+		if rel.Type != relationshipTypeComments {
+			continue
+		}
+		if f, ok := fi.files[rel.Target]; ok {
+			if err := readCommentsFromZipFile(f, vml, sheet, options); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // readSheetsFromZipFile is an internal helper function that loops
 // over the Worksheets defined in the XSLXWorkbook and loads them into
 // Sheet objects stored in the Sheets slice of a xlsx.File struct.
-func readSheetsFromZipFile(f *zip.File, file *File, sheetXMLMap map[string]string, rowLimit int) (map[string]*Sheet, []*Sheet, error) {
+func readSheetsFromZipFile(f *zip.File, file *File, sheetXMLMap map[string]string, options OpenOptions) (map[string]*Sheet, []*Sheet, error) {
 	var workbook *xlsxWorkbook
 	var err error
 	var rc io.ReadCloser
@@ -791,19 +955,68 @@ func readSheetsFromZipFile(f *zip.File, file *File, sheetXMLMap map[string]strin
 		return nil, nil, err
 	}
 	file.Date1904 = workbook.WorkbookPr.Date1904
+	file.codeName = workbook.WorkbookPr.CodeName
+	file.Protection = readWorkbookProtection(workbook.WorkbookProtection)
+	if options.PreserveUnknownParts {
+		file.preserved.externalReferences = workbook.ExternalReferences
+		file.preserved.pivotCaches = workbook.PivotCaches
+	}
 
-	for entryNum := range workbook.DefinedNames.DefinedName {
-		file.DefinedNames = append(file.DefinedNames, &workbook.DefinedNames.DefinedName[entryNum])
+	workbookRels, err := readPartRelations(file.files, "xl/workbook.xml")
+	if err != nil {
+		return nil, nil, err
 	}
 
 	// Only try and read sheets that have corresponding files.
-	// Notably this excludes chartsheets don't right now
+	// Chartsheets are known by their relationship, and are kept
+	// by the name of their part.
 	var workbookSheets []xlsxSheet
-	for _, sheet := range workbook.Sheets.Sheet {
+	sheetIndexes := make(map[int]int)
+	chartsheets := make(map[int]string)
+	for i, sheet := range workbook.Sheets.Sheet {
+		if !options.includesSheet(sheet.Name) {
+			continue
+		}
+		if rel, ok := workbookRels[sheet.Id]; ok && rel.Type == relationshipTypeChartsheet {
+			if _, ok := file.files[rel.Target]; ok {
+				sheetIndexes[i] = len(workbookSheets)
+				chartsheets[len(workbookSheets)] = rel.Target
+				workbookSheets = append(workbookSheets, sheet)
+			}
+			continue
+		}
 		if f := worksheetFileForSheet(sheet, file.worksheets, sheetXMLMap); f != nil {
+			sheetIndexes[i] = len(workbookSheets)
 			workbookSheets = append(workbookSheets, sheet)
 		}
 	}
+
+	// The scope of a defined name is the index of a sheet in the
+	// workbook, which changes when sheets aren't read.  Names that
+	// are local to a sheet that isn't read are left out.
+	for entryNum := range workbook.DefinedNames.DefinedName {
+		dn := &workbook.DefinedNames.DefinedName[entryNum]
+		if dn.HasLocalSheetID {
+			index, ok := sheetIndexes[dn.LocalSheetID]
+			if !ok {
+				continue
+			}
+			dn.LocalSheetID = index
+		}
+		file.DefinedNames = append(file.DefinedNames, dn)
+	}
+	for _, name := range options.Sheets {
+		found := false
+		for _, sheet := range workbookSheets {
+			if sheet.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, nil, fmt.Errorf("sheet '%s' not found in input xlsx", name)
+		}
+	}
 	sheetCount = len(workbookSheets)
 	sheetsByName := make(map[string]*Sheet, sheetCount)
 	sheets := make([]*Sheet, sheetCount)
@@ -813,7 +1026,13 @@ func readSheetsFromZipFile(f *zip.File, file *File, sheetXMLMap map[string]strin
 		defer close(sheetChan)
 		err = nil
 		for i, rawsheet := range workbookSheets {
-			if err := readSheetFromFile(sheetChan, i, rawsheet, file, sheetXMLMap, rowLimit); err != nil {
+			if partName, ok := chartsheets[i]; ok {
+				if err := readChartsheetFromFile(sheetChan, i, rawsheet, file, partName); err != nil {
+					return
+				}
+				continue
+			}
+			if err := readSheetFromFile(sheetChan, i, rawsheet, file, sheetXMLMap, options); err != nil {
 				return
 			}
 		}
@@ -917,10 +1136,14 @@ func (w *WorkBookRels) MakeXLSXWorkbookRels() xlsxWorkbookRels {
 		if err != nil {
 			panic(err.Error())
 		}
+		relType := relationshipTypeWorksheet
+		if strings.HasPrefix(v, "chartsheets/") {
+			relType = relationshipTypeChartsheet
+		}
 		xWorkbookRels.Relationships[index-1] = xlsxWorkbookRelation{
 			Id:     k,
 			Target: v,
-			Type:   "http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet"}
+			Type:   relType}
 	}
 
 	relCount++
@@ -1004,6 +1227,25 @@ func ReadZipReader(r *zip.Reader) (*File, error) {
 // rowLimit is the number of rows that should be read from the file. If rowLimit is -1, no limit is applied.
 // You can specify this with the constant NoRowLimit.
 func ReadZipReaderWithRowLimit(r *zip.Reader, rowLimit int) (*File, error) {
+	return readZipReader(r, OpenOptions{RowLimit: rowLimit})
+}
+
+// ReadZipReaderWithOptions() can be used to read an XLSX in memory
+// without touching the filesystem, parsing only the parts selected by
+// the provided OpenOptions.
+func ReadZipReaderWithOptions(r *zip.Reader, options OpenOptions) (*File, error) {
+	if options.RowLimit == 0 {
+		options.RowLimit = NoRowLimit
+	}
+	if options.Columns != "" {
+		if _, _, err := getColRangeFromString(options.Columns); err != nil {
+			return nil, err
+		}
+	}
+	return readZipReader(r, options)
+}
+
+func readZipReader(r *zip.Reader, options OpenOptions) (*File, error) {
 	var err error
 	var file *File
 	var reftable *RefTable
@@ -1022,7 +1264,9 @@ func ReadZipReaderWithRowLimit(r *zip.Reader, rowLimit int) (*File, error) {
 	file = NewFile()
 	// file.numFmtRefTable = make(map[int]xlsxNumFmt, 1)
 	worksheets = make(map[string]*zip.File, len(r.File))
+	file.files = make(map[string]*zip.File, len(r.File))
 	for _, v = range r.File {
+		file.files[v.Name] = v
 		switch v.Name {
 		case "xl/sharedStrings.xml":
 			sharedStrings = v
@@ -1053,12 +1297,30 @@ func ReadZipReaderWithRowLimit(r *zip.Reader, rowLimit int) (*File, error) {
 		return nil, fmt.Errorf("Input xlsx contains no worksheets.")
 	}
 	file.worksheets = worksheets
+	file.Properties, err = readDocumentPropertiesFromZipFile(file.files["docProps/core.xml"], file.files["docProps/app.xml"])
+	if err != nil {
+		return nil, err
+	}
+	if custom := file.files["docProps/custom.xml"]; custom != nil {
+		file.CustomProperties, err = readCustomPropertiesFromZipFile(custom)
+		if err != nil {
+			return nil, err
+		}
+	}
+	file.vbaProject, err = readVBAProjectFromZipFile(file.files)
+	if err != nil {
+		return nil, err
+	}
+	file.preserved, err = readPreservedParts(file.files, options.PreserveUnknownParts)
+	if err != nil {
+		return nil, err
+	}
 	reftable, err = readSharedStringsFromZipFile(sharedStrings)
 	if err != nil {
 		return nil, err
 	}
 	file.referenceTable = reftable
-	if themeFile != nil {
+	if themeFile != nil && !options.SkipStyles {
 		theme, err := readThemeFromZipFile(themeFile)
 		if err != nil {
 			return nil, err
@@ -1066,7 +1328,7 @@ func ReadZipReaderWithRowLimit(r *zip.Reader, rowLimit int) (*File, error) {
 
 		file.theme = theme
 	}
-	if styles != nil {
+	if styles != nil && !options.SkipStyles {
 		style, err = readStylesFromZipFile(styles, file.theme)
 		if err != nil {
 			return nil, err
@@ -1074,7 +1336,7 @@ func ReadZipReaderWithRowLimit(r *zip.Reader, rowLimit int) (*File, error) {
 
 		file.styles = style
 	}
-	sheetsByName, sheets, err = readSheetsFromZipFile(workbook, file, sheetXMLMap, rowLimit)
+	sheetsByName, sheets, err = readSheetsFromZipFile(workbook, file, sheetXMLMap, options)
 	if err != nil {
 		return nil, err
 	}
@@ -1083,6 +1345,9 @@ func ReadZipReaderWithRowLimit(r *zip.Reader, rowLimit int) (*File, error) {
 		readerErr.Err = "No sheets found in XLSX File"
 		return nil, readerErr
 	}
+	if err = file.preserved.load(file.files, sheets); err != nil {
+		return nil, err
+	}
 	file.Sheet = sheetsByName
 	file.Sheets = sheets
 	return file, nil
@@ -0,0 +1,123 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+)
+
+// Picture is an image placed on a sheet.
+type Picture struct {
+	Name        string
+	Description string
+	// Format is the format of the image, such as "png", "jpeg" or
+	// "gif".  It is also used as the extension of the file that holds
+	// the image.
+	Format string
+	Data   []byte
+	Anchor DrawingAnchor
+}
+
+// PictureOptions control how AddPicture places a picture.
+type PictureOptions struct {
+	Name        string
+	Description string
+	// OffsetX and OffsetY move the picture right and down from the
+	// top left corner of its cell, in pixels.
+	OffsetX int
+	OffsetY int
+	// ScaleX and ScaleY resize the picture from the size of the
+	// image, so 0.5 makes it half as large.  Zero means 1.
+	ScaleX float64
+	ScaleY float64
+	// AnchorType defaults to DrawingAnchorTwoCell.
+	AnchorType DrawingAnchorType
+}
+
+// AddPicture places an image in PNG, JPEG or GIF format on the sheet,
+// with its top left corner in the named cell.  The options may be nil.
+func (s *Sheet) AddPicture(cell string, data []byte, options *PictureOptions) (*Picture, error) {
+	if options == nil {
+		options = &PictureOptions{}
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported image: %v", err)
+	}
+	scaleX, scaleY := options.ScaleX, options.ScaleY
+	if scaleX == 0 {
+		scaleX = 1
+	}
+	if scaleY == 0 {
+		scaleY = 1
+	}
+	if scaleX < 0 || scaleY < 0 {
+		return nil, fmt.Errorf("invalid picture scale %v, %v", scaleX, scaleY)
+	}
+	width := int64(math.Floor(float64(config.Width)*scaleX + 0.5))
+	height := int64(math.Floor(float64(config.Height)*scaleY + 0.5))
+	anchor, err := s.makeDrawingAnchor(options.AnchorType, cell, int64(options.OffsetX), int64(options.OffsetY), width, height)
+	if err != nil {
+		return nil, err
+	}
+	name := options.Name
+	if name == "" {
+		name = fmt.Sprintf("Picture %d", len(s.Pictures)+1)
+	}
+	picture := &Picture{
+		Name:        name,
+		Description: options.Description,
+		Format:      format,
+		Data:        data,
+		Anchor:      anchor,
+	}
+	s.Pictures = append(s.Pictures, picture)
+	return picture, nil
+}
+
+// writeXLSXPic writes the pic element of a picture, whose image is the
+// target of the relationship rID.
+func (p *Picture) writeXLSXPic(buf *bytes.Buffer, id int, rID string) {
+	buf.WriteString(`<xdr:pic><xdr:nvPicPr>`)
+	writeDrawingCNvPr(buf, id, p.Name, p.Description)
+	buf.WriteString(`<xdr:cNvPicPr><a:picLocks noChangeAspect="1"/></xdr:cNvPicPr></xdr:nvPicPr>`)
+	fmt.Fprintf(buf, `<xdr:blipFill><a:blip r:embed="%s"/><a:stretch><a:fillRect/></a:stretch></xdr:blipFill>`, rID)
+	buf.WriteString(`<xdr:spPr>`)
+	if p.Anchor.Width > 0 && p.Anchor.Height > 0 {
+		fmt.Fprintf(buf, `<a:xfrm><a:off x="0" y="0"/><a:ext cx="%d" cy="%d"/></a:xfrm>`, p.Anchor.Width, p.Anchor.Height)
+	}
+	buf.WriteString(`<a:prstGeom prst="rect"><a:avLst/></a:prstGeom></xdr:spPr></xdr:pic>`)
+}
+
+// readPicture reads the picture of an anchor, along with its image.
+// Pictures that are linked to an image outside of the package, rather
+// than embedding it, result in nil.
+func readPicture(files map[string]*zip.File, rels map[string]xlsxWorkbookRelation, xPic *xlsxDrawingPic, anchor DrawingAnchor) (*Picture, error) {
+	rel, ok := rels[xPic.Blip.Embed]
+	if !ok {
+		return nil, nil
+	}
+	f, ok := files[rel.Target]
+	if !ok {
+		return nil, fmt.Errorf("image %q not found", rel.Target)
+	}
+	data, err := readZipFileBytes(f)
+	if err != nil {
+		return nil, err
+	}
+	if anchor.Type == DrawingAnchorTwoCell && xPic.Ext != nil {
+		anchor.Width, anchor.Height = xPic.Ext.Cx, xPic.Ext.Cy
+	}
+	return &Picture{
+		Name:        xPic.CNvPr.Name,
+		Description: xPic.CNvPr.Descr,
+		Format:      imageFormatFromPartName(rel.Target),
+		Data:        data,
+		Anchor:      anchor,
+	}, nil
+}
@@ -0,0 +1,170 @@
+package xlsx
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type PictureSuite struct{}
+
+var _ = Suite(&PictureSuite{})
+
+// makeTestPNG returns a blank PNG image of the given size.
+func makeTestPNG(c *C, width, height int) []byte {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height)))
+	c.Assert(err, IsNil)
+	return buf.Bytes()
+}
+
+// A picture is anchored to the cells it covers, which depend on the
+// size of the columns and rows.
+func (s *PictureSuite) TestAddPicture(c *C) {
+	f := NewFile()
+	sheet, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	sheet.SetColWidth(1, 1, 20)
+	sheet.Row(2).SetHeight(30)
+
+	picture, err := sheet.AddPicture("B2", makeTestPNG(c, 200, 50), &PictureOptions{OffsetX: 10, OffsetY: 5})
+	c.Assert(err, IsNil)
+	c.Assert(picture.Format, Equals, "png")
+	c.Assert(picture.Name, Equals, "Picture 1")
+	// Column B is 140 pixels wide, the others 66. Row 2 is 20 pixels
+	// high and row 3 is 40.
+	c.Assert(picture.Anchor, Equals, DrawingAnchor{
+		Type:   DrawingAnchorTwoCell,
+		From:   DrawingMarker{Col: 1, Row: 1, ColOffset: 10 * EMUsPerPixel, RowOffset: 5 * EMUsPerPixel},
+		To:     DrawingMarker{Col: 3, Row: 2, ColOffset: 4 * EMUsPerPixel, RowOffset: 35 * EMUsPerPixel},
+		Width:  200 * EMUsPerPixel,
+		Height: 50 * EMUsPerPixel,
+	})
+
+	picture, err = sheet.AddPicture("D4", makeTestPNG(c, 100, 100), &PictureOptions{
+		AnchorType: DrawingAnchorOneCell,
+		ScaleX:     0.5,
+		ScaleY:     2,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(picture.Anchor, Equals, DrawingAnchor{
+		Type:   DrawingAnchorOneCell,
+		From:   DrawingMarker{Col: 3, Row: 3},
+		Width:  50 * EMUsPerPixel,
+		Height: 200 * EMUsPerPixel,
+	})
+
+	_, err = sheet.AddPicture("A1", []byte("not an image"), nil)
+	c.Assert(err, NotNil)
+	c.Assert(sheet.Pictures, HasLen, 2)
+}
+
+// Columns and rows too narrow to have any pixels are skipped when
+// anchoring a picture, and the anchor can't go past the end of the
+// sheet.
+func (s *PictureSuite) TestAnchorSkipsEmptyColumnsAndRows(c *C) {
+	f := NewFile()
+	sheet, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	c.Assert(sheet.SetColWidth(1, 1, 0.01), IsNil)
+
+	picture, err := sheet.AddPicture("A1", makeTestPNG(c, 70, 10), nil)
+	c.Assert(err, IsNil)
+	c.Assert(picture.Anchor.To, Equals, DrawingMarker{Col: 2, Row: 0, ColOffset: 4 * EMUsPerPixel, RowOffset: 10 * EMUsPerPixel})
+
+	sheet.SheetFormat.DefaultColWidth = 0.01
+	sheet.SheetFormat.DefaultRowHeight = 0.1
+	picture, err = sheet.AddPicture("C3", makeTestPNG(c, 10, 10), nil)
+	c.Assert(err, IsNil)
+	c.Assert(picture.Anchor.To.Col, Equals, excel2006MaxColCount-1)
+	c.Assert(picture.Anchor.To.Row, Equals, Excel2006MaxRowIndex)
+}
+
+// Pictures are written to a drawing part, and their images to the
+// media folder.
+func (s *PictureSuite) TestMarshalPictures(c *C) {
+	f := NewFile()
+	sheet, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	image := makeTestPNG(c, 10, 10)
+	_, err = sheet.AddPicture("A1", image, &PictureOptions{Name: "Logo", Description: "A & B", AnchorType: DrawingAnchorOneCell})
+	c.Assert(err, IsNil)
+	_, err = sheet.AddPicture("C3", image, nil)
+	c.Assert(err, IsNil)
+
+	parts, err := f.MarshallParts()
+	c.Assert(err, IsNil)
+	c.Assert(parts["xl/media/image1.png"], Equals, string(image))
+	_, ok := parts["xl/media/image2.png"]
+	c.Assert(ok, Equals, false)
+	c.Assert(parts["xl/worksheets/_rels/sheet1.xml.rels"], Equals, `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Target="../drawings/drawing1.xml" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/drawing"></Relationship></Relationships>`)
+	c.Assert(parts["xl/drawings/_rels/drawing1.xml.rels"], Equals, `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Target="../media/image1.png" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/image"></Relationship><Relationship Id="rId2" Target="../media/image1.png" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/image"></Relationship></Relationships>`)
+	c.Assert(parts["xl/drawings/drawing1.xml"], Equals, `<?xml version="1.0" encoding="UTF-8"?>
+<xdr:wsDr xmlns:xdr="http://schemas.openxmlformats.org/drawingml/2006/spreadsheetDrawing" xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">`+
+		`<xdr:oneCellAnchor><xdr:from><xdr:col>0</xdr:col><xdr:colOff>0</xdr:colOff><xdr:row>0</xdr:row><xdr:rowOff>0</xdr:rowOff></xdr:from><xdr:ext cx="95250" cy="95250"/>`+
+		`<xdr:pic><xdr:nvPicPr><xdr:cNvPr id="1" name="Logo" descr="A &amp; B"/><xdr:cNvPicPr><a:picLocks noChangeAspect="1"/></xdr:cNvPicPr></xdr:nvPicPr>`+
+		`<xdr:blipFill><a:blip r:embed="rId1"/><a:stretch><a:fillRect/></a:stretch></xdr:blipFill>`+
+		`<xdr:spPr><a:xfrm><a:off x="0" y="0"/><a:ext cx="95250" cy="95250"/></a:xfrm><a:prstGeom prst="rect"><a:avLst/></a:prstGeom></xdr:spPr></xdr:pic>`+
+		`<xdr:clientData/></xdr:oneCellAnchor>`+
+		`<xdr:twoCellAnchor><xdr:from><xdr:col>2</xdr:col><xdr:colOff>0</xdr:colOff><xdr:row>2</xdr:row><xdr:rowOff>0</xdr:rowOff></xdr:from>`+
+		`<xdr:to><xdr:col>2</xdr:col><xdr:colOff>95250</xdr:colOff><xdr:row>2</xdr:row><xdr:rowOff>95250</xdr:rowOff></xdr:to>`+
+		`<xdr:pic><xdr:nvPicPr><xdr:cNvPr id="2" name="Picture 2"/><xdr:cNvPicPr><a:picLocks noChangeAspect="1"/></xdr:cNvPicPr></xdr:nvPicPr>`+
+		`<xdr:blipFill><a:blip r:embed="rId2"/><a:stretch><a:fillRect/></a:stretch></xdr:blipFill>`+
+		`<xdr:spPr><a:xfrm><a:off x="0" y="0"/><a:ext cx="95250" cy="95250"/></a:xfrm><a:prstGeom prst="rect"><a:avLst/></a:prstGeom></xdr:spPr></xdr:pic>`+
+		`<xdr:clientData/></xdr:twoCellAnchor></xdr:wsDr>`)
+	c.Assert(strings.Contains(parts["xl/worksheets/sheet1.xml"], `<drawing r:id="rId1"></drawing>`), Equals, true)
+	types := parts["[Content_Types].xml"]
+	c.Assert(strings.Contains(types, `<Override PartName="/xl/drawings/drawing1.xml" ContentType="application/vnd.openxmlformats-officedocument.drawing+xml"></Override>`), Equals, true)
+	c.Assert(strings.Contains(types, `<Default Extension="png" ContentType="image/png"></Default>`), Equals, true)
+}
+
+// Pictures in a workbook written by another application are read.
+func (s *PictureSuite) TestReadPictures(c *C) {
+	f, err := OpenFile("./testdocs/inlineStrings.xlsx")
+	c.Assert(err, IsNil)
+	pictures := f.Sheets[0].Pictures
+	c.Assert(pictures, HasLen, 2)
+	c.Assert(pictures[0].Name, Equals, "Picture 1")
+	c.Assert(pictures[0].Description, Equals, "Hyperlink")
+	c.Assert(pictures[0].Format, Equals, "jpeg")
+	c.Assert(pictures[0].Data, HasLen, 25266)
+	c.Assert(pictures[0].Anchor, Equals, DrawingAnchor{
+		Type: DrawingAnchorTwoCell,
+		From: DrawingMarker{Col: 8},
+		To:   DrawingMarker{Col: 10, ColOffset: 140589, Row: 2, RowOffset: 50800},
+	})
+	c.Assert(pictures[1].Format, Equals, "png")
+	c.Assert(pictures[1].Data, HasLen, 19563)
+}
+
+// Pictures survive writing a File and reading it back.
+func (s *PictureSuite) TestPictureRoundTrip(c *C) {
+	f, err := OpenFile("./testdocs/inlineStrings.xlsx")
+	c.Assert(err, IsNil)
+	sheet, err := f.AddSheet("Pictures")
+	c.Assert(err, IsNil)
+	_, err = sheet.AddPicture("B2", makeTestPNG(c, 30, 20), &PictureOptions{AnchorType: DrawingAnchorAbsolute})
+	c.Assert(err, IsNil)
+
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), IsNil)
+	read, err := OpenBinary(buf.Bytes())
+	c.Assert(err, IsNil)
+	c.Assert(read.Sheets[0].Pictures, HasLen, 2)
+	for i, picture := range read.Sheets[0].Pictures {
+		c.Assert(*picture, DeepEquals, *f.Sheets[0].Pictures[i])
+	}
+	c.Assert(read.Sheets[1].Pictures, HasLen, 1)
+	c.Assert(read.Sheets[1].Pictures[0].Anchor, Equals, DrawingAnchor{
+		Type:   DrawingAnchorAbsolute,
+		X:      66 * EMUsPerPixel,
+		Y:      20 * EMUsPerPixel,
+		Width:  30 * EMUsPerPixel,
+		Height: 20 * EMUsPerPixel,
+	})
+}
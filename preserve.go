@@ -0,0 +1,694 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// These are the types of the relationships whose targets the library
+// reads and writes itself, for each kind of part that relationships
+// can belong to.  The targets of any other relationship are unknown
+// parts.  The calculation chain is left out on purpose, as it is no
+// longer valid once cells have been edited.  The drawing of a
+// worksheet is modelled, but its part is also kept, as an
+// originalDrawing, so that it can be written back unchanged.
+var (
+	packageRelationshipTypes = map[string]bool{
+		relationshipTypeOfficeDocument:     true,
+		relationshipTypeCoreProperties:     true,
+		relationshipTypeExtendedProperties: true,
+		relationshipTypeCustomProperties:   true,
+	}
+	workbookRelationshipTypes = map[string]bool{
+		relationshipTypeWorksheet:     true,
+		relationshipTypeChartsheet:    true,
+		relationshipTypeSharedStrings: true,
+		relationshipTypeStyles:        true,
+		relationshipTypeTheme:         true,
+		relationshipTypeCalcChain:     true,
+		relationshipTypeVBAProject:    true,
+	}
+	worksheetRelationshipTypes = map[string]bool{
+		relationshipTypeComments:   true,
+		relationshipTypeVMLDrawing: true,
+		relationshipTypeDrawing:    true,
+		relationshipTypeTable:      true,
+		relationshipTypeHyperlink:  true,
+	}
+)
+
+// relationshipIDAttr matches the attributes, such as r:id, and the
+// r:embed and r:link of images in drawings, through which XML refers to
+// the relationships of its part.
+var relationshipIDAttr = regexp.MustCompile(`(\s[A-Za-z_][\w.-]*:(?:id|embed|link)=")([^"]*)(")`)
+
+// preservedParts holds the parts of a file opened with the
+// PreserveUnknownParts option that the library doesn't model, along
+// with the relationships that lead to them, so that they can be
+// written back unchanged.  The targets of the relationships are
+// resolved to the full names of the parts.
+type preservedParts struct {
+	// parts holds the content of the unknown parts, and rels
+	// their own relationships, by the name of the part.
+	parts map[string][]byte
+	rels  map[string][]xlsxWorkbookRelation
+	// overrides and defaults are the content types of the
+	// original file, by part name and by file extension.
+	overrides map[string]string
+	defaults  map[string]string
+	// root and workbook are the relationships of the package and
+	// of the workbook that lead to unknown parts.  The sheets keep
+	// their own.
+	root     []xlsxWorkbookRelation
+	workbook []xlsxWorkbookRelation
+	// externalReferences and pivotCaches are the elements of the
+	// workbook that refer to unknown parts.
+	externalReferences *xlsxInnerXML
+	pivotCaches        *xlsxInnerXML
+}
+
+// readPreservedParts reads the content types of a file and, when
+// unknown is set, the relationships of the package and of the workbook
+// that lead to unknown parts.  Without it, only the parts that
+// chartsheets lead to are kept.  The parts themselves are read by
+// load, once the sheets have been read.
+func readPreservedParts(files map[string]*zip.File, unknown bool) (*preservedParts, error) {
+	p := &preservedParts{
+		parts:     make(map[string][]byte),
+		rels:      make(map[string][]xlsxWorkbookRelation),
+		overrides: make(map[string]string),
+		defaults:  make(map[string]string),
+	}
+	if f, ok := files["[Content_Types].xml"]; ok {
+		b, err := readZipFileBytes(f)
+		if err != nil {
+			return nil, err
+		}
+		var types xlsxTypes
+		if err = xml.Unmarshal(b, &types); err != nil {
+			return nil, err
+		}
+		for _, override := range types.Overrides {
+			p.overrides[strings.TrimPrefix(override.PartName, "/")] = override.ContentType
+		}
+		for _, d := range types.Defaults {
+			p.defaults[strings.ToLower(d.Extension)] = d.ContentType
+		}
+	}
+	if !unknown {
+		return p, nil
+	}
+	rels, err := readPartRelations(files, "")
+	if err != nil {
+		return nil, err
+	}
+	p.root = unmodelledRelationships(rels, packageRelationshipTypes)
+	rels, err = readPartRelations(files, "xl/workbook.xml")
+	if err != nil {
+		return nil, err
+	}
+	p.workbook = unmodelledRelationships(rels, workbookRelationshipTypes)
+	return p, nil
+}
+
+// unmodelledRelationships returns the relationships whose types are
+// not amongst the modelled ones, in the order of their Ids.
+func unmodelledRelationships(rels map[string]xlsxWorkbookRelation, modelled map[string]bool) []xlsxWorkbookRelation {
+	var unmodelled []xlsxWorkbookRelation
+	for _, rel := range rels {
+		if !modelled[rel.Type] {
+			unmodelled = append(unmodelled, rel)
+		}
+	}
+	sort.Slice(unmodelled, func(i, j int) bool {
+		a, b := unmodelled[i].Id, unmodelled[j].Id
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return a < b
+	})
+	return unmodelled
+}
+
+// load reads the unknown parts that the relationships of the package,
+// the workbook and the sheets lead to, and every part that those lead
+// to in turn, as well as the original drawings of the sheets.
+// Relationships to parts missing from the file are dropped.
+func (p *preservedParts) load(files map[string]*zip.File, sheets []*Sheet) error {
+	var visit func(rels []xlsxWorkbookRelation) ([]xlsxWorkbookRelation, error)
+	visit = func(rels []xlsxWorkbookRelation) ([]xlsxWorkbookRelation, error) {
+		var kept []xlsxWorkbookRelation
+		for _, rel := range rels {
+			if rel.TargetMode == relationshipTargetModeExternal {
+				kept = append(kept, rel)
+				continue
+			}
+			f, ok := files[rel.Target]
+			if !ok {
+				continue
+			}
+			kept = append(kept, rel)
+			if _, ok := p.parts[rel.Target]; ok {
+				continue
+			}
+			b, err := readZipFileBytes(f)
+			if err != nil {
+				return nil, err
+			}
+			p.parts[rel.Target] = b
+			partRels, err := readPartRelations(files, rel.Target)
+			if err != nil {
+				return nil, err
+			}
+			if len(partRels) > 0 {
+				all := unmodelledRelationships(partRels, nil)
+				if p.rels[rel.Target], err = visit(all); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return kept, nil
+	}
+	var err error
+	if p.root, err = visit(p.root); err != nil {
+		return err
+	}
+	if p.workbook, err = visit(p.workbook); err != nil {
+		return err
+	}
+	for _, sheet := range sheets {
+		if sheet.preservedRels, err = visit(sheet.preservedRels); err != nil {
+			return err
+		}
+		if sheet.drawing != nil {
+			kept, err := visit([]xlsxWorkbookRelation{sheet.drawing.rel})
+			if err != nil {
+				return err
+			}
+			if len(kept) == 0 {
+				sheet.drawing = nil
+			}
+		}
+	}
+	return nil
+}
+
+// remapRelationshipIDs returns the XML with the relationship Ids it
+// refers to replaced as given by ids, and whether all of them were
+// found there.  Ids that aren't in the map are left alone.
+func remapRelationshipIDs(content string, ids map[string]string) (string, bool) {
+	found := true
+	content = relationshipIDAttr.ReplaceAllStringFunc(content, func(attr string) string {
+		m := relationshipIDAttr.FindStringSubmatch(attr)
+		if id, ok := ids[m[2]]; ok {
+			return m[1] + id + m[3]
+		}
+		found = false
+		return attr
+	})
+	return content, found
+}
+
+// dropRelationshipElements returns the XML without the elements that
+// refer to relationships, for when the parts they lead to aren't
+// written.
+func dropRelationshipElements(content string) string {
+	for {
+		loc := relationshipIDAttr.FindStringIndex(content)
+		if loc == nil {
+			return content
+		}
+		start := strings.LastIndex(content[:loc[0]], "<")
+		name := content[start+1 : loc[0]]
+		if i := strings.IndexAny(name, " \t\r\n"); i >= 0 {
+			name = name[:i]
+		}
+		element := regexp.MustCompile(`(?s)^<` + regexp.QuoteMeta(name) + `\b[^>]*?(?:/>|>.*?</` + regexp.QuoteMeta(name) + `>)`)
+		end := start + len(element.FindString(content[start:]))
+		if end == start {
+			end = loc[1]
+		}
+		content = content[:start] + content[end:]
+	}
+}
+
+// carriedRelationship is a relationship to an unknown part that has
+// been added to the relationships of a part being written.  Its target
+// is fixed once the names of all the parts are known.
+type carriedRelationship struct {
+	rels   *xlsxWorkbookRels
+	index  int
+	source string
+}
+
+// partCarrier writes the unknown parts of a file along with the parts
+// that the library makes itself.
+type partCarrier struct {
+	preserved *preservedParts
+	pending   []carriedRelationship
+}
+
+// addRelationships appends the relationships to unknown parts to the
+// relationships of the named part, and returns the new Id of each of
+// them by its original Id.
+func (c *partCarrier) addRelationships(rels *xlsxWorkbookRels, source string, carried []xlsxWorkbookRelation) map[string]string {
+	ids := make(map[string]string, len(carried))
+	for _, rel := range carried {
+		ids[rel.Id] = rels.addRelationship(rel.Type, rel.Target, rel.TargetMode)
+		if rel.TargetMode != relationshipTargetModeExternal {
+			c.pending = append(c.pending, carriedRelationship{rels: rels, index: len(rels.Relationships) - 1, source: source})
+		}
+	}
+	return ids
+}
+
+// keeps reports whether the parts that the relationships lead to are
+// written, which they are when they are external or were preserved.
+func (c *partCarrier) keeps(rels []xlsxWorkbookRelation) bool {
+	for _, rel := range rels {
+		if rel.TargetMode == relationshipTargetModeExternal {
+			continue
+		}
+		if c.preserved == nil {
+			return false
+		}
+		if _, ok := c.preserved.parts[rel.Target]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// finish adds the unknown parts that are still referred to, and their
+// relationships and content types, to the parts that have been made.
+// An unknown part whose name has been taken by a new part is renamed.
+func (c *partCarrier) finish(parts map[string]string, types *xlsxTypes) error {
+	if c.preserved == nil {
+		return nil
+	}
+	names := make(map[string]string)
+	var order []string
+	taken := func(name string) bool {
+		if _, ok := parts[name]; ok {
+			return true
+		}
+		for _, written := range names {
+			if written == name {
+				return true
+			}
+		}
+		return false
+	}
+	var visit func(name string)
+	visit = func(name string) {
+		if _, ok := names[name]; ok {
+			return
+		}
+		if _, ok := c.preserved.parts[name]; !ok {
+			return
+		}
+		written := name
+		ext := path.Ext(name)
+		for n := 1; taken(written); n++ {
+			written = fmt.Sprintf("%s_%d%s", strings.TrimSuffix(name, ext), n, ext)
+		}
+		names[name] = written
+		order = append(order, name)
+		for _, rel := range c.preserved.rels[name] {
+			if rel.TargetMode != relationshipTargetModeExternal {
+				visit(rel.Target)
+			}
+		}
+	}
+	for _, p := range c.pending {
+		visit(p.rels.Relationships[p.index].Target)
+	}
+
+	for _, name := range order {
+		written := names[name]
+		parts[written] = string(c.preserved.parts[name])
+		if partRels := c.preserved.rels[name]; len(partRels) > 0 {
+			xRels := xlsxWorkbookRels{}
+			for _, rel := range partRels {
+				if rel.TargetMode != relationshipTargetModeExternal {
+					rel.Target = relativeRelationshipTarget(written, names[rel.Target])
+				}
+				xRels.Relationships = append(xRels.Relationships, rel)
+			}
+			body, err := xml.Marshal(xRels)
+			if err != nil {
+				return err
+			}
+			parts[relsNameForPart(written)] = xml.Header + string(body)
+		}
+		if contentType, ok := c.preserved.overrides[name]; ok {
+			types.Overrides = append(types.Overrides, xlsxOverride{PartName: "/" + written, ContentType: contentType})
+		} else {
+			ext := strings.ToLower(strings.TrimPrefix(path.Ext(name), "."))
+			if contentType, ok := c.preserved.defaults[ext]; ok {
+				types.addDefault(ext, contentType)
+			}
+		}
+	}
+	for _, p := range c.pending {
+		rel := &p.rels.Relationships[p.index]
+		rel.Target = relativeRelationshipTarget(p.source, names[rel.Target])
+	}
+	return nil
+}
+
+// namespaceSpreadsheetML is the namespace of the elements of a
+// worksheet.
+const namespaceSpreadsheetML = "http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+
+// namespaceXML is the namespace that the xml prefix is bound to.
+const namespaceXML = "http://www.w3.org/XML/1998/namespace"
+
+// rawElements returns the fields of the worksheet that hold elements
+// the library doesn't model, in the order of the schema.
+func (w *xlsxWorksheet) rawElements() []**xlsxRawElement {
+	return []**xlsxRawElement{
+		&w.SheetCalcPr, &w.ProtectedRanges, &w.Scenarios, &w.SortState,
+		&w.DataConsolidate, &w.CustomSheetViews, &w.PhoneticPr,
+		&w.RowBreaks, &w.ColBreaks, &w.CustomProperties, &w.CellWatches,
+		&w.IgnoredErrors, &w.SmartTags, &w.LegacyDrawingHF, &w.DrawingHF,
+		&w.Picture, &w.OleObjects, &w.Controls, &w.WebPublishItems,
+	}
+}
+
+// qualifyRawNames gives the elements of a worksheet that are held as
+// raw XML, and the attributes that aren't mapped, the prefixes that
+// they had in the file.  encoding/xml would otherwise invent prefixes
+// of its own, which the raw content of the elements doesn't know.
+func (w *xlsxWorksheet) qualifyRawNames() {
+	prefixes := map[string]string{namespaceXML: "xml"}
+	for _, attr := range w.Attrs {
+		if attr.Name.Space == "xmlns" {
+			prefixes[attr.Value] = attr.Name.Local
+		}
+	}
+	qualifyAttrNames(w.Attrs, prefixes)
+	for _, e := range w.rawElements() {
+		if *e != nil {
+			(*e).qualifyNames(prefixes)
+		}
+	}
+	qualifyRawElements(w.Unknown, prefixes)
+	qualifyAttrNames(w.SheetPr.Attrs, prefixes)
+	qualifyRawElements(w.SheetPr.Unknown, prefixes)
+	for i := range w.SheetViews.SheetView {
+		qualifyAttrNames(w.SheetViews.SheetView[i].Attrs, prefixes)
+		qualifyRawElements(w.SheetViews.SheetView[i].Unknown, prefixes)
+	}
+}
+
+func qualifyRawElements(elements []xlsxRawElement, prefixes map[string]string) {
+	for i := range elements {
+		elements[i].qualifyNames(prefixes)
+	}
+}
+
+func qualifyAttrNames(attrs []xml.Attr, prefixes map[string]string) {
+	for i := range attrs {
+		attrs[i].Name = qualifyAttrName(attrs[i].Name, prefixes)
+	}
+}
+
+// qualifyNames gives the element and its attributes the prefixes
+// bound on the worksheet or on the element itself.  The element keeps
+// the namespace of the worksheet, so that the unprefixed elements of
+// its content stay in it.
+func (e *xlsxRawElement) qualifyNames(prefixes map[string]string) {
+	local := prefixes
+	copied := false
+	attrs := e.Attrs[:0]
+	for _, attr := range e.Attrs {
+		if attr.Name.Space == "" && attr.Name.Local == "xmlns" {
+			continue
+		}
+		if attr.Name.Space == "xmlns" {
+			if !copied {
+				local = make(map[string]string, len(prefixes)+1)
+				for k, v := range prefixes {
+					local[k] = v
+				}
+				copied = true
+			}
+			local[attr.Value] = attr.Name.Local
+		}
+		attrs = append(attrs, attr)
+	}
+	e.Attrs = attrs
+	qualifyAttrNames(e.Attrs, local)
+	if e.XMLName.Space != namespaceSpreadsheetML {
+		if prefix, ok := local[e.XMLName.Space]; ok {
+			e.XMLName.Local = prefix + ":" + e.XMLName.Local
+		}
+	}
+	e.XMLName.Space = namespaceSpreadsheetML
+}
+
+// qualifyAttrName returns the name of an attribute with the prefix of
+// its namespace in place of the namespace.
+func qualifyAttrName(name xml.Name, prefixes map[string]string) xml.Name {
+	switch name.Space {
+	case "":
+		return name
+	case "xmlns":
+		return xml.Name{Local: "xmlns:" + name.Local}
+	}
+	if prefix, ok := prefixes[name.Space]; ok {
+		return xml.Name{Local: prefix + ":" + name.Local}
+	}
+	return name
+}
+
+// copyUnmodelledXML copies the XML that the library doesn't model from
+// the worksheet that the sheet was read from, if any.
+func (s *Sheet) copyUnmodelledXML(worksheet *xlsxWorksheet) {
+	original := s.unmodelled
+	if original == nil {
+		return
+	}
+	from := original.rawElements()
+	for i, e := range worksheet.rawElements() {
+		*e = *from[i]
+	}
+	worksheet.Unknown = original.Unknown
+	worksheet.SheetPr.Attrs = original.SheetPr.Attrs
+	worksheet.SheetPr.Unknown = original.SheetPr.Unknown
+	for i := range worksheet.SheetViews.SheetView {
+		if i < len(original.SheetViews.SheetView) {
+			view, originalView := &worksheet.SheetViews.SheetView[i], original.SheetViews.SheetView[i]
+			view.Attrs = originalView.Attrs
+			view.Unknown = originalView.Unknown
+			// The selections name the pane they are in, so they are
+			// only kept while the view is split in the same way.
+			if len(originalView.Selection) > 0 && (view.Pane == nil) == (originalView.Pane == nil) &&
+				(view.Pane == nil || view.Pane.ActivePane == originalView.Pane.ActivePane) {
+				view.Selection = originalView.Selection
+			}
+		}
+	}
+}
+
+// remapRawRelationships rewrites the relationship Ids that the raw XML
+// of a worksheet refers to as given by ids, and drops the elements that
+// refer to relationships which aren't written.  The elements are
+// copied, as they are shared with the sheet.
+func (w *xlsxWorksheet) remapRawRelationships(ids map[string]string) {
+	for _, e := range w.rawElements() {
+		if *e != nil {
+			*e = (*e).remapRelationships(ids)
+		}
+	}
+	w.Unknown = remapRawElements(w.Unknown, ids)
+	w.SheetPr.Unknown = remapRawElements(w.SheetPr.Unknown, ids)
+	for i := range w.SheetViews.SheetView {
+		w.SheetViews.SheetView[i].Unknown = remapRawElements(w.SheetViews.SheetView[i].Unknown, ids)
+	}
+}
+
+func remapRawElements(elements []xlsxRawElement, ids map[string]string) []xlsxRawElement {
+	var remapped []xlsxRawElement
+	for i := range elements {
+		if e := elements[i].remapRelationships(ids); e != nil {
+			remapped = append(remapped, *e)
+		}
+	}
+	return remapped
+}
+
+// remapRelationships returns a copy of the element that refers to the
+// relationships given by ids, or nil if it refers to any relationship
+// that isn't there.
+func (e *xlsxRawElement) remapRelationships(ids map[string]string) *xlsxRawElement {
+	content, ok := remapRelationshipIDs(e.Content, ids)
+	if !ok {
+		return nil
+	}
+	remapped := &xlsxRawElement{XMLName: e.XMLName, Content: content}
+	for _, attr := range e.Attrs {
+		if strings.HasSuffix(attr.Name.Local, ":id") && attr.Name.Space == "" {
+			id, ok := ids[attr.Value]
+			if !ok {
+				return nil
+			}
+			attr.Value = id
+		}
+		remapped.Attrs = append(remapped.Attrs, attr)
+	}
+	return remapped
+}
+
+// mergeWorksheetExtLst returns the extLst of a worksheet, which holds
+// the extensions that the library made followed by those that the
+// worksheet was read with, with their relationship Ids remapped.
+// Extensions that refer to relationships which aren't written are
+// dropped.  The Excel 2010 conditional formattings that were read are
+// merged with those that were made, leaving out the data bars of
+// dataBarIDs, which have been made again.
+func mergeWorksheetExtLst(original, made *xlsxInnerXML, ids map[string]string, dataBarIDs map[string]bool) (*xlsxInnerXML, error) {
+	if original == nil {
+		return made, nil
+	}
+	exts, err := splitExtLst(original.Content)
+	if err != nil {
+		return nil, err
+	}
+	madeContent := ""
+	if made != nil {
+		madeContent = made.Content
+	}
+	var buf strings.Builder
+	for _, ext := range exts {
+		if ext.uri == extURIConditionalFormattings {
+			ext.content = mergeConditionalFormattingExt(ext.content, madeContent, dataBarIDs)
+			madeContent = ""
+		}
+		if content, ok := remapRelationshipIDs(ext.content, ids); ok {
+			buf.WriteString(content)
+		}
+	}
+	content := madeContent + buf.String()
+	if content == "" {
+		return nil, nil
+	}
+	return &xlsxInnerXML{Content: content}, nil
+}
+
+// These match the parts of the Excel 2010 conditional formattings of a
+// worksheet.
+var (
+	rawX14ConditionalFormatting     = rawElementsNamed("conditionalFormatting")
+	rawX14ConditionalFormattingsEnd = regexp.MustCompile(`</(?:\w+:)?conditionalFormattings>`)
+	rawX14CfRule                    = rawElementsNamed("cfRule")
+)
+
+// mergeConditionalFormattingExt returns the ext element of the Excel
+// 2010 conditional formattings that a worksheet was read with, without
+// the rules of dataBarIDs, and with those of the ext that the library
+// made added at the end.  It returns made when none of the formattings
+// that were read are left.
+func mergeConditionalFormattingExt(original, made string, dataBarIDs map[string]bool) string {
+	kept := rawX14CfRule.ReplaceAllStringFunc(original, func(rule string) string {
+		start := rule[:strings.Index(rule, ">")]
+		if m := rawIDAttr.FindStringSubmatch(start); m != nil && dataBarIDs[m[2]] {
+			return ""
+		}
+		return rule
+	})
+	kept = rawX14ConditionalFormatting.ReplaceAllStringFunc(kept, func(cf string) string {
+		if !rawX14CfRule.MatchString(cf) {
+			return ""
+		}
+		return cf
+	})
+	if !rawX14ConditionalFormatting.MatchString(kept) {
+		return made
+	}
+	end := rawX14ConditionalFormattingsEnd.FindStringIndex(kept)
+	if made == "" || end == nil {
+		return kept
+	}
+	// The formattings that were made declare the prefix they use, as
+	// the ext that they go into may not.
+	const openTag, closeTag = "<x14:conditionalFormattings>", "</x14:conditionalFormattings>"
+	inner := made[strings.Index(made, openTag)+len(openTag) : strings.LastIndex(made, closeTag)]
+	inner = strings.Replace(inner, "<x14:conditionalFormatting ", `<x14:conditionalFormatting xmlns:x14="`+namespaceX14+`" `, -1)
+	return kept[:end[0]] + inner + kept[end[0]:]
+}
+
+// rawExt is an ext element of an extLst, as raw XML.
+type rawExt struct {
+	uri     string
+	content string
+}
+
+// splitExtLst splits the raw content of an extLst into its ext
+// elements.
+func splitExtLst(content string) ([]rawExt, error) {
+	var exts []rawExt
+	decoder := xml.NewDecoder(strings.NewReader(content))
+	depth := 0
+	start := int64(0)
+	var uri string
+	for {
+		offset := decoder.InputOffset()
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			return exts, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if depth == 0 {
+				start = offset
+				uri = ""
+				for _, attr := range t.Attr {
+					if attr.Name.Space == "" && attr.Name.Local == "uri" {
+						uri = attr.Value
+					}
+				}
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+			if depth == 0 {
+				exts = append(exts, rawExt{uri: uri, content: content[start:decoder.InputOffset()]})
+			}
+		}
+	}
+}
+
+// addWorksheetRootAttrs adds the attributes that a worksheet was read
+// with, which are mostly declarations of the namespaces that its raw
+// XML refers to, to the root element of the marshalled worksheet,
+// unless it already has them.
+func addWorksheetRootAttrs(sheetMarshal string, attrs []xml.Attr) string {
+	start := strings.Index(sheetMarshal, "<worksheet ")
+	if start < 0 {
+		return sheetMarshal
+	}
+	end := start + strings.Index(sheetMarshal[start:], ">")
+	tag := sheetMarshal[start:end]
+	var extra bytes.Buffer
+	for _, attr := range attrs {
+		if attr.Name.Space != "" || attr.Name.Local == "xmlns" || strings.Contains(tag, " "+attr.Name.Local+"=") {
+			continue
+		}
+		fmt.Fprintf(&extra, ` %s="`, attr.Name.Local)
+		xml.EscapeText(&extra, []byte(attr.Value))
+		extra.WriteString(`"`)
+	}
+	return sheetMarshal[:end] + extra.String() + sheetMarshal[end:]
+}
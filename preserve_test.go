@@ -0,0 +1,330 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type PreserveSuite struct{}
+
+var _ = Suite(&PreserveSuite{})
+
+// readZipParts returns the content of every part of a zip file by name.
+func readZipParts(c *C, b []byte) map[string]string {
+	r, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	c.Assert(err, IsNil)
+	parts := make(map[string]string)
+	for _, f := range r.File {
+		rc, err := f.Open()
+		c.Assert(err, IsNil)
+		content, err := ioutil.ReadAll(rc)
+		rc.Close()
+		c.Assert(err, IsNil)
+		parts[f.Name] = string(content)
+	}
+	return parts
+}
+
+// Unknown parts are only written back when they are asked to be
+// preserved, and are then written unchanged along with their
+// relationships and content types.
+func (s *PreserveSuite) TestPreserveUnknownParts(c *C) {
+	original, err := ioutil.ReadFile("./testdocs/testFileToSlice.xlsx")
+	c.Assert(err, IsNil)
+	originalParts := readZipParts(c, original)
+
+	f, err := OpenBinary(original)
+	c.Assert(err, IsNil)
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), IsNil)
+	_, ok := readZipParts(c, buf.Bytes())["xl/printerSettings/printerSettings1.bin"]
+	c.Assert(ok, Equals, false)
+
+	f, err = OpenBinaryWithOptions(original, OpenOptions{PreserveUnknownParts: true})
+	c.Assert(err, IsNil)
+	f.Sheets[0].Cell(0, 0).SetString("edited")
+	buf.Reset()
+	c.Assert(f.Write(&buf), IsNil)
+	parts := readZipParts(c, buf.Bytes())
+	c.Assert(parts["xl/printerSettings/printerSettings1.bin"], Equals, originalParts["xl/printerSettings/printerSettings1.bin"])
+	c.Assert(strings.Contains(parts["xl/worksheets/_rels/sheet1.xml.rels"], `<Relationship Id="rId1" Target="../printerSettings/printerSettings1.bin" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/printerSettings"></Relationship>`), Equals, true)
+	c.Assert(strings.Contains(parts["[Content_Types].xml"], `<Default Extension="bin" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.printerSettings">`), Equals, true)
+
+	read, err := OpenBinary(buf.Bytes())
+	c.Assert(err, IsNil)
+	c.Assert(read.Sheets[0].Cell(0, 0).Value, Equals, "edited")
+}
+
+// Relationships of the package are preserved, but the calculation
+// chain is dropped as it may no longer match the cells.
+func (s *PreserveSuite) TestPreservePackageParts(c *C) {
+	f, err := OpenFileWithOptions("./testdocs/testcelltypes.xlsx", OpenOptions{PreserveUnknownParts: true})
+	c.Assert(err, IsNil)
+	parts, err := f.MarshallParts()
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(parts["_rels/.rels"], `<Relationship Id="rId4" Target="docProps/thumbnail.jpeg" Type="http://schemas.openxmlformats.org/package/2006/relationships/metadata/thumbnail"></Relationship>`), Equals, true)
+	c.Assert(len(parts["docProps/thumbnail.jpeg"]) > 0, Equals, true)
+	_, ok := parts["xl/calcChain.xml"]
+	c.Assert(ok, Equals, false)
+	c.Assert(strings.Contains(parts["xl/_rels/workbook.xml.rels"], "calcChain"), Equals, false)
+}
+
+// Unknown parts whose names are taken by the parts the library makes
+// are renamed, and the Ids that the workbook uses to refer to them
+// follow the new relationships.
+func (s *PreserveSuite) TestCarriedPartsAreRenamed(c *C) {
+	f := NewFile()
+	sheet, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	_, err = sheet.AddTable("A1:B3", "People", nil, "")
+	c.Assert(err, IsNil)
+	const cacheType = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/pivotCacheDefinition"
+	f.preserved = &preservedParts{
+		parts: map[string][]byte{
+			"xl/pivotCache/pivotCacheDefinition1.xml": []byte("<definition/>"),
+			"xl/tables/table1.xml":                    []byte("<other/>"),
+		},
+		rels: map[string][]xlsxWorkbookRelation{
+			"xl/pivotCache/pivotCacheDefinition1.xml": {{Id: "rId1", Type: "other", Target: "xl/tables/table1.xml"}},
+		},
+		overrides: map[string]string{"xl/tables/table1.xml": "application/other+xml"},
+		workbook: []xlsxWorkbookRelation{
+			{Id: "rId7", Type: cacheType, Target: "xl/pivotCache/pivotCacheDefinition1.xml"},
+		},
+		pivotCaches: &xlsxInnerXML{Content: `<pivotCache cacheId="3" r:id="rId7"/>`},
+	}
+	parts, err := f.MarshallParts()
+	c.Assert(err, IsNil)
+	c.Assert(parts["xl/tables/table1_1.xml"], Equals, "<other/>")
+	c.Assert(strings.Contains(parts["xl/tables/table1.xml"], "People"), Equals, true)
+	c.Assert(strings.Contains(parts["xl/pivotCache/_rels/pivotCacheDefinition1.xml.rels"], `Target="../tables/table1_1.xml"`), Equals, true)
+	c.Assert(strings.Contains(parts["xl/_rels/workbook.xml.rels"], `<Relationship Id="rId5" Target="pivotCache/pivotCacheDefinition1.xml" Type="`+cacheType+`"></Relationship>`), Equals, true)
+	c.Assert(strings.Contains(parts["xl/workbook.xml"], `<pivotCaches><pivotCache cacheId="3" r:id="rId5"/></pivotCaches>`), Equals, true)
+	c.Assert(strings.Contains(parts["[Content_Types].xml"], `<Override PartName="/xl/tables/table1_1.xml" ContentType="application/other+xml">`), Equals, true)
+
+	c.Assert(relativeRelationshipTarget("xl/worksheets/sheet1.xml", "xl/media/image1.png"), Equals, "../media/image1.png")
+	c.Assert(relativeRelationshipTarget("xl/workbook.xml", "xl/styles.xml"), Equals, "styles.xml")
+	c.Assert(relativeRelationshipTarget("", "docProps/app.xml"), Equals, "docProps/app.xml")
+}
+
+const unmodelledWorksheetXML = `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships" xmlns:mc="http://schemas.openxmlformats.org/markup-compatibility/2006" xmlns:x14ac="http://schemas.microsoft.com/office/spreadsheetml/2009/9/ac" mc:Ignorable="x14ac">` +
+	`<sheetPr codeName="Sheet1"><tabColor rgb="FFFF0000"/><pageSetUpPr fitToPage="1"/></sheetPr>` +
+	`<sheetViews><sheetView zoomScaleSheetLayoutView="85" workbookViewId="0"/></sheetViews>` +
+	`<sheetData/>` +
+	`<rowBreaks count="1" manualBreakCount="1"><brk id="10" max="16383" man="1"/></rowBreaks>` +
+	`<ignoredErrors><ignoredError sqref="A1" numberStoredAsText="1"/></ignoredErrors>` +
+	`<mc:AlternateContent><mc:Choice Requires="x14"><controls><control shapeId="1025" r:id="rId3" name="Button 1"/></controls></mc:Choice></mc:AlternateContent>` +
+	`<extLst><ext uri="{78C0D931-6437-407d-A8EE-F0AAD7539E65}" xmlns:x14="http://schemas.microsoft.com/office/spreadsheetml/2009/9/main"><x14:conditionalFormattings/></ext>` +
+	`<ext uri="{CCE6A557-97BC-4b89-ADB6-D9C93CAAB3DF}" xmlns:x14="http://schemas.microsoft.com/office/spreadsheetml/2009/9/main"><x14:dataValidations count="0"/></ext></extLst>` +
+	`</worksheet>`
+
+// readUnmodelledSheet returns a File with a sheet that was read from
+// unmodelledWorksheetXML.
+func readUnmodelledSheet(c *C) (*File, *Sheet) {
+	worksheet := new(xlsxWorksheet)
+	c.Assert(xml.Unmarshal([]byte(unmodelledWorksheetXML), worksheet), IsNil)
+	worksheet.qualifyRawNames()
+	f := NewFile()
+	sheet, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	sheet.unmodelled = worksheet
+	sheet.Cell(0, 0).SetInt(1)
+	return f, sheet
+}
+
+// The elements and attributes of a worksheet that the library doesn't
+// model are written back where the schema puts them, except those
+// that refer to relationships which aren't written.
+func (s *PreserveSuite) TestUnmodelledWorksheetXML(c *C) {
+	f, _ := readUnmodelledSheet(c)
+	parts, err := f.MarshallParts()
+	c.Assert(err, IsNil)
+	sheetXML := parts["xl/worksheets/sheet1.xml"]
+	c.Assert(strings.Contains(sheetXML, `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships" xmlns:mc="http://schemas.openxmlformats.org/markup-compatibility/2006" xmlns:x14ac="http://schemas.microsoft.com/office/spreadsheetml/2009/9/ac" mc:Ignorable="x14ac">`), Equals, true)
+	c.Assert(strings.Contains(sheetXML, `<sheetPr filterMode="false" codeName="Sheet1"><tabColor xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" rgb="FFFF0000"></tabColor><pageSetUpPr`), Equals, true)
+	c.Assert(strings.Contains(sheetXML, `workbookViewId="0" zoomScaleSheetLayoutView="85">`), Equals, true)
+	c.Assert(strings.Contains(sheetXML, `</headerFooter><rowBreaks xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" count="1" manualBreakCount="1"><brk id="10" max="16383" man="1"/></rowBreaks><ignoredErrors`), Equals, true)
+	c.Assert(strings.Contains(sheetXML, "AlternateContent"), Equals, false)
+	c.Assert(strings.Contains(sheetXML, `<extLst><ext uri="{CCE6A557-97BC-4b89-ADB6-D9C93CAAB3DF}" xmlns:x14="http://schemas.microsoft.com/office/spreadsheetml/2009/9/main"><x14:dataValidations count="0"/></ext></extLst>`), Equals, true)
+
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), IsNil)
+	read, err := OpenBinary(buf.Bytes())
+	c.Assert(err, IsNil)
+	c.Assert(read.Sheets[0].unmodelled.RowBreaks, NotNil)
+	c.Assert(read.Sheets[0].unmodelled.SheetPr.Attrs, HasLen, 1)
+}
+
+// Raw XML that refers to relationships kept by PreserveUnknownParts
+// follows their new Ids.
+func (s *PreserveSuite) TestUnmodelledWorksheetXMLRelationships(c *C) {
+	f, sheet := readUnmodelledSheet(c)
+	_, err := sheet.AddTable("A1:B3", "People", nil, "")
+	c.Assert(err, IsNil)
+	f.preserved = &preservedParts{
+		parts: map[string][]byte{"xl/ctrlProps/ctrlProp1.xml": []byte("<formControlPr/>")},
+	}
+	sheet.preservedRels = []xlsxWorkbookRelation{
+		{Id: "rId3", Type: "http://schemas.openxmlformats.org/officeDocument/2006/relationships/ctrlProp", Target: "xl/ctrlProps/ctrlProp1.xml"},
+	}
+	parts, err := f.MarshallParts()
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(parts["xl/worksheets/sheet1.xml"], `<mc:AlternateContent xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><mc:Choice Requires="x14"><controls><control shapeId="1025" r:id="rId2" name="Button 1"/></controls></mc:Choice></mc:AlternateContent><tableParts count="1"><tablePart r:id="rId1">`), Equals, true)
+	c.Assert(strings.Contains(parts["xl/worksheets/_rels/sheet1.xml.rels"], `<Relationship Id="rId2" Target="../ctrlProps/ctrlProp1.xml"`), Equals, true)
+	c.Assert(sheet.unmodelled.Unknown[0].Content, Equals, `<mc:Choice Requires="x14"><controls><control shapeId="1025" r:id="rId3" name="Button 1"/></controls></mc:Choice>`)
+}
+
+// replaceZipParts returns a copy of a zip file with the content of
+// some of its parts replaced.
+func replaceZipParts(c *C, b []byte, replacements map[string]string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range readZipParts(c, b) {
+		if replacement, ok := replacements[name]; ok {
+			content = replacement
+		}
+		part, err := w.Create(name)
+		c.Assert(err, IsNil)
+		_, err = part.Write([]byte(content))
+		c.Assert(err, IsNil)
+	}
+	c.Assert(w.Close(), IsNil)
+	return buf.Bytes()
+}
+
+const preservedDrawingXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<xdr:wsDr xmlns:xdr="http://schemas.openxmlformats.org/drawingml/2006/spreadsheetDrawing" xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main">` +
+	`<xdr:twoCellAnchor><xdr:from><xdr:col>1</xdr:col><xdr:colOff>0</xdr:colOff><xdr:row>1</xdr:row><xdr:rowOff>0</xdr:rowOff></xdr:from>` +
+	`<xdr:to><xdr:col>3</xdr:col><xdr:colOff>0</xdr:colOff><xdr:row>4</xdr:row><xdr:rowOff>0</xdr:rowOff></xdr:to>` +
+	`<xdr:sp macro="" textlink=""><xdr:nvSpPr><xdr:cNvPr id="2" name="TextBox 1"/><xdr:cNvSpPr txBox="1"/></xdr:nvSpPr>` +
+	`<xdr:spPr><a:prstGeom prst="rect"><a:avLst/></a:prstGeom></xdr:spPr><xdr:txBody><a:bodyPr/><a:p><a:r><a:t>Note</a:t></a:r></a:p></xdr:txBody></xdr:sp>` +
+	`<xdr:clientData/></xdr:twoCellAnchor>` +
+	`<xdr:twoCellAnchor><xdr:from><xdr:col>5</xdr:col><xdr:colOff>0</xdr:colOff><xdr:row>1</xdr:row><xdr:rowOff>0</xdr:rowOff></xdr:from>` +
+	`<xdr:to><xdr:col>12</xdr:col><xdr:colOff>0</xdr:colOff><xdr:row>15</xdr:row><xdr:rowOff>0</xdr:rowOff></xdr:to>` +
+	`<xdr:graphicFrame macro=""><xdr:nvGraphicFramePr><xdr:cNvPr id="3" name="Chart 2"/><xdr:cNvGraphicFramePr/></xdr:nvGraphicFramePr>` +
+	`<xdr:xfrm><a:off x="0" y="0"/><a:ext cx="0" cy="0"/></xdr:xfrm><a:graphic><a:graphicData uri="http://schemas.openxmlformats.org/drawingml/2006/chart">` +
+	`<c:chart xmlns:c="http://schemas.openxmlformats.org/drawingml/2006/chart" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships" r:id="rId1"/>` +
+	`</a:graphicData></a:graphic></xdr:graphicFrame><xdr:clientData/></xdr:twoCellAnchor></xdr:wsDr>`
+
+const radarChartXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<c:chartSpace xmlns:c="http://schemas.openxmlformats.org/drawingml/2006/chart" xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+	`<c:chart><c:autoTitleDeleted val="1"/><c:plotArea><c:layout/>` +
+	`<c:radarChart><c:radarStyle val="marker"/><c:varyColors val="0"/>` +
+	`<c:ser><c:idx val="0"/><c:order val="0"/><c:val><c:numRef><c:f>Sheet1!$A$1:$A$3</c:f></c:numRef></c:val></c:ser>` +
+	`<c:axId val="1"/><c:axId val="2"/></c:radarChart>` +
+	`<c:catAx><c:axId val="1"/><c:scaling><c:orientation val="minMax"/></c:scaling><c:delete val="0"/><c:axPos val="b"/><c:crossAx val="2"/></c:catAx>` +
+	`<c:valAx><c:axId val="2"/><c:scaling><c:orientation val="minMax"/></c:scaling><c:delete val="0"/><c:axPos val="l"/><c:crossAx val="1"/></c:valAx>` +
+	`</c:plotArea><c:plotVisOnly val="1"/></c:chart></c:chartSpace>`
+
+// makeDrawingFile returns a file with a sheet whose drawing and chart
+// parts hold the given XML, in which the chart is rId1.
+func makeDrawingFile(c *C, drawingXML, chartXML string) []byte {
+	f := NewFile()
+	sheet, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	for i := 0; i < 3; i++ {
+		sheet.Cell(i, 0).SetInt(i + 1)
+	}
+	chart := &Chart{Type: ChartTypeColumn, Series: []*ChartSeries{{Values: "Sheet1!$A$1:$A$3"}}}
+	c.Assert(sheet.AddChart("F2", chart, nil), IsNil)
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), IsNil)
+	return replaceZipParts(c, buf.Bytes(), map[string]string{
+		"xl/drawings/drawing1.xml": drawingXML,
+		"xl/charts/chart1.xml":     chartXML,
+	})
+}
+
+// readPreservedDrawing returns a file, opened with the
+// PreserveUnknownParts option, with a sheet whose drawing holds a text
+// box and a radar chart.
+func readPreservedDrawing(c *C) *File {
+	f, err := OpenBinaryWithOptions(makeDrawingFile(c, preservedDrawingXML, radarChartXML), OpenOptions{PreserveUnknownParts: true})
+	c.Assert(err, IsNil)
+	return f
+}
+
+// A drawing is written back as it was read, along with its charts,
+// for as long as its pictures and charts are left alone.
+func (s *PreserveSuite) TestPreserveDrawing(c *C) {
+	f := readPreservedDrawing(c)
+	parts, err := f.MarshallParts()
+	c.Assert(err, IsNil)
+	c.Assert(parts["xl/drawings/drawing1.xml"], Equals, preservedDrawingXML)
+	c.Assert(parts["xl/charts/chart1.xml"], Equals, radarChartXML)
+	c.Assert(strings.Contains(parts["xl/drawings/_rels/drawing1.xml.rels"], `<Relationship Id="rId1" Target="../charts/chart1.xml"`), Equals, true)
+	c.Assert(strings.Contains(parts["xl/worksheets/_rels/sheet1.xml.rels"], `Target="../drawings/drawing1.xml"`), Equals, true)
+	c.Assert(strings.Contains(parts["[Content_Types].xml"], `<Override PartName="/xl/charts/chart1.xml" ContentType="`+contentTypeChart+`">`), Equals, true)
+
+	// Rows inserted above the drawing move its anchors and the
+	// series of its chart.
+	_, err = f.Sheets[0].AddRowAtIndex(0)
+	c.Assert(err, IsNil)
+	parts, err = f.MarshallParts()
+	c.Assert(err, IsNil)
+	c.Assert(strings.Count(parts["xl/drawings/drawing1.xml"], `<xdr:row>2</xdr:row>`), Equals, 2)
+	c.Assert(strings.Contains(parts["xl/drawings/drawing1.xml"], `<xdr:row>16</xdr:row>`), Equals, true)
+	c.Assert(strings.Contains(parts["xl/drawings/drawing1.xml"], "TextBox 1"), Equals, true)
+	c.Assert(strings.Contains(parts["xl/charts/chart1.xml"], `<c:f>Sheet1!$A$2:$A$4</c:f>`), Equals, true)
+
+	// Once a picture is added, the drawing is made again, with the
+	// text box and the chart as they were.
+	_, err = f.Sheets[0].AddPicture("A1", makeTestPNG(c, 4, 4), nil)
+	c.Assert(err, IsNil)
+	parts, err = f.MarshallParts()
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(parts["xl/drawings/drawing1.xml"], "<xdr:pic>"), Equals, true)
+	c.Assert(strings.Contains(parts["xl/drawings/drawing1.xml"], "TextBox 1"), Equals, true)
+	c.Assert(parts["xl/charts/chart1.xml"], Equals, strings.Replace(radarChartXML, "$A$1:$A$3", "$A$2:$A$4", 1))
+}
+
+// The Excel 2010 conditional formattings that a worksheet was read
+// with are kept, along with the data bars made again from its
+// ConditionalFormats, and move with the cells they apply to.
+func (s *PreserveSuite) TestMergeConditionalFormattingExt(c *C) {
+	worksheet := new(xlsxWorksheet)
+	c.Assert(xml.Unmarshal([]byte(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:x14="http://schemas.microsoft.com/office/spreadsheetml/2009/9/main" xmlns:xm="http://schemas.microsoft.com/office/excel/2006/main">`+
+		`<sheetData/>`+
+		`<conditionalFormatting sqref="A1:A5"><cfRule type="dataBar" priority="1"><dataBar><cfvo type="min"/><cfvo type="max"/><color rgb="FF5A8AC6"/></dataBar>`+
+		`<extLst><ext uri="{B025F937-C7B1-47D3-B67F-A62EFF666E3E}"><x14:id>{8E1A4A4B-4B45-4F0A-9C6C-0D7B1D2E3F40}</x14:id></ext></extLst></cfRule></conditionalFormatting>`+
+		`<extLst><ext uri="{78C0D931-6437-407d-A8EE-F0AAD7539E65}"><x14:conditionalFormattings>`+
+		`<x14:conditionalFormatting><x14:cfRule type="dataBar" id="{8E1A4A4B-4B45-4F0A-9C6C-0D7B1D2E3F40}"><x14:dataBar minLength="0" maxLength="100"><x14:cfvo type="autoMin"/><x14:cfvo type="autoMax"/></x14:dataBar></x14:cfRule><xm:sqref>A1:A5</xm:sqref></x14:conditionalFormatting>`+
+		`<x14:conditionalFormatting><x14:cfRule type="expression" priority="2" id="{1B6A0C8E-3D5F-4E7A-9B2C-6D8E0F1A2B3C}"><xm:f>Lists!$A$3&gt;0</xm:f><x14:dxf><font><b/></font></x14:dxf></x14:cfRule><xm:sqref>C2:C6</xm:sqref></x14:conditionalFormatting>`+
+		`</x14:conditionalFormattings></ext></extLst></worksheet>`), worksheet), IsNil)
+	f := NewFile()
+	sheet, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	_, err = f.AddSheet("Lists")
+	c.Assert(err, IsNil)
+	sheet.ConditionalFormats, err = readConditionalFormats(worksheet.ConditionalFormatting, worksheet.ExtLst, nil)
+	c.Assert(err, IsNil)
+	worksheet.qualifyRawNames()
+	sheet.unmodelled = worksheet
+
+	parts, err := f.MarshallParts()
+	c.Assert(err, IsNil)
+	sheetXML := parts["xl/worksheets/sheet1.xml"]
+	c.Assert(strings.Count(sheetXML, "{78C0D931-6437-407d-A8EE-F0AAD7539E65}"), Equals, 1)
+	c.Assert(strings.Contains(sheetXML, "{8E1A4A4B-4B45-4F0A-9C6C-0D7B1D2E3F40}"), Equals, false)
+	c.Assert(strings.Contains(sheetXML, `<x14:conditionalFormattings><x14:conditionalFormatting><x14:cfRule type="expression" priority="2" id="{1B6A0C8E-3D5F-4E7A-9B2C-6D8E0F1A2B3C}"><xm:f>Lists!$A$3&gt;0</xm:f>`), Equals, true)
+	c.Assert(strings.Contains(sheetXML, `<xm:sqref>C2:C6</xm:sqref></x14:conditionalFormatting><x14:conditionalFormatting xmlns:x14="http://schemas.microsoft.com/office/spreadsheetml/2009/9/main" xmlns:xm="http://schemas.microsoft.com/office/excel/2006/main"><x14:cfRule type="dataBar"`), Equals, true)
+	c.Assert(strings.Contains(sheetXML, `<xm:sqref>A1:A5</xm:sqref></x14:conditionalFormatting></x14:conditionalFormattings></ext></extLst>`), Equals, true)
+
+	// Without any data bars, the rest of the formattings are still
+	// written, and they move with their cells and the cells their
+	// formulas refer to.
+	sheet.ConditionalFormats = nil
+	sheet.Cell(5, 0).SetInt(1)
+	f.Sheets[1].Cell(5, 0).SetInt(1)
+	c.Assert(sheet.RemoveRowAtIndex(0), IsNil)
+	c.Assert(f.Sheets[1].RemoveRowAtIndex(0), IsNil)
+	parts, err = f.MarshallParts()
+	c.Assert(err, IsNil)
+	sheetXML = parts["xl/worksheets/sheet1.xml"]
+	c.Assert(strings.Contains(sheetXML, `<extLst><ext uri="{78C0D931-6437-407d-A8EE-F0AAD7539E65}"><x14:conditionalFormattings><x14:conditionalFormatting><x14:cfRule type="expression" priority="2" id="{1B6A0C8E-3D5F-4E7A-9B2C-6D8E0F1A2B3C}"><xm:f>Lists!$A$2&gt;0</xm:f><x14:dxf><font><b/></font></x14:dxf></x14:cfRule><xm:sqref>C1:C5</xm:sqref></x14:conditionalFormatting></x14:conditionalFormattings></ext></extLst>`), Equals, true)
+}
@@ -0,0 +1,364 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultApplication = "Go XLSX"
+
+// customPropertiesFmtID is the format id of the properties that users
+// define, which is the same for every custom property.
+const customPropertiesFmtID = "{D5CDD505-2E9C-101B-9397-08002B2CF9AE}"
+
+// w3cdtfLayouts are the forms of the W3C date and time format that the
+// created and modified properties may take, from the most to the least
+// precise.
+var w3cdtfLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// DocumentProperties are the properties of a workbook that Excel shows
+// on the Info page of the File menu.  They are stored in the
+// docProps/core.xml and docProps/app.xml parts of the file.
+type DocumentProperties struct {
+	Title          string
+	Subject        string
+	Creator        string
+	Keywords       string
+	Description    string
+	LastModifiedBy string
+	Category       string
+	Revision       string
+	// Created and Modified are left out of the file when they
+	// are zero.
+	Created  time.Time
+	Modified time.Time
+	Company  string
+	// Application is the name of the program that wrote the
+	// file, "Go XLSX" when it is empty, and AppVersion is its
+	// version, such as "16.0300".
+	Application string
+	AppVersion  string
+}
+
+// makeCoreXML returns the docProps/core.xml part.
+func (p *DocumentProperties) makeCoreXML() string {
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcmitype="http://purl.org/dc/dcmitype/" xmlns:dcterms="http://purl.org/dc/terms/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">`)
+	writeElement := func(name, value string) {
+		if value == "" {
+			return
+		}
+		fmt.Fprintf(&buf, "<%s>", name)
+		xml.EscapeText(&buf, []byte(value))
+		fmt.Fprintf(&buf, "</%s>", name)
+	}
+	writeTime := func(name string, t time.Time) {
+		if t.IsZero() {
+			return
+		}
+		fmt.Fprintf(&buf, `<%s xsi:type="dcterms:W3CDTF">%s</%s>`, name, t.UTC().Format("2006-01-02T15:04:05Z"), name)
+	}
+	writeElement("dc:title", p.Title)
+	writeElement("dc:subject", p.Subject)
+	writeElement("dc:creator", p.Creator)
+	writeElement("cp:keywords", p.Keywords)
+	writeElement("dc:description", p.Description)
+	writeElement("cp:lastModifiedBy", p.LastModifiedBy)
+	writeElement("cp:revision", p.Revision)
+	writeTime("dcterms:created", p.Created)
+	writeTime("dcterms:modified", p.Modified)
+	writeElement("cp:category", p.Category)
+	buf.WriteString("</cp:coreProperties>")
+	return buf.String()
+}
+
+// makeAppXML returns the docProps/app.xml part, whose TitlesOfParts
+// lists the names of the sheets: the worksheets first and then the
+// chartsheets, each kind counted by its own pair of HeadingPairs.
+func (p *DocumentProperties) makeAppXML(sheets []*Sheet) string {
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Properties xmlns="http://schemas.openxmlformats.org/officeDocument/2006/extended-properties" xmlns:vt="http://schemas.openxmlformats.org/officeDocument/2006/docPropsVTypes">
+  <TotalTime>0</TotalTime>
+`)
+	writeElement := func(name, value string) {
+		if value == "" {
+			return
+		}
+		fmt.Fprintf(&buf, "  <%s>", name)
+		xml.EscapeText(&buf, []byte(value))
+		fmt.Fprintf(&buf, "</%s>\n", name)
+	}
+	application := p.Application
+	if application == "" {
+		application = defaultApplication
+	}
+	writeElement("Application", application)
+	var worksheets, charts []string
+	for _, sheet := range sheets {
+		if sheet.Type == SheetTypeChartsheet {
+			charts = append(charts, sheet.Name)
+		} else {
+			worksheets = append(worksheets, sheet.Name)
+		}
+	}
+	var headings bytes.Buffer
+	pairs := 0
+	for _, heading := range []struct {
+		name  string
+		count int
+	}{{"Worksheets", len(worksheets)}, {"Charts", len(charts)}} {
+		if heading.count == 0 {
+			continue
+		}
+		fmt.Fprintf(&headings, `<vt:variant><vt:lpstr>%s</vt:lpstr></vt:variant><vt:variant><vt:i4>%d</vt:i4></vt:variant>`, heading.name, heading.count)
+		pairs++
+	}
+	if pairs > 0 {
+		fmt.Fprintf(&buf, `  <HeadingPairs><vt:vector size="%d" baseType="variant">%s</vt:vector></HeadingPairs>`+"\n", 2*pairs, headings.String())
+		fmt.Fprintf(&buf, `  <TitlesOfParts><vt:vector size="%d" baseType="lpstr">`, len(worksheets)+len(charts))
+		for _, name := range append(worksheets, charts...) {
+			buf.WriteString("<vt:lpstr>")
+			xml.EscapeText(&buf, []byte(name))
+			buf.WriteString("</vt:lpstr>")
+		}
+		buf.WriteString("</vt:vector></TitlesOfParts>\n")
+	}
+	writeElement("Company", p.Company)
+	writeElement("AppVersion", p.AppVersion)
+	buf.WriteString("</Properties>")
+	return buf.String()
+}
+
+// readDocumentPropertiesFromZipFile reads the core and the extended
+// properties of a workbook, either of which may be missing.
+func readDocumentPropertiesFromZipFile(core, app *zip.File) (DocumentProperties, error) {
+	var p DocumentProperties
+	if core != nil {
+		var xCore xlsxCoreProperties
+		b, err := readZipFileBytes(core)
+		if err != nil {
+			return p, err
+		}
+		if err = xml.Unmarshal(b, &xCore); err != nil {
+			return p, err
+		}
+		p.Title = xCore.Title
+		p.Subject = xCore.Subject
+		p.Creator = xCore.Creator
+		p.Keywords = xCore.Keywords
+		p.Description = xCore.Description
+		p.LastModifiedBy = xCore.LastModifiedBy
+		p.Revision = xCore.Revision
+		p.Category = xCore.Category
+		p.Created = parseW3CDTF(xCore.Created)
+		p.Modified = parseW3CDTF(xCore.Modified)
+	}
+	if app != nil {
+		var xApp xlsxExtendedProperties
+		b, err := readZipFileBytes(app)
+		if err != nil {
+			return p, err
+		}
+		if err = xml.Unmarshal(b, &xApp); err != nil {
+			return p, err
+		}
+		p.Application = xApp.Application
+		p.Company = xApp.Company
+		p.AppVersion = xApp.AppVersion
+	}
+	return p, nil
+}
+
+// parseW3CDTF parses a date and time in any of the forms of the W3C
+// format, and returns the zero time for anything else.
+func parseW3CDTF(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range w3cdtfLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// CustomProperty is a property that users define for a workbook, which
+// Excel shows on the Custom tab of the Advanced Properties dialog.
+type CustomProperty struct {
+	Name string
+	// Value is a string, an integer, a float64, a bool or a
+	// time.Time.
+	Value interface{}
+	// fmtID and pid identify the property in the docProps/custom.xml
+	// part.  Properties read from a file keep the ones they had.
+	fmtID string
+	pid   int
+}
+
+// CustomProperty returns the custom property with the name, or nil if
+// the workbook doesn't have one.  Names are case insensitive, as in
+// Excel.
+func (f *File) CustomProperty(name string) *CustomProperty {
+	for _, property := range f.CustomProperties {
+		if strings.EqualFold(property.Name, name) {
+			return property
+		}
+	}
+	return nil
+}
+
+// SetCustomProperty sets the value of the custom property with the
+// name, adding it after the others if the workbook doesn't have it
+// yet.  The value has to be a string, an integer, a float, a bool or a
+// time.Time.
+func (f *File) SetCustomProperty(name string, value interface{}) error {
+	if name == "" {
+		return fmt.Errorf("custom property has no name")
+	}
+	if _, _, err := customPropertyValue(value); err != nil {
+		return fmt.Errorf("custom property %q: %v", name, err)
+	}
+	if property := f.CustomProperty(name); property != nil {
+		property.Value = value
+		return nil
+	}
+	f.CustomProperties = append(f.CustomProperties, &CustomProperty{Name: name, Value: value})
+	return nil
+}
+
+// RemoveCustomProperty removes the custom property with the name,
+// returning false if the workbook doesn't have it.
+func (f *File) RemoveCustomProperty(name string) bool {
+	for i, property := range f.CustomProperties {
+		if strings.EqualFold(property.Name, name) {
+			f.CustomProperties = append(f.CustomProperties[:i], f.CustomProperties[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// customPropertyValue returns the docPropsVTypes element that holds a
+// value of a custom property, and the value as it is written in it.
+func customPropertyValue(value interface{}) (string, string, error) {
+	switch v := value.(type) {
+	case string:
+		return "lpwstr", v, nil
+	case bool:
+		return "bool", strconv.FormatBool(v), nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		n, err := strconv.ParseInt(fmt.Sprint(v), 10, 64)
+		if err == nil && n >= math.MinInt32 && n <= math.MaxInt32 {
+			return "i4", strconv.FormatInt(n, 10), nil
+		}
+		return "r8", fmt.Sprint(v), nil
+	case float32:
+		return "r8", strconv.FormatFloat(float64(v), 'g', -1, 32), nil
+	case float64:
+		return "r8", strconv.FormatFloat(v, 'g', -1, 64), nil
+	case time.Time:
+		return "filetime", v.UTC().Format("2006-01-02T15:04:05Z"), nil
+	}
+	return "", "", fmt.Errorf("unsupported type %T", value)
+}
+
+// makeCustomXML returns the docProps/custom.xml part, which holds the
+// custom properties of a workbook in their order.  Properties that
+// were read from a file keep their format id and property id, and the
+// others are given the next free property ids.
+func makeCustomXML(properties []*CustomProperty) (string, error) {
+	used := make(map[int]bool)
+	nextPID := 2
+	for _, property := range properties {
+		if property.pid >= 2 {
+			used[property.pid] = true
+			if property.pid >= nextPID {
+				nextPID = property.pid + 1
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Properties xmlns="http://schemas.openxmlformats.org/officeDocument/2006/custom-properties" xmlns:vt="http://schemas.openxmlformats.org/officeDocument/2006/docPropsVTypes">`)
+	written := make(map[int]bool)
+	for _, property := range properties {
+		valueType, value, err := customPropertyValue(property.Value)
+		if err != nil {
+			return "", fmt.Errorf("custom property %q: %v", property.Name, err)
+		}
+		fmtID, pid := property.fmtID, property.pid
+		if fmtID == "" {
+			fmtID = customPropertiesFmtID
+		}
+		if pid < 2 || written[pid] {
+			pid = nextPID
+			nextPID++
+		}
+		written[pid] = true
+		fmt.Fprintf(&buf, `<property fmtid="%s" pid="%d" name="`, fmtID, pid)
+		xml.EscapeText(&buf, []byte(property.Name))
+		fmt.Fprintf(&buf, `"><vt:%s>`, valueType)
+		xml.EscapeText(&buf, []byte(value))
+		fmt.Fprintf(&buf, `</vt:%s></property>`, valueType)
+	}
+	buf.WriteString("</Properties>")
+	return buf.String(), nil
+}
+
+// readCustomPropertiesFromZipFile reads the custom properties of a
+// workbook, in the order of the file.  Values whose type isn't known
+// are kept as strings.
+func readCustomPropertiesFromZipFile(f *zip.File) ([]*CustomProperty, error) {
+	b, err := readZipFileBytes(f)
+	if err != nil {
+		return nil, err
+	}
+	var xProperties xlsxCustomProperties
+	if err = xml.Unmarshal(b, &xProperties); err != nil {
+		return nil, err
+	}
+	properties := make([]*CustomProperty, 0, len(xProperties.Property))
+	for _, property := range xProperties.Property {
+		text := strings.TrimSpace(property.Value.Text)
+		var value interface{} = property.Value.Text
+		switch property.Value.XMLName.Local {
+		case "i1", "i2", "i4", "i8", "int", "ui1", "ui2", "ui4", "ui8", "uint":
+			if n, err := strconv.Atoi(text); err == nil {
+				value = n
+			}
+		case "r4", "r8", "decimal":
+			if n, err := strconv.ParseFloat(text, 64); err == nil {
+				value = n
+			}
+		case "bool":
+			if b, err := strconv.ParseBool(text); err == nil {
+				value = b
+			}
+		case "filetime", "date":
+			if t := parseW3CDTF(text); !t.IsZero() {
+				value = t
+			}
+		}
+		properties = append(properties, &CustomProperty{
+			Name:  property.Name,
+			Value: value,
+			fmtID: property.FmtID,
+			pid:   property.PID,
+		})
+	}
+	return properties, nil
+}
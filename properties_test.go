@@ -0,0 +1,182 @@
+package xlsx
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type PropertiesSuite struct{}
+
+var _ = Suite(&PropertiesSuite{})
+
+// Properties are read from files written by Excel.
+func (s *PropertiesSuite) TestReadProperties(c *C) {
+	f, err := OpenFile("./testdocs/testfile.xlsx")
+	c.Assert(err, IsNil)
+	c.Assert(f.Properties.Creator, Equals, "TealeG")
+	c.Assert(f.Properties.LastModifiedBy, Equals, "TealeG")
+	c.Assert(f.Properties.Revision, Equals, "0")
+	c.Assert(f.Properties.Created.Equal(time.Date(2011, 6, 28, 14, 13, 3, 0, time.UTC)), Equals, true)
+	c.Assert(f.Properties.Modified.Equal(time.Date(2011, 6, 28, 14, 14, 32, 0, time.UTC)), Equals, true)
+	c.Assert(f.Properties.Application, Equals, "Microsoft Excel")
+
+	f, err = OpenFile("./testdocs/original.xlsx")
+	c.Assert(err, IsNil)
+	c.Assert(f.Properties.Creator, Equals, "Chris")
+	c.Assert(f.Properties.AppVersion, Equals, "15.0300")
+}
+
+// Only the properties that are set are written, and they are escaped.
+func (s *PropertiesSuite) TestMarshalProperties(c *C) {
+	p := DocumentProperties{
+		Title:    "Q3 <draft>",
+		Creator:  "Finance & Ops",
+		Created:  time.Date(2020, 1, 2, 13, 4, 5, 0, time.FixedZone("CET", 3600)),
+		Company:  "Example Ltd",
+		Category: "Reports",
+	}
+	c.Assert(p.makeCoreXML(), Equals, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcmitype="http://purl.org/dc/dcmitype/" xmlns:dcterms="http://purl.org/dc/terms/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"><dc:title>Q3 &lt;draft&gt;</dc:title><dc:creator>Finance &amp; Ops</dc:creator><dcterms:created xsi:type="dcterms:W3CDTF">2020-01-02T12:04:05Z</dcterms:created><cp:category>Reports</cp:category></cp:coreProperties>`)
+	c.Assert(p.makeAppXML([]*Sheet{{Name: "A&B"}}), Equals, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Properties xmlns="http://schemas.openxmlformats.org/officeDocument/2006/extended-properties" xmlns:vt="http://schemas.openxmlformats.org/officeDocument/2006/docPropsVTypes">
+  <TotalTime>0</TotalTime>
+  <Application>Go XLSX</Application>
+  <HeadingPairs><vt:vector size="2" baseType="variant"><vt:variant><vt:lpstr>Worksheets</vt:lpstr></vt:variant><vt:variant><vt:i4>1</vt:i4></vt:variant></vt:vector></HeadingPairs>
+  <TitlesOfParts><vt:vector size="1" baseType="lpstr"><vt:lpstr>A&amp;B</vt:lpstr></vt:vector></TitlesOfParts>
+  <Company>Example Ltd</Company>
+</Properties>`)
+
+	// Chartsheets are counted under their own heading, after the
+	// worksheets.
+	app := p.makeAppXML([]*Sheet{
+		{Name: "Chart1", Type: SheetTypeChartsheet},
+		{Name: "Data"},
+		{Name: "Summary"},
+	})
+	c.Assert(strings.Contains(app, `<HeadingPairs><vt:vector size="4" baseType="variant"><vt:variant><vt:lpstr>Worksheets</vt:lpstr></vt:variant><vt:variant><vt:i4>2</vt:i4></vt:variant><vt:variant><vt:lpstr>Charts</vt:lpstr></vt:variant><vt:variant><vt:i4>1</vt:i4></vt:variant></vt:vector></HeadingPairs>`), Equals, true, Commentf(app))
+	c.Assert(strings.Contains(app, `<TitlesOfParts><vt:vector size="3" baseType="lpstr"><vt:lpstr>Data</vt:lpstr><vt:lpstr>Summary</vt:lpstr><vt:lpstr>Chart1</vt:lpstr></vt:vector></TitlesOfParts>`), Equals, true, Commentf(app))
+}
+
+// Properties survive writing and reading a file.
+func (s *PropertiesSuite) TestPropertiesRoundTrip(c *C) {
+	f := NewFile()
+	_, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	f.Properties = DocumentProperties{
+		Title:          "Title",
+		Subject:        "Subject",
+		Creator:        "Creator",
+		Keywords:       "one two",
+		Description:    "Description",
+		LastModifiedBy: "Editor",
+		Category:       "Category",
+		Revision:       "3",
+		Created:        time.Date(2019, 5, 6, 7, 8, 9, 0, time.UTC),
+		Modified:       time.Date(2020, 5, 6, 7, 8, 9, 0, time.UTC),
+		Company:        "Company",
+		Application:    "Reporter",
+		AppVersion:     "1.0000",
+	}
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), IsNil)
+	read, err := OpenBinary(buf.Bytes())
+	c.Assert(err, IsNil)
+	c.Assert(read.Properties, DeepEquals, f.Properties)
+
+	c.Assert(parseW3CDTF("2003-12").Equal(time.Date(2003, 12, 1, 0, 0, 0, 0, time.UTC)), Equals, true)
+	c.Assert(parseW3CDTF("2003-12-31T10:14:55.5+01:00").IsZero(), Equals, false)
+	c.Assert(parseW3CDTF("yesterday").IsZero(), Equals, true)
+	c.Assert(strings.Contains(NewFile().Properties.makeAppXML(nil), "TitlesOfParts"), Equals, false)
+}
+
+// Custom properties are written in their order, with the type that
+// matches their value.  Properties read from a file keep their ids.
+func (s *PropertiesSuite) TestMarshalCustomProperties(c *C) {
+	custom, err := makeCustomXML([]*CustomProperty{
+		{Name: "Client", Value: "A & B"},
+		{Name: "Approved", Value: true, fmtID: "{64440492-4C8B-11D1-8B70-080036B11A03}", pid: 3},
+		{Name: "Count", Value: int64(42)},
+		{Name: "Big", Value: int64(1) << 40},
+		{Name: "Rate", Value: 0.25, fmtID: customPropertiesFmtID, pid: 5},
+		{Name: "Due", Value: time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(custom, Equals, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Properties xmlns="http://schemas.openxmlformats.org/officeDocument/2006/custom-properties" xmlns:vt="http://schemas.openxmlformats.org/officeDocument/2006/docPropsVTypes">`+
+		`<property fmtid="{D5CDD505-2E9C-101B-9397-08002B2CF9AE}" pid="6" name="Client"><vt:lpwstr>A &amp; B</vt:lpwstr></property>`+
+		`<property fmtid="{64440492-4C8B-11D1-8B70-080036B11A03}" pid="3" name="Approved"><vt:bool>true</vt:bool></property>`+
+		`<property fmtid="{D5CDD505-2E9C-101B-9397-08002B2CF9AE}" pid="7" name="Count"><vt:i4>42</vt:i4></property>`+
+		`<property fmtid="{D5CDD505-2E9C-101B-9397-08002B2CF9AE}" pid="8" name="Big"><vt:r8>1099511627776</vt:r8></property>`+
+		`<property fmtid="{D5CDD505-2E9C-101B-9397-08002B2CF9AE}" pid="5" name="Rate"><vt:r8>0.25</vt:r8></property>`+
+		`<property fmtid="{D5CDD505-2E9C-101B-9397-08002B2CF9AE}" pid="9" name="Due"><vt:filetime>2021-03-04T05:06:07Z</vt:filetime></property>`+
+		`</Properties>`)
+
+	_, err = makeCustomXML([]*CustomProperty{{Name: "Bad", Value: []int{1}}})
+	c.Assert(err, NotNil)
+}
+
+// Custom properties are set and removed by name, which is case
+// insensitive, and keep the order they were added in.
+func (s *PropertiesSuite) TestSetCustomProperty(c *C) {
+	f := NewFile()
+	c.Assert(f.SetCustomProperty("Client", "Acme"), IsNil)
+	c.Assert(f.SetCustomProperty("Pages", 12), IsNil)
+	c.Assert(f.SetCustomProperty("client", "Other"), IsNil)
+	c.Assert(f.SetCustomProperty("Bad", []int{1}), NotNil)
+	c.Assert(f.SetCustomProperty("", 1), NotNil)
+	c.Assert(f.CustomProperties, HasLen, 2)
+	c.Assert(f.CustomProperties[0].Name, Equals, "Client")
+	c.Assert(f.CustomProperty("CLIENT").Value, Equals, "Other")
+	c.Assert(f.RemoveCustomProperty("Client"), Equals, true)
+	c.Assert(f.RemoveCustomProperty("Client"), Equals, false)
+	c.Assert(f.CustomProperty("Client"), IsNil)
+	c.Assert(f.CustomProperties[0].Name, Equals, "Pages")
+}
+
+// Custom properties survive writing and reading a file, along with
+// their ids, and the part is only written when there are any.
+func (s *PropertiesSuite) TestCustomPropertiesRoundTrip(c *C) {
+	f := NewFile()
+	_, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	parts, err := f.MarshallParts()
+	c.Assert(err, IsNil)
+	_, ok := parts["docProps/custom.xml"]
+	c.Assert(ok, Equals, false)
+	c.Assert(parts["_rels/.rels"], Equals, TEMPLATE__RELS_DOT_RELS)
+
+	c.Assert(f.SetCustomProperty("Client", "Acme"), IsNil)
+	c.Assert(f.SetCustomProperty("Pages", 12), IsNil)
+	c.Assert(f.SetCustomProperty("Total", 1234.5), IsNil)
+	c.Assert(f.SetCustomProperty("Final", false), IsNil)
+	c.Assert(f.SetCustomProperty("Due", time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)), IsNil)
+	parts, err = f.MarshallParts()
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(parts["_rels/.rels"], `<Relationship Id="rId4" Target="docProps/custom.xml" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/custom-properties"></Relationship>`), Equals, true)
+	c.Assert(strings.Contains(parts["[Content_Types].xml"], `<Override PartName="/docProps/custom.xml" ContentType="application/vnd.openxmlformats-officedocument.custom-properties+xml">`), Equals, true)
+
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), IsNil)
+	read, err := OpenBinary(buf.Bytes())
+	c.Assert(err, IsNil)
+	c.Assert(read.CustomProperties, HasLen, len(f.CustomProperties))
+	for i, property := range read.CustomProperties {
+		c.Assert(property.Name, Equals, f.CustomProperties[i].Name)
+		c.Assert(property.Value, DeepEquals, f.CustomProperties[i].Value)
+		c.Assert(property.pid, Equals, i+2)
+	}
+
+	// Properties keep their ids when the file is written again, and
+	// new ones don't take them.
+	read.CustomProperties[1].pid = 20
+	read.RemoveCustomProperty("Client")
+	c.Assert(read.SetCustomProperty("Extra", "x"), IsNil)
+	parts, err = read.MarshallParts()
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(parts["docProps/custom.xml"], `pid="20" name="Pages"`), Equals, true)
+	c.Assert(strings.Contains(parts["docProps/custom.xml"], `pid="5" name="Final"`), Equals, true)
+	c.Assert(strings.Contains(parts["docProps/custom.xml"], `pid="21" name="Extra"`), Equals, true)
+}
@@ -0,0 +1,317 @@
+package xlsx
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"strings"
+	"unicode/utf16"
+)
+
+// The hash algorithm and spin count that Excel uses for the passwords
+// of protected sheets and workbooks.
+const (
+	passwordHashAlgorithm = "SHA-512"
+	passwordHashSpinCount = 100000
+	passwordSaltLength    = 16
+)
+
+// PasswordHash is the hash of the password that protects a sheet or
+// the structure of a workbook.  The password itself is not stored in
+// the file.  A modern hash uses AlgorithmName, HashValue, SaltValue
+// and SpinCount, the legacy hash is a 16 bit value written in hex.
+type PasswordHash struct {
+	AlgorithmName string
+	HashValue     string
+	SaltValue     string
+	SpinCount     int
+	LegacyHash    string
+}
+
+// newPasswordHash hashes a password with both a random salt and the
+// legacy scheme.  The empty password, which Excel allows, results in
+// an empty hash.
+func newPasswordHash(password string) (PasswordHash, error) {
+	if password == "" {
+		return PasswordHash{}, nil
+	}
+	salt := make([]byte, passwordSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return PasswordHash{}, err
+	}
+	return PasswordHash{
+		AlgorithmName: passwordHashAlgorithm,
+		HashValue:     base64.StdEncoding.EncodeToString(spinPasswordHash(sha512.New(), password, salt, passwordHashSpinCount)),
+		SaltValue:     base64.StdEncoding.EncodeToString(salt),
+		SpinCount:     passwordHashSpinCount,
+		LegacyHash:    legacyPasswordHash(password),
+	}, nil
+}
+
+// Check returns true if password matches the hash.  The modern hash is
+// used when there is one.
+func (h PasswordHash) Check(password string) bool {
+	if h.HashValue != "" {
+		var newHash func() hash.Hash
+		switch strings.ToUpper(h.AlgorithmName) {
+		case "SHA-1":
+			newHash = sha1.New
+		case "SHA-256":
+			newHash = sha256.New
+		case "SHA-384":
+			newHash = sha512.New384
+		case "SHA-512":
+			newHash = sha512.New
+		default:
+			return false
+		}
+		salt, err := base64.StdEncoding.DecodeString(h.SaltValue)
+		if err != nil {
+			return false
+		}
+		want, err := base64.StdEncoding.DecodeString(h.HashValue)
+		if err != nil {
+			return false
+		}
+		return bytes.Equal(spinPasswordHash(newHash(), password, salt, h.SpinCount), want)
+	}
+	if h.LegacyHash != "" {
+		return strings.EqualFold(h.LegacyHash, legacyPasswordHash(password))
+	}
+	return password == ""
+}
+
+// spinPasswordHash hashes the salt followed by the UTF-16 password,
+// then hashes the result together with the number of the iteration
+// spinCount times.
+func spinPasswordHash(h hash.Hash, password string, salt []byte, spinCount int) []byte {
+	h.Write(salt)
+	for _, u := range utf16.Encode([]rune(password)) {
+		h.Write([]byte{byte(u), byte(u >> 8)})
+	}
+	sum := h.Sum(nil)
+	iteration := make([]byte, 4)
+	for i := 0; i < spinCount; i++ {
+		binary.LittleEndian.PutUint32(iteration, uint32(i))
+		h.Reset()
+		h.Write(sum)
+		h.Write(iteration)
+		sum = h.Sum(sum[:0])
+	}
+	return sum
+}
+
+// legacyPasswordHash returns the 16 bit hash of a password that older
+// versions of Excel use, as four hex digits.
+func legacyPasswordHash(password string) string {
+	var hash uint16
+	chars := []rune(password)
+	for i, char := range chars {
+		value := uint32(byte(char)) << uint(i+1)
+		rotated := value >> 15
+		hash ^= uint16((value & 0x7fff) | rotated)
+	}
+	hash ^= uint16(len(chars))
+	hash ^= 0xCE4B
+	return fmt.Sprintf("%04X", hash)
+}
+
+// SheetProtectionOptions say what may still be done to a protected
+// sheet.  Everything that is false is prohibited.
+type SheetProtectionOptions struct {
+	SelectLockedCells   bool
+	SelectUnlockedCells bool
+	FormatCells         bool
+	FormatColumns       bool
+	FormatRows          bool
+	InsertColumns       bool
+	InsertRows          bool
+	InsertHyperlinks    bool
+	DeleteColumns       bool
+	DeleteRows          bool
+	Sort                bool
+	AutoFilter          bool
+	PivotTables         bool
+	EditObjects         bool
+	EditScenarios       bool
+}
+
+// defaultSheetProtectionOptions are the options that Excel suggests
+// when a sheet is protected, which only allow selecting cells.
+var defaultSheetProtectionOptions = SheetProtectionOptions{
+	SelectLockedCells:   true,
+	SelectUnlockedCells: true,
+}
+
+// SheetProtection is the protection of a sheet against changes.
+type SheetProtection struct {
+	Options  SheetProtectionOptions
+	Password PasswordHash
+}
+
+// Protect protects the sheet against changes, except for the ones that
+// options allow.  When options is nil, only selecting cells is allowed,
+// as in Excel.  An empty password protects the sheet without a
+// password.
+func (s *Sheet) Protect(password string, options *SheetProtectionOptions) error {
+	if options == nil {
+		options = &defaultSheetProtectionOptions
+	}
+	passwordHash, err := newPasswordHash(password)
+	if err != nil {
+		return err
+	}
+	s.Protection = &SheetProtection{Options: *options, Password: passwordHash}
+	return nil
+}
+
+// Unprotect removes the protection of the sheet.
+func (s *Sheet) Unprotect() {
+	s.Protection = nil
+}
+
+// makeXLSXSheetProtection converts the protection of the sheet, which
+// is nil for an unprotected sheet.
+func (p *SheetProtection) makeXLSXSheetProtection() *xlsxSheetProtection {
+	if p == nil {
+		return nil
+	}
+	prohibited := func(allowed bool) *bool {
+		b := !allowed
+		return &b
+	}
+	protected := true
+	o := p.Options
+	return &xlsxSheetProtection{
+		Password:            p.Password.LegacyHash,
+		AlgorithmName:       p.Password.AlgorithmName,
+		HashValue:           p.Password.HashValue,
+		SaltValue:           p.Password.SaltValue,
+		SpinCount:           p.Password.SpinCount,
+		Sheet:               &protected,
+		Objects:             prohibited(o.EditObjects),
+		Scenarios:           prohibited(o.EditScenarios),
+		FormatCells:         prohibited(o.FormatCells),
+		FormatColumns:       prohibited(o.FormatColumns),
+		FormatRows:          prohibited(o.FormatRows),
+		InsertColumns:       prohibited(o.InsertColumns),
+		InsertRows:          prohibited(o.InsertRows),
+		InsertHyperlinks:    prohibited(o.InsertHyperlinks),
+		DeleteColumns:       prohibited(o.DeleteColumns),
+		DeleteRows:          prohibited(o.DeleteRows),
+		SelectLockedCells:   prohibited(o.SelectLockedCells),
+		Sort:                prohibited(o.Sort),
+		AutoFilter:          prohibited(o.AutoFilter),
+		PivotTables:         prohibited(o.PivotTables),
+		SelectUnlockedCells: prohibited(o.SelectUnlockedCells),
+	}
+}
+
+// readSheetProtection converts the sheetProtection element of a
+// worksheet.  Flags that are left out get their default value, and a
+// sheet whose sheet flag isn't set is not protected at all.
+func readSheetProtection(xProtection *xlsxSheetProtection) *SheetProtection {
+	if xProtection == nil || xProtection.Sheet == nil || !*xProtection.Sheet {
+		return nil
+	}
+	allowed := func(prohibited *bool, prohibitedByDefault bool) bool {
+		if prohibited == nil {
+			return !prohibitedByDefault
+		}
+		return !*prohibited
+	}
+	x := xProtection
+	return &SheetProtection{
+		Options: SheetProtectionOptions{
+			EditObjects:         allowed(x.Objects, false),
+			EditScenarios:       allowed(x.Scenarios, false),
+			FormatCells:         allowed(x.FormatCells, true),
+			FormatColumns:       allowed(x.FormatColumns, true),
+			FormatRows:          allowed(x.FormatRows, true),
+			InsertColumns:       allowed(x.InsertColumns, true),
+			InsertRows:          allowed(x.InsertRows, true),
+			InsertHyperlinks:    allowed(x.InsertHyperlinks, true),
+			DeleteColumns:       allowed(x.DeleteColumns, true),
+			DeleteRows:          allowed(x.DeleteRows, true),
+			SelectLockedCells:   allowed(x.SelectLockedCells, false),
+			Sort:                allowed(x.Sort, true),
+			AutoFilter:          allowed(x.AutoFilter, true),
+			PivotTables:         allowed(x.PivotTables, true),
+			SelectUnlockedCells: allowed(x.SelectUnlockedCells, false),
+		},
+		Password: PasswordHash{
+			AlgorithmName: x.AlgorithmName,
+			HashValue:     x.HashValue,
+			SaltValue:     x.SaltValue,
+			SpinCount:     x.SpinCount,
+			LegacyHash:    x.Password,
+		},
+	}
+}
+
+// WorkbookProtection is the protection of the structure of a workbook,
+// which stops sheets from being added, removed, moved or renamed, or
+// of its windows.
+type WorkbookProtection struct {
+	LockStructure bool
+	LockWindows   bool
+	Password      PasswordHash
+}
+
+// ProtectStructure protects the structure of the workbook, so that
+// sheets can't be added, removed, moved, renamed, hidden or shown.  An
+// empty password protects the structure without a password.
+func (f *File) ProtectStructure(password string) error {
+	passwordHash, err := newPasswordHash(password)
+	if err != nil {
+		return err
+	}
+	f.Protection = &WorkbookProtection{LockStructure: true, Password: passwordHash}
+	return nil
+}
+
+// UnprotectStructure removes the protection of the workbook.
+func (f *File) UnprotectStructure() {
+	f.Protection = nil
+}
+
+// makeXLSXWorkbookProtection converts the protection of the workbook.
+func (p *WorkbookProtection) makeXLSXWorkbookProtection() xlsxWorkbookProtection {
+	if p == nil {
+		return xlsxWorkbookProtection{}
+	}
+	return xlsxWorkbookProtection{
+		WorkbookPassword:      p.Password.LegacyHash,
+		LockStructure:         p.LockStructure,
+		LockWindows:           p.LockWindows,
+		WorkbookAlgorithmName: p.Password.AlgorithmName,
+		WorkbookHashValue:     p.Password.HashValue,
+		WorkbookSaltValue:     p.Password.SaltValue,
+		WorkbookSpinCount:     p.Password.SpinCount,
+	}
+}
+
+// readWorkbookProtection converts the workbookProtection element of a
+// workbook, which is nil when nothing is locked.
+func readWorkbookProtection(x xlsxWorkbookProtection) *WorkbookProtection {
+	if !x.LockStructure && !x.LockWindows {
+		return nil
+	}
+	return &WorkbookProtection{
+		LockStructure: x.LockStructure,
+		LockWindows:   x.LockWindows,
+		Password: PasswordHash{
+			AlgorithmName: x.WorkbookAlgorithmName,
+			HashValue:     x.WorkbookHashValue,
+			SaltValue:     x.WorkbookSaltValue,
+			SpinCount:     x.WorkbookSpinCount,
+			LegacyHash:    x.WorkbookPassword,
+		},
+	}
+}
@@ -0,0 +1,98 @@
+package xlsx
+
+import (
+	"bytes"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type ProtectionSuite struct{}
+
+var _ = Suite(&ProtectionSuite{})
+
+// Both kinds of hash check the password they were made from.
+func (s *ProtectionSuite) TestPasswordHash(c *C) {
+	c.Assert(legacyPasswordHash("password"), Equals, "83AF")
+	c.Assert(PasswordHash{LegacyHash: "83af"}.Check("password"), Equals, true)
+	c.Assert(PasswordHash{LegacyHash: "83AF"}.Check("Password"), Equals, false)
+
+	known := PasswordHash{
+		AlgorithmName: "SHA-512",
+		HashValue:     "M5SOVnbQG4SHyBnRVAYzAx8mPtxyyzMuWxcMv7tkyFO3MBXX9OJjklwPglNHdoHVkKPm4MPfUblqHmAsXfF5HA==",
+		SaltValue:     "AAECAwQFBgcICQoLDA0ODw==",
+		SpinCount:     100000,
+	}
+	c.Assert(known.Check("secret"), Equals, true)
+	c.Assert(known.Check("Secret"), Equals, false)
+
+	h, err := newPasswordHash("secret")
+	c.Assert(err, IsNil)
+	c.Assert(h.AlgorithmName, Equals, "SHA-512")
+	c.Assert(h.SpinCount, Equals, 100000)
+	c.Assert(h.Check("secret"), Equals, true)
+	c.Assert(h.Check("other"), Equals, false)
+
+	h, err = newPasswordHash("")
+	c.Assert(err, IsNil)
+	c.Assert(h, Equals, PasswordHash{})
+	c.Assert(h.Check(""), Equals, true)
+}
+
+// A protected sheet writes every flag, where true means prohibited.
+func (s *ProtectionSuite) TestMarshalSheetProtection(c *C) {
+	f := NewFile()
+	sheet, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	c.Assert(sheet.Protect("", &SheetProtectionOptions{FormatCells: true, Sort: true}), IsNil)
+	c.Assert(f.ProtectStructure(""), IsNil)
+
+	parts, err := f.MarshallParts()
+	c.Assert(err, IsNil)
+	worksheet := parts["xl/worksheets/sheet1.xml"]
+	c.Assert(strings.Contains(worksheet, `<sheetProtection sheet="true" objects="true" scenarios="true" formatCells="false" formatColumns="true" formatRows="true" insertColumns="true" insertRows="true" insertHyperlinks="true" deleteColumns="true" deleteRows="true" selectLockedCells="true" sort="false" autoFilter="true" pivotTables="true" selectUnlockedCells="true"></sheetProtection>`), Equals, true, Commentf(worksheet))
+	c.Assert(strings.Index(worksheet, "<sheetProtection") > strings.Index(worksheet, "</sheetData>"), Equals, true)
+	c.Assert(strings.Contains(parts["xl/workbook.xml"], `<workbookProtection lockStructure="true"></workbookProtection>`), Equals, true)
+
+	sheet.Unprotect()
+	f.UnprotectStructure()
+	parts, err = f.MarshallParts()
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(parts["xl/worksheets/sheet1.xml"], "sheetProtection"), Equals, false)
+	c.Assert(strings.Contains(parts["xl/workbook.xml"], "<workbookProtection></workbookProtection>"), Equals, true)
+}
+
+// Protection survives writing and reading a file, and missing flags
+// take their default values.
+func (s *ProtectionSuite) TestProtectionRoundTrip(c *C) {
+	f := NewFile()
+	sheet, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	c.Assert(sheet.Protect("secret", nil), IsNil)
+	c.Assert(f.ProtectStructure("book"), IsNil)
+
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), IsNil)
+	read, err := OpenBinary(buf.Bytes())
+	c.Assert(err, IsNil)
+
+	protection := read.Sheets[0].Protection
+	c.Assert(protection, NotNil)
+	c.Assert(protection.Options, Equals, defaultSheetProtectionOptions)
+	c.Assert(protection.Password, Equals, sheet.Protection.Password)
+	c.Assert(protection.Password.Check("secret"), Equals, true)
+	c.Assert(read.Protection, NotNil)
+	c.Assert(read.Protection.LockStructure, Equals, true)
+	c.Assert(read.Protection.Password.Check("book"), Equals, true)
+
+	sheetTrue := true
+	defaults := readSheetProtection(&xlsxSheetProtection{Sheet: &sheetTrue, Password: "83AF"})
+	c.Assert(defaults.Options, Equals, SheetProtectionOptions{
+		EditObjects:         true,
+		EditScenarios:       true,
+		SelectLockedCells:   true,
+		SelectUnlockedCells: true,
+	})
+	c.Assert(defaults.Password.Check("password"), Equals, true)
+	c.Assert(readSheetProtection(&xlsxSheetProtection{}), IsNil)
+}
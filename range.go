@@ -0,0 +1,302 @@
+package xlsx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Range is a rectangular range of the cells of a Sheet, such as
+// "B2:F40", for working with many cells at once.  Its coordinates are
+// zero based and inclusive, so that "B2:F40" has a MinCol of 1, a
+// MinRow of 1, a MaxCol of 5 and a MaxRow of 39.
+type Range struct {
+	Sheet                          *Sheet
+	MinCol, MinRow, MaxCol, MaxRow int
+}
+
+// NewRange returns the range of the cells of the sheet between two
+// corners, which can be given in either order.
+func NewRange(sheet *Sheet, x1, y1, x2, y2 int) *Range {
+	return &Range{
+		Sheet:  sheet,
+		MinCol: minInt(x1, x2),
+		MinRow: minInt(y1, y2),
+		MaxCol: maxInt(x1, x2),
+		MaxRow: maxInt(y1, y2),
+	}
+}
+
+// Range returns the range of the sheet's cells given by ref, which is
+// a range such as "B2:F40", or a single cell such as "B2".  The cells
+// can be absolute, as in "$B$2:$F$40", and the range can name the
+// sheet, as in "Sheet1!B2:F40".
+func (s *Sheet) Range(ref string) (*Range, error) {
+	sheetName, cells, err := splitSheetRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	if sheetName != "" && !strings.EqualFold(sheetName, s.Name) {
+		return nil, fmt.Errorf("range %q is not on sheet %q", ref, s.Name)
+	}
+	if !strings.Contains(cells, cellRangeChar) {
+		cells += cellRangeChar + cells
+	}
+	minCol, minRow, maxCol, maxRow, err := getMaxMinFromDimensionRef(cells)
+	if err != nil {
+		return nil, err
+	}
+	return NewRange(s, minCol, minRow, maxCol, maxRow), nil
+}
+
+// String returns the range the way Excel writes it, e.g. "B2:F40", or
+// "B2" for a single cell.
+func (r *Range) String() string {
+	first := GetCellIDStringFromCoords(r.MinCol, r.MinRow)
+	if r.MinCol == r.MaxCol && r.MinRow == r.MaxRow {
+		return first
+	}
+	return first + cellRangeChar + GetCellIDStringFromCoords(r.MaxCol, r.MaxRow)
+}
+
+// Size returns the number of rows and columns in the range.
+func (r *Range) Size() (rows, cols int) {
+	return r.MaxRow - r.MinRow + 1, r.MaxCol - r.MinCol + 1
+}
+
+// Contains reports whether the cell at the zero based coordinates is
+// in the range.
+func (r *Range) Contains(x, y int) bool {
+	return x >= r.MinCol && x <= r.MaxCol && y >= r.MinRow && y <= r.MaxRow
+}
+
+// Intersect returns the cells that are in both ranges, or nil if there
+// are none.
+func (r *Range) Intersect(other *Range) *Range {
+	if r.Sheet != other.Sheet {
+		return nil
+	}
+	minCol, minRow := maxInt(r.MinCol, other.MinCol), maxInt(r.MinRow, other.MinRow)
+	maxCol, maxRow := minInt(r.MaxCol, other.MaxCol), minInt(r.MaxRow, other.MaxRow)
+	if minCol > maxCol || minRow > maxRow {
+		return nil
+	}
+	return NewRange(r.Sheet, minCol, minRow, maxCol, maxRow)
+}
+
+// BoundingBox returns the smallest range that holds the cells of both
+// ranges, or nil if they are on different sheets.  Unlike Union, it
+// also holds any cells between the two ranges.
+func (r *Range) BoundingBox(other *Range) *Range {
+	if r.Sheet != other.Sheet {
+		return nil
+	}
+	return NewRange(r.Sheet,
+		minInt(r.MinCol, other.MinCol), minInt(r.MinRow, other.MinRow),
+		maxInt(r.MaxCol, other.MaxCol), maxInt(r.MaxRow, other.MaxRow))
+}
+
+// Union returns the cells that are in either range, or nil if they are
+// on different sheets.  The cells that the ranges share are only in
+// the first of the Ranges, and two ranges that make up a rectangle
+// together are joined into one.
+func (r *Range) Union(other *Range) Ranges {
+	return Ranges{r}.Union(other)
+}
+
+// subtract returns the cells of the range that aren't in other, as the
+// ranges above, to the left of, to the right of and below the cells
+// that they share.
+func (r *Range) subtract(other *Range) []*Range {
+	shared := r.Intersect(other)
+	if shared == nil {
+		return []*Range{r}
+	}
+	var parts []*Range
+	if r.MinRow < shared.MinRow {
+		parts = append(parts, NewRange(r.Sheet, r.MinCol, r.MinRow, r.MaxCol, shared.MinRow-1))
+	}
+	if r.MinCol < shared.MinCol {
+		parts = append(parts, NewRange(r.Sheet, r.MinCol, shared.MinRow, shared.MinCol-1, shared.MaxRow))
+	}
+	if shared.MaxCol < r.MaxCol {
+		parts = append(parts, NewRange(r.Sheet, shared.MaxCol+1, shared.MinRow, r.MaxCol, shared.MaxRow))
+	}
+	if shared.MaxRow < r.MaxRow {
+		parts = append(parts, NewRange(r.Sheet, r.MinCol, shared.MaxRow+1, r.MaxCol, r.MaxRow))
+	}
+	return parts
+}
+
+// Ranges are several ranges of the cells of a Sheet that are used
+// together, such as "A1:B4 D2 F1:F9", like the cells that a conditional
+// format applies to.
+type Ranges []*Range
+
+// String returns the ranges the way Excel writes them, separated by
+// spaces.
+func (rs Ranges) String() string {
+	refs := make([]string, len(rs))
+	for i, r := range rs {
+		refs[i] = r.String()
+	}
+	return strings.Join(refs, " ")
+}
+
+// Contains reports whether the cell at the zero based coordinates is
+// in any of the ranges.
+func (rs Ranges) Contains(x, y int) bool {
+	for _, r := range rs {
+		if r.Contains(x, y) {
+			return true
+		}
+	}
+	return false
+}
+
+// Union returns the ranges with the cells of other added, or nil if
+// other is on a different sheet.  Only the cells of other that aren't
+// in the ranges yet are added, so that no cell is in two of them, and
+// when all the cells make up a rectangle they are joined into one.
+func (rs Ranges) Union(other *Range) Ranges {
+	if len(rs) > 0 && rs[0].Sheet != other.Sheet {
+		return nil
+	}
+	added := []*Range{other}
+	for _, r := range rs {
+		var rest []*Range
+		for _, part := range added {
+			rest = append(rest, part.subtract(r)...)
+		}
+		added = rest
+	}
+	union := append(append(Ranges{}, rs...), added...)
+	box := union[0]
+	cells := 0
+	for _, r := range union {
+		box = box.BoundingBox(r)
+		rows, cols := r.Size()
+		cells += rows * cols
+	}
+	if rows, cols := box.Size(); rows*cols == cells {
+		return Ranges{box}
+	}
+	return union
+}
+
+// ForEachCell calls fn with each cell of the range, row by row, along
+// with its zero based coordinates, until fn returns an error.  Cells
+// that the sheet doesn't have yet are added to it.
+func (r *Range) ForEachCell(fn func(cell *Cell, x, y int) error) error {
+	for y := r.MinRow; y <= r.MaxRow; y++ {
+		for x := r.MinCol; x <= r.MaxCol; x++ {
+			if err := fn(r.Sheet.Cell(y, x), x, y); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SetStyle sets the style of every cell in the range.
+func (r *Range) SetStyle(style *Style) {
+	r.ForEachCell(func(cell *Cell, x, y int) error {
+		cell.SetStyle(style)
+		return nil
+	})
+}
+
+// SetOuterBorder draws a border around the outside of the range, in
+// the given border style, such as "thin", and color.  The other sides
+// of the cells, and the rest of their styles, are left as they are.
+func (r *Range) SetOuterBorder(borderStyle, color string) {
+	r.ForEachCell(func(cell *Cell, x, y int) error {
+		left, right := x == r.MinCol, x == r.MaxCol
+		top, bottom := y == r.MinRow, y == r.MaxRow
+		if !left && !right && !top && !bottom {
+			return nil
+		}
+		// Cells can share a Style, so the border goes on a copy.
+		style := *cell.GetStyle()
+		if left {
+			style.Border.Left, style.Border.LeftColor = borderStyle, color
+		}
+		if right {
+			style.Border.Right, style.Border.RightColor = borderStyle, color
+		}
+		if top {
+			style.Border.Top, style.Border.TopColor = borderStyle, color
+		}
+		if bottom {
+			style.Border.Bottom, style.Border.BottomColor = borderStyle, color
+		}
+		style.ApplyBorder = true
+		cell.SetStyle(&style)
+		return nil
+	})
+}
+
+// SetValues sets the values of the cells of the range, from its top
+// left cell, row by row, as Cell.SetValue does.  It is an error for
+// the values not to fit in the range.
+func (r *Range) SetValues(values [][]interface{}) error {
+	rows, cols := r.Size()
+	if len(values) > rows {
+		return fmt.Errorf("%d rows of values don't fit in range %s", len(values), r)
+	}
+	for _, row := range values {
+		if len(row) > cols {
+			return fmt.Errorf("%d columns of values don't fit in range %s", len(row), r)
+		}
+	}
+	for i, row := range values {
+		for j, value := range row {
+			r.Sheet.Cell(r.MinRow+i, r.MinCol+j).SetValue(value)
+		}
+	}
+	return nil
+}
+
+// Clear empties the cells of the range, removing their values and
+// formulas but keeping their styles, as Excel's Clear Contents does.
+func (r *Range) Clear() {
+	for y := r.MinRow; y <= r.MaxRow && y < len(r.Sheet.Rows); y++ {
+		row := r.Sheet.Rows[y]
+		if row == nil {
+			continue
+		}
+		for x := r.MinCol; x <= r.MaxCol && x < len(row.Cells); x++ {
+			if cell := row.Cells[x]; cell != nil {
+				cell.SetString("")
+			}
+		}
+	}
+}
+
+// Merge merges the cells of the range into its top left cell, first
+// splitting any merged cells that overlap it.
+func (r *Range) Merge() {
+	r.Unmerge()
+	rows, cols := r.Size()
+	r.Sheet.Cell(r.MinRow, r.MinCol).Merge(cols-1, rows-1)
+}
+
+// Unmerge splits every merged cell that overlaps the range.
+func (r *Range) Unmerge() {
+	for y, row := range r.Sheet.Rows {
+		if y > r.MaxRow {
+			break
+		}
+		if row == nil {
+			continue
+		}
+		for x, cell := range row.Cells {
+			if cell == nil || (cell.HMerge == 0 && cell.VMerge == 0) {
+				continue
+			}
+			merged := NewRange(r.Sheet, x, y, x+cell.HMerge, y+cell.VMerge)
+			if r.Intersect(merged) != nil {
+				cell.HMerge, cell.VMerge = 0, 0
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package xlsx
+
+import (
+	"errors"
+
+	. "gopkg.in/check.v1"
+)
+
+type RangeSuite struct{}
+
+var _ = Suite(&RangeSuite{})
+
+func (s *RangeSuite) TestParseRange(c *C) {
+	f := NewFile()
+	sheet, err := f.AddSheet("Data")
+	c.Assert(err, IsNil)
+
+	r, err := sheet.Range("B2:F40")
+	c.Assert(err, IsNil)
+	c.Assert(*r, Equals, Range{Sheet: sheet, MinCol: 1, MinRow: 1, MaxCol: 5, MaxRow: 39})
+	c.Assert(r.String(), Equals, "B2:F40")
+	rows, cols := r.Size()
+	c.Assert(rows, Equals, 39)
+	c.Assert(cols, Equals, 5)
+
+	r, err = sheet.Range("Data!$C$3")
+	c.Assert(err, IsNil)
+	c.Assert(r.String(), Equals, "C3")
+
+	r, err = sheet.Range("D4:A1")
+	c.Assert(err, IsNil)
+	c.Assert(r.String(), Equals, "A1:D4")
+	c.Assert(NewRange(sheet, 3, 3, 0, 0), DeepEquals, r)
+
+	for _, ref := range []string{"", "A", "A1:B2:C3", "1A", "Other!A1"} {
+		_, err = sheet.Range(ref)
+		c.Assert(err, NotNil, Commentf(ref))
+	}
+}
+
+func (s *RangeSuite) TestBoundingBoxAndIntersect(c *C) {
+	sheet := &Sheet{Name: "Data"}
+	a := NewRange(sheet, 0, 0, 2, 2)
+	b := NewRange(sheet, 1, 1, 4, 3)
+	c.Assert(a.Intersect(b).String(), Equals, "B2:C3")
+	c.Assert(a.BoundingBox(b).String(), Equals, "A1:E4")
+	c.Assert(a.Intersect(NewRange(sheet, 3, 0, 3, 0)), IsNil)
+	c.Assert(a.Contains(2, 2), Equals, true)
+	c.Assert(a.Contains(3, 2), Equals, false)
+
+	other := NewRange(&Sheet{Name: "Other"}, 0, 0, 1, 1)
+	c.Assert(a.Intersect(other), IsNil)
+	c.Assert(a.BoundingBox(other), IsNil)
+}
+
+// The union of ranges holds each of their cells once, joining ranges
+// that make up a rectangle.
+func (s *RangeSuite) TestUnion(c *C) {
+	sheet := &Sheet{Name: "Data"}
+	a := NewRange(sheet, 0, 0, 2, 2)
+	b := NewRange(sheet, 1, 1, 4, 3)
+	union := a.Union(b)
+	c.Assert(union.String(), Equals, "A1:C3 D2:E3 B4:E4")
+	c.Assert(union.Contains(4, 3), Equals, true)
+	c.Assert(union.Contains(0, 3), Equals, false)
+	c.Assert(union.Contains(3, 0), Equals, false)
+
+	c.Assert(a.Union(NewRange(sheet, 1, 1, 1, 1)).String(), Equals, "A1:C3")
+	c.Assert(a.Union(NewRange(sheet, 3, 0, 5, 2)).String(), Equals, "A1:F3")
+	c.Assert(a.Union(NewRange(sheet, 5, 5, 5, 5)).String(), Equals, "A1:C3 F6")
+	c.Assert(union.Union(NewRange(sheet, 0, 3, 0, 3)).String(), Equals, "A1:C3 D2:E3 B4:E4 A4")
+	c.Assert(a.Union(NewRange(&Sheet{Name: "Other"}, 0, 0, 0, 0)), IsNil)
+}
+
+func (s *RangeSuite) TestValuesAndIteration(c *C) {
+	f := NewFile()
+	sheet, err := f.AddSheet("Data")
+	c.Assert(err, IsNil)
+	r := NewRange(sheet, 1, 1, 3, 2)
+
+	c.Assert(r.SetValues([][]interface{}{{"a", 1, 2.5}, {true, nil}}), IsNil)
+	c.Assert(sheet.Cell(1, 1).Value, Equals, "a")
+	c.Assert(sheet.Cell(1, 2).Value, Equals, "1")
+	c.Assert(sheet.Cell(1, 3).Value, Equals, "2.5")
+	c.Assert(sheet.Cell(2, 1).Value, Equals, "true")
+	c.Assert(r.SetValues([][]interface{}{{1, 2, 3, 4}}), NotNil)
+	c.Assert(r.SetValues([][]interface{}{{1}, {2}, {3}}), NotNil)
+
+	var visited []string
+	err = r.ForEachCell(func(cell *Cell, x, y int) error {
+		visited = append(visited, GetCellIDStringFromCoords(x, y)+"="+cell.Value)
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(visited, DeepEquals, []string{"B2=a", "C2=1", "D2=2.5", "B3=true", "C3=", "D3="})
+
+	stop := errors.New("stop")
+	count := 0
+	err = r.ForEachCell(func(cell *Cell, x, y int) error {
+		count++
+		return stop
+	})
+	c.Assert(err, Equals, stop)
+	c.Assert(count, Equals, 1)
+
+	style := NewStyle()
+	style.Font.Bold = true
+	sheet.Cell(1, 2).SetFormula("1+1")
+	sheet.Cell(1, 2).SetStyle(style)
+	NewRange(sheet, 2, 1, 9, 9).Clear()
+	c.Assert(sheet.Cell(1, 1).Value, Equals, "a")
+	c.Assert(sheet.Cell(1, 2).Value, Equals, "")
+	c.Assert(sheet.Cell(1, 2).Formula(), Equals, "")
+	c.Assert(sheet.Cell(1, 2).GetStyle(), Equals, style)
+	c.Assert(sheet.Rows, HasLen, 3)
+}
+
+func (s *RangeSuite) TestStyles(c *C) {
+	f := NewFile()
+	sheet, err := f.AddSheet("Data")
+	c.Assert(err, IsNil)
+	r := NewRange(sheet, 0, 0, 2, 2)
+
+	style := NewStyle()
+	style.Fill = *NewFill("solid", "FFFFFF00", "FFFFFF00")
+	style.ApplyFill = true
+	r.SetStyle(style)
+	r.SetOuterBorder("thin", "FF000000")
+
+	corner := sheet.Cell(0, 0).GetStyle()
+	c.Assert(corner.Border, Equals, Border{Left: "thin", LeftColor: "FF000000", Right: "none", Top: "thin", TopColor: "FF000000", Bottom: "none"})
+	c.Assert(corner.Fill, Equals, style.Fill)
+	c.Assert(corner.ApplyBorder, Equals, true)
+	c.Assert(sheet.Cell(1, 1).GetStyle(), Equals, style)
+	c.Assert(sheet.Cell(2, 1).GetStyle().Border, Equals, Border{Left: "none", Right: "none", Top: "none", Bottom: "thin", BottomColor: "FF000000"})
+	c.Assert(sheet.Cell(1, 2).GetStyle().Border, Equals, Border{Left: "none", Right: "thin", RightColor: "FF000000", Top: "none", Bottom: "none"})
+	c.Assert(style.Border, Equals, *DefaultBorder())
+}
+
+func (s *RangeSuite) TestMerge(c *C) {
+	f := NewFile()
+	sheet, err := f.AddSheet("Data")
+	c.Assert(err, IsNil)
+	sheet.Cell(0, 0).Merge(1, 1)
+	sheet.Cell(5, 5).Merge(1, 0)
+
+	r, err := sheet.Range("B2:D3")
+	c.Assert(err, IsNil)
+	r.Merge()
+	c.Assert(sheet.Cell(0, 0).HMerge, Equals, 0)
+	c.Assert(sheet.Cell(0, 0).VMerge, Equals, 0)
+	c.Assert(sheet.Cell(1, 1).HMerge, Equals, 2)
+	c.Assert(sheet.Cell(1, 1).VMerge, Equals, 1)
+	c.Assert(sheet.Cell(5, 5).HMerge, Equals, 1)
+
+	NewRange(sheet, 3, 2, 3, 2).Unmerge()
+	c.Assert(sheet.Cell(1, 1).HMerge, Equals, 0)
+	c.Assert(sheet.Cell(1, 1).VMerge, Equals, 0)
+	c.Assert(sheet.Cell(5, 5).HMerge, Equals, 1)
+}
@@ -1,32 +1,33 @@
 package xlsx
 
 type RefTable struct {
-	indexedStrings []string
-	knownStrings   map[string]int
-	isWrite        bool
+	indexedStrings  []string
+	knownStrings    map[string]int
+	indexedRichText map[int][]RichTextRun
+	knownRichText   map[string]int
+	isWrite         bool
 }
 
 // NewSharedStringRefTable() creates a new, empty RefTable.
 func NewSharedStringRefTable() *RefTable {
 	rt := RefTable{}
 	rt.knownStrings = make(map[string]int)
+	rt.indexedRichText = make(map[int][]RichTextRun)
+	rt.knownRichText = make(map[string]int)
 	return &rt
 }
 
 // MakeSharedStringRefTable() takes an xlsxSST struct and converts
 // it's contents to an slice of strings used to refer to string values
 // by numeric index - this is the model used within XLSX worksheet (a
-// numeric reference is stored to a shared cell value).
+// numeric reference is stored to a shared cell value).  Strings made
+// up of runs of rich text are also kept as RichTextRun slices.
 func MakeSharedStringRefTable(source *xlsxSST) *RefTable {
 	reftable := NewSharedStringRefTable()
 	reftable.isWrite = false
 	for _, si := range source.SI {
 		if len(si.R) > 0 {
-			newString := ""
-			for j := 0; j < len(si.R); j++ {
-				newString = newString + si.R[j].T
-			}
-			reftable.AddString(newString)
+			reftable.AddRichText(makeRichTextFromXLSX(si.R))
 		} else {
 			reftable.AddString(si.T)
 		}
@@ -40,9 +41,13 @@ func (rt *RefTable) makeXLSXSST() xlsxSST {
 	sst := xlsxSST{}
 	sst.Count = len(rt.indexedStrings)
 	sst.UniqueCount = sst.Count
-	for _, ref := range rt.indexedStrings {
+	for index, ref := range rt.indexedStrings {
 		si := xlsxSI{}
-		si.T = ref
+		if runs, ok := rt.indexedRichText[index]; ok {
+			si.R = makeXLSXRichText(runs)
+		} else {
+			si.T = ref
+		}
 		sst.SI = append(sst.SI, si)
 	}
 	return sst
@@ -51,11 +56,18 @@ func (rt *RefTable) makeXLSXSST() xlsxSST {
 // Resolvesharedstring() looks up a string value by numeric index from
 // a provided reference table (just a slice of strings in the correct
 // order).  This function only exists to provide clarity or purpose
-// via it's name.
+// via it's name.  Rich text is returned as plain text.
 func (rt *RefTable) ResolveSharedString(index int) string {
 	return rt.indexedStrings[index]
 }
 
+// ResolveRichText looks up the runs of rich text by numeric index
+// from a provided reference table.  It returns nil if the string at
+// that index is plain text.
+func (rt *RefTable) ResolveRichText(index int) []RichTextRun {
+	return rt.indexedRichText[index]
+}
+
 // AddString adds a string to the reference table and return it's
 // numeric index.  If the string already exists then it simply returns
 // the existing index.
@@ -72,6 +84,24 @@ func (rt *RefTable) AddString(str string) int {
 	return index
 }
 
+// AddRichText adds runs of rich text to the reference table and
+// return it's numeric index.  If identical rich text already exists
+// then it simply returns the existing index.
+func (rt *RefTable) AddRichText(runs []RichTextRun) int {
+	key := richTextKey(runs)
+	if rt.isWrite {
+		index, ok := rt.knownRichText[key]
+		if ok {
+			return index
+		}
+	}
+	rt.indexedStrings = append(rt.indexedStrings, richTextToPlainString(runs))
+	index := len(rt.indexedStrings) - 1
+	rt.indexedRichText[index] = runs
+	rt.knownRichText[key] = index
+	return index
+}
+
 func (rt *RefTable) Length() int {
 	return len(rt.indexedStrings)
 }
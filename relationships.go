@@ -0,0 +1,126 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// These are the relationship types used to link the parts of a
+// workbook to one another.
+const (
+	relationshipTypeCalcChain          = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/calcChain"
+	relationshipTypeChartsheet         = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/chartsheet"
+	relationshipTypeChart              = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/chart"
+	relationshipTypeComments           = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/comments"
+	relationshipTypeCoreProperties     = "http://schemas.openxmlformats.org/package/2006/relationships/metadata/core-properties"
+	relationshipTypeCustomProperties   = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/custom-properties"
+	relationshipTypeDrawing            = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/drawing"
+	relationshipTypeExtendedProperties = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/extended-properties"
+	relationshipTypeHyperlink          = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/hyperlink"
+	relationshipTypeImage              = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/image"
+	relationshipTypeOfficeDocument     = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument"
+	relationshipTypeSharedStrings      = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/sharedStrings"
+	relationshipTypeStyles             = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles"
+	relationshipTypeTable              = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/table"
+	relationshipTypeTheme              = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/theme"
+	relationshipTypeVBAProject         = "http://schemas.microsoft.com/office/2006/relationships/vbaProject"
+	relationshipTypeVMLDrawing         = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/vmlDrawing"
+	relationshipTypeWorksheet          = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet"
+)
+
+// relationshipTargetModeExternal marks a relationship whose target is
+// outside of the package, such as the URL of a hyperlink.
+const relationshipTargetModeExternal = "External"
+
+// relsNameForPart returns the name of the part holding the
+// relationships of the named part, so "xl/worksheets/sheet1.xml" has
+// its relationships in "xl/worksheets/_rels/sheet1.xml.rels".
+func relsNameForPart(partName string) string {
+	dir, file := path.Split(partName)
+	return dir + "_rels/" + file + ".rels"
+}
+
+// resolveRelationshipTarget returns the name, within the package, of
+// the target of a relationship belonging to the named part.
+// Relationship targets are relative to the directory of their source
+// part, unless they start with a slash.
+func resolveRelationshipTarget(partName, target string) string {
+	if strings.HasPrefix(target, "/") {
+		return target[1:]
+	}
+	return path.Join(path.Dir(partName), target)
+}
+
+// readPartRelations returns the relationships of the named part,
+// keyed by their Id.  Targets inside the package are resolved to the
+// full name of the part they refer to.  A part without relationships
+// results in an empty map.
+func readPartRelations(files map[string]*zip.File, partName string) (map[string]xlsxWorkbookRelation, error) {
+	rels := make(map[string]xlsxWorkbookRelation)
+	f, ok := files[relsNameForPart(partName)]
+	if !ok {
+		return rels, nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	xRels := new(xlsxWorkbookRels)
+	if err = xml.NewDecoder(rc).Decode(xRels); err != nil {
+		return nil, err
+	}
+	for _, rel := range xRels.Relationships {
+		if rel.TargetMode != relationshipTargetModeExternal {
+			rel.Target = resolveRelationshipTarget(partName, rel.Target)
+		}
+		rels[rel.Id] = rel
+	}
+	return rels, nil
+}
+
+// relativeRelationshipTarget returns the target that a relationship
+// belonging to sourcePart needs in order to refer to targetPart, which
+// is the reverse of resolveRelationshipTarget.
+func relativeRelationshipTarget(sourcePart, targetPart string) string {
+	dir := path.Dir(sourcePart)
+	if dir == "." {
+		return targetPart
+	}
+	from := strings.Split(dir, "/")
+	to := strings.Split(targetPart, "/")
+	i := 0
+	for i < len(from) && i < len(to)-1 && from[i] == to[i] {
+		i++
+	}
+	return strings.Repeat("../", len(from)-i) + strings.Join(to[i:], "/")
+}
+
+// addRelationship appends a relationship with the next free Id and
+// returns that Id.
+func (rels *xlsxWorkbookRels) addRelationship(relType, target, targetMode string) string {
+	id := fmt.Sprintf("rId%d", len(rels.Relationships)+1)
+	rels.Relationships = append(rels.Relationships, xlsxWorkbookRelation{
+		Id:         id,
+		Target:     target,
+		Type:       relType,
+		TargetMode: targetMode,
+	})
+	return id
+}
+
+// replaceWorksheetRelationshipsNameSpace does for a worksheet what
+// replaceRelationshipsNameSpace does for the workbook.  Worksheets
+// that don't refer to any relationships are returned unchanged.
+func replaceWorksheetRelationshipsNameSpace(sheetMarshal string) string {
+	if !strings.Contains(sheetMarshal, "relationships:id") {
+		return sheetMarshal
+	}
+	newSheet := strings.Replace(sheetMarshal, `xmlns:relationships="http://schemas.openxmlformats.org/officeDocument/2006/relationships" relationships:id`, `r:id`, -1)
+	oldXmlns := `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`
+	newXmlns := `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">`
+	return strings.Replace(newSheet, oldXmlns, newXmlns, 1)
+}
@@ -0,0 +1,193 @@
+package xlsx
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strconv"
+	"strings"
+)
+
+// RichTextVertAlign is the vertical alignment of a run of rich text.
+type RichTextVertAlign string
+
+// These are the vertical alignments from the ST_VerticalAlignRun spec
+const (
+	RichTextVertAlignBaseline    RichTextVertAlign = "baseline"
+	RichTextVertAlignSuperscript RichTextVertAlign = "superscript"
+	RichTextVertAlignSubscript   RichTextVertAlign = "subscript"
+)
+
+// RichTextUnderline is the style of the line under a run of rich text.
+type RichTextUnderline string
+
+// These are the underline styles from the ST_UnderlineValues spec
+const (
+	RichTextUnderlineSingle           RichTextUnderline = "single"
+	RichTextUnderlineDouble           RichTextUnderline = "double"
+	RichTextUnderlineSingleAccounting RichTextUnderline = "singleAccounting"
+	RichTextUnderlineDoubleAccounting RichTextUnderline = "doubleAccounting"
+)
+
+// RichTextFont is the font of a run of rich text.  Any field left at
+// its zero value is inherited from the style of the cell.
+type RichTextFont struct {
+	Name    string
+	Size    float64
+	Family  int
+	Charset int
+	// Color is the ARGB value of the color of the text, such as
+	// "FFFF0000".  ColorTheme and ColorIndexed pick the color from
+	// the theme of the workbook or from the indexed palette
+	// instead, and ColorTint lightens or darkens it.
+	Color        string
+	ColorTheme   *int
+	ColorIndexed *int
+	ColorTint    float64
+	Bold         bool
+	Italic       bool
+	Underline    RichTextUnderline
+	Strike       bool
+	VertAlign    RichTextVertAlign
+}
+
+// RichTextRun is a fragment of text within a cell that shares a
+// single font.  A run with a nil Font uses the style of the cell.
+type RichTextRun struct {
+	Font *RichTextFont
+	Text string
+}
+
+// richTextToPlainString returns the text of a slice of runs with all
+// formatting removed.
+func richTextToPlainString(runs []RichTextRun) string {
+	var text bytes.Buffer
+	for _, run := range runs {
+		text.WriteString(run.Text)
+	}
+	return text.String()
+}
+
+// richTextFor returns the runs of rich text of a cell or comment when
+// their plain text is still the text it holds, and nil once the text
+// has been replaced, so that the runs don't bring back the old text.
+func richTextFor(runs []RichTextRun, text string) []RichTextRun {
+	if len(runs) == 0 || richTextToPlainString(runs) != text {
+		return nil
+	}
+	return runs
+}
+
+// richTextKey returns a string that is identical for two slices of
+// runs only if they have the same text and fonts.  It is used to
+// deduplicate rich text in the shared string table.
+func richTextKey(runs []RichTextRun) string {
+	key, _ := xml.Marshal(makeXLSXRichText(runs))
+	return string(key)
+}
+
+// makeRichTextFromXLSX converts the r elements of a string item into
+// runs of rich text.
+func makeRichTextFromXLSX(rs []xlsxR) []RichTextRun {
+	if len(rs) == 0 {
+		return nil
+	}
+	runs := make([]RichTextRun, len(rs))
+	for i, r := range rs {
+		runs[i].Text = r.T.Text
+		if r.RPr == nil {
+			continue
+		}
+		font := &RichTextFont{}
+		rPr := r.RPr
+		if rPr.RFont != nil {
+			font.Name = rPr.RFont.Val
+		}
+		if rPr.Sz != nil {
+			font.Size, _ = strconv.ParseFloat(rPr.Sz.Val, 64)
+		}
+		if rPr.Family != nil {
+			font.Family, _ = strconv.Atoi(rPr.Family.Val)
+		}
+		if rPr.Charset != nil {
+			font.Charset, _ = strconv.Atoi(rPr.Charset.Val)
+		}
+		if rPr.Color != nil {
+			font.Color = rPr.Color.RGB
+			font.ColorTheme = rPr.Color.Theme
+			font.ColorIndexed = rPr.Color.Indexed
+			font.ColorTint = rPr.Color.Tint
+		}
+		font.Bold = rPr.B != nil && rPr.B.Val != "0" && rPr.B.Val != "false"
+		font.Italic = rPr.I != nil && rPr.I.Val != "0" && rPr.I.Val != "false"
+		font.Strike = rPr.Strike != nil && rPr.Strike.Val != "0" && rPr.Strike.Val != "false"
+		if rPr.U != nil && rPr.U.Val != "none" {
+			font.Underline = RichTextUnderline(rPr.U.Val)
+			if font.Underline == "" {
+				font.Underline = RichTextUnderlineSingle
+			}
+		}
+		if rPr.VertAlign != nil {
+			font.VertAlign = RichTextVertAlign(rPr.VertAlign.Val)
+		}
+		runs[i].Font = font
+	}
+	return runs
+}
+
+// makeXLSXRichText converts runs of rich text into the r elements of
+// a string item.
+func makeXLSXRichText(runs []RichTextRun) []xlsxR {
+	rs := make([]xlsxR, len(runs))
+	for i, run := range runs {
+		rs[i].T = xlsxT{Text: run.Text}
+		if strings.TrimSpace(run.Text) != run.Text {
+			rs[i].T.Space = "preserve"
+		}
+		font := run.Font
+		if font == nil {
+			continue
+		}
+		rPr := &xlsxRunProperties{}
+		if font.Bold {
+			rPr.B = &xlsxVal{}
+		}
+		if font.Italic {
+			rPr.I = &xlsxVal{}
+		}
+		if font.Strike {
+			rPr.Strike = &xlsxVal{}
+		}
+		switch font.Underline {
+		case "":
+		case RichTextUnderlineSingle:
+			rPr.U = &xlsxVal{}
+		default:
+			rPr.U = &xlsxVal{Val: string(font.Underline)}
+		}
+		if font.VertAlign != "" {
+			rPr.VertAlign = &xlsxVal{Val: string(font.VertAlign)}
+		}
+		if font.Size > 0 {
+			rPr.Sz = &xlsxVal{Val: strconv.FormatFloat(font.Size, 'f', -1, 64)}
+		}
+		if font.Color != "" || font.ColorTheme != nil || font.ColorIndexed != nil {
+			rPr.Color = &xlsxColor{
+				RGB:     font.Color,
+				Theme:   font.ColorTheme,
+				Indexed: font.ColorIndexed,
+				Tint:    font.ColorTint,
+			}
+		}
+		if font.Name != "" {
+			rPr.RFont = &xlsxVal{Val: font.Name}
+		}
+		if font.Family != 0 {
+			rPr.Family = &xlsxVal{Val: strconv.Itoa(font.Family)}
+		}
+		if font.Charset != 0 {
+			rPr.Charset = &xlsxVal{Val: strconv.Itoa(font.Charset)}
+		}
+		rs[i].RPr = rPr
+	}
+	return rs
+}
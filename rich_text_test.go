@@ -0,0 +1,183 @@
+package xlsx
+
+import (
+	"bytes"
+	"encoding/xml"
+
+	. "gopkg.in/check.v1"
+)
+
+type RichTextSuite struct{}
+
+var _ = Suite(&RichTextSuite{})
+
+// Runs of rich text in the shared string table are kept, and their
+// plain text is used as the value of the string.
+func (s *RichTextSuite) TestMakeSharedStringRefTableWithRichText(c *C) {
+	sharedStringsXML := bytes.NewBufferString(
+		`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+        <sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" count="2" uniqueCount="2">
+          <si><t>Foo</t></si>
+          <si>
+            <r><rPr><b/><sz val="11.5"/><color rgb="FFFF0000"/><rFont val="Calibri"/><family val="2"/></rPr><t>Bold</t></r>
+            <r><rPr><i/><strike/><u/><vertAlign val="superscript"/></rPr><t xml:space="preserve"> and more</t></r>
+            <r><t>!</t></r>
+            <r><rPr><u val="double"/><color theme="4" tint="-0.25"/></rPr><t>?</t></r>
+            <r><rPr><u val="singleAccounting"/><color indexed="10"/></rPr><t>!</t></r>
+          </si>
+        </sst>`)
+	sst := new(xlsxSST)
+	err := xml.NewDecoder(sharedStringsXML).Decode(sst)
+	c.Assert(err, IsNil)
+	reftable := MakeSharedStringRefTable(sst)
+	c.Assert(reftable.Length(), Equals, 2)
+	c.Assert(reftable.ResolveRichText(0), IsNil)
+	c.Assert(reftable.ResolveSharedString(1), Equals, "Bold and more!?!")
+
+	runs := reftable.ResolveRichText(1)
+	c.Assert(runs, HasLen, 5)
+	c.Assert(runs[0].Text, Equals, "Bold")
+	c.Assert(*runs[0].Font, DeepEquals, RichTextFont{
+		Name:   "Calibri",
+		Size:   11.5,
+		Family: 2,
+		Color:  "FFFF0000",
+		Bold:   true,
+	})
+	c.Assert(runs[1].Text, Equals, " and more")
+	c.Assert(*runs[1].Font, DeepEquals, RichTextFont{
+		Italic:    true,
+		Strike:    true,
+		Underline: RichTextUnderlineSingle,
+		VertAlign: RichTextVertAlignSuperscript,
+	})
+	c.Assert(runs[2].Font, IsNil)
+	theme, indexed := 4, 10
+	c.Assert(*runs[3].Font, DeepEquals, RichTextFont{
+		Underline:  RichTextUnderlineDouble,
+		ColorTheme: &theme,
+		ColorTint:  -0.25,
+	})
+	c.Assert(*runs[4].Font, DeepEquals, RichTextFont{
+		Underline:    RichTextUnderlineSingleAccounting,
+		ColorIndexed: &indexed,
+	})
+
+	// The colors and underlines are written back as they were read.
+	rs := makeXLSXRichText(runs)
+	c.Assert(*rs[1].RPr.U, Equals, xlsxVal{})
+	c.Assert(*rs[3].RPr.U, Equals, xlsxVal{Val: "double"})
+	c.Assert(*rs[3].RPr.Color, DeepEquals, xlsxColor{Theme: &theme, Tint: -0.25})
+	c.Assert(*rs[4].RPr.U, Equals, xlsxVal{Val: "singleAccounting"})
+	c.Assert(*rs[4].RPr.Color, DeepEquals, xlsxColor{Indexed: &indexed})
+}
+
+// Rich text is written to the shared string table as r elements.
+func (s *RichTextSuite) TestMarshalRichText(c *C) {
+	refTable := NewSharedStringRefTable()
+	refTable.isWrite = true
+	runs := []RichTextRun{
+		{Font: &RichTextFont{Bold: true, Size: 12, Color: "FF0000FF"}, Text: "Hello"},
+		{Text: " world"},
+	}
+	c.Assert(refTable.AddRichText(runs), Equals, 0)
+	c.Assert(refTable.AddString("Hello world"), Equals, 1)
+	c.Assert(refTable.AddRichText(runs), Equals, 0)
+
+	body, err := xml.Marshal(refTable.makeXLSXSST())
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" count="2" uniqueCount="2">`+
+		`<si><r><rPr><b></b><sz val="12"></sz><color rgb="FF0000FF"></color></rPr><t>Hello</t></r>`+
+		`<r><t xml:space="preserve"> world</t></r></si>`+
+		`<si><t>Hello world</t></si></sst>`)
+}
+
+// Rich text survives writing a File and reading it back.
+func (s *RichTextSuite) TestRichTextRoundTrip(c *C) {
+	f := NewFile()
+	sheet, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	cell := sheet.Cell(0, 0)
+	cell.SetRichText([]RichTextRun{
+		{Font: &RichTextFont{Italic: true, VertAlign: RichTextVertAlignSubscript}, Text: "H2"},
+		{Font: &RichTextFont{Name: "Arial", Underline: RichTextUnderlineDouble}, Text: "O"},
+	})
+	c.Assert(cell.Value, Equals, "H2O")
+	c.Assert(cell.IsRichText(), Equals, true)
+	sheet.Cell(0, 1).SetString("plain")
+
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), IsNil)
+	f, err = OpenBinary(buf.Bytes())
+	c.Assert(err, IsNil)
+	cell = f.Sheets[0].Cell(0, 0)
+	c.Assert(cell.Value, Equals, "H2O")
+	c.Assert(cell.RichText, HasLen, 2)
+	c.Assert(cell.RichText[0].Font.Italic, Equals, true)
+	c.Assert(cell.RichText[0].Font.VertAlign, Equals, RichTextVertAlignSubscript)
+	c.Assert(cell.RichText[1].Font.Name, Equals, "Arial")
+	c.Assert(cell.RichText[1].Font.Underline, Equals, RichTextUnderlineDouble)
+	c.Assert(f.Sheets[0].Cell(0, 1).IsRichText(), Equals, false)
+
+	cell.SetString("no longer rich")
+	c.Assert(cell.IsRichText(), Equals, false)
+
+	// Every setter that replaces the content of the cell drops its runs.
+	for _, set := range []func(*Cell){
+		func(cell *Cell) { cell.SetFormula("1+1") },
+		func(cell *Cell) { cell.SetStringFormula("\"a\"&\"b\"") },
+		func(cell *Cell) { cell.SetInt(1) },
+		func(cell *Cell) { cell.SetBool(true) },
+		func(cell *Cell) { cell.SetDateTimeWithFormat(1, DefaultDateFormat) },
+	} {
+		cell.SetRichText([]RichTextRun{{Text: "rich"}})
+		set(cell)
+		c.Assert(cell.IsRichText(), Equals, false)
+	}
+}
+
+// Replacing the value of a cell read as rich text writes the new value,
+// not the runs it was read with.
+func (s *RichTextSuite) TestReplaceRichTextValue(c *C) {
+	f := NewFile()
+	sheet, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	sheet.Cell(0, 0).SetRichText([]RichTextRun{{Font: &RichTextFont{Bold: true}, Text: "rich"}})
+	sheet.Cell(0, 1).SetRichText([]RichTextRun{{Font: &RichTextFont{Italic: true}, Text: "also rich"}})
+
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), IsNil)
+	f, err = OpenBinary(buf.Bytes())
+	c.Assert(err, IsNil)
+	sheet = f.Sheets[0]
+	c.Assert(sheet.Cell(0, 0).IsRichText(), Equals, true)
+	sheet.Cell(0, 0).SetString("x")
+	sheet.Cell(0, 1).Value = "y"
+	c.Assert(sheet.Cell(0, 1).IsRichText(), Equals, false)
+
+	buf.Reset()
+	c.Assert(f.Write(&buf), IsNil)
+	f, err = OpenBinary(buf.Bytes())
+	c.Assert(err, IsNil)
+	sheet = f.Sheets[0]
+	c.Assert(sheet.Cell(0, 0).Value, Equals, "x")
+	c.Assert(sheet.Cell(0, 0).IsRichText(), Equals, false)
+	c.Assert(sheet.Cell(0, 1).Value, Equals, "y")
+	c.Assert(sheet.Cell(0, 1).IsRichText(), Equals, false)
+}
+
+// Inline strings made of runs keep their rich text.
+func (s *RichTextSuite) TestFillCellDataFromInlineRichText(c *C) {
+	rawcell := xlsxC{
+		T: "inlineStr",
+		Is: &xlsxSI{R: []xlsxR{
+			{RPr: &xlsxRunProperties{B: &xlsxVal{}}, T: xlsxT{Text: "A"}},
+			{T: xlsxT{Text: "B"}},
+		}},
+	}
+	cell := new(Cell)
+	fillCellData(rawcell, nil, nil, cell)
+	c.Assert(cell.Value, Equals, "AB")
+	c.Assert(cell.RichText, HasLen, 2)
+	c.Assert(cell.RichText[0].Font.Bold, Equals, true)
+}
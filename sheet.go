@@ -11,6 +11,7 @@ import (
 type Sheet struct {
 	Name        string
 	File        *File
+	Type        SheetType
 	Rows        []*Row
 	Cols        []*Col
 	MaxRow      int
@@ -20,6 +21,32 @@ type Sheet struct {
 	SheetViews  []SheetView
 	SheetFormat SheetFormat
 	AutoFilter  *AutoFilter
+	Protection  *SheetProtection
+	// ConditionalFormats are applied in the order of the
+	// Priority of their rules.
+	ConditionalFormats []*ConditionalFormat
+	Tables             []*Table
+	Pictures           []*Picture
+	Charts             []*Chart
+	// Hyperlinks are the links over ranges of cells, such as
+	// "A1:C3" or "A:A", each with its Ref set.  A link on a single
+	// cell is the Hyperlink of the Cell.
+	Hyperlinks []*Hyperlink
+	// preservedRels are the relationships of the worksheet that
+	// lead to parts the library doesn't model.
+	preservedRels []xlsxWorkbookRelation
+	// drawing is the drawing part that the worksheet was read
+	// with, when unknown parts are preserved.
+	drawing *originalDrawing
+	// shapes are the anchors of the drawing that the worksheet was
+	// read with that hold neither pictures nor charts.
+	shapes *drawingShapes
+	// unmodelled is the worksheet that the sheet was read from,
+	// without its rows, which holds the XML that the library
+	// doesn't model.
+	unmodelled *xlsxWorksheet
+	// chartsheet is the XML of a chartsheet, as it was read.
+	chartsheet []byte
 }
 
 type SheetView struct {
@@ -56,11 +83,18 @@ func (s *Sheet) AddRow() *Row {
 	return row
 }
 
-// Add a new Row to a Sheet at a specific index
+// Add a new Row to a Sheet at a specific index.  As in Excel, the
+// references to the rows below it throughout the workbook move down
+// with them.  The references of a formula that can't be parsed stay
+// as they are, and the error for it is returned along with the Row.
 func (s *Sheet) AddRowAtIndex(index int) (*Row, error) {
+	if err := s.errChartsheet("AddRowAtIndex"); err != nil {
+		return nil, err
+	}
 	if index < 0 || index > len(s.Rows) {
 		return nil, errors.New("AddRowAtIndex: index out of bounds")
 	}
+	merged := s.unmerge()
 	row := &Row{Sheet: s}
 	s.Rows = append(s.Rows, nil)
 
@@ -71,16 +105,27 @@ func (s *Sheet) AddRowAtIndex(index int) (*Row, error) {
 	if len(s.Rows) > s.MaxRow {
 		s.MaxRow = len(s.Rows)
 	}
-	return row, nil
+	return row, s.shiftReferences(referenceShift{sheet: s, index: index, count: 1}, merged)
 }
 
-// Removes a row at a specific index
+// Removes a row at a specific index.  As in Excel, the references to
+// the rows below it throughout the workbook move up with them, and
+// references to the row itself become #REF! errors.  The references of
+// a formula that can't be parsed stay as they are, and the error for it
+// is returned once the row has been removed.
 func (s *Sheet) RemoveRowAtIndex(index int) error {
+	if err := s.errChartsheet("RemoveRowAtIndex"); err != nil {
+		return err
+	}
 	if index < 0 || index >= len(s.Rows) {
 		return errors.New("RemoveRowAtIndex: index out of bounds")
 	}
+	merged := s.unmerge()
 	s.Rows = append(s.Rows[:index], s.Rows[index+1:]...)
-	return nil
+	if s.MaxRow > len(s.Rows) {
+		s.MaxRow = len(s.Rows)
+	}
+	return s.shiftReferences(referenceShift{sheet: s, index: index, count: -1}, merged)
 }
 
 // Make sure we always have as many Rows as we do cells.
@@ -129,6 +174,99 @@ func (s *Sheet) Col(idx int) *Col {
 	return s.Cols[idx]
 }
 
+// InsertColAtIndex inserts a new, empty column into the Sheet, moving
+// the cells of every row, and the column definitions with their width,
+// style, visibility, outline level and data validations, to the right.
+// As in Excel, the references to the columns that move throughout the
+// workbook move with them.  The references of a formula that can't be
+// parsed stay as they are, and the error for it is returned along with
+// the Col.
+func (s *Sheet) InsertColAtIndex(index int) (*Col, error) {
+	if err := s.errChartsheet("InsertColAtIndex"); err != nil {
+		return nil, err
+	}
+	if index < 0 || index > len(s.Cols) {
+		return nil, errors.New("InsertColAtIndex: index out of bounds")
+	}
+	merged := s.unmerge()
+	for _, row := range s.Rows {
+		if row == nil || index >= len(row.Cells) {
+			continue
+		}
+		row.Cells = append(row.Cells, nil)
+		copy(row.Cells[index+1:], row.Cells[index:])
+		row.Cells[index] = NewCell(row)
+	}
+	col := &Col{style: NewStyle()}
+	s.Cols = append(s.Cols, nil)
+	copy(s.Cols[index+1:], s.Cols[index:])
+	s.Cols[index] = col
+	if len(s.Cols) > s.MaxCol {
+		s.MaxCol = len(s.Cols)
+	}
+	sh := referenceShift{sheet: s, cols: true, index: index, count: 1}
+	s.respanCols(sh)
+	return col, s.shiftReferences(sh, merged)
+}
+
+// RemoveColAtIndex removes a column from the Sheet, along with its
+// cells in every row and its column definition, moving the columns
+// after it to the left.  As in Excel, the references to the columns
+// that move throughout the workbook move with them, and references to
+// the column itself become #REF! errors.  The references of a formula
+// that can't be parsed stay as they are, and the error for it is
+// returned once the column has been removed.
+func (s *Sheet) RemoveColAtIndex(index int) error {
+	if err := s.errChartsheet("RemoveColAtIndex"); err != nil {
+		return err
+	}
+	if index < 0 || index >= len(s.Cols) {
+		return errors.New("RemoveColAtIndex: index out of bounds")
+	}
+	merged := s.unmerge()
+	for _, row := range s.Rows {
+		if row != nil && index < len(row.Cells) {
+			row.Cells = append(row.Cells[:index], row.Cells[index+1:]...)
+		}
+	}
+	s.Cols = append(s.Cols[:index], s.Cols[index+1:]...)
+	if s.MaxCol > len(s.Cols) {
+		s.MaxCol = len(s.Cols)
+	}
+	sh := referenceShift{sheet: s, cols: true, index: index, count: -1}
+	s.respanCols(sh)
+	return s.shiftReferences(sh, merged)
+}
+
+// respanCols moves the span of each column definition past the
+// inserted or removed columns, shrinking the spans that lose some of
+// their columns.  A span that columns are inserted into is split
+// around them, so that the new columns keep definitions of their own.
+// A column with no span of its own, like one just inserted, spans just
+// itself.
+func (s *Sheet) respanCols(sh referenceShift) {
+	for i, col := range s.Cols {
+		if col == nil {
+			continue
+		}
+		if col.Min > 0 && col.Max >= col.Min {
+			min, max, ok := sh.span(col.Min-1, col.Max-1)
+			if ok && sh.count > 0 && min < sh.index && sh.index <= max {
+				if i < sh.index {
+					max = sh.index - 1
+				} else {
+					min = sh.index + sh.count
+				}
+			}
+			if ok && min <= i && i <= max {
+				col.Min, col.Max = min+1, max+1
+				continue
+			}
+		}
+		col.Min, col.Max = i+1, i+1
+	}
+}
+
 // Get a Cell by passing it's cartesian coordinates (zero based) as
 // row and column integer indexes.
 //
@@ -339,7 +477,9 @@ func (s *Sheet) makeXLSXSheet(refTable *RefTable, styles *xlsxStyleSheet) *xlsxW
 				// This is what Excel does as well.
 				fallthrough
 			case CellTypeString:
-				if len(cell.Value) > 0 {
+				if runs := richTextFor(cell.RichText, cell.Value); runs != nil {
+					xC.V = strconv.Itoa(refTable.AddRichText(runs))
+				} else if len(cell.Value) > 0 {
 					xC.V = strconv.Itoa(refTable.AddString(cell.Value))
 				}
 				xC.T = "s"
@@ -400,10 +540,14 @@ func (s *Sheet) makeXLSXSheet(refTable *RefTable, styles *xlsxStyleSheet) *xlsxW
 		worksheet.MergeCells.Count = len(worksheet.MergeCells.Cells)
 	}
 
+	worksheet.SheetProtection = s.Protection.makeXLSXSheetProtection()
+
 	if s.AutoFilter != nil {
 		worksheet.AutoFilter = &xlsxAutoFilter{Ref: fmt.Sprintf("%v:%v", s.AutoFilter.TopLeftCell, s.AutoFilter.BottomRightCell)}
 	}
 
+	s.copyUnmodelledXML(worksheet)
+
 	worksheet.SheetData = xSheet
 	dimension := xlsxDimension{}
 	dimension.Ref = "A1:" + GetCellIDStringFromCoords(maxCell, maxRow)
@@ -0,0 +1,803 @@
+package xlsx
+
+import (
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// referenceShift is rows or columns being inserted into a sheet, or
+// removed from it, which moves the cells that references point to.
+type referenceShift struct {
+	sheet *Sheet
+	// cols is set when columns, rather than rows, are shifted.
+	cols bool
+	// sheetRemoved is set when the whole sheet is removed, so that
+	// every reference to it becomes a #REF! error.
+	sheetRemoved bool
+	// index is the first row or column inserted or removed, and count
+	// how many are inserted, or minus how many are removed.
+	index, count int
+	// err is where the first formula that can't be parsed, and so
+	// isn't moved, is noted.
+	err *error
+}
+
+// mergedArea is the range of cells merged into the cell at its top left.
+type mergedArea struct {
+	minCol, minRow, maxCol, maxRow int
+}
+
+// span shifts the rows or columns from min to max, returning false if
+// all of them are removed or pushed off the end of the sheet.  As in
+// Excel, a span that the new rows or columns are inserted into grows,
+// and one that loses some of its rows or columns shrinks.
+func (sh referenceShift) span(min, max int) (int, int, bool) {
+	limit := Excel2006MaxRowCount
+	if sh.cols {
+		limit = excel2006MaxColCount
+	}
+	if sh.count > 0 {
+		if min >= sh.index {
+			min += sh.count
+		}
+		if max >= sh.index {
+			max += sh.count
+		}
+		if min >= limit {
+			return 0, 0, false
+		}
+		if max >= limit {
+			max = limit - 1
+		}
+		return min, max, true
+	}
+	removed := -sh.count
+	last := sh.index + removed - 1
+	switch {
+	case max < sh.index:
+		return min, max, true
+	case min > last:
+		return min - removed, max - removed, true
+	case min >= sh.index && max <= last:
+		return 0, 0, false
+	}
+	if min > sh.index {
+		min = sh.index
+	}
+	if max > last {
+		max -= removed
+	} else {
+		max = sh.index - 1
+	}
+	return min, max, true
+}
+
+// move returns where a row or column moves to, and whether it is
+// removed, in which case it moves to the first row or column after
+// those removed.
+func (sh referenceShift) move(i int) (int, bool) {
+	switch {
+	case sh.count > 0 && i >= sh.index, sh.count < 0 && i >= sh.index-sh.count:
+		return i + sh.count, false
+	case sh.count < 0 && i >= sh.index:
+		return sh.index, true
+	}
+	return i, false
+}
+
+// fail notes a formula that can't be parsed.
+func (sh referenceShift) fail(err error) {
+	if sh.err != nil && *sh.err == nil {
+		*sh.err = err
+	}
+}
+
+// area shifts a range of cells, returning false if it is removed.
+func (sh referenceShift) area(minCol, minRow, maxCol, maxRow int) (int, int, int, int, bool) {
+	ok := true
+	if sh.cols {
+		minCol, maxCol, ok = sh.span(minCol, maxCol)
+	} else {
+		minRow, maxRow, ok = sh.span(minRow, maxRow)
+	}
+	return minCol, minRow, maxCol, maxRow, ok
+}
+
+// ref shifts a reference, returning false if its cells are removed.
+// References to whole rows don't change when columns are shifted, nor
+// references to whole columns when rows are.
+func (sh referenceShift) ref(ref FormulaRef) (FormulaRef, bool) {
+	if sh.sheetRemoved {
+		return ref, false
+	}
+	if (sh.cols && ref.WholeRows) || (!sh.cols && ref.WholeColumns) {
+		return ref, true
+	}
+	var ok bool
+	ref.MinCol, ref.MinRow, ref.MaxCol, ref.MaxRow, ok = sh.area(ref.MinCol, ref.MinRow, ref.MaxCol, ref.MaxRow)
+	return ref, ok
+}
+
+// refersToSheet reports whether a reference qualified with sheetName,
+// in a formula on formulaSheet, is to the shifted sheet.  Formulas
+// that aren't on a sheet, such as those of defined names, only refer
+// to it by name.
+func (sh referenceShift) refersToSheet(sheetName string, formulaSheet *Sheet) bool {
+	if sheetName == "" {
+		return formulaSheet == sh.sheet
+	}
+	return strings.EqualFold(sheetName, sh.sheet.Name)
+}
+
+// mayReferToSheet reports whether a formula on formulaSheet could refer
+// to the shifted sheet, so that the formulas of other sheets that don't
+// mention it by name aren't parsed for every shift.
+func (sh referenceShift) mayReferToSheet(formula string, formulaSheet *Sheet) bool {
+	if formulaSheet == sh.sheet {
+		return true
+	}
+	// A quoted sheet name doubles its apostrophes.
+	name := strings.ToLower(strings.Replace(sh.sheet.Name, "'", "''", -1))
+	return strings.Contains(strings.ToLower(formula), name)
+}
+
+// formula returns the formula with its references to the shifted sheet
+// moved along with their cells.  References to cells that are removed
+// become #REF! errors.  A formula that doesn't refer to the shifted
+// cells is returned as it is, as is one that can't be parsed, which is
+// noted.
+func (sh referenceShift) formula(formula string, formulaSheet *Sheet) string {
+	if formula == "" || !sh.mayReferToSheet(formula, formulaSheet) {
+		return formula
+	}
+	node, err := parseFormula(formula, true)
+	if err != nil {
+		sh.fail(err)
+		return formula
+	}
+	changed := false
+	node.Walk(func(n *FormulaNode) bool {
+		// References to other workbooks, and 3-D references to the
+		// same cells on several sheets, stay as they are.
+		if n.Type != FormulaNodeRef || n.Workbook != "" || n.LastSheet != "" || !sh.refersToSheet(n.Sheet, formulaSheet) {
+			return true
+		}
+		ref, ok := sh.ref(n.Ref)
+		switch {
+		case !ok && sh.sheetRemoved:
+			*n = FormulaNode{Type: FormulaNodeError, Text: formulaErrorRef}
+			changed = true
+		case !ok:
+			*n = FormulaNode{Type: FormulaNodeError, Text: formulaErrorRef, Sheet: n.Sheet}
+			changed = true
+		case ref != n.Ref:
+			n.Ref = ref
+			changed = true
+		}
+		return true
+	})
+	if !changed {
+		return formula
+	}
+	if strings.HasPrefix(formula, "=") {
+		return "=" + node.String()
+	}
+	return node.String()
+}
+
+// cells shifts a range of cells such as "A1:C10" on the shifted sheet,
+// returning false if its cells are removed.  A range that can't be
+// parsed is returned as it is.
+func (sh referenceShift) cells(cells string) (string, bool) {
+	ref, err := ParseFormulaRef(cells)
+	if err != nil {
+		return cells, true
+	}
+	shifted, ok := sh.ref(ref)
+	if !ok {
+		return "", false
+	}
+	if shifted == ref {
+		return cells, true
+	}
+	return shifted.String(), true
+}
+
+// sqref shifts a space separated list of ranges, such as the range of
+// a conditional format, leaving out the ranges that are removed.
+func (sh referenceShift) sqref(sqref string) string {
+	var refs []string
+	for _, cells := range strings.Fields(sqref) {
+		if shifted, ok := sh.cells(cells); ok {
+			refs = append(refs, shifted)
+		}
+	}
+	return strings.Join(refs, " ")
+}
+
+// marker moves a corner of a drawing along with the cell it is in.  A
+// corner in a removed row or column moves to the start of the first
+// row or column after them.
+func (sh referenceShift) marker(m *DrawingMarker) {
+	i, offset := &m.Row, &m.RowOffset
+	if sh.cols {
+		i, offset = &m.Col, &m.ColOffset
+	}
+	var removed bool
+	if *i, removed = sh.move(*i); removed {
+		*offset = 0
+	}
+}
+
+// cell moves a single cell, such as the top left cell of a pane, which
+// moves to the first row or column after those removed when it is
+// removed itself.  A cell that can't be parsed is returned as it is.
+func (sh referenceShift) cell(cell string) string {
+	col, row, err := GetCoordsFromCellIDString(cell)
+	if err != nil {
+		return cell
+	}
+	if sh.cols {
+		col, _ = sh.move(col)
+		col = minInt(col, excel2006MaxColCount-1)
+	} else {
+		row, _ = sh.move(row)
+		row = minInt(row, Excel2006MaxRowIndex)
+	}
+	return GetCellIDStringFromCoords(col, row)
+}
+
+// tableColumns adds columns to a table, or removes them, when columns
+// are inserted into it or removed from it.  As in Excel, new columns
+// are named Column1, Column2 and so on.
+func (sh referenceShift) tableColumns(table *Table) {
+	minCol, minRow, maxCol, _, err := getTableBounds(table.Ref)
+	if err != nil || len(table.Columns) != maxCol-minCol+1 {
+		return
+	}
+	if sh.count > 0 {
+		if sh.index <= minCol || sh.index > maxCol {
+			return
+		}
+		for i := 0; i < sh.count; i++ {
+			column := &TableColumn{}
+			for n := 1; column.Name == "" || table.Column(column.Name) != nil; n++ {
+				column.Name = fmt.Sprintf("Column%d", n)
+			}
+			at := sh.index - minCol + i
+			table.Columns = append(table.Columns[:at], append([]*TableColumn{column}, table.Columns[at:]...)...)
+			sh.sheet.Cell(minRow, sh.index+i).SetString(column.Name)
+		}
+		return
+	}
+	first, last := maxInt(sh.index, minCol), minInt(sh.index-sh.count-1, maxCol)
+	if first > last || (first == minCol && last == maxCol) {
+		return
+	}
+	table.Columns = append(table.Columns[:first-minCol], table.Columns[last-minCol+1:]...)
+}
+
+// unmerge splits the merged cells of the sheet, returning the areas
+// that were merged so that they can be merged again once the rows or
+// columns have been shifted.
+func (s *Sheet) unmerge() []mergedArea {
+	var merged []mergedArea
+	for r, row := range s.Rows {
+		if row == nil {
+			continue
+		}
+		for c, cell := range row.Cells {
+			if cell != nil && (cell.HMerge > 0 || cell.VMerge > 0) {
+				merged = append(merged, mergedArea{c, r, c + cell.HMerge, r + cell.VMerge})
+				cell.HMerge, cell.VMerge = 0, 0
+			}
+		}
+	}
+	return merged
+}
+
+// shiftReferences moves everything in the workbook that refers to the
+// cells of the shifted sheet, once its rows or columns have been
+// shifted: the formulas of cells, defined names, data validations,
+// conditional formats and chart series, the ranges of merged cells,
+// tables and the AutoFilter, the anchors of pictures and charts, the
+// panes and selections, and the XML the library doesn't model that
+// refers to cells, such as page breaks, the charts of chartsheets and
+// the sources of pivot caches.  merged are the areas that unmerge
+// returned before the shift.
+//
+// The references of formulas that can't be parsed are left as they
+// are, and the first of them is returned as an error once everything
+// else has been moved.
+func (s *Sheet) shiftReferences(sh referenceShift, merged []mergedArea) error {
+	var err error
+	sh.err = &err
+	for _, area := range merged {
+		minCol, minRow, maxCol, maxRow, ok := sh.area(area.minCol, area.minRow, area.maxCol, area.maxRow)
+		if ok && (maxCol > minCol || maxRow > minRow) {
+			s.Cell(minRow, minCol).Merge(maxCol-minCol, maxRow-minRow)
+		}
+	}
+
+	if s.AutoFilter != nil {
+		ref := s.AutoFilter.TopLeftCell + cellRangeChar + s.AutoFilter.BottomRightCell
+		if shifted, ok := sh.cells(ref); !ok {
+			s.AutoFilter = nil
+		} else if shifted != ref {
+			parts := strings.SplitN(shifted, cellRangeChar, 2)
+			s.AutoFilter.TopLeftCell, s.AutoFilter.BottomRightCell = parts[0], parts[len(parts)-1]
+		}
+	}
+
+	tables := s.Tables[:0]
+	for _, table := range s.Tables {
+		if sh.cols {
+			sh.tableColumns(table)
+		}
+		if ref, ok := sh.cells(table.Ref); ok {
+			table.Ref = ref
+			tables = append(tables, table)
+		}
+	}
+	s.Tables = tables
+
+	links := s.Hyperlinks[:0]
+	for _, link := range s.Hyperlinks {
+		if ref, ok := sh.cells(link.Ref); ok {
+			link.Ref = ref
+			links = append(links, link)
+		}
+	}
+	s.Hyperlinks = links
+
+	for _, picture := range s.Pictures {
+		sh.marker(&picture.Anchor.From)
+		sh.marker(&picture.Anchor.To)
+	}
+	for _, chart := range s.Charts {
+		sh.marker(&chart.Anchor.From)
+		sh.marker(&chart.Anchor.To)
+	}
+	if s.shapes != nil {
+		for i := range s.shapes.anchors {
+			s.shapes.anchors[i].content = sh.rawMarkers(s.shapes.anchors[i].content)
+		}
+	}
+	if d := s.drawing; d != nil {
+		// The copies of the pictures and charts read from the
+		// original drawing move with them, so that it is still
+		// written back when nothing else has changed.
+		for i := range d.readPictures {
+			sh.marker(&d.readPictures[i].Anchor.From)
+			sh.marker(&d.readPictures[i].Anchor.To)
+		}
+		for i := range d.readCharts {
+			sh.marker(&d.readCharts[i].Anchor.From)
+			sh.marker(&d.readCharts[i].Anchor.To)
+		}
+		if s.File != nil && s.File.preserved != nil {
+			if content, ok := s.File.preserved.parts[d.rel.Target]; ok {
+				s.File.preserved.parts[d.rel.Target] = []byte(sh.rawMarkers(string(content)))
+			}
+		}
+	}
+	for _, view := range s.SheetViews {
+		if view.Pane != nil && view.Pane.TopLeftCell != "" {
+			view.Pane.TopLeftCell = sh.cell(view.Pane.TopLeftCell)
+		}
+	}
+	if s.unmodelled != nil {
+		s.unmodelled.shiftRawReferences(sh)
+	}
+
+	if !sh.cols {
+		for _, col := range s.Cols {
+			if col == nil {
+				continue
+			}
+			validations := col.DataValidation[:0]
+			for _, dd := range col.DataValidation {
+				if min, max, ok := sh.span(dd.minRow, dd.maxRow); ok {
+					dd.minRow, dd.maxRow = min, max
+					validations = append(validations, dd)
+				}
+			}
+			col.DataValidation = validations
+		}
+	}
+
+	sheets := []*Sheet{s}
+	if s.File != nil {
+		sheets = s.File.Sheets
+		for _, dn := range s.File.DefinedNames {
+			dn.Data = sh.formula(dn.Data, nil)
+		}
+		if s.File.preserved != nil {
+			s.File.preserved.shiftReferences(sh)
+		}
+	}
+	for _, sheet := range sheets {
+		sheet.shiftFormulas(sh)
+	}
+	return err
+}
+
+// removeSheetReferences turns the references to a sheet that has been
+// removed from the File, in the formulas, defined names, data
+// validations and charts of the sheets that are left, into #REF!
+// errors.  The references of formulas that can't be parsed are left as
+// they are, and the first of them is returned as an error.
+func (f *File) removeSheetReferences(removed *Sheet) error {
+	var err error
+	sh := referenceShift{sheet: removed, sheetRemoved: true, err: &err}
+	for _, dn := range f.DefinedNames {
+		dn.Data = sh.formula(dn.Data, nil)
+	}
+	if f.preserved != nil {
+		f.preserved.shiftReferences(sh)
+	}
+	for _, sheet := range f.Sheets {
+		sheet.shiftFormulas(sh)
+	}
+	return err
+}
+
+// shiftFormulas moves the references of the formulas on the sheet to
+// the cells of the shifted sheet.
+func (s *Sheet) shiftFormulas(sh referenceShift) {
+	validation := func(dd *xlsxCellDataValidation) {
+		if dd != nil {
+			dd.Formula1 = sh.formula(dd.Formula1, s)
+			dd.Formula2 = sh.formula(dd.Formula2, s)
+		}
+	}
+	for _, row := range s.Rows {
+		if row == nil {
+			continue
+		}
+		for _, cell := range row.Cells {
+			if cell == nil {
+				continue
+			}
+			cell.formula = sh.formula(cell.formula, s)
+			validation(cell.DataValidation)
+			if cell.Hyperlink != nil && cell.Hyperlink.Location != "" {
+				cell.Hyperlink.Location = sh.formula(cell.Hyperlink.Location, s)
+			}
+		}
+	}
+	for _, col := range s.Cols {
+		if col != nil {
+			for _, dd := range col.DataValidation {
+				validation(dd)
+			}
+		}
+	}
+	for _, link := range s.Hyperlinks {
+		if link.Location != "" {
+			link.Location = sh.formula(link.Location, s)
+		}
+	}
+	for _, cf := range s.ConditionalFormats {
+		if s == sh.sheet {
+			cf.Ref = sh.sqref(cf.Ref)
+		}
+		for _, rule := range cf.Rules {
+			for i, formula := range rule.Formulas {
+				rule.Formulas[i] = sh.formula(formula, s)
+			}
+		}
+	}
+	if s == sh.sheet {
+		formats := s.ConditionalFormats[:0]
+		for _, cf := range s.ConditionalFormats {
+			if cf.Ref != "" {
+				formats = append(formats, cf)
+			}
+		}
+		s.ConditionalFormats = formats
+	}
+	for _, chart := range s.Charts {
+		sh.chartSeries(chart, s)
+	}
+	if s.unmodelled != nil && s.unmodelled.ExtLst != nil {
+		s.unmodelled.ExtLst.Content = sh.extLst(s.unmodelled.ExtLst.Content, s)
+	}
+}
+
+// chartSeries moves the references of the series of a chart on the
+// sheet, along with those of the chart as it was read and of the XML
+// it was read from, so that it is still written back as it was read.
+func (sh referenceShift) chartSeries(chart *Chart, s *Sheet) {
+	shift := func(series []*ChartSeries) {
+		for _, series := range series {
+			series.NameRef = sh.formula(series.NameRef, s)
+			series.Categories = sh.formula(series.Categories, s)
+			series.Values = sh.formula(series.Values, s)
+		}
+	}
+	shift(chart.Series)
+	if chart.read != nil {
+		shift(chart.read.Series)
+		chart.original = sh.rawFormulas(chart.original, s)
+		chart.read.original = chart.original
+	}
+}
+
+// extURIDataValidations is the URI of the extension of a worksheet that
+// holds the Excel 2010 data validations, whose lists come from other
+// sheets.
+const extURIDataValidations = "{CCE6A557-97BC-4b89-ADB6-D9C93CAAB3DF}"
+
+const contentTypePivotCacheDefinition = "application/vnd.openxmlformats-officedocument.spreadsheetml.pivotCacheDefinition+xml"
+
+// These match the parts of the raw XML that refer to cells.  The
+// regular expressions of attributes and of elements with text have the
+// value as their second group of three.
+var (
+	rawIDAttr         = regexp.MustCompile(`(\sid=")([^"]*)(")`)
+	rawRefAttr        = regexp.MustCompile(`(\sref=")([^"]*)(")`)
+	rawSheetAttr      = regexp.MustCompile(`(\ssheet=")([^"]*)(")`)
+	rawSqrefAttr      = regexp.MustCompile(`(\ssqref=")([^"]*)(")`)
+	rawCountAttr      = regexp.MustCompile(`(\scount=")([^"]*)(")`)
+	rawSqrefElement   = regexp.MustCompile(`(<(?:\w+:)?sqref>)([^<]*)(</(?:\w+:)?sqref>)`)
+	rawFormulaElement = regexp.MustCompile(`(<(?:\w+:)?f>)([^<]*)(</(?:\w+:)?f>)`)
+	rawBreaks         = rawElementsNamed("brk")
+	rawProtectedRange = rawElementsNamed("protectedRange")
+	rawIgnoredError   = rawElementsNamed("ignoredError")
+	rawDataValidation = rawElementsNamed("dataValidation")
+	rawValidations    = regexp.MustCompile(`(?s)(<(?:\w+:)?dataValidations\b[^>]*>)(.*)(</(?:\w+:)?dataValidations>)`)
+	rawWorksheetSrc   = regexp.MustCompile(`<(?:\w+:)?worksheetSource\b[^>]*>`)
+	rawMarker         = regexp.MustCompile(`(?s)<(?:\w+:)?(?:from|to)>.*?</(?:\w+:)?(?:from|to)>`)
+	rawMarkerCol      = regexp.MustCompile(`(<(?:\w+:)?col>)([^<]*)(</(?:\w+:)?col>)`)
+	rawMarkerColOff   = regexp.MustCompile(`(<(?:\w+:)?colOff>)([^<]*)(</(?:\w+:)?colOff>)`)
+	rawMarkerRow      = regexp.MustCompile(`(<(?:\w+:)?row>)([^<]*)(</(?:\w+:)?row>)`)
+	rawMarkerRowOff   = regexp.MustCompile(`(<(?:\w+:)?rowOff>)([^<]*)(</(?:\w+:)?rowOff>)`)
+)
+
+// rawElementsNamed returns the regular expression that matches the
+// elements of raw XML with the local name, which mustn't nest.
+func rawElementsNamed(name string) *regexp.Regexp {
+	return regexp.MustCompile(`(?s)<(?:\w+:)?` + name + `\b[^>]*?(?:/>|>.*?</(?:\w+:)?` + name + `>)`)
+}
+
+// replaceRawValues replaces the values of the matches of re, which are
+// its second group of three, with what fn returns for them.
+func replaceRawValues(re *regexp.Regexp, content string, fn func(value string) string) string {
+	return re.ReplaceAllStringFunc(content, func(match string) string {
+		m := re.FindStringSubmatch(match)
+		return m[1] + fn(m[2]) + m[3]
+	})
+}
+
+// unescapeRawText returns the text that raw XML escapes.
+func unescapeRawText(s string) string {
+	if !strings.Contains(s, "&") {
+		return s
+	}
+	var text struct {
+		Value string `xml:",chardata"`
+	}
+	if err := xml.Unmarshal([]byte("<t>"+s+"</t>"), &text); err != nil {
+		return s
+	}
+	return text.Value
+}
+
+func escapeRawText(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// rawFormulas moves the references of the formulas in the f elements of
+// raw XML, such as the series of a chart.
+func (sh referenceShift) rawFormulas(content string, formulaSheet *Sheet) string {
+	return replaceRawValues(rawFormulaElement, content, func(text string) string {
+		formula := unescapeRawText(text)
+		if shifted := sh.formula(formula, formulaSheet); shifted != formula {
+			return escapeRawText(shifted)
+		}
+		return text
+	})
+}
+
+// rawMarkers moves the corners of the anchors of a drawing part as
+// marker moves those of the pictures and charts of a sheet.
+func (sh referenceShift) rawMarkers(content string) string {
+	index, offset := rawMarkerRow, rawMarkerRowOff
+	if sh.cols {
+		index, offset = rawMarkerCol, rawMarkerColOff
+	}
+	return rawMarker.ReplaceAllStringFunc(content, func(marker string) string {
+		removed := false
+		marker = replaceRawValues(index, marker, func(value string) string {
+			i, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return value
+			}
+			i, removed = sh.move(i)
+			return strconv.Itoa(i)
+		})
+		if removed {
+			marker = replaceRawValues(offset, marker, func(string) string { return "0" })
+		}
+		return marker
+	})
+}
+
+// rawSqrefs moves the ranges of the elements of raw XML that re
+// matches, which are in their sqref attribute or sqref element, and
+// drops the elements whose ranges are all removed.  It returns how many
+// elements are left.
+func (sh referenceShift) rawSqrefs(content string, re *regexp.Regexp) (string, int) {
+	left := 0
+	content = re.ReplaceAllStringFunc(content, func(element string) string {
+		removed := false
+		shift := func(sqref string) string {
+			shifted := sh.sqref(sqref)
+			removed = removed || shifted == ""
+			return shifted
+		}
+		element = replaceRawValues(rawSqrefAttr, element, shift)
+		element = replaceRawValues(rawSqrefElement, element, shift)
+		if removed {
+			return ""
+		}
+		left++
+		return element
+	})
+	return content, left
+}
+
+// breaks moves the page breaks of a rowBreaks or colBreaks element,
+// each of which comes before the row or column of its id.  Breaks that
+// end up in the same place as another, or off the end of the sheet,
+// are dropped.
+func (sh referenceShift) breaks(e *xlsxRawElement) {
+	limit := Excel2006MaxRowCount
+	if sh.cols {
+		limit = excel2006MaxColCount
+	}
+	seen := make(map[int]bool)
+	count, manual := 0, 0
+	e.Content = rawBreaks.ReplaceAllStringFunc(e.Content, func(brk string) string {
+		m := rawIDAttr.FindStringSubmatch(brk)
+		if m == nil {
+			return brk
+		}
+		id, err := strconv.Atoi(m[2])
+		if err != nil {
+			return brk
+		}
+		if id, _ = sh.move(id); id >= limit || seen[id] {
+			return ""
+		}
+		seen[id] = true
+		count++
+		if strings.Contains(brk, ` man="1"`) || strings.Contains(brk, ` man="true"`) {
+			manual++
+		}
+		return strings.Replace(brk, m[0], m[1]+strconv.Itoa(id)+m[3], 1)
+	})
+	for i, attr := range e.Attrs {
+		switch attr.Name.Local {
+		case "count":
+			e.Attrs[i].Value = strconv.Itoa(count)
+		case "manualBreakCount":
+			e.Attrs[i].Value = strconv.Itoa(manual)
+		}
+	}
+}
+
+// shiftRawReferences moves the references to cells in the XML of the
+// shifted sheet that the library doesn't model, dropping the elements
+// whose cells are all removed.
+func (w *xlsxWorksheet) shiftRawReferences(sh referenceShift) {
+	breaks := w.RowBreaks
+	if sh.cols {
+		breaks = w.ColBreaks
+	}
+	if breaks != nil {
+		sh.breaks(breaks)
+	}
+	for _, raw := range []struct {
+		e  **xlsxRawElement
+		re *regexp.Regexp
+	}{{&w.ProtectedRanges, rawProtectedRange}, {&w.IgnoredErrors, rawIgnoredError}} {
+		if *raw.e == nil {
+			continue
+		}
+		content, left := sh.rawSqrefs((*raw.e).Content, raw.re)
+		if left == 0 {
+			*raw.e = nil
+		} else {
+			(*raw.e).Content = content
+		}
+	}
+	for i := range w.SheetViews.SheetView {
+		selections := w.SheetViews.SheetView[i].Selection
+		for j := range selections {
+			if selections[j].ActiveCell != "" {
+				selections[j].ActiveCell = sh.cell(selections[j].ActiveCell)
+			}
+			if sqref := sh.sqref(selections[j].SQRef); sqref != "" {
+				selections[j].SQRef = sqref
+			} else {
+				selections[j].SQRef = selections[j].ActiveCell
+			}
+		}
+	}
+}
+
+// extLst moves the references of the Excel 2010 data validations and
+// conditional formattings in the raw extLst of a sheet: their formulas
+// and, on the shifted sheet, their ranges.
+func (sh referenceShift) extLst(content string, sheet *Sheet) string {
+	exts, err := splitExtLst(content)
+	if err != nil {
+		return content
+	}
+	var b strings.Builder
+	for _, ext := range exts {
+		switch ext.uri {
+		case extURIConditionalFormattings:
+			ext.content = sh.rawFormulas(ext.content, sheet)
+			if sheet == sh.sheet {
+				var left int
+				if ext.content, left = sh.rawSqrefs(ext.content, rawX14ConditionalFormatting); left == 0 {
+					continue
+				}
+			}
+		case extURIDataValidations:
+			ext.content = sh.rawFormulas(ext.content, sheet)
+			if sheet == sh.sheet {
+				dropped := false
+				ext.content = rawValidations.ReplaceAllStringFunc(ext.content, func(validations string) string {
+					m := rawValidations.FindStringSubmatch(validations)
+					inner, left := sh.rawSqrefs(m[2], rawDataValidation)
+					if left == 0 {
+						dropped = true
+						return ""
+					}
+					start := replaceRawValues(rawCountAttr, m[1], func(string) string { return strconv.Itoa(left) })
+					return start + inner + m[3]
+				})
+				if dropped {
+					continue
+				}
+			}
+		}
+		b.WriteString(ext.content)
+	}
+	return b.String()
+}
+
+// shiftReferences moves the references to cells in the preserved parts
+// that refer to them: the series of charts, such as those of
+// chartsheets, and the ranges that pivot caches are made from.
+func (p *preservedParts) shiftReferences(sh referenceShift) {
+	for name, content := range p.parts {
+		switch p.overrides[name] {
+		case contentTypeChart:
+			p.parts[name] = []byte(sh.rawFormulas(string(content), nil))
+		case contentTypePivotCacheDefinition:
+			shifted := rawWorksheetSrc.ReplaceAllStringFunc(string(content), func(source string) string {
+				sheet := rawSheetAttr.FindStringSubmatch(source)
+				if sheet == nil || !strings.EqualFold(unescapeRawText(sheet[2]), sh.sheet.Name) {
+					return source
+				}
+				return replaceRawValues(rawRefAttr, source, func(ref string) string {
+					if shifted, ok := sh.cells(ref); ok {
+						return shifted
+					}
+					return ref
+				})
+			})
+			p.parts[name] = []byte(shifted)
+		}
+	}
+}
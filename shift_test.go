@@ -0,0 +1,377 @@
+package xlsx
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type ShiftSuite struct{}
+
+var _ = Suite(&ShiftSuite{})
+
+func (s *ShiftSuite) TestSpan(c *C) {
+	insert := referenceShift{index: 4, count: 2}
+	remove := referenceShift{index: 4, count: -2}
+	for _, t := range []struct {
+		shift          referenceShift
+		min, max       int
+		expMin, expMax int
+		expOK          bool
+	}{
+		{insert, 0, 3, 0, 3, true},
+		{insert, 4, 6, 6, 8, true},
+		{insert, 2, 4, 2, 6, true},
+		{insert, 2, Excel2006MaxRowIndex, 2, Excel2006MaxRowIndex, true},
+		{insert, Excel2006MaxRowIndex, Excel2006MaxRowIndex, 0, 0, false},
+		{remove, 0, 3, 0, 3, true},
+		{remove, 6, 8, 4, 6, true},
+		{remove, 4, 5, 0, 0, false},
+		{remove, 2, 4, 2, 3, true},
+		{remove, 5, 9, 4, 7, true},
+		{remove, 2, 9, 2, 7, true},
+	} {
+		min, max, ok := t.shift.span(t.min, t.max)
+		c.Check([]interface{}{min, max, ok}, DeepEquals, []interface{}{t.expMin, t.expMax, t.expOK},
+			Commentf("%+v %d:%d", t.shift, t.min, t.max))
+	}
+}
+
+func (s *ShiftSuite) TestFormula(c *C) {
+	f := NewFile()
+	data, err := f.AddSheet("Data")
+	c.Assert(err, IsNil)
+	other, err := f.AddSheet("Other Sheet")
+	c.Assert(err, IsNil)
+	remove := referenceShift{sheet: data, index: 2, count: -1}
+	for formula, expected := range map[string]string{
+		"A1+A4":               "A1+A3",
+		"SUM($A$1:$A$10)":     "SUM($A$1:$A$9)",
+		"A4 + A5":             "A3+A4",
+		"A1 + A2":             "A1 + A2",
+		"B3*2":                "#REF!*2",
+		"SUM(A:A)+SUM(4:5)":   "SUM(A:A)+SUM(3:4)",
+		"'Other Sheet'!A5+A5": "'Other Sheet'!A5+A4",
+		`"A5"&Unknown(`:       `"A5"&Unknown(`,
+		"=Data!A5":            "=Data!A4",
+	} {
+		c.Check(remove.formula(formula, data), Equals, expected, Commentf(formula))
+	}
+	c.Assert(remove.formula("A5+Data!A5", other), Equals, "A5+Data!A4")
+	c.Assert(remove.formula("Data!$B$3", nil), Equals, "Data!#REF!")
+	c.Assert(remove.formula("A5", nil), Equals, "A5")
+	c.Assert(remove.formula("[1]Data!A5+Data:Other!A5+SUM(A5:A9 A5)", data), Equals, "[1]Data!A5+Data:Other!A5+SUM(A4:A8 A4)")
+	c.Assert(remove.formula("Data!$A$5,Data!$1:$1", nil), Equals, "Data!$A$4,Data!$1:$1")
+
+	// A formula that can't be parsed is noted.
+	var parseErr error
+	remove.err = &parseErr
+	c.Assert(remove.formula("A5+", data), Equals, "A5+")
+	c.Assert(remove.formula("A5+)", data), Equals, "A5+)")
+	c.Assert(parseErr, ErrorMatches, `unexpected end of formula "A5\+"`)
+}
+
+// Inserting and removing rows moves every reference to the cells below
+// them, as Excel does.
+func (s *ShiftSuite) TestAddAndRemoveRows(c *C) {
+	f := NewFile()
+	sheet, err := f.AddSheet("Data")
+	c.Assert(err, IsNil)
+	summary, err := f.AddSheet("Summary")
+	c.Assert(err, IsNil)
+	for i := 0; i < 6; i++ {
+		sheet.Cell(i, 0).SetInt(i + 1)
+	}
+	sheet.Cell(6, 0).SetFormula("SUM(A1:A6)")
+	sheet.Cell(2, 1).Merge(1, 1)
+	sheet.Cell(2, 1).SetFormula("A4*2")
+	sheet.AutoFilter = &AutoFilter{TopLeftCell: "A1", BottomRightCell: "B6"}
+	summary.Cell(0, 0).SetFormula("Data!A7")
+	summary.Cell(1, 0).SetFormula("Data!A2")
+	c.Assert(f.AddDefinedName("Values", "Data!$A$1:$A$6", nil), IsNil)
+	c.Assert(f.AddDefinedName("Fourth", "Data!$A$4", nil), IsNil)
+	dd := NewXlsxCellDataValidation(true)
+	c.Assert(dd.SetInFileList("Data", 0, 0, 0, 5), IsNil)
+	summary.Cell(2, 0).SetDataValidation(dd)
+	cf, err := sheet.AddConditionalFormat("A1:A6 C4", NewExpressionRule("A1>A$6", nil))
+	c.Assert(err, IsNil)
+	table, err := sheet.AddTable("D3:E6", "Things", []string{"Name", "Count"}, "")
+	c.Assert(err, IsNil)
+	sheet.Col(0).SetDataValidation(NewXlsxCellDataValidation(true), 4, 5)
+
+	_, err = sheet.AddRowAtIndex(1)
+	c.Assert(err, IsNil)
+	c.Assert(sheet.Cell(7, 0).Formula(), Equals, "SUM(A1:A7)")
+	c.Assert(sheet.Cell(3, 1).Formula(), Equals, "A5*2")
+	c.Assert(sheet.Cell(3, 1).HMerge, Equals, 1)
+	c.Assert(sheet.Cell(3, 1).VMerge, Equals, 1)
+	c.Assert(sheet.Cell(2, 1).VMerge, Equals, 0)
+	c.Assert(*sheet.AutoFilter, Equals, AutoFilter{TopLeftCell: "A1", BottomRightCell: "B7"})
+	c.Assert(summary.Cell(0, 0).Formula(), Equals, "Data!A8")
+	c.Assert(summary.Cell(1, 0).Formula(), Equals, "Data!A3")
+	c.Assert(f.DefinedNames[0].Data, Equals, "Data!$A$1:$A$7")
+	c.Assert(f.DefinedNames[1].Data, Equals, "Data!$A$5")
+	c.Assert(dd.Formula1, Equals, "Data!$A$1:$A$7")
+	c.Assert(cf.Ref, Equals, "A1:A7 C5")
+	c.Assert(cf.Rules[0].Formulas, DeepEquals, []string{"A1>A$7"})
+	c.Assert(table.Ref, Equals, "D4:E7")
+	c.Assert(sheet.Col(0).DataValidation[0].minRow, Equals, 6)
+
+	// Removing the merged row shrinks the merge, and references to the
+	// removed row become errors.
+	c.Assert(sheet.RemoveRowAtIndex(4), IsNil)
+	c.Assert(sheet.Cell(6, 0).Formula(), Equals, "SUM(A1:A6)")
+	c.Assert(sheet.Cell(3, 1).Formula(), Equals, "#REF!*2")
+	c.Assert(sheet.Cell(3, 1).HMerge, Equals, 1)
+	c.Assert(sheet.Cell(3, 1).VMerge, Equals, 0)
+	c.Assert(f.DefinedNames[1].Data, Equals, "Data!#REF!")
+	c.Assert(summary.Cell(0, 0).Formula(), Equals, "Data!A7")
+	c.Assert(cf.Ref, Equals, "A1:A6")
+	c.Assert(table.Ref, Equals, "D4:E6")
+
+	// Removing the top row of a merge moves the merge to the row below.
+	sheet.Cell(0, 2).Merge(0, 2)
+	c.Assert(sheet.RemoveRowAtIndex(0), IsNil)
+	c.Assert(sheet.Cell(0, 2).VMerge, Equals, 1)
+	c.Assert(*sheet.AutoFilter, Equals, AutoFilter{TopLeftCell: "A1", BottomRightCell: "B5"})
+	c.Assert(summary.Cell(1, 0).Formula(), Equals, "Data!A2")
+}
+
+// Inserting and removing columns moves the cells of every row and the
+// column definitions, along with every reference to them.
+func (s *ShiftSuite) TestInsertAndRemoveCols(c *C) {
+	f := NewFile()
+	sheet, err := f.AddSheet("Data")
+	c.Assert(err, IsNil)
+	for i, value := range []string{"a", "b", "c", "d"} {
+		sheet.Cell(0, i).SetString(value)
+		sheet.Cell(1, i).SetInt(i + 1)
+	}
+	sheet.Cell(2, 0).SetFormula("SUM(A2:D2)")
+	sheet.Cell(2, 1).SetFormula("$C$2*2")
+	sheet.Cell(3, 0).Merge(2, 0)
+	c.Assert(sheet.SetColWidth(2, 2, 20), IsNil)
+	sheet.Col(2).Hidden = true
+	sheet.Col(2).OutlineLevel = 1
+	dd := NewXlsxCellDataValidation(true)
+	sheet.Col(3).SetDataValidation(dd, 1, 5)
+	table, err := sheet.AddTable("A5:C6", "Things", []string{"Name", "Count", "Column1"}, "")
+	c.Assert(err, IsNil)
+
+	col, err := sheet.InsertColAtIndex(1)
+	c.Assert(err, IsNil)
+	c.Assert(sheet.Col(1), Equals, col)
+	c.Assert(sheet.MaxCol, Equals, 5)
+	c.Assert(sheet.Cell(0, 1).Value, Equals, "")
+	c.Assert(sheet.Cell(0, 2).Value, Equals, "b")
+	c.Assert(sheet.Cell(1, 4).Value, Equals, "4")
+	c.Assert(sheet.Cell(2, 0).Formula(), Equals, "SUM(A2:E2)")
+	c.Assert(sheet.Cell(2, 2).Formula(), Equals, "$D$2*2")
+	c.Assert(sheet.Cell(3, 0).HMerge, Equals, 3)
+	c.Assert(sheet.Col(3).Width, Equals, 20.0)
+	c.Assert(sheet.Col(3).Hidden, Equals, true)
+	c.Assert(sheet.Col(3).OutlineLevel, Equals, uint8(1))
+	c.Assert(sheet.Col(3).Min, Equals, 4)
+	c.Assert(sheet.Col(3).Max, Equals, 4)
+	c.Assert(sheet.Col(4).DataValidation, DeepEquals, []*xlsxCellDataValidation{dd})
+	c.Assert(table.Ref, Equals, "A5:D6")
+	c.Assert(table.Columns, HasLen, 4)
+	c.Assert(table.Columns[1].Name, Equals, "Column2")
+	c.Assert(sheet.Cell(4, 1).Value, Equals, "Column2")
+
+	c.Assert(sheet.RemoveColAtIndex(3), IsNil)
+	c.Assert(sheet.MaxCol, Equals, 4)
+	c.Assert(sheet.Cell(0, 3).Value, Equals, "d")
+	c.Assert(sheet.Cell(2, 0).Formula(), Equals, "SUM(A2:D2)")
+	c.Assert(sheet.Cell(2, 2).Formula(), Equals, "#REF!*2")
+	c.Assert(sheet.Cell(3, 0).HMerge, Equals, 2)
+	c.Assert(sheet.Col(3).DataValidation, DeepEquals, []*xlsxCellDataValidation{dd})
+	c.Assert(sheet.Col(3).Min, Equals, 4)
+	c.Assert(table.Ref, Equals, "A5:C6")
+	c.Assert(table.Columns[2].Name, Equals, "Count")
+
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), IsNil)
+	read, err := OpenBinary(buf.Bytes())
+	c.Assert(err, IsNil)
+	c.Assert(read.Sheet["Data"].Cell(0, 3).Value, Equals, "d")
+	c.Assert(read.Sheet["Data"].Cols[3].DataValidation, HasLen, 1)
+
+	_, err = sheet.InsertColAtIndex(5)
+	c.Assert(err, NotNil)
+	c.Assert(sheet.RemoveColAtIndex(4), NotNil)
+}
+
+// A column definition that spans several columns moves past the
+// inserted or removed columns, and grows or shrinks when they fall
+// inside it.
+func (s *ShiftSuite) TestInsertAndRemoveColsInSpan(c *C) {
+	f := NewFile()
+	sheet, err := f.AddSheet("Data")
+	c.Assert(err, IsNil)
+	for i := 0; i < 5; i++ {
+		sheet.Cell(0, i).SetInt(i)
+	}
+	for i := 2; i < 5; i++ {
+		col := sheet.Col(i)
+		col.Min, col.Max = 3, excel2006MaxColCount
+		col.Hidden = true
+	}
+
+	_, err = sheet.InsertColAtIndex(0)
+	c.Assert(err, IsNil)
+	c.Assert(sheet.Col(0).Min, Equals, 1)
+	c.Assert(sheet.Col(0).Max, Equals, 1)
+	c.Assert(sheet.Col(2).Min, Equals, 3)
+	c.Assert(sheet.Col(2).Max, Equals, 3)
+	for i := 3; i < 6; i++ {
+		c.Assert(sheet.Col(i).Min, Equals, 4)
+		c.Assert(sheet.Col(i).Max, Equals, excel2006MaxColCount)
+	}
+
+	_, err = sheet.InsertColAtIndex(4)
+	c.Assert(err, IsNil)
+	c.Assert(sheet.Col(3).Min, Equals, 4)
+	c.Assert(sheet.Col(3).Max, Equals, 4)
+	c.Assert(sheet.Col(4).Min, Equals, 5)
+	c.Assert(sheet.Col(4).Max, Equals, 5)
+	c.Assert(sheet.Col(4).Hidden, Equals, false)
+	for _, i := range []int{5, 6} {
+		c.Assert(sheet.Col(i).Min, Equals, 6)
+		c.Assert(sheet.Col(i).Max, Equals, excel2006MaxColCount)
+	}
+
+	c.Assert(sheet.RemoveColAtIndex(4), IsNil)
+	c.Assert(sheet.RemoveColAtIndex(5), IsNil)
+	c.Assert(sheet.Col(3).Min, Equals, 4)
+	c.Assert(sheet.Col(3).Max, Equals, 4)
+	c.Assert(sheet.Col(4).Min, Equals, 5)
+	c.Assert(sheet.Col(4).Max, Equals, excel2006MaxColCount-2)
+
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), IsNil)
+	read, err := OpenBinary(buf.Bytes())
+	c.Assert(err, IsNil)
+	col := read.Sheet["Data"].Cols[4]
+	c.Assert(col.Min, Equals, 5)
+	c.Assert(col.Max, Equals, excel2006MaxColCount-2)
+	c.Assert(col.Hidden, Equals, true)
+}
+
+// The references to cells in the XML that the library doesn't model
+// move too: page breaks, protected ranges, ignored errors, selections,
+// Excel 2010 data validations, the charts of chartsheets and the
+// sources of pivot caches.
+func (s *ShiftSuite) TestShiftRawXML(c *C) {
+	f := NewFile()
+	sheet, err := f.AddSheet("Data")
+	c.Assert(err, IsNil)
+	other, err := f.AddSheet("Lists")
+	c.Assert(err, IsNil)
+	sheet.SheetViews = []SheetView{{Pane: &Pane{YSplit: 2, TopLeftCell: "A6", ActivePane: "bottomLeft", State: "frozen"}}}
+	sheet.unmodelled = &xlsxWorksheet{
+		RowBreaks: &xlsxRawElement{
+			Attrs:   []xml.Attr{{Name: xml.Name{Local: "count"}, Value: "3"}, {Name: xml.Name{Local: "manualBreakCount"}, Value: "3"}},
+			Content: `<brk id="2" max="16383" man="1"/><brk id="3" max="16383" man="1"/><brk id="8" max="16383" man="1"/>`,
+		},
+		ProtectedRanges: &xlsxRawElement{Content: `<protectedRange sqref="C3" name="One"/><protectedRange sqref="A1:B6" name="Two"/>`},
+		IgnoredErrors:   &xlsxRawElement{Content: `<ignoredError sqref="C3" numberStoredAsText="1"/>`},
+		ExtLst: &xlsxInnerXML{Content: `<ext uri="{CCE6A557-97BC-4b89-ADB6-D9C93CAAB3DF}" xmlns:x14="http://schemas.microsoft.com/office/spreadsheetml/2009/9/main">` +
+			`<x14:dataValidations count="2" xmlns:xm="http://schemas.microsoft.com/office/excel/2006/main">` +
+			`<x14:dataValidation type="list"><x14:formula1><xm:f>Lists!$A$1:$A$5</xm:f></x14:formula1><xm:sqref>C3</xm:sqref></x14:dataValidation>` +
+			`<x14:dataValidation type="list"><x14:formula1><xm:f>Data!$E$4:$E$9</xm:f></x14:formula1><xm:sqref>D4:D9</xm:sqref></x14:dataValidation>` +
+			`</x14:dataValidations></ext>`},
+	}
+	sheet.unmodelled.SheetViews.SheetView = []xlsxSheetView{{Selection: []xlsxSelection{{Pane: "bottomLeft", ActiveCell: "B7", SQRef: "B7:C8"}}}}
+	other.unmodelled = &xlsxWorksheet{ExtLst: &xlsxInnerXML{Content: `<ext uri="{CCE6A557-97BC-4b89-ADB6-D9C93CAAB3DF}"><x14:dataValidations count="1">` +
+		`<x14:dataValidation type="list"><x14:formula1><xm:f>Data!$E$4:$E$9&amp;""</xm:f></x14:formula1><xm:sqref>C3</xm:sqref></x14:dataValidation>` +
+		`</x14:dataValidations></ext>`}}
+	f.preserved = &preservedParts{
+		parts: map[string][]byte{
+			"xl/charts/chart1.xml":                    []byte(`<c:chartSpace><c:ser><c:tx><c:strRef><c:f>Data!$B$3</c:f></c:strRef></c:tx><c:val><c:numRef><c:f>Data!$B$4:$B$9</c:f></c:numRef></c:val></c:ser></c:chartSpace>`),
+			"xl/pivotCache/pivotCacheDefinition1.xml": []byte(`<pivotCacheDefinition><cacheSource type="worksheet"><worksheetSource ref="A3:E9" sheet="Data"/></cacheSource></pivotCacheDefinition>`),
+			"xl/pivotCache/pivotCacheDefinition2.xml": []byte(`<pivotCacheDefinition><cacheSource type="worksheet"><worksheetSource ref="A3:E9" sheet="Lists"/></cacheSource></pivotCacheDefinition>`),
+		},
+		overrides: map[string]string{
+			"xl/charts/chart1.xml":                    contentTypeChart,
+			"xl/pivotCache/pivotCacheDefinition1.xml": contentTypePivotCacheDefinition,
+			"xl/pivotCache/pivotCacheDefinition2.xml": contentTypePivotCacheDefinition,
+		},
+	}
+	sheet.Cell(9, 0).SetFormula("SUM(A1")
+	sheet.Cell(9, 1).SetFormula("B4")
+
+	// The row being removed takes the cells that are only in it with
+	// it, and the formula that can't be parsed is reported.
+	err = sheet.RemoveRowAtIndex(2)
+	c.Assert(err, ErrorMatches, `unexpected end of formula "SUM\(A1"`)
+	c.Assert(sheet.Cell(8, 1).Formula(), Equals, "B3")
+	w := sheet.unmodelled
+	c.Assert(w.RowBreaks.Content, Equals, `<brk id="2" max="16383" man="1"/><brk id="7" max="16383" man="1"/>`)
+	c.Assert(w.RowBreaks.Attrs[0].Value, Equals, "2")
+	c.Assert(w.RowBreaks.Attrs[1].Value, Equals, "2")
+	c.Assert(w.ProtectedRanges.Content, Equals, `<protectedRange sqref="A1:B5" name="Two"/>`)
+	c.Assert(w.IgnoredErrors, IsNil)
+	c.Assert(w.SheetViews.SheetView[0].Selection[0], Equals, xlsxSelection{Pane: "bottomLeft", ActiveCell: "B6", SQRef: "B6:C7"})
+	c.Assert(sheet.SheetViews[0].Pane.TopLeftCell, Equals, "A5")
+	c.Assert(w.ExtLst.Content, Equals, `<ext uri="{CCE6A557-97BC-4b89-ADB6-D9C93CAAB3DF}" xmlns:x14="http://schemas.microsoft.com/office/spreadsheetml/2009/9/main">`+
+		`<x14:dataValidations count="1" xmlns:xm="http://schemas.microsoft.com/office/excel/2006/main">`+
+		`<x14:dataValidation type="list"><x14:formula1><xm:f>Data!$E$3:$E$8</xm:f></x14:formula1><xm:sqref>D3:D8</xm:sqref></x14:dataValidation>`+
+		`</x14:dataValidations></ext>`)
+	c.Assert(strings.Contains(other.unmodelled.ExtLst.Content, `<xm:f>Data!$E$3:$E$8&amp;&#34;&#34;</xm:f></x14:formula1><xm:sqref>C3</xm:sqref>`), Equals, true, Commentf(other.unmodelled.ExtLst.Content))
+	c.Assert(string(f.preserved.parts["xl/charts/chart1.xml"]), Equals, `<c:chartSpace><c:ser><c:tx><c:strRef><c:f>Data!#REF!</c:f></c:strRef></c:tx><c:val><c:numRef><c:f>Data!$B$3:$B$8</c:f></c:numRef></c:val></c:ser></c:chartSpace>`)
+	c.Assert(string(f.preserved.parts["xl/pivotCache/pivotCacheDefinition1.xml"]), Equals, `<pivotCacheDefinition><cacheSource type="worksheet"><worksheetSource ref="A3:E8" sheet="Data"/></cacheSource></pivotCacheDefinition>`)
+	c.Assert(string(f.preserved.parts["xl/pivotCache/pivotCacheDefinition2.xml"]), Equals, `<pivotCacheDefinition><cacheSource type="worksheet"><worksheetSource ref="A3:E9" sheet="Lists"/></cacheSource></pivotCacheDefinition>`)
+
+	// Columns move the column breaks and leave the row breaks alone.
+	w.ColBreaks = &xlsxRawElement{Content: `<brk id="3" max="1048575"/>`}
+	_, err = sheet.InsertColAtIndex(1)
+	c.Assert(err, NotNil)
+	c.Assert(w.ColBreaks.Content, Equals, `<brk id="4" max="1048575"/>`)
+	c.Assert(w.RowBreaks.Content, Equals, `<brk id="2" max="16383" man="1"/><brk id="7" max="16383" man="1"/>`)
+	c.Assert(w.ProtectedRanges.Content, Equals, `<protectedRange sqref="A1:C5" name="Two"/>`)
+}
+
+// The formulas of other sheets move when they name the shifted sheet,
+// however it is quoted or cased, and are left alone when they don't.
+func (s *ShiftSuite) TestShiftOtherSheets(c *C) {
+	f := NewFile()
+	data, err := f.AddSheet("It's data")
+	c.Assert(err, IsNil)
+	other, err := f.AddSheet("Other")
+	c.Assert(err, IsNil)
+	data.Cell(4, 0).SetInt(1)
+	other.Cell(0, 0).SetFormula("'it''s DATA'!A5+A5")
+	other.Cell(0, 1).SetFormula("A5*2")
+
+	_, err = data.AddRowAtIndex(0)
+	c.Assert(err, IsNil)
+	c.Assert(other.Cell(0, 0).Formula(), Equals, "'it''s DATA'!A6+A5")
+	c.Assert(other.Cell(0, 1).Formula(), Equals, "A5*2")
+}
+
+// Inserting rows only parses the formulas that could refer to the
+// sheet, which leaves out those of the other sheets that don't name
+// it.
+func (s *ShiftSuite) BenchmarkAddRowAtIndex(c *C) {
+	f := NewFile()
+	for _, name := range []string{"Data", "Other", "More"} {
+		sheet, err := f.AddSheet(name)
+		c.Assert(err, IsNil)
+		for row := 0; row < 200; row++ {
+			for col := 0; col < 10; col++ {
+				sheet.Cell(row, col).SetFormula("SUM(A1:A10)*2+B3")
+			}
+		}
+	}
+	f.Sheet["Other"].Cell(0, 0).SetFormula("Data!A1+1")
+	sheet := f.Sheet["Data"]
+	c.ResetTimer()
+	for i := 0; i < c.N; i++ {
+		_, err := sheet.AddRowAtIndex(1)
+		c.Assert(err, IsNil)
+		c.Assert(sheet.RemoveRowAtIndex(1), IsNil)
+	}
+}
@@ -0,0 +1,543 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// StreamReader is the reading counterpart of StreamFile.  Rather than
+// decoding a whole worksheet into memory, as OpenFile does, it walks
+// the worksheet XML with an xml.Decoder and hands back one Row at a
+// time.  Shared strings and styles are only loaded from the zip file
+// the first time a cell refers to them.
+//
+// Directions:
+// 1. Create a StreamReader with OpenStreamReader() or NewStreamReader().
+// 2. Call NextSheet() to move to the first (or next) sheet, or
+// SelectSheet() to jump to a sheet by name.
+// 3. Call Read() repeatedly until it returns io.EOF.
+// 4. Call Close() to finish.
+//
+// Because merged cell definitions are stored after the sheet data,
+// HMerge and VMerge are never populated on cells read by a StreamReader.
+type StreamReader struct {
+	zipReader     *zip.Reader
+	closer        io.Closer
+	xlsxFile      *File
+	sheets        []xlsxSheet
+	sheetXMLMap   map[string]string
+	sharedStrings *zip.File
+	styles        *zip.File
+	themeFile     *zip.File
+	stringsLoaded bool
+	stylesLoaded  bool
+	currentSheet  *streamReaderSheet
+	currentIndex  int
+	err           error
+}
+
+type streamReaderSheet struct {
+	sheet          *Sheet
+	rc             io.ReadCloser
+	decoder        *xml.Decoder
+	sharedFormulas map[int]sharedFormula
+	// The number of rows that have been returned from Read so far
+	rowCount int
+	// The XLSX row number of the next row found in the sheet data,
+	// if it is further along than rowCount, empty rows are returned
+	// until the gap has been filled.
+	pendingRow *xlsxRow
+	pendingC   []xlsxC
+	done       bool
+}
+
+var (
+	NoMoreSheetsError  = errors.New("NextSheet() called, but there are no more sheets")
+	SheetNotFoundError = errors.New("sheet not found")
+)
+
+// OpenStreamReader takes the name of an XLSX file and returns a
+// StreamReader for it.  The underlying file is held open until Close
+// is called.
+func OpenStreamReader(fileName string) (*StreamReader, error) {
+	z, err := zip.OpenReader(fileName)
+	if err != nil {
+		return nil, err
+	}
+	sr, err := newStreamReader(&z.Reader)
+	if err != nil {
+		z.Close()
+		return nil, err
+	}
+	sr.closer = z
+	return sr, nil
+}
+
+// NewStreamReader takes an io.ReaderAt of an XLSX file and returns a
+// StreamReader for it.
+func NewStreamReader(r io.ReaderAt, size int64) (*StreamReader, error) {
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return newStreamReader(z)
+}
+
+func newStreamReader(r *zip.Reader) (*StreamReader, error) {
+	var workbook *zip.File
+	var workbookRels *zip.File
+	worksheets := make(map[string]*zip.File, len(r.File))
+	sr := &StreamReader{
+		zipReader:    r,
+		xlsxFile:     NewFile(),
+		currentIndex: -1,
+	}
+	for _, v := range r.File {
+		switch v.Name {
+		case "xl/sharedStrings.xml":
+			sr.sharedStrings = v
+		case "xl/workbook.xml":
+			workbook = v
+		case "xl/_rels/workbook.xml.rels":
+			workbookRels = v
+		case "xl/styles.xml":
+			sr.styles = v
+		case "xl/theme/theme1.xml":
+			sr.themeFile = v
+		default:
+			if len(v.Name) > 17 {
+				if v.Name[0:13] == "xl/worksheets" {
+					worksheets[v.Name[14:len(v.Name)-4]] = v
+				}
+			}
+		}
+	}
+	if workbookRels == nil {
+		return nil, fmt.Errorf("xl/_rels/workbook.xml.rels not found in input xlsx.")
+	}
+	if workbook == nil {
+		return nil, fmt.Errorf("xl/workbook.xml not found in input xlsx.")
+	}
+	sheetXMLMap, err := readWorkbookRelationsFromZipFile(workbookRels)
+	if err != nil {
+		return nil, err
+	}
+	if len(worksheets) == 0 {
+		return nil, fmt.Errorf("Input xlsx contains no worksheets.")
+	}
+	sr.sheetXMLMap = sheetXMLMap
+	sr.xlsxFile.worksheets = worksheets
+
+	rc, err := workbook.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	xWorkbook := new(xlsxWorkbook)
+	if err = xml.NewDecoder(rc).Decode(xWorkbook); err != nil {
+		return nil, err
+	}
+	sr.xlsxFile.Date1904 = xWorkbook.WorkbookPr.Date1904
+	for _, sheet := range xWorkbook.Sheets.Sheet {
+		if f := worksheetFileForSheet(sheet, worksheets, sheetXMLMap); f != nil {
+			sr.sheets = append(sr.sheets, sheet)
+		}
+	}
+	return sr, nil
+}
+
+// SheetNames returns the names of the worksheets that can be read, in
+// workbook order.
+func (sr *StreamReader) SheetNames() []string {
+	names := make([]string, len(sr.sheets))
+	for i, sheet := range sr.sheets {
+		names[i] = sheet.Name
+	}
+	return names
+}
+
+// Sheet returns the Sheet that rows are currently being read from,
+// or nil if no sheet has been selected yet.  The Sheet carries the
+// name and column definitions but never any rows.
+func (sr *StreamReader) Sheet() *Sheet {
+	if sr.currentSheet == nil {
+		return nil
+	}
+	return sr.currentSheet.sheet
+}
+
+// NextSheet will switch to the next sheet, in workbook order.  The
+// first call selects the first sheet.
+func (sr *StreamReader) NextSheet() error {
+	if sr.err != nil {
+		return sr.err
+	}
+	if sr.currentIndex+1 >= len(sr.sheets) {
+		return NoMoreSheetsError
+	}
+	return sr.openSheet(sr.currentIndex + 1)
+}
+
+// SelectSheet will switch to the sheet with the given name.  Sheets
+// may be selected in any order, but selecting a sheet always starts
+// reading it from the first row.
+func (sr *StreamReader) SelectSheet(name string) error {
+	if sr.err != nil {
+		return sr.err
+	}
+	for i, sheet := range sr.sheets {
+		if sheet.Name == name {
+			return sr.openSheet(i)
+		}
+	}
+	return SheetNotFoundError
+}
+
+func (sr *StreamReader) openSheet(index int) error {
+	if err := sr.closeSheet(); err != nil {
+		sr.err = err
+		return err
+	}
+	rawsheet := sr.sheets[index]
+	f := worksheetFileForSheet(rawsheet, sr.xlsxFile.worksheets, sr.sheetXMLMap)
+	rc, err := f.Open()
+	if err != nil {
+		sr.err = err
+		return err
+	}
+	sheet := &Sheet{
+		Name:   rawsheet.Name,
+		File:   sr.xlsxFile,
+		Hidden: rawsheet.State == sheetStateHidden || rawsheet.State == sheetStateVeryHidden,
+	}
+	sr.currentIndex = index
+	sr.currentSheet = &streamReaderSheet{
+		sheet:          sheet,
+		rc:             rc,
+		decoder:        xml.NewDecoder(rc),
+		sharedFormulas: map[int]sharedFormula{},
+	}
+	if err := sr.seekSheetData(); err != nil {
+		sr.err = err
+		return err
+	}
+	return nil
+}
+
+// seekSheetData advances the decoder to the start of the sheetData
+// element, picking up the column definitions on the way.
+func (sr *StreamReader) seekSheetData() error {
+	ss := sr.currentSheet
+	for {
+		token, err := ss.decoder.Token()
+		if err == io.EOF {
+			ss.done = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "cols":
+			var cols xlsxCols
+			if err := ss.decoder.DecodeElement(&cols, &start); err != nil {
+				return err
+			}
+			sr.makeCols(cols)
+		case "sheetData":
+			return nil
+		}
+	}
+}
+
+func (sr *StreamReader) makeCols(cols xlsxCols) {
+	sheet := sr.currentSheet.sheet
+	for _, rawcol := range cols.Col {
+		for i := rawcol.Min; i <= rawcol.Max; i++ {
+			if i > len(sheet.Cols) {
+				sheet.maybeAddCol(i)
+			}
+			col := sheet.Cols[i-1]
+			col.Min = rawcol.Min
+			col.Max = rawcol.Max
+			col.Hidden = rawcol.Hidden
+			col.Width = rawcol.Width
+			col.OutlineLevel = rawcol.OutlineLevel
+			col.Collapsed = rawcol.Collapsed
+		}
+	}
+}
+
+// Read returns the next row of the current sheet.  Rows that are
+// omitted from the sheet data are returned as empty rows, so that the
+// n-th call to Read always returns the n-th row of the sheet.  Once
+// all rows have been read, Read returns io.EOF.
+func (sr *StreamReader) Read() (row *Row, err error) {
+	if sr.err != nil {
+		return nil, sr.err
+	}
+	if sr.currentSheet == nil {
+		return nil, NoCurrentSheetError
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			switch e.(type) {
+			case error:
+				err = e.(error)
+			default:
+				err = fmt.Errorf("%v", e)
+			}
+			row = nil
+			sr.err = err
+		}
+	}()
+	row, err = sr.read()
+	if err != nil && err != io.EOF {
+		sr.err = err
+	}
+	return row, err
+}
+
+func (sr *StreamReader) read() (*Row, error) {
+	ss := sr.currentSheet
+	if ss.pendingRow == nil {
+		if ss.done {
+			return nil, io.EOF
+		}
+		rawrow, rawcells, err := sr.nextRawRow()
+		if err != nil {
+			return nil, err
+		}
+		if rawrow == nil {
+			ss.done = true
+			return nil, io.EOF
+		}
+		if rawrow.R == 0 {
+			rawrow.R = ss.rowCount + 1
+		}
+		ss.pendingRow = rawrow
+		ss.pendingC = rawcells
+	}
+	ss.rowCount++
+	if ss.pendingRow.R > ss.rowCount {
+		return makeEmptyRow(ss.sheet), nil
+	}
+	row, err := sr.makeRow(*ss.pendingRow, ss.pendingC)
+	ss.pendingRow = nil
+	ss.pendingC = nil
+	return row, err
+}
+
+// nextRawRow reads the next row element and the cells it contains
+// from the sheet data.  A nil row is returned when the end of the
+// sheet data has been reached.
+func (sr *StreamReader) nextRawRow() (*xlsxRow, []xlsxC, error) {
+	decoder := sr.currentSheet.decoder
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, nil, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local != "row" {
+				if err := decoder.Skip(); err != nil {
+					return nil, nil, err
+				}
+				continue
+			}
+			rawrow, err := parseRowAttrs(t)
+			if err != nil {
+				return nil, nil, err
+			}
+			rawcells, err := readRawCells(decoder)
+			if err != nil {
+				return nil, nil, err
+			}
+			return rawrow, rawcells, nil
+		case xml.EndElement:
+			if t.Name.Local == "sheetData" {
+				return nil, nil, nil
+			}
+		}
+	}
+}
+
+func parseRowAttrs(start xml.StartElement) (*xlsxRow, error) {
+	rawrow := new(xlsxRow)
+	for _, attr := range start.Attr {
+		var err error
+		switch attr.Name.Local {
+		case "r":
+			rawrow.R, err = strconv.Atoi(attr.Value)
+		case "spans":
+			rawrow.Spans = attr.Value
+		case "hidden":
+			rawrow.Hidden, err = strconv.ParseBool(attr.Value)
+		case "ht":
+			rawrow.Ht = attr.Value
+		case "customHeight":
+			rawrow.CustomHeight, err = strconv.ParseBool(attr.Value)
+		case "outlineLevel":
+			var level uint64
+			level, err = strconv.ParseUint(attr.Value, 10, 8)
+			rawrow.OutlineLevel = uint8(level)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid row attribute %s=%q: %s", attr.Name.Local, attr.Value, err)
+		}
+	}
+	return rawrow, nil
+}
+
+// readRawCells decodes the c elements of a row, the decoder must be
+// positioned just after the row start element.
+func readRawCells(decoder *xml.Decoder) ([]xlsxC, error) {
+	var rawcells []xlsxC
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local != "c" {
+				if err := decoder.Skip(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			var rawcell xlsxC
+			if err := decoder.DecodeElement(&rawcell, &t); err != nil {
+				return nil, err
+			}
+			rawcells = append(rawcells, rawcell)
+		case xml.EndElement:
+			return rawcells, nil
+		}
+	}
+}
+
+func (sr *StreamReader) makeRow(rawrow xlsxRow, rawcells []xlsxC) (*Row, error) {
+	ss := sr.currentSheet
+	row := makeEmptyRow(ss.sheet)
+	row.Hidden = rawrow.Hidden
+	if height, err := strconv.ParseFloat(rawrow.Ht, 64); err == nil {
+		row.Height = height
+	}
+	row.isCustom = rawrow.CustomHeight
+	row.OutlineLevel = rawrow.OutlineLevel
+
+	x := -1
+	for _, rawcell := range rawcells {
+		if rawcell.R != "" {
+			var err error
+			x, _, err = GetCoordsFromCellIDString(rawcell.R)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			x++
+			rawcell.R = GetCellIDStringFromCoords(x, ss.rowCount-1)
+		}
+		// Some spreadsheets will omit blank cells from the data.
+		for len(row.Cells) < x {
+			row.Cells = append(row.Cells, NewCell(row))
+		}
+		cell := NewCell(row)
+		row.Cells = append(row.Cells, cell)
+
+		if rawcell.T == "s" {
+			if err := sr.loadSharedStrings(); err != nil {
+				return nil, err
+			}
+		}
+		fillCellData(rawcell, sr.xlsxFile.referenceTable, ss.sharedFormulas, cell)
+		if err := sr.loadStyles(); err != nil {
+			return nil, err
+		}
+		if sr.xlsxFile.styles != nil {
+			cell.style = sr.xlsxFile.styles.getStyle(rawcell.S)
+			cell.NumFmt, cell.parsedNumFmt = sr.xlsxFile.styles.getNumberFormat(rawcell.S)
+		}
+		cell.date1904 = sr.xlsxFile.Date1904
+		cell.Hidden = rawrow.Hidden || (x < len(ss.sheet.Cols) && ss.sheet.Cols[x].Hidden)
+	}
+	return row, nil
+}
+
+// loadSharedStrings reads the shared string table the first time a
+// cell refers to it.
+func (sr *StreamReader) loadSharedStrings() error {
+	if sr.stringsLoaded {
+		return nil
+	}
+	reftable, err := readSharedStringsFromZipFile(sr.sharedStrings)
+	if err != nil {
+		return err
+	}
+	if reftable == nil {
+		return errors.New("shared string referenced, but xl/sharedStrings.xml not found in input xlsx")
+	}
+	sr.xlsxFile.referenceTable = reftable
+	sr.stringsLoaded = true
+	return nil
+}
+
+// loadStyles reads the theme and style sheet the first time a cell
+// is read.
+func (sr *StreamReader) loadStyles() error {
+	if sr.stylesLoaded {
+		return nil
+	}
+	sr.stylesLoaded = true
+	if sr.themeFile != nil {
+		theme, err := readThemeFromZipFile(sr.themeFile)
+		if err != nil {
+			return err
+		}
+		sr.xlsxFile.theme = theme
+	}
+	if sr.styles != nil {
+		style, err := readStylesFromZipFile(sr.styles, sr.xlsxFile.theme)
+		if err != nil {
+			return err
+		}
+		sr.xlsxFile.styles = style
+	}
+	return nil
+}
+
+func (sr *StreamReader) closeSheet() error {
+	if sr.currentSheet == nil {
+		return nil
+	}
+	err := sr.currentSheet.rc.Close()
+	sr.currentSheet = nil
+	return err
+}
+
+// Close releases the current sheet and, if the StreamReader was
+// created with OpenStreamReader, the underlying file.  It is safe to
+// stop reading a sheet part way through and call Close.
+func (sr *StreamReader) Close() error {
+	err := sr.closeSheet()
+	if sr.closer != nil {
+		if cerr := sr.closer.Close(); err == nil {
+			err = cerr
+		}
+		sr.closer = nil
+	}
+	return err
+}
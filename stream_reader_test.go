@@ -0,0 +1,108 @@
+package xlsx
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+
+	. "gopkg.in/check.v1"
+)
+
+type StreamReaderSuite struct{}
+
+var _ = Suite(&StreamReaderSuite{})
+
+// readAllStreamRows reads every remaining row of the current sheet.
+func readAllStreamRows(c *C, sr *StreamReader) []*Row {
+	var rows []*Row
+	for {
+		row, err := sr.Read()
+		if err == io.EOF {
+			return rows
+		}
+		c.Assert(err, IsNil)
+		rows = append(rows, row)
+	}
+}
+
+// A StreamReader yields the same values as OpenFile does.
+func (s *StreamReaderSuite) TestStreamReaderMatchesOpenFile(c *C) {
+	f, err := OpenFile("./testdocs/testfile.xlsx")
+	c.Assert(err, IsNil)
+
+	sr, err := OpenStreamReader("./testdocs/testfile.xlsx")
+	c.Assert(err, IsNil)
+	defer sr.Close()
+	c.Assert(len(sr.SheetNames()), Equals, len(f.Sheets))
+
+	for _, sheet := range f.Sheets {
+		c.Assert(sr.NextSheet(), IsNil)
+		c.Assert(sr.Sheet().Name, Equals, sheet.Name)
+		rows := readAllStreamRows(c, sr)
+		c.Assert(len(rows), Equals, len(sheet.Rows))
+		for r, row := range sheet.Rows {
+			for i, cell := range rows[r].Cells {
+				c.Assert(cell.Value, Equals, row.Cells[i].Value)
+				c.Assert(cell.Type(), Equals, row.Cells[i].Type())
+			}
+		}
+	}
+	c.Assert(sr.NextSheet(), Equals, NoMoreSheetsError)
+}
+
+// Cell types and formulas are handled the same way as fillCellData.
+func (s *StreamReaderSuite) TestStreamReaderCellTypes(c *C) {
+	sr, err := OpenStreamReader("./testdocs/testcelltypes.xlsx")
+	c.Assert(err, IsNil)
+	defer sr.Close()
+	c.Assert(sr.SelectSheet("Sheet1"), IsNil)
+	rows := readAllStreamRows(c, sr)
+	c.Assert(len(rows), Equals, 8)
+
+	c.Assert(rows[0].Cells[0].Type(), Equals, CellTypeString)
+	c.Assert(rows[0].Cells[0].Value, Equals, "hello world")
+	c.Assert(rows[2].Cells[0].Type(), Equals, CellTypeNumeric)
+	c.Assert(rows[5].Cells[0].Type(), Equals, CellTypeBool)
+	c.Assert(rows[6].Cells[0].Formula(), Equals, "10+20")
+	c.Assert(rows[6].Cells[0].Value, Equals, "30")
+	c.Assert(rows[7].Cells[0].Type(), Equals, CellTypeError)
+	c.Assert(rows[7].Cells[0].Value, Equals, "#DIV/0!")
+}
+
+// Rows and cells that are omitted from the sheet data are returned as
+// empty rows and cells.
+func (s *StreamReaderSuite) TestStreamReaderEmptyRowsAndCols(c *C) {
+	sr, err := OpenStreamReader("./testdocs/empty_rows.xlsx")
+	c.Assert(err, IsNil)
+	defer sr.Close()
+
+	c.Assert(sr.SelectSheet("EmptyRows"), IsNil)
+	rows := readAllStreamRows(c, sr)
+	c.Assert(len(rows) >= 3, Equals, true)
+	c.Assert(len(rows[0].Cells), Equals, 0)
+	c.Assert(rows[2].Cells[0].Value, Equals, "A3")
+
+	c.Assert(sr.SelectSheet("EmptyCols"), IsNil)
+	row, err := sr.Read()
+	c.Assert(err, IsNil)
+	c.Assert(row.Cells[0].Value, Equals, "")
+	c.Assert(row.Cells[2].Value, Equals, "C1")
+}
+
+// Reading can stop early, and the reader can be built from an io.ReaderAt.
+func (s *StreamReaderSuite) TestStreamReaderStopEarly(c *C) {
+	data, err := ioutil.ReadFile("./testdocs/testfile.xlsx")
+	c.Assert(err, IsNil)
+	sr, err := NewStreamReader(bytes.NewReader(data), int64(len(data)))
+	c.Assert(err, IsNil)
+
+	_, err = sr.Read()
+	c.Assert(err, Equals, NoCurrentSheetError)
+	c.Assert(sr.NextSheet(), IsNil)
+	row, err := sr.Read()
+	c.Assert(err, IsNil)
+	c.Assert(row.Cells[0].Value, Equals, "Foo")
+	c.Assert(sr.Close(), IsNil)
+
+	c.Assert(sr.SelectSheet("NoSuchSheet"), Equals, SheetNotFoundError)
+}
@@ -12,17 +12,20 @@ type Style struct {
 	ApplyFill       bool
 	ApplyFont       bool
 	ApplyAlignment  bool
+	ApplyProtection bool
 	Alignment       Alignment
+	Protection      Protection
 	NamedStyleIndex *int
 }
 
 // Return a new Style structure initialised with the default values.
 func NewStyle() *Style {
 	return &Style{
-		Alignment: *DefaultAlignment(),
-		Border:    *DefaultBorder(),
-		Fill:      *DefaultFill(),
-		Font:      *DefaultFont(),
+		Alignment:  *DefaultAlignment(),
+		Border:     *DefaultBorder(),
+		Fill:       *DefaultFill(),
+		Font:       *DefaultFont(),
+		Protection: *DefaultProtection(),
 	}
 }
 
@@ -78,6 +81,14 @@ func (style *Style) makeXLSXStyleElements() (xFont xlsxFont, xFill xlsxFill, xBo
 	xCellXf.ApplyFill = style.ApplyFill
 	xCellXf.ApplyFont = style.ApplyFont
 	xCellXf.ApplyAlignment = style.ApplyAlignment
+	xCellXf.ApplyProtection = style.ApplyProtection
+	if style.ApplyProtection {
+		locked := style.Protection.Locked
+		xCellXf.Protection = &xlsxProtection{
+			Locked: &locked,
+			Hidden: style.Protection.Hidden,
+		}
+	}
 	if style.NamedStyleIndex != nil {
 		xCellXf.XfId = style.NamedStyleIndex
 	}
@@ -151,6 +162,14 @@ type Alignment struct {
 	WrapText     bool
 }
 
+// Protection says whether a cell can be changed, and whether its
+// formula is shown, once the sheet is protected.  Cells are locked
+// unless their style says otherwise.
+type Protection struct {
+	Locked bool
+	Hidden bool
+}
+
 var defaultFontSize = 12
 var defaultFontName = "Verdana"
 
@@ -172,6 +191,10 @@ func DefaultBorder() *Border {
 	return NewBorder("none", "none", "none", "none")
 }
 
+func DefaultProtection() *Protection {
+	return &Protection{Locked: true}
+}
+
 func DefaultAlignment() *Alignment {
 	return &Alignment{
 		Horizontal: "general",
@@ -1,6 +1,8 @@
 package xlsx
 
 import (
+	"bytes"
+
 	. "gopkg.in/check.v1"
 )
 
@@ -18,6 +20,7 @@ func (s *StyleSuite) TestNewStyleDefaultts(c *C) {
 	c.Assert(style.Font, Equals, *DefaultFont())
 	c.Assert(style.Fill, Equals, *DefaultFill())
 	c.Assert(style.Border, Equals, *DefaultBorder())
+	c.Assert(style.Protection, Equals, Protection{Locked: true})
 }
 
 func (s *StyleSuite) TestMakeXLSXStyleElements(c *C) {
@@ -51,7 +54,42 @@ func (s *StyleSuite) TestMakeXLSXStyleElements(c *C) {
 	c.Assert(xCellXf.ApplyBorder, Equals, true)
 	c.Assert(xCellXf.ApplyFill, Equals, true)
 	c.Assert(xCellXf.ApplyFont, Equals, true)
+	c.Assert(xCellXf.ApplyProtection, Equals, false)
+	c.Assert(xCellXf.Protection, IsNil)
+
+	style.ApplyProtection = true
+	style.Protection.Locked = false
+	_, _, _, xCellXf = style.makeXLSXStyleElements()
+	c.Assert(xCellXf.ApplyProtection, Equals, true)
+	c.Assert(xCellXf.Protection, NotNil)
+	c.Assert(*xCellXf.Protection.Locked, Equals, false)
+	c.Assert(xCellXf.Protection.Hidden, Equals, false)
+}
+
+// Unlocked and hidden cells keep their protection through a file, while
+// other cells stay locked.
+func (s *StyleSuite) TestProtectionRoundTrip(c *C) {
+	f := NewFile()
+	sheet, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	input := sheet.Cell(0, 0)
+	input.SetString("input")
+	style := NewStyle()
+	style.ApplyProtection = true
+	style.Protection = Protection{Locked: false, Hidden: true}
+	input.SetStyle(style)
+	sheet.Cell(0, 1).SetString("fixed")
+
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), IsNil)
+	read, err := OpenBinary(buf.Bytes())
+	c.Assert(err, IsNil)
 
+	inputStyle := read.Sheets[0].Cell(0, 0).GetStyle()
+	c.Assert(inputStyle.ApplyProtection, Equals, true)
+	c.Assert(inputStyle.Protection, Equals, Protection{Locked: false, Hidden: true})
+	fixedStyle := read.Sheets[0].Cell(0, 1).GetStyle()
+	c.Assert(fixedStyle.Protection, Equals, Protection{Locked: true})
 }
 
 type FontSuite struct{}
@@ -0,0 +1,395 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// TotalsRowFunction is the function that Excel shows in the totals
+// row of a table column.
+type TotalsRowFunction string
+
+const (
+	TotalsRowFunctionNone      TotalsRowFunction = "none"
+	TotalsRowFunctionSum       TotalsRowFunction = "sum"
+	TotalsRowFunctionMin       TotalsRowFunction = "min"
+	TotalsRowFunctionMax       TotalsRowFunction = "max"
+	TotalsRowFunctionAverage   TotalsRowFunction = "average"
+	TotalsRowFunctionCount     TotalsRowFunction = "count"
+	TotalsRowFunctionCountNums TotalsRowFunction = "countNums"
+	TotalsRowFunctionStdDev    TotalsRowFunction = "stdDev"
+	TotalsRowFunctionVar       TotalsRowFunction = "var"
+	TotalsRowFunctionCustom    TotalsRowFunction = "custom"
+)
+
+// subtotalFunctionNumbers maps the totals row functions to the
+// function number that SUBTOTAL uses for them, ignoring hidden rows
+// the way Excel does.
+var subtotalFunctionNumbers = map[TotalsRowFunction]int{
+	TotalsRowFunctionAverage:   101,
+	TotalsRowFunctionCountNums: 102,
+	TotalsRowFunctionCount:     103,
+	TotalsRowFunctionMax:       104,
+	TotalsRowFunctionMin:       105,
+	TotalsRowFunctionStdDev:    107,
+	TotalsRowFunctionSum:       109,
+	TotalsRowFunctionVar:       110,
+}
+
+// nameRegexp matches the names that Excel accepts for tables and
+// defined names.
+var nameRegexp = regexp.MustCompile(`^[\p{L}_\\][\p{L}\p{N}_.\\]*$`)
+
+// cellNameRegexp matches names that Excel would take to be a cell
+// reference, in either the A1 or the R1C1 style.
+var cellNameRegexp = regexp.MustCompile(`^(?i:[a-z]{1,3}[0-9]+|r[0-9]*c?[0-9]*|c[0-9]*)$`)
+
+// Table is a range of cells that Excel manages as a single table, with
+// a header row naming its columns, an optional totals row and a
+// table style.
+type Table struct {
+	// Name identifies the table in formulas.  It is unique within the
+	// workbook.
+	Name string
+	// Ref is the range of the table, including the header row and the
+	// totals row, e.g. "A1:C10".
+	Ref     string
+	Columns []*TableColumn
+	// StyleName is the name of a table style, such as one of the
+	// built-in styles "TableStyleLight1" to "TableStyleDark11".
+	StyleName         string
+	ShowFirstColumn   bool
+	ShowLastColumn    bool
+	ShowRowStripes    bool
+	ShowColumnStripes bool
+	// AutoFilter shows the filter buttons in the header row.
+	AutoFilter bool
+	// TotalsRow makes the last row of Ref the totals row of the
+	// table.  The SetTotalsRow methods turn it on, adding a row to
+	// the bottom of Ref as Excel does.
+	TotalsRow bool
+
+	sheet *Sheet
+}
+
+// TableColumn is a column of a Table.
+type TableColumn struct {
+	Name              string
+	TotalsRowFunction TotalsRowFunction
+	// TotalsRowLabel is shown in the totals row of a column that has
+	// no totals row function.
+	TotalsRowLabel string
+	// TotalsRowFormula is the formula of a column whose totals row
+	// function is TotalsRowFunctionCustom.
+	TotalsRowFormula string
+}
+
+// AddTable makes a table of the cells in ref, which is a range such as
+// "A1:C10" whose first row is the header row of the table.  The header
+// row is filled in with the names in columns.  When columns is nil the
+// names are taken from the header row instead, and any empty cell
+// there is named after its position in the table.  styleName is the
+// name of a table style such as "TableStyleMedium2", or "" for none.
+func (s *Sheet) AddTable(ref, name string, columns []string, styleName string) (*Table, error) {
+	if err := validateTableName(name); err != nil {
+		return nil, err
+	}
+	if s.Table(name) != nil || (s.File != nil && s.File.Table(name) != nil) {
+		return nil, fmt.Errorf("duplicate table name %q", name)
+	}
+	if s.File != nil {
+		for _, dn := range s.File.DefinedNames {
+			if strings.EqualFold(dn.Name, name) {
+				return nil, fmt.Errorf("table name %q is already a defined name", name)
+			}
+		}
+	}
+	minCol, minRow, maxCol, _, err := getTableBounds(ref)
+	if err != nil {
+		return nil, err
+	}
+	width := maxCol - minCol + 1
+	if columns != nil && len(columns) != width {
+		return nil, fmt.Errorf("table %q has %d columns but %d column names were given", name, width, len(columns))
+	}
+	names := make(map[string]bool)
+	table := &Table{
+		Name:           name,
+		Ref:            ref,
+		StyleName:      styleName,
+		ShowRowStripes: true,
+		AutoFilter:     true,
+		sheet:          s,
+	}
+	for i := 0; i < width; i++ {
+		var colName string
+		if columns != nil {
+			colName = columns[i]
+		} else {
+			colName = s.Cell(minRow, minCol+i).Value
+		}
+		if colName == "" {
+			colName = fmt.Sprintf("Column%d", i+1)
+		}
+		key := strings.ToLower(colName)
+		if names[key] {
+			return nil, fmt.Errorf("duplicate column name %q in table %q", colName, name)
+		}
+		names[key] = true
+		table.Columns = append(table.Columns, &TableColumn{Name: colName})
+	}
+	for i, column := range table.Columns {
+		s.Cell(minRow, minCol+i).SetString(column.Name)
+	}
+	s.Tables = append(s.Tables, table)
+	return table, nil
+}
+
+// Table returns the table of the sheet with the given name, or nil if
+// there is no such table.  Like in Excel, table names are not case
+// sensitive.
+func (s *Sheet) Table(name string) *Table {
+	for _, table := range s.Tables {
+		if strings.EqualFold(table.Name, name) {
+			return table
+		}
+	}
+	return nil
+}
+
+// Table returns the table with the given name from any of the sheets
+// of the file, or nil if there is no such table.
+func (f *File) Table(name string) *Table {
+	for _, sheet := range f.Sheets {
+		if table := sheet.Table(name); table != nil {
+			return table
+		}
+	}
+	return nil
+}
+
+// Column returns the column of the table with the given name, or nil
+// if there is no such column.
+func (t *Table) Column(name string) *TableColumn {
+	for _, column := range t.Columns {
+		if strings.EqualFold(column.Name, name) {
+			return column
+		}
+	}
+	return nil
+}
+
+// SetTotalsRowFunction turns on the totals row of the table and makes
+// it show the result of function for the named column.
+func (t *Table) SetTotalsRowFunction(column string, function TotalsRowFunction) error {
+	number, ok := subtotalFunctionNumbers[function]
+	if !ok && function != TotalsRowFunctionNone {
+		return fmt.Errorf("invalid totals row function %q", function)
+	}
+	if c := t.Column(column); c != nil {
+		column = c.Name
+	}
+	formula := ""
+	if ok {
+		formula = fmt.Sprintf("SUBTOTAL(%d,%s[%s])", number, t.Name, escapeTableColumnName(column))
+	}
+	return t.setTotalsRow(column, function, "", formula)
+}
+
+// SetTotalsRowFormula turns on the totals row of the table and makes
+// it show the result of formula for the named column.
+func (t *Table) SetTotalsRowFormula(column, formula string) error {
+	return t.setTotalsRow(column, TotalsRowFunctionCustom, "", formula)
+}
+
+// SetTotalsRowLabel turns on the totals row of the table and makes it
+// show label for the named column.
+func (t *Table) SetTotalsRowLabel(column, label string) error {
+	return t.setTotalsRow(column, "", label, "")
+}
+
+// setTotalsRow sets what the totals row shows for a column, both in
+// the table and in the cell of the sheet that holds it.  If the table
+// has no totals row yet, the row below it becomes the totals row, which
+// is an error if the row has anything in it.
+func (t *Table) setTotalsRow(column string, function TotalsRowFunction, label, formula string) error {
+	index := -1
+	for i, c := range t.Columns {
+		if strings.EqualFold(c.Name, column) {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("table %q has no column %q", t.Name, column)
+	}
+	if t.sheet == nil {
+		return fmt.Errorf("table %q does not belong to a sheet", t.Name)
+	}
+	minCol, minRow, maxCol, maxRow, err := getTableBounds(t.Ref)
+	if err != nil {
+		return err
+	}
+	if !t.TotalsRow {
+		maxRow++
+		if maxRow >= Excel2006MaxRowCount {
+			return fmt.Errorf("table %q has no room for a totals row", t.Name)
+		}
+		for col := minCol; col <= maxCol; col++ {
+			if cell := cellAt(t.sheet, maxRow, col); cell != nil && (cell.Value != "" || cell.formula != "") {
+				return fmt.Errorf("cannot add a totals row to table %q because cell %s is not empty", t.Name, GetCellIDStringFromCoords(col, maxRow))
+			}
+		}
+		t.Ref = GetCellIDStringFromCoords(minCol, minRow) + cellRangeChar + GetCellIDStringFromCoords(maxCol, maxRow)
+	}
+	c := t.Columns[index]
+	c.TotalsRowFunction = function
+	c.TotalsRowLabel = label
+	c.TotalsRowFormula = ""
+	if function == TotalsRowFunctionCustom {
+		c.TotalsRowFormula = formula
+	}
+	t.TotalsRow = true
+	cell := t.sheet.Cell(maxRow, minCol+index)
+	switch {
+	case formula != "":
+		cell.SetFormula(formula)
+	case label != "":
+		cell.SetString(label)
+	default:
+		cell.SetString("")
+	}
+	return nil
+}
+
+// escapeTableColumnName escapes the characters that have a special
+// meaning inside the brackets of a structured reference.
+func escapeTableColumnName(name string) string {
+	r := strings.NewReplacer("'", "''", "[", "'[", "]", "']", "#", "'#")
+	return r.Replace(name)
+}
+
+// validateTableName returns an error if Excel would not accept name as
+// the name of a table.
+func validateTableName(name string) error {
+	if len(name) > 255 {
+		return fmt.Errorf("table name %q is longer than 255 characters", name)
+	}
+	if !nameRegexp.MatchString(name) || cellNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid table name %q", name)
+	}
+	return nil
+}
+
+// getTableBounds returns the zero based coordinates of the corners of
+// the range of a table, which must have a header row and at least one
+// more row.
+func getTableBounds(ref string) (minCol, minRow, maxCol, maxRow int, err error) {
+	if strings.Count(ref, cellRangeChar) != 1 {
+		return -1, -1, -1, -1, fmt.Errorf("invalid table range %q", ref)
+	}
+	minCol, minRow, maxCol, maxRow, err = getMaxMinFromDimensionRef(ref)
+	if err != nil || minCol < 0 || minRow < 0 || maxCol < minCol || maxRow <= minRow {
+		return -1, -1, -1, -1, fmt.Errorf("invalid table range %q", ref)
+	}
+	return minCol, minRow, maxCol, maxRow, nil
+}
+
+// makeXLSXTable builds the table part for a Table.  id is the id of
+// the table, which has to be unique within the workbook.
+func (t *Table) makeXLSXTable(id int) (*xlsxTable, error) {
+	minCol, minRow, maxCol, maxRow, err := getTableBounds(t.Ref)
+	if err != nil {
+		return nil, err
+	}
+	if len(t.Columns) != maxCol-minCol+1 {
+		return nil, fmt.Errorf("table %q has %d columns but its range %q is %d columns wide", t.Name, len(t.Columns), t.Ref, maxCol-minCol+1)
+	}
+	xTable := &xlsxTable{
+		Id:          id,
+		Name:        t.Name,
+		DisplayName: t.Name,
+		Ref:         t.Ref,
+		TableColumns: xlsxTableColumns{
+			Count: len(t.Columns),
+		},
+		TableStyleInfo: &xlsxTableStyleInfo{
+			Name:              t.StyleName,
+			ShowFirstColumn:   t.ShowFirstColumn,
+			ShowLastColumn:    t.ShowLastColumn,
+			ShowRowStripes:    t.ShowRowStripes,
+			ShowColumnStripes: t.ShowColumnStripes,
+		},
+	}
+	lastDataRow := maxRow
+	if t.TotalsRow {
+		xTable.TotalsRowCount = 1
+		lastDataRow--
+	}
+	if t.AutoFilter {
+		xTable.AutoFilter = &xlsxAutoFilter{
+			Ref: GetCellIDStringFromCoords(minCol, minRow) + cellRangeChar + GetCellIDStringFromCoords(maxCol, lastDataRow),
+		}
+	}
+	for i, column := range t.Columns {
+		xColumn := xlsxTableColumn{
+			Id:   i + 1,
+			Name: column.Name,
+		}
+		if t.TotalsRow {
+			if column.TotalsRowFunction != TotalsRowFunctionNone {
+				xColumn.TotalsRowFunction = string(column.TotalsRowFunction)
+			}
+			xColumn.TotalsRowLabel = column.TotalsRowLabel
+			if column.TotalsRowFunction == TotalsRowFunctionCustom {
+				xColumn.TotalsRowFormula = column.TotalsRowFormula
+			}
+		}
+		xTable.TableColumns.TableColumn = append(xTable.TableColumns.TableColumn, xColumn)
+	}
+	return xTable, nil
+}
+
+// readTableFromZipFile reads a table part, attaching the table to the
+// sheet it belongs to.
+func readTableFromZipFile(f *zip.File, sheet *Sheet) (*Table, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	xTable := new(xlsxTable)
+	if err = xml.NewDecoder(rc).Decode(xTable); err != nil {
+		return nil, err
+	}
+	name := xTable.DisplayName
+	if name == "" {
+		name = xTable.Name
+	}
+	table := &Table{
+		Name:       name,
+		Ref:        xTable.Ref,
+		AutoFilter: xTable.AutoFilter != nil,
+		TotalsRow:  xTable.TotalsRowCount > 0,
+		sheet:      sheet,
+	}
+	if info := xTable.TableStyleInfo; info != nil {
+		table.StyleName = info.Name
+		table.ShowFirstColumn = info.ShowFirstColumn
+		table.ShowLastColumn = info.ShowLastColumn
+		table.ShowRowStripes = info.ShowRowStripes
+		table.ShowColumnStripes = info.ShowColumnStripes
+	}
+	for _, xColumn := range xTable.TableColumns.TableColumn {
+		table.Columns = append(table.Columns, &TableColumn{
+			Name:              xColumn.Name,
+			TotalsRowFunction: TotalsRowFunction(xColumn.TotalsRowFunction),
+			TotalsRowLabel:    xColumn.TotalsRowLabel,
+			TotalsRowFormula:  xColumn.TotalsRowFormula,
+		})
+	}
+	return table, nil
+}
@@ -0,0 +1,164 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type TableSuite struct{}
+
+var _ = Suite(&TableSuite{})
+
+// A table is written to its own part, referred to by the sheet, and
+// fills in its header row.
+func (s *TableSuite) TestMarshalTable(c *C) {
+	f := NewFile()
+	sheet, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	table, err := sheet.AddTable("B2:C5", "Sales", []string{"Region", "Amount"}, "TableStyleMedium2")
+	c.Assert(err, IsNil)
+	c.Assert(sheet.Cell(1, 1).Value, Equals, "Region")
+	c.Assert(sheet.Cell(1, 2).Value, Equals, "Amount")
+	c.Assert(table.SetTotalsRowLabel("region", "Total"), IsNil)
+	c.Assert(table.SetTotalsRowFunction("amount", TotalsRowFunctionSum), IsNil)
+	c.Assert(table.Ref, Equals, "B2:C6")
+	c.Assert(sheet.Cell(5, 1).Value, Equals, "Total")
+	c.Assert(sheet.Cell(5, 2).Formula(), Equals, "SUBTOTAL(109,Sales[Amount])")
+
+	parts, err := f.MarshallParts()
+	c.Assert(err, IsNil)
+	c.Assert(parts["xl/tables/table1.xml"], Equals, `<?xml version="1.0" encoding="UTF-8"?>
+<table xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" id="1" name="Sales" displayName="Sales" ref="B2:C6" totalsRowCount="1"><autoFilter ref="B2:C5"></autoFilter><tableColumns count="2"><tableColumn id="1" name="Region" totalsRowLabel="Total"></tableColumn><tableColumn id="2" name="Amount" totalsRowFunction="sum"></tableColumn></tableColumns><tableStyleInfo name="TableStyleMedium2" showFirstColumn="false" showLastColumn="false" showRowStripes="true" showColumnStripes="false"></tableStyleInfo></table>`)
+	c.Assert(parts["xl/worksheets/_rels/sheet1.xml.rels"], Equals, `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Target="../tables/table1.xml" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/table"></Relationship></Relationships>`)
+	c.Assert(strings.Contains(parts["xl/worksheets/sheet1.xml"],
+		`<tableParts count="1"><tablePart r:id="rId1"></tablePart></tableParts></worksheet>`), Equals, true)
+	c.Assert(strings.Contains(parts["[Content_Types].xml"],
+		`<Override PartName="/xl/tables/table1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.table+xml"></Override>`), Equals, true)
+}
+
+// Table names are checked, and have to be unique in the workbook.
+func (s *TableSuite) TestAddTableErrors(c *C) {
+	f := NewFile()
+	sheet1, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	sheet2, err := f.AddSheet("Sheet2")
+	c.Assert(err, IsNil)
+	_, err = sheet1.AddTable("A1:B3", "People", nil, "")
+	c.Assert(err, IsNil)
+	_, err = sheet2.AddTable("A1:B3", "people", nil, "")
+	c.Assert(err, NotNil)
+	for _, name := range []string{"", "A1", "R1C1", "1st", "Has Space"} {
+		_, err = sheet2.AddTable("A1:B3", name, nil, "")
+		c.Assert(err, NotNil, Commentf("name %q", name))
+	}
+	_, err = sheet2.AddTable("A1", "Single", nil, "")
+	c.Assert(err, NotNil)
+	_, err = sheet2.AddTable("A1:C3", "Short", []string{"One", "Two"}, "")
+	c.Assert(err, NotNil)
+	_, err = sheet2.AddTable("A1:B3", "Twice", []string{"Same", "same"}, "")
+	c.Assert(err, NotNil)
+	c.Assert(sheet2.Tables, HasLen, 0)
+}
+
+// Tables on several sheets get ids that are unique in the workbook
+// and can be found by name after being read back.
+func (s *TableSuite) TestTableRoundTrip(c *C) {
+	f := NewFile()
+	sheet1, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	sheet2, err := f.AddSheet("Sheet2")
+	c.Assert(err, IsNil)
+	sheet1.Cell(0, 0).SetString("Name")
+	_, err = sheet1.AddTable("A1:B4", "People", nil, "TableStyleLight9")
+	c.Assert(err, IsNil)
+	_, err = sheet1.AddTable("D1:D2", "Other", []string{"X"}, "")
+	c.Assert(err, IsNil)
+	table, err := sheet2.AddTable("C3:E6", "Totals", []string{"A", "B", "C"}, "TableStyleDark1")
+	c.Assert(err, IsNil)
+	table.ShowColumnStripes = true
+	c.Assert(table.SetTotalsRowFormula("C", "SUM(Totals[A])*2"), IsNil)
+
+	parts, err := f.MarshallParts()
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(parts["xl/tables/table3.xml"], `id="3" name="Totals"`), Equals, true)
+
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), IsNil)
+	f, err = OpenBinary(buf.Bytes())
+	c.Assert(err, IsNil)
+
+	people := f.Table("PEOPLE")
+	c.Assert(people, NotNil)
+	c.Assert(people.Ref, Equals, "A1:B4")
+	c.Assert(people.StyleName, Equals, "TableStyleLight9")
+	c.Assert(people.Columns[0].Name, Equals, "Name")
+	c.Assert(people.Columns[1].Name, Equals, "Column2")
+	c.Assert(f.Sheets[0].Tables, HasLen, 2)
+
+	totals := f.Sheets[1].Table("Totals")
+	c.Assert(totals, NotNil)
+	c.Assert(totals.TotalsRow, Equals, true)
+	c.Assert(totals.ShowColumnStripes, Equals, true)
+	c.Assert(totals.Column("C").TotalsRowFunction, Equals, TotalsRowFunctionCustom)
+	c.Assert(totals.Column("C").TotalsRowFormula, Equals, "SUM(Totals[A])*2")
+	c.Assert(totals.Ref, Equals, "C3:E7")
+	c.Assert(f.Sheets[1].Cell(6, 4).Formula(), Equals, "SUM(Totals[A])*2")
+}
+
+// The totals row is added below the table, as long as the row is empty
+// there.
+func (s *TableSuite) TestTotalsRowGrowsTable(c *C) {
+	f := NewFile()
+	sheet, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	table, err := sheet.AddTable("A1:B3", "Blocked", []string{"Name", "Count"}, "")
+	c.Assert(err, IsNil)
+	sheet.Cell(3, 1).SetInt(7)
+	c.Assert(table.SetTotalsRowLabel("Name", "Total"), NotNil)
+	c.Assert(table.TotalsRow, Equals, false)
+	c.Assert(table.Ref, Equals, "A1:B3")
+	c.Assert(sheet.Cell(3, 0).Value, Equals, "")
+
+	sheet.Cell(3, 1).SetString("")
+	c.Assert(table.SetTotalsRowLabel("Name", "Total"), IsNil)
+	c.Assert(table.SetTotalsRowFunction("Count", TotalsRowFunctionCount), IsNil)
+	c.Assert(table.Ref, Equals, "A1:B4")
+	c.Assert(sheet.Cell(3, 0).Value, Equals, "Total")
+	c.Assert(sheet.Cell(3, 1).Formula(), Equals, "SUBTOTAL(103,Blocked[Count])")
+}
+
+// Tables written by Excel are read, using the display name as the
+// name of the table.
+func (s *TableSuite) TestReadTable(c *C) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	part, err := w.Create("xl/tables/table2.xml")
+	c.Assert(err, IsNil)
+	_, err = part.Write([]byte(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<table xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" id="2" name="Table2" displayName="Inventory" ref="A1:B3" totalsRowShown="0">
+  <autoFilter ref="A1:B3"/>
+  <tableColumns count="2"><tableColumn id="1" name="Item"/><tableColumn id="2" name="Count"/></tableColumns>
+  <tableStyleInfo name="TableStyleMedium2" showFirstColumn="0" showLastColumn="0" showRowStripes="1" showColumnStripes="0"/>
+</table>`))
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(), IsNil)
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	c.Assert(err, IsNil)
+
+	sheet := &Sheet{}
+	table, err := readTableFromZipFile(r.File[0], sheet)
+	c.Assert(err, IsNil)
+	c.Assert(table.Name, Equals, "Inventory")
+	c.Assert(table.Ref, Equals, "A1:B3")
+	c.Assert(table.AutoFilter, Equals, true)
+	c.Assert(table.TotalsRow, Equals, false)
+	c.Assert(table.StyleName, Equals, "TableStyleMedium2")
+	c.Assert(table.ShowRowStripes, Equals, true)
+	c.Assert(table.ShowFirstColumn, Equals, false)
+	c.Assert(table.Columns, HasLen, 2)
+	c.Assert(table.Columns[1].Name, Equals, "Count")
+}
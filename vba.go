@@ -0,0 +1,80 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+)
+
+// These are the content types of the parts that make a workbook
+// macro-enabled.
+const (
+	contentTypeMacroEnabledWorkbook = "application/vnd.ms-excel.sheet.macroEnabled.main+xml"
+	contentTypeVBAProject           = "application/vnd.ms-office.vbaProject"
+)
+
+// ErrInvalidVBAProject is returned by SetVBAProject when it is given
+// something other than the content of a vbaProject.bin file.
+var ErrInvalidVBAProject = errors.New("not a VBA project")
+
+// IsMacroEnabled reports whether the File holds a VBA project, in
+// which case it should be saved with the .xlsm extension, as Excel
+// won't open a workbook with macros that is named .xlsx.
+func (f *File) IsMacroEnabled() bool {
+	return f.vbaProject != nil
+}
+
+// VBAProject returns the VBA project of a macro-enabled File, which is
+// the content of its vbaProject.bin part, or nil when it has none.
+func (f *File) VBAProject() []byte {
+	return f.vbaProject
+}
+
+// SetVBAProject sets the VBA project that the File is written with,
+// which makes it a macro-enabled workbook.  The project is the content
+// of the vbaProject.bin part of an .xlsm file, which can be taken from
+// any workbook that has the macros.  Setting it to nil removes the
+// macros.
+func (f *File) SetVBAProject(project []byte) error {
+	if project == nil {
+		f.vbaProject = nil
+		return nil
+	}
+	if !isCompoundFile(bytes.NewReader(project), int64(len(project))) {
+		return ErrInvalidVBAProject
+	}
+	f.vbaProject = project
+	return nil
+}
+
+// readVBAProjectFromZipFile returns the VBA project that the workbook
+// refers to, or nil when it isn't macro-enabled.
+func readVBAProjectFromZipFile(files map[string]*zip.File) ([]byte, error) {
+	rels, err := readPartRelations(files, "xl/workbook.xml")
+	if err != nil {
+		return nil, err
+	}
+	for _, rel := range rels {
+		if rel.Type != relationshipTypeVBAProject {
+			continue
+		}
+		if f, ok := files[rel.Target]; ok {
+			return readZipFileBytes(f)
+		}
+	}
+	return nil, nil
+}
+
+// makeMacroEnabled changes the content types of a workbook to those of
+// a macro-enabled one, with its VBA project in xl/vbaProject.bin.
+func (types *xlsxTypes) makeMacroEnabled() {
+	for i := range types.Overrides {
+		if types.Overrides[i].PartName == "/xl/workbook.xml" {
+			types.Overrides[i].ContentType = contentTypeMacroEnabledWorkbook
+		}
+	}
+	types.Overrides = append(types.Overrides, xlsxOverride{
+		PartName:    "/xl/vbaProject.bin",
+		ContentType: contentTypeVBAProject,
+	})
+}
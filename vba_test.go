@@ -0,0 +1,76 @@
+package xlsx
+
+import (
+	"bytes"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type VBASuite struct{}
+
+var _ = Suite(&VBASuite{})
+
+// makeTestVBAProject returns a compound file laid out like a VBA
+// project, which is all that SetVBAProject looks at.
+func makeTestVBAProject(c *C) []byte {
+	var buf bytes.Buffer
+	err := writeCompoundFile(&buf,
+		cfbStorage("VBA",
+			cfbStream("dir", []byte{1, 2, 3}),
+			cfbStream("_VBA_PROJECT", []byte{0xcc, 0x61}),
+		),
+		cfbStream("PROJECT", []byte("ID=\"{00000000-0000-0000-0000-000000000000}\"\r\n")),
+	)
+	c.Assert(err, IsNil)
+	return buf.Bytes()
+}
+
+// A VBA project is written with the content types of a macro-enabled
+// workbook, and is found again when the file is read.
+func (s *VBASuite) TestVBAProjectRoundTrip(c *C) {
+	f := NewFile()
+	_, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	c.Assert(f.IsMacroEnabled(), Equals, false)
+	c.Assert(f.SetVBAProject([]byte("Sub Macro()")), Equals, ErrInvalidVBAProject)
+
+	project := makeTestVBAProject(c)
+	c.Assert(f.SetVBAProject(project), IsNil)
+	c.Assert(f.IsMacroEnabled(), Equals, true)
+	parts, err := f.MarshallParts()
+	c.Assert(err, IsNil)
+	c.Assert(parts["xl/vbaProject.bin"], Equals, string(project))
+	c.Assert(strings.Contains(parts["xl/_rels/workbook.xml.rels"], `<Relationship Id="rId5" Target="vbaProject.bin" Type="http://schemas.microsoft.com/office/2006/relationships/vbaProject"></Relationship>`), Equals, true)
+	c.Assert(strings.Contains(parts["[Content_Types].xml"], `<Override PartName="/xl/workbook.xml" ContentType="application/vnd.ms-excel.sheet.macroEnabled.main+xml">`), Equals, true)
+	c.Assert(strings.Contains(parts["[Content_Types].xml"], `<Override PartName="/xl/vbaProject.bin" ContentType="application/vnd.ms-office.vbaProject">`), Equals, true)
+
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), IsNil)
+	read, err := OpenBinaryWithOptions(buf.Bytes(), OpenOptions{PreserveUnknownParts: true})
+	c.Assert(err, IsNil)
+	c.Assert(read.VBAProject(), DeepEquals, project)
+	parts, err = read.MarshallParts()
+	c.Assert(err, IsNil)
+	c.Assert(strings.Count(parts["xl/_rels/workbook.xml.rels"], "vbaProject.bin"), Equals, 1)
+
+	c.Assert(read.SetVBAProject(nil), IsNil)
+	parts, err = read.MarshallParts()
+	c.Assert(err, IsNil)
+	_, ok := parts["xl/vbaProject.bin"]
+	c.Assert(ok, Equals, false)
+	c.Assert(strings.Contains(parts["[Content_Types].xml"], "macroEnabled"), Equals, false)
+}
+
+// The code name that macros use for the workbook is kept.
+func (s *VBASuite) TestWorkbookCodeName(c *C) {
+	f := NewFile()
+	f.codeName = "ThisWorkbook"
+	_, err := f.AddSheet("Sheet1")
+	c.Assert(err, IsNil)
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), IsNil)
+	read, err := OpenBinary(buf.Bytes())
+	c.Assert(err, IsNil)
+	c.Assert(read.codeName, Equals, "ThisWorkbook")
+}
@@ -0,0 +1,119 @@
+package xlsx
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// xlsxChartSpace directly maps the chartSpace element from the
+// namespace http://schemas.openxmlformats.org/drawingml/2006/chart -
+// currently I have not checked it for completeness - it does as much
+// as I need.  Like drawings, charts are only ever read into these
+// types.
+type xlsxChartSpace struct {
+	XMLName xml.Name  `xml:"chartSpace"`
+	Chart   xlsxChart `xml:"chart"`
+}
+
+// xlsxChart maps the chart element from the namespace
+// http://schemas.openxmlformats.org/drawingml/2006/chart
+type xlsxChart struct {
+	Title    *xlsxChartTitle   `xml:"title"`
+	PlotArea xlsxChartPlotArea `xml:"plotArea"`
+	Legend   *xlsxChartLegend  `xml:"legend"`
+}
+
+// xlsxChartTitle maps the title element of a chart or axis.  Only
+// titles given as rich text are read.
+type xlsxChartTitle struct {
+	Paragraphs []xlsxChartParagraph `xml:"tx>rich>p"`
+}
+
+// xlsxChartParagraph maps a paragraph of rich text in a chart.
+type xlsxChartParagraph struct {
+	Runs []string `xml:"r>t"`
+}
+
+// text returns the plain text of a title, which is "" for a nil
+// title.
+func (t *xlsxChartTitle) text() string {
+	if t == nil {
+		return ""
+	}
+	var paragraphs []string
+	for _, p := range t.Paragraphs {
+		paragraphs = append(paragraphs, strings.Join(p.Runs, ""))
+	}
+	return strings.Join(paragraphs, "\n")
+}
+
+// xlsxChartPlotArea maps the plotArea element from the namespace
+// http://schemas.openxmlformats.org/drawingml/2006/chart - the chart
+// groups and axes are collected in document order.
+type xlsxChartPlotArea struct {
+	Items []xlsxChartPlotAreaItem `xml:",any"`
+}
+
+// xlsxChartPlotAreaItem maps the chart groups, such as barChart, and
+// the axes, such as catAx, of a plot area.
+type xlsxChartPlotAreaItem struct {
+	XMLName        xml.Name
+	BarDir         xlsxChartVal    `xml:"barDir"`
+	Grouping       xlsxChartVal    `xml:"grouping"`
+	Ser            []xlsxChartSer  `xml:"ser"`
+	AxID           []xlsxChartVal  `xml:"axId"`
+	Delete         xlsxChartVal    `xml:"delete"`
+	MajorGridlines *struct{}       `xml:"majorGridlines"`
+	Title          *xlsxChartTitle `xml:"title"`
+}
+
+// xlsxChartVal maps the many elements of a chart that only have a val
+// attribute.
+type xlsxChartVal struct {
+	Val string `xml:"val,attr"`
+}
+
+// xlsxChartSer maps the ser element from the namespace
+// http://schemas.openxmlformats.org/drawingml/2006/chart
+type xlsxChartSer struct {
+	Tx   xlsxChartTx         `xml:"tx"`
+	SpPr *xlsxChartSpPr      `xml:"spPr"`
+	Cat  xlsxChartDataSource `xml:"cat"`
+	Val  xlsxChartDataSource `xml:"val"`
+	XVal xlsxChartDataSource `xml:"xVal"`
+	YVal xlsxChartDataSource `xml:"yVal"`
+}
+
+// xlsxChartTx maps the tx element of a series, which holds its name.
+type xlsxChartTx struct {
+	StrRef string `xml:"strRef>f"`
+	V      string `xml:"v"`
+}
+
+// xlsxChartSpPr maps the shape properties of a series, as far as its
+// color goes.
+type xlsxChartSpPr struct {
+	SolidFill xlsxChartVal `xml:"solidFill>srgbClr"`
+	LineFill  xlsxChartVal `xml:"ln>solidFill>srgbClr"`
+}
+
+// xlsxChartDataSource maps the cat, val, xVal and yVal elements of a
+// series.
+type xlsxChartDataSource struct {
+	NumRef string `xml:"numRef>f"`
+	StrRef string `xml:"strRef>f"`
+}
+
+// ref returns the formula that the data source refers to.
+func (ds xlsxChartDataSource) ref() string {
+	if ds.NumRef != "" {
+		return ds.NumRef
+	}
+	return ds.StrRef
+}
+
+// xlsxChartLegend maps the legend element from the namespace
+// http://schemas.openxmlformats.org/drawingml/2006/chart
+type xlsxChartLegend struct {
+	LegendPos xlsxChartVal `xml:"legendPos"`
+}
@@ -0,0 +1,43 @@
+package xlsx
+
+import (
+	"encoding/xml"
+)
+
+// xlsxComments directly maps the comments element from the namespace
+// http://schemas.openxmlformats.org/spreadsheetml/2006/main -
+// currently I have not checked it for completeness - it does as much
+// as I need.
+type xlsxComments struct {
+	XMLName     xml.Name        `xml:"http://schemas.openxmlformats.org/spreadsheetml/2006/main comments"`
+	Authors     xlsxAuthors     `xml:"authors"`
+	CommentList xlsxCommentList `xml:"commentList"`
+}
+
+// xlsxAuthors directly maps the authors element from the namespace
+// http://schemas.openxmlformats.org/spreadsheetml/2006/main
+type xlsxAuthors struct {
+	Author []string `xml:"author"`
+}
+
+// xlsxCommentList directly maps the commentList element from the
+// namespace http://schemas.openxmlformats.org/spreadsheetml/2006/main
+type xlsxCommentList struct {
+	Comment []xlsxComment `xml:"comment"`
+}
+
+// xlsxComment directly maps the comment element from the namespace
+// http://schemas.openxmlformats.org/spreadsheetml/2006/main - the
+// text of a comment has the same form as a shared string item.
+type xlsxComment struct {
+	Ref      string `xml:"ref,attr"`
+	AuthorId int    `xml:"authorId,attr"`
+	Text     xlsxSI `xml:"text"`
+}
+
+// xlsxLegacyDrawing directly maps the legacyDrawing element from the
+// namespace http://schemas.openxmlformats.org/spreadsheetml/2006/main
+// - it refers to the VML drawing that holds the shapes of comments.
+type xlsxLegacyDrawing struct {
+	Id string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+}
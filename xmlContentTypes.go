@@ -48,3 +48,14 @@ func MakeDefaultContentTypes() (types xlsxTypes) {
 	types.Defaults[1].ContentType = "application/xml"
 	return
 }
+
+// addDefault adds a content type for every part with the given file
+// extension, unless one has already been added.
+func (types *xlsxTypes) addDefault(extension, contentType string) {
+	for _, d := range types.Defaults {
+		if d.Extension == extension {
+			return
+		}
+	}
+	types.Defaults = append(types.Defaults, xlsxDefault{Extension: extension, ContentType: contentType})
+}
@@ -0,0 +1,94 @@
+package xlsx
+
+import (
+	"encoding/xml"
+)
+
+// xlsxDrawing directly maps the drawing element from the namespace
+// http://schemas.openxmlformats.org/spreadsheetml/2006/main - it
+// refers to the drawing part that holds the pictures and charts of a
+// worksheet.
+type xlsxDrawing struct {
+	Id string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+}
+
+// xlsxDrawingAnchor maps the oneCellAnchor, twoCellAnchor and
+// absoluteAnchor elements from the namespace
+// http://schemas.openxmlformats.org/drawingml/2006/spreadsheetDrawing
+// - currently I have not checked it for completeness - it does as
+// much as I need.  The children of the wsDr element of a drawing are
+// read into it one at a time, and drawings are never written through
+// these types, as encoding/xml can't write the namespace prefixes that
+// Excel expects.
+type xlsxDrawingAnchor struct {
+	XMLName xml.Name
+	EditAs  string             `xml:"editAs,attr"`
+	From    *xlsxDrawingMarker `xml:"from"`
+	To      *xlsxDrawingMarker `xml:"to"`
+	Pos     *xlsxDrawingPoint  `xml:"pos"`
+	Ext     *xlsxDrawingExtent `xml:"ext"`
+	Pic     *xlsxDrawingPic    `xml:"pic"`
+
+	GraphicFrame *xlsxDrawingGraphicFrame `xml:"graphicFrame"`
+}
+
+// xlsxDrawingMarker maps the from and to elements from the namespace
+// http://schemas.openxmlformats.org/drawingml/2006/spreadsheetDrawing
+type xlsxDrawingMarker struct {
+	Col    int   `xml:"col"`
+	ColOff int64 `xml:"colOff"`
+	Row    int   `xml:"row"`
+	RowOff int64 `xml:"rowOff"`
+}
+
+// xlsxDrawingPoint maps the pos and off elements of a drawing.
+type xlsxDrawingPoint struct {
+	X int64 `xml:"x,attr"`
+	Y int64 `xml:"y,attr"`
+}
+
+// xlsxDrawingExtent maps the ext element of a drawing.
+type xlsxDrawingExtent struct {
+	Cx int64 `xml:"cx,attr"`
+	Cy int64 `xml:"cy,attr"`
+}
+
+// xlsxDrawingPic maps the pic element from the namespace
+// http://schemas.openxmlformats.org/drawingml/2006/spreadsheetDrawing
+type xlsxDrawingPic struct {
+	CNvPr xlsxDrawingCNvPr   `xml:"nvPicPr>cNvPr"`
+	Blip  xlsxDrawingBlip    `xml:"blipFill>blip"`
+	Ext   *xlsxDrawingExtent `xml:"spPr>xfrm>ext"`
+}
+
+// xlsxDrawingCNvPr maps the cNvPr element, which holds the id, name
+// and description of a shape.
+type xlsxDrawingCNvPr struct {
+	Id    int    `xml:"id,attr"`
+	Name  string `xml:"name,attr"`
+	Descr string `xml:"descr,attr"`
+}
+
+// xlsxDrawingBlip maps the blip element from the namespace
+// http://schemas.openxmlformats.org/drawingml/2006/main - it refers to
+// the image of a picture.
+type xlsxDrawingBlip struct {
+	Embed string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships embed,attr"`
+}
+
+// xlsxDrawingGraphicFrame maps the graphicFrame element from the
+// namespace
+// http://schemas.openxmlformats.org/drawingml/2006/spreadsheetDrawing
+// - it holds a chart.
+type xlsxDrawingGraphicFrame struct {
+	CNvPr xlsxDrawingCNvPr     `xml:"nvGraphicFramePr>cNvPr"`
+	Ext   *xlsxDrawingExtent   `xml:"xfrm>ext"`
+	Chart *xlsxDrawingChartRef `xml:"graphic>graphicData>chart"`
+}
+
+// xlsxDrawingChartRef maps the chart element from the namespace
+// http://schemas.openxmlformats.org/drawingml/2006/chart that refers
+// to a chart part from a drawing.
+type xlsxDrawingChartRef struct {
+	Id string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+}
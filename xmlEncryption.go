@@ -0,0 +1,50 @@
+package xlsx
+
+// xlsxEncryption directly maps the encryption element from the
+// namespace http://schemas.microsoft.com/office/2006/encryption, which
+// is the EncryptionInfo stream of a workbook that uses Agile
+// encryption.  It is only used for reading, the element is written by
+// makeAgileEncryptionInfo.
+type xlsxEncryption struct {
+	KeyData       xlsxEncryptionKeyData `xml:"keyData"`
+	DataIntegrity *xlsxDataIntegrity    `xml:"dataIntegrity"`
+	KeyEncryptors []xlsxKeyEncryptor    `xml:"keyEncryptors>keyEncryptor"`
+}
+
+// xlsxEncryptionKeyData directly maps the keyData element from the
+// namespace http://schemas.microsoft.com/office/2006/encryption
+type xlsxEncryptionKeyData struct {
+	SaltSize        int    `xml:"saltSize,attr"`
+	BlockSize       int    `xml:"blockSize,attr"`
+	KeyBits         int    `xml:"keyBits,attr"`
+	HashSize        int    `xml:"hashSize,attr"`
+	CipherAlgorithm string `xml:"cipherAlgorithm,attr"`
+	CipherChaining  string `xml:"cipherChaining,attr"`
+	HashAlgorithm   string `xml:"hashAlgorithm,attr"`
+	SaltValue       string `xml:"saltValue,attr"`
+}
+
+// xlsxDataIntegrity directly maps the dataIntegrity element from the
+// namespace http://schemas.microsoft.com/office/2006/encryption
+type xlsxDataIntegrity struct {
+	EncryptedHmacKey   string `xml:"encryptedHmacKey,attr"`
+	EncryptedHmacValue string `xml:"encryptedHmacValue,attr"`
+}
+
+// xlsxKeyEncryptor directly maps the keyEncryptor element from the
+// namespace http://schemas.microsoft.com/office/2006/encryption
+type xlsxKeyEncryptor struct {
+	URI          string            `xml:"uri,attr"`
+	EncryptedKey *xlsxEncryptedKey `xml:"encryptedKey"`
+}
+
+// xlsxEncryptedKey directly maps the encryptedKey element from the
+// namespace
+// http://schemas.microsoft.com/office/2006/keyEncryptor/password
+type xlsxEncryptedKey struct {
+	xlsxEncryptionKeyData
+	SpinCount                  int    `xml:"spinCount,attr"`
+	EncryptedVerifierHashInput string `xml:"encryptedVerifierHashInput,attr"`
+	EncryptedVerifierHashValue string `xml:"encryptedVerifierHashValue,attr"`
+	EncryptedKeyValue          string `xml:"encryptedKeyValue,attr"`
+}
@@ -0,0 +1,65 @@
+package xlsx
+
+import (
+	"encoding/xml"
+)
+
+// xlsxCoreProperties directly maps the coreProperties element from the
+// namespace
+// http://schemas.openxmlformats.org/package/2006/metadata/core-properties,
+// whose children come from the Dublin Core namespaces.  It is only
+// used for reading, as encoding/xml can't write the namespace prefixes
+// that Excel expects.
+type xlsxCoreProperties struct {
+	XMLName        xml.Name `xml:"coreProperties"`
+	Title          string   `xml:"title"`
+	Subject        string   `xml:"subject"`
+	Creator        string   `xml:"creator"`
+	Keywords       string   `xml:"keywords"`
+	Description    string   `xml:"description"`
+	LastModifiedBy string   `xml:"lastModifiedBy"`
+	Revision       string   `xml:"revision"`
+	Created        string   `xml:"created"`
+	Modified       string   `xml:"modified"`
+	Category       string   `xml:"category"`
+}
+
+// xlsxExtendedProperties directly maps the Properties element from the
+// namespace
+// http://schemas.openxmlformats.org/officeDocument/2006/extended-properties
+// - currently I have not checked it for completeness - it does as
+// much as I need.
+type xlsxExtendedProperties struct {
+	XMLName     xml.Name `xml:"Properties"`
+	Application string   `xml:"Application"`
+	Company     string   `xml:"Company"`
+	AppVersion  string   `xml:"AppVersion"`
+}
+
+// xlsxCustomProperties directly maps the Properties element from the
+// namespace
+// http://schemas.openxmlformats.org/officeDocument/2006/custom-properties
+type xlsxCustomProperties struct {
+	XMLName  xml.Name             `xml:"Properties"`
+	Property []xlsxCustomProperty `xml:"property"`
+}
+
+// xlsxCustomProperty directly maps the property element from the
+// namespace
+// http://schemas.openxmlformats.org/officeDocument/2006/custom-properties
+// - its value is a single element from the docPropsVTypes namespace,
+// whose name is its type.
+type xlsxCustomProperty struct {
+	FmtID string                  `xml:"fmtid,attr"`
+	PID   int                     `xml:"pid,attr"`
+	Name  string                  `xml:"name,attr"`
+	Value xlsxCustomPropertyValue `xml:",any"`
+}
+
+// xlsxCustomPropertyValue maps any of the elements from the namespace
+// http://schemas.openxmlformats.org/officeDocument/2006/docPropsVTypes
+// that hold a simple value.
+type xlsxCustomPropertyValue struct {
+	XMLName xml.Name
+	Text    string `xml:",chardata"`
+}
@@ -19,7 +19,7 @@ type xlsxSST struct {
 // currently I have not checked this for completeness - it does as
 // much as I need.
 type xlsxSI struct {
-	T string  `xml:"t"`
+	T string  `xml:"t,omitempty"`
 	R []xlsxR `xml:"r"`
 }
 
@@ -28,5 +28,32 @@ type xlsxSI struct {
 // currently I have not checked this for completeness - it does as
 // much as I need.
 type xlsxR struct {
-	T string `xml:"t"`
+	RPr *xlsxRunProperties `xml:"rPr,omitempty"`
+	T   xlsxT              `xml:"t"`
+}
+
+// xlsxT directly maps the t element from the namespace
+// http://schemas.openxmlformats.org/spreadsheetml/2006/main -
+// currently I have not checked this for completeness - it does as
+// much as I need.
+type xlsxT struct {
+	Space string `xml:"http://www.w3.org/XML/1998/namespace space,attr,omitempty"`
+	Text  string `xml:",chardata"`
+}
+
+// xlsxRunProperties directly maps the rPr element from the namespace
+// http://schemas.openxmlformats.org/spreadsheetml/2006/main -
+// currently I have not checked this for completeness - it does as
+// much as I need.
+type xlsxRunProperties struct {
+	B         *xlsxVal   `xml:"b,omitempty"`
+	I         *xlsxVal   `xml:"i,omitempty"`
+	Strike    *xlsxVal   `xml:"strike,omitempty"`
+	U         *xlsxVal   `xml:"u,omitempty"`
+	VertAlign *xlsxVal   `xml:"vertAlign,omitempty"`
+	Sz        *xlsxVal   `xml:"sz,omitempty"`
+	Color     *xlsxColor `xml:"color,omitempty"`
+	RFont     *xlsxVal   `xml:"rFont,omitempty"`
+	Family    *xlsxVal   `xml:"family,omitempty"`
+	Charset   *xlsxVal   `xml:"charset,omitempty"`
 }
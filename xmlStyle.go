@@ -100,6 +100,7 @@ type xlsxStyleSheet struct {
 	CellStyleXfs *xlsxCellStyleXfs `xml:"cellStyleXfs,omitempty"`
 	CellXfs      xlsxCellXfs       `xml:"cellXfs,omitempty"`
 	NumFmts      xlsxNumFmts       `xml:"numFmts,omitempty"`
+	Dxfs         *xlsxDxfs         `xml:"dxfs,omitempty"`
 
 	theme *theme
 
@@ -135,6 +136,7 @@ func (styles *xlsxStyleSheet) reset() {
 	// add default xf
 	styles.CellXfs = xlsxCellXfs{Count: 1, Xf: []xlsxXf{{}}}
 	styles.NumFmts = xlsxNumFmts{}
+	styles.Dxfs = nil
 }
 
 func (styles *xlsxStyleSheet) getStyle(styleIndex int) *Style {
@@ -164,6 +166,7 @@ func (styles *xlsxStyleSheet) getStyle(styleIndex int) *Style {
 		style.ApplyFill = xf.ApplyFill || namedStyleXf.ApplyFill
 		style.ApplyFont = xf.ApplyFont || namedStyleXf.ApplyFont
 		style.ApplyAlignment = xf.ApplyAlignment || namedStyleXf.ApplyAlignment
+		style.ApplyProtection = xf.ApplyProtection || namedStyleXf.ApplyProtection
 
 		if xf.BorderId > -1 && xf.BorderId < styles.Borders.Count {
 			var border xlsxBorder
@@ -212,6 +215,10 @@ func (styles *xlsxStyleSheet) getStyle(styleIndex int) *Style {
 		}
 		style.Alignment.WrapText = xf.Alignment.WrapText
         	style.Alignment.TextRotation = xf.Alignment.TextRotation
+		style.Protection.Locked = xf.Protection.isLocked()
+		if xf.Protection != nil {
+			style.Protection.Hidden = xf.Protection.Hidden
+		}
 		
         	styles.Lock()
 		styles.styleCache[styleIndex] = style
@@ -333,6 +340,31 @@ func (styles *xlsxStyleSheet) addCellXf(xCellXf xlsxXf) (index int) {
 	return
 }
 
+// addDxf adds a differential format, unless an identical one already
+// exists, and returns its index.
+func (styles *xlsxStyleSheet) addDxf(xDxf xlsxDxf) (index int, err error) {
+	if styles.Dxfs == nil {
+		styles.Dxfs = &xlsxDxfs{}
+	}
+	marshalled, err := xDxf.Marshal()
+	if err != nil {
+		return 0, err
+	}
+	for index, dxf := range styles.Dxfs.Dxf {
+		existing, err := dxf.Marshal()
+		if err != nil {
+			return 0, err
+		}
+		if existing == marshalled {
+			return index, nil
+		}
+	}
+	styles.Dxfs.Dxf = append(styles.Dxfs.Dxf, xDxf)
+	index = styles.Dxfs.Count
+	styles.Dxfs.Count++
+	return index, nil
+}
+
 // newNumFmt generate a xlsxNumFmt according the format code. When the FormatCode is built in, it will return a xlsxNumFmt with the NumFmtId defined in ECMA document, otherwise it will generate a new NumFmtId greater than 164.
 func (styles *xlsxStyleSheet) newNumFmt(formatCode string) xlsxNumFmt {
 	if compareFormatString(formatCode, "general") {
@@ -436,6 +468,14 @@ func (styles *xlsxStyleSheet) Marshal() (string, error) {
 		result += xcellStyles
 	}
 
+	if styles.Dxfs != nil {
+		xdxfs, err := styles.Dxfs.Marshal()
+		if err != nil {
+			return "", err
+		}
+		result += xdxfs
+	}
+
 	return result + "</styleSheet>", nil
 }
 
@@ -686,9 +726,10 @@ func (patternFill *xlsxPatternFill) Marshal() (result string, err error) {
 // currently I have not checked it for completeness - it does as much
 // as I need.
 type xlsxColor struct {
-	RGB   string  `xml:"rgb,attr,omitempty"`
-	Theme *int    `xml:"theme,attr,omitempty"`
-	Tint  float64 `xml:"tint,attr,omitempty"`
+	RGB     string  `xml:"rgb,attr,omitempty"`
+	Theme   *int    `xml:"theme,attr,omitempty"`
+	Indexed *int    `xml:"indexed,attr,omitempty"`
+	Tint    float64 `xml:"tint,attr,omitempty"`
 }
 
 func (color *xlsxColor) Equals(other xlsxColor) bool {
@@ -792,6 +833,97 @@ func (line *xlsxLine) Equals(other xlsxLine) bool {
 	return line.Style == other.Style && line.Color.Equals(other.Color)
 }
 
+// xlsxDxfs directly maps the dxfs element in the namespace
+// http://schemas.openxmlformats.org/spreadsheetml/2006/main -
+// currently I have not checked it for completeness - it does as much
+// as I need.
+type xlsxDxfs struct {
+	Count int       `xml:"count,attr"`
+	Dxf   []xlsxDxf `xml:"dxf,omitempty"`
+}
+
+func (dxfs *xlsxDxfs) Marshal() (result string, err error) {
+	if dxfs.Count == 0 {
+		return
+	}
+	result = fmt.Sprintf(`<dxfs count="%d">`, dxfs.Count)
+	for _, dxf := range dxfs.Dxf {
+		var xdxf string
+		xdxf, err = dxf.Marshal()
+		if err != nil {
+			return
+		}
+		result += xdxf
+	}
+	result += `</dxfs>`
+	return
+}
+
+// xlsxDxf directly maps the dxf element in the namespace
+// http://schemas.openxmlformats.org/spreadsheetml/2006/main - a
+// differential format only holds the parts of a style that it
+// changes.
+type xlsxDxf struct {
+	Font   *xlsxFont   `xml:"font,omitempty"`
+	NumFmt *xlsxNumFmt `xml:"numFmt,omitempty"`
+	Fill   *xlsxFill   `xml:"fill,omitempty"`
+	Border *xlsxBorder `xml:"border,omitempty"`
+}
+
+func (dxf *xlsxDxf) Marshal() (result string, err error) {
+	result = `<dxf>`
+	if dxf.Font != nil {
+		var xfont string
+		xfont, err = dxf.Font.Marshal()
+		if err != nil {
+			return
+		}
+		result += xfont
+	}
+	if dxf.NumFmt != nil {
+		var xNumFmt string
+		xNumFmt, err = dxf.NumFmt.Marshal()
+		if err != nil {
+			return
+		}
+		result += xNumFmt
+	}
+	if dxf.Fill != nil {
+		var xfill string
+		xfill, err = dxf.Fill.Marshal()
+		if err != nil {
+			return
+		}
+		result += xfill
+	}
+	if dxf.Border != nil {
+		// Unlike the borders of a cell format, the border of a
+		// differential format only lists the sides it changes.
+		result += `<border>`
+		sides := []struct {
+			name string
+			line xlsxLine
+		}{
+			{"left", dxf.Border.Left},
+			{"right", dxf.Border.Right},
+			{"top", dxf.Border.Top},
+			{"bottom", dxf.Border.Bottom},
+		}
+		for _, side := range sides {
+			if side.line.Style == "" {
+				continue
+			}
+			result += fmt.Sprintf(`<%s style="%s">`, side.name, side.line.Style)
+			if side.line.Color.RGB != "" {
+				result += fmt.Sprintf(`<color rgb="%s"/>`, side.line.Color.RGB)
+			}
+			result += fmt.Sprintf(`</%s>`, side.name)
+		}
+		result += `</border>`
+	}
+	return result + `</dxf>`, nil
+}
+
 type xlsxCellStyles struct {
 	XMLName   xml.Name        `xml:"cellStyles"`
 	Count     int             `xml:"count,attr"`
@@ -880,18 +1012,19 @@ func (cellXfs *xlsxCellXfs) Marshal(outputBorderMap, outputFillMap, outputFontMa
 // currently I have not checked it for completeness - it does as much
 // as I need.
 type xlsxXf struct {
-	ApplyAlignment    bool          `xml:"applyAlignment,attr"`
-	ApplyBorder       bool          `xml:"applyBorder,attr"`
-	ApplyFont         bool          `xml:"applyFont,attr"`
-	ApplyFill         bool          `xml:"applyFill,attr"`
-	ApplyNumberFormat bool          `xml:"applyNumberFormat,attr"`
-	ApplyProtection   bool          `xml:"applyProtection,attr"`
-	BorderId          int           `xml:"borderId,attr"`
-	FillId            int           `xml:"fillId,attr"`
-	FontId            int           `xml:"fontId,attr"`
-	NumFmtId          int           `xml:"numFmtId,attr"`
-	XfId              *int          `xml:"xfId,attr,omitempty"`
-	Alignment         xlsxAlignment `xml:"alignment"`
+	ApplyAlignment    bool            `xml:"applyAlignment,attr"`
+	ApplyBorder       bool            `xml:"applyBorder,attr"`
+	ApplyFont         bool            `xml:"applyFont,attr"`
+	ApplyFill         bool            `xml:"applyFill,attr"`
+	ApplyNumberFormat bool            `xml:"applyNumberFormat,attr"`
+	ApplyProtection   bool            `xml:"applyProtection,attr"`
+	BorderId          int             `xml:"borderId,attr"`
+	FillId            int             `xml:"fillId,attr"`
+	FontId            int             `xml:"fontId,attr"`
+	NumFmtId          int             `xml:"numFmtId,attr"`
+	XfId              *int            `xml:"xfId,attr,omitempty"`
+	Alignment         xlsxAlignment   `xml:"alignment"`
+	Protection        *xlsxProtection `xml:"protection"`
 }
 
 func (xf *xlsxXf) Equals(other xlsxXf) bool {
@@ -907,7 +1040,8 @@ func (xf *xlsxXf) Equals(other xlsxXf) bool {
 		(xf.XfId == other.XfId ||
 			((xf.XfId != nil && other.XfId != nil) &&
 				*xf.XfId == *other.XfId)) &&
-		xf.Alignment.Equals(other.Alignment)
+		xf.Alignment.Equals(other.Alignment) &&
+		xf.Protection.Equals(other.Protection)
 }
 
 func (xf *xlsxXf) Marshal(outputBorderMap, outputFillMap, outputFontMap map[int]int) (result string, err error) {
@@ -920,7 +1054,11 @@ func (xf *xlsxXf) Marshal(outputBorderMap, outputFillMap, outputFontMap map[int]
 	if err != nil {
 		return result, err
 	}
-	return result + xAlignment + "</xf>", nil
+	result += xAlignment
+	if xf.Protection != nil {
+		result += xf.Protection.Marshal()
+	}
+	return result + "</xf>", nil
 }
 
 type xlsxAlignment struct {
@@ -951,6 +1089,32 @@ func (alignment *xlsxAlignment) Marshal() (result string, err error) {
 	return fmt.Sprintf(`<alignment horizontal="%s" indent="%d" shrinkToFit="%b" textRotation="%d" vertical="%s" wrapText="%b"/>`, alignment.Horizontal, alignment.Indent, bool2Int(alignment.ShrinkToFit), alignment.TextRotation, alignment.Vertical, bool2Int(alignment.WrapText)), nil
 }
 
+// xlsxProtection directly maps the protection element in the namespace
+// http://schemas.openxmlformats.org/spreadsheetml/2006/main.  Locked
+// is a pointer because a cell is locked when the attribute is missing.
+type xlsxProtection struct {
+	Locked *bool `xml:"locked,attr"`
+	Hidden bool  `xml:"hidden,attr"`
+}
+
+// isLocked returns the value of the locked attribute, which is true
+// when there is no protection element at all.
+func (protection *xlsxProtection) isLocked() bool {
+	return protection == nil || protection.Locked == nil || *protection.Locked
+}
+
+func (protection *xlsxProtection) Equals(other *xlsxProtection) bool {
+	if protection == nil || other == nil {
+		return protection == other
+	}
+	return protection.isLocked() == other.isLocked() &&
+		protection.Hidden == other.Hidden
+}
+
+func (protection *xlsxProtection) Marshal() string {
+	return fmt.Sprintf(`<protection locked="%b" hidden="%b"/>`, bool2Int(protection.isLocked()), bool2Int(protection.Hidden))
+}
+
 func bool2Int(b bool) int {
 	if b {
 		return 1
@@ -337,6 +337,35 @@ func (x *XMLStyleSuite) TestXfEquals(c *C) {
 
 	i2 = 2
 	c.Assert(xfA.Equals(xfB), Equals, false)
+	xfB.XfId = &i1
+
+	locked, unlocked := true, false
+	xfA.Protection = &xlsxProtection{Locked: &unlocked}
+	c.Assert(xfA.Equals(xfB), Equals, false)
+	xfB.Protection = &xlsxProtection{Locked: &unlocked}
+	c.Assert(xfA.Equals(xfB), Equals, true)
+	xfB.Protection.Hidden = true
+	c.Assert(xfA.Equals(xfB), Equals, false)
+	// A missing locked attribute means the cell is locked.
+	xfA.Protection = &xlsxProtection{}
+	xfB.Protection = &xlsxProtection{Locked: &locked}
+	c.Assert(xfA.Equals(xfB), Equals, true)
+}
+
+// The protection element follows the alignment of a cell xf.
+func (x *XMLStyleSuite) TestMarshalXlsxStyleSheetWithACellXfProtection(c *C) {
+	styles := newXlsxStyleSheet(nil)
+	unlocked := false
+	styles.CellXfs = xlsxCellXfs{Count: 1, Xf: []xlsxXf{{
+		ApplyProtection: true,
+		Protection:      &xlsxProtection{Locked: &unlocked, Hidden: true},
+	}}}
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><cellXfs count="1"><xf applyAlignment="0" applyBorder="0" applyFont="0" applyFill="0" applyNumberFormat="0" applyProtection="1" borderId="0" fillId="0" fontId="0" numFmtId="0"><alignment horizontal="general" indent="0" shrinkToFit="0" textRotation="0" vertical="bottom" wrapText="0"/><protection locked="0" hidden="1"/></xf></cellXfs></styleSheet>`
+	result, err := styles.Marshal()
+	c.Assert(err, IsNil)
+	c.Assert(string(result), Equals, expected)
 }
 
 func (s *CellSuite) TestNewNumFmt(c *C) {
@@ -0,0 +1,64 @@
+package xlsx
+
+import (
+	"encoding/xml"
+)
+
+// xlsxTable directly maps the table element from the namespace
+// http://schemas.openxmlformats.org/spreadsheetml/2006/main -
+// currently I have not checked it for completeness - it does as much
+// as I need.
+type xlsxTable struct {
+	XMLName        xml.Name            `xml:"http://schemas.openxmlformats.org/spreadsheetml/2006/main table"`
+	Id             int                 `xml:"id,attr"`
+	Name           string              `xml:"name,attr,omitempty"`
+	DisplayName    string              `xml:"displayName,attr"`
+	Ref            string              `xml:"ref,attr"`
+	HeaderRowCount *int                `xml:"headerRowCount,attr"`
+	TotalsRowCount int                 `xml:"totalsRowCount,attr,omitempty"`
+	TotalsRowShown *bool               `xml:"totalsRowShown,attr"`
+	AutoFilter     *xlsxAutoFilter     `xml:"autoFilter,omitempty"`
+	TableColumns   xlsxTableColumns    `xml:"tableColumns"`
+	TableStyleInfo *xlsxTableStyleInfo `xml:"tableStyleInfo,omitempty"`
+}
+
+// xlsxTableColumns directly maps the tableColumns element from the
+// namespace http://schemas.openxmlformats.org/spreadsheetml/2006/main
+type xlsxTableColumns struct {
+	Count       int               `xml:"count,attr"`
+	TableColumn []xlsxTableColumn `xml:"tableColumn"`
+}
+
+// xlsxTableColumn directly maps the tableColumn element from the
+// namespace http://schemas.openxmlformats.org/spreadsheetml/2006/main
+type xlsxTableColumn struct {
+	Id                int    `xml:"id,attr"`
+	Name              string `xml:"name,attr"`
+	TotalsRowFunction string `xml:"totalsRowFunction,attr,omitempty"`
+	TotalsRowLabel    string `xml:"totalsRowLabel,attr,omitempty"`
+	TotalsRowFormula  string `xml:"totalsRowFormula,omitempty"`
+}
+
+// xlsxTableStyleInfo directly maps the tableStyleInfo element from the
+// namespace http://schemas.openxmlformats.org/spreadsheetml/2006/main
+type xlsxTableStyleInfo struct {
+	Name              string `xml:"name,attr,omitempty"`
+	ShowFirstColumn   bool   `xml:"showFirstColumn,attr"`
+	ShowLastColumn    bool   `xml:"showLastColumn,attr"`
+	ShowRowStripes    bool   `xml:"showRowStripes,attr"`
+	ShowColumnStripes bool   `xml:"showColumnStripes,attr"`
+}
+
+// xlsxTableParts directly maps the tableParts element from the
+// namespace http://schemas.openxmlformats.org/spreadsheetml/2006/main
+// - each tablePart refers to a table part of the worksheet.
+type xlsxTableParts struct {
+	Count     int             `xml:"count,attr"`
+	TablePart []xlsxTablePart `xml:"tablePart"`
+}
+
+// xlsxTablePart directly maps the tablePart element from the namespace
+// http://schemas.openxmlformats.org/spreadsheetml/2006/main
+type xlsxTablePart struct {
+	Id string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+}
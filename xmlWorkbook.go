@@ -24,9 +24,10 @@ type xlsxWorkbookRels struct {
 
 // xmlxWorkbookRelation maps sheet id and xl/worksheets/sheet%d.xml
 type xlsxWorkbookRelation struct {
-	Id     string `xml:",attr"`
-	Target string `xml:",attr"`
-	Type   string `xml:",attr"`
+	Id         string `xml:",attr"`
+	Target     string `xml:",attr"`
+	Type       string `xml:",attr"`
+	TargetMode string `xml:",attr,omitempty"`
 }
 
 // xlsxWorkbook directly maps the workbook element from the namespace
@@ -40,8 +41,10 @@ type xlsxWorkbook struct {
 	WorkbookProtection xlsxWorkbookProtection `xml:"workbookProtection"`
 	BookViews          xlsxBookViews          `xml:"bookViews"`
 	Sheets             xlsxSheets             `xml:"sheets"`
+	ExternalReferences *xlsxInnerXML          `xml:"externalReferences"`
 	DefinedNames       xlsxDefinedNames       `xml:"definedNames"`
 	CalcPr             xlsxCalcPr             `xml:"calcPr"`
+	PivotCaches        *xlsxInnerXML          `xml:"pivotCaches"`
 }
 
 // xlsxWorkbookProtection directly maps the workbookProtection element from the
@@ -49,7 +52,13 @@ type xlsxWorkbook struct {
 // - currently I have not checked it for completeness - it does as
 // much as I need.
 type xlsxWorkbookProtection struct {
-	// We don't need this, yet.
+	WorkbookPassword      string `xml:"workbookPassword,attr,omitempty"`
+	LockStructure         bool   `xml:"lockStructure,attr,omitempty"`
+	LockWindows           bool   `xml:"lockWindows,attr,omitempty"`
+	WorkbookAlgorithmName string `xml:"workbookAlgorithmName,attr,omitempty"`
+	WorkbookHashValue     string `xml:"workbookHashValue,attr,omitempty"`
+	WorkbookSaltValue     string `xml:"workbookSaltValue,attr,omitempty"`
+	WorkbookSpinCount     int    `xml:"workbookSpinCount,attr,omitempty"`
 }
 
 // xlsxFileVersion directly maps the fileVersion element from the
@@ -72,6 +81,7 @@ type xlsxWorkbookPr struct {
 	BackupFile          bool   `xml:"backupFile,attr,omitempty"`
 	ShowObjects         string `xml:"showObjects,attr,omitempty"`
 	Date1904            bool   `xml:"date1904,attr"`
+	CodeName            string `xml:"codeName,attr,omitempty"`
 }
 
 // xlsxBookViews directly maps the bookViews element from the
@@ -141,7 +151,7 @@ type xlsxDefinedName struct {
 	Help              string `xml:"help,attr,omitempty"`
 	ShortcutKey       string `xml:"shortcutKey,attr,omitempty"`
 	StatusBar         string `xml:"statusBar,attr,omitempty"`
-	LocalSheetID      int    `xml:"localSheetId,attr,omitempty"`
+	LocalSheetID      int    `xml:"localSheetId,attr"`
 	FunctionGroupID   int    `xml:"functionGroupId,attr,omitempty"`
 	Function          bool   `xml:"function,attr,omitempty"`
 	Hidden            bool   `xml:"hidden,attr,omitempty"`
@@ -149,6 +159,45 @@ type xlsxDefinedName struct {
 	PublishToServer   bool   `xml:"publishToServer,attr,omitempty"`
 	WorkbookParameter bool   `xml:"workbookParameter,attr,omitempty"`
 	Xlm               bool   `xml:"xml,attr,omitempty"`
+	// HasLocalSheetID is set for a name that is local to the sheet
+	// given by LocalSheetID, whose localSheetId attribute is written
+	// even when it is 0.
+	HasLocalSheetID bool `xml:"-"`
+}
+
+// definedNameLocalSheetID is an xlsxDefinedName whose localSheetId
+// attribute can be told apart from a missing one.  plainDefinedName
+// leaves out the methods of xlsxDefinedName, whose LocalSheetID field
+// is hidden by the one here.
+type plainDefinedName xlsxDefinedName
+
+type definedNameLocalSheetID struct {
+	plainDefinedName
+	LocalSheetID *int `xml:"localSheetId,attr"`
+}
+
+// MarshalXML writes the localSheetId attribute only for names that are
+// local to a sheet.
+func (dn xlsxDefinedName) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	v := definedNameLocalSheetID{plainDefinedName: plainDefinedName(dn)}
+	if dn.HasLocalSheetID {
+		v.LocalSheetID = &dn.LocalSheetID
+	}
+	return e.EncodeElement(v, start)
+}
+
+// UnmarshalXML sets HasLocalSheetID when the name has a localSheetId
+// attribute.
+func (dn *xlsxDefinedName) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var v definedNameLocalSheetID
+	if err := d.DecodeElement(&v, &start); err != nil {
+		return err
+	}
+	*dn = xlsxDefinedName(v.plainDefinedName)
+	if v.LocalSheetID != nil {
+		dn.LocalSheetID, dn.HasLocalSheetID = *v.LocalSheetID, true
+	}
+	return nil
 }
 
 // xlsxCalcPr directly maps the calcPr element from the namespace
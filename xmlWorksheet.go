@@ -10,20 +10,183 @@ import (
 // currently I have not checked it for completeness - it does as much
 // as I need.
 type xlsxWorksheet struct {
-	XMLName         xml.Name                 `xml:"http://schemas.openxmlformats.org/spreadsheetml/2006/main worksheet"`
-	SheetPr         xlsxSheetPr              `xml:"sheetPr"`
-	Dimension       xlsxDimension            `xml:"dimension"`
-	SheetViews      xlsxSheetViews           `xml:"sheetViews"`
-	SheetFormatPr   xlsxSheetFormatPr        `xml:"sheetFormatPr"`
-	Cols            *xlsxCols                `xml:"cols,omitempty"`
-	SheetData       xlsxSheetData            `xml:"sheetData"`
-	DataValidations *xlsxCellDataValidations `xml:"dataValidations"`
-	AutoFilter      *xlsxAutoFilter          `xml:"autoFilter,omitempty"`
-	MergeCells      *xlsxMergeCells          `xml:"mergeCells,omitempty"`
-	PrintOptions    xlsxPrintOptions         `xml:"printOptions"`
-	PageMargins     xlsxPageMargins          `xml:"pageMargins"`
-	PageSetUp       xlsxPageSetUp            `xml:"pageSetup"`
-	HeaderFooter    xlsxHeaderFooter         `xml:"headerFooter"`
+	XMLName               xml.Name                     `xml:"http://schemas.openxmlformats.org/spreadsheetml/2006/main worksheet"`
+	Attrs                 []xml.Attr                   `xml:",any,attr"`
+	SheetPr               xlsxSheetPr                  `xml:"sheetPr"`
+	Dimension             xlsxDimension                `xml:"dimension"`
+	SheetViews            xlsxSheetViews               `xml:"sheetViews"`
+	SheetFormatPr         xlsxSheetFormatPr            `xml:"sheetFormatPr"`
+	Cols                  *xlsxCols                    `xml:"cols,omitempty"`
+	SheetData             xlsxSheetData                `xml:"sheetData"`
+	SheetCalcPr           *xlsxRawElement              `xml:"sheetCalcPr"`
+	SheetProtection       *xlsxSheetProtection         `xml:"sheetProtection,omitempty"`
+	ProtectedRanges       *xlsxRawElement              `xml:"protectedRanges"`
+	Scenarios             *xlsxRawElement              `xml:"scenarios"`
+	AutoFilter            *xlsxAutoFilter              `xml:"autoFilter,omitempty"`
+	SortState             *xlsxRawElement              `xml:"sortState"`
+	DataConsolidate       *xlsxRawElement              `xml:"dataConsolidate"`
+	CustomSheetViews      *xlsxRawElement              `xml:"customSheetViews"`
+	MergeCells            *xlsxMergeCells              `xml:"mergeCells,omitempty"`
+	PhoneticPr            *xlsxRawElement              `xml:"phoneticPr"`
+	ConditionalFormatting []*xlsxConditionalFormatting `xml:"conditionalFormatting,omitempty"`
+	DataValidations       *xlsxCellDataValidations     `xml:"dataValidations"`
+	Hyperlinks            *xlsxHyperlinks              `xml:"hyperlinks,omitempty"`
+	PrintOptions          xlsxPrintOptions             `xml:"printOptions"`
+	PageMargins           xlsxPageMargins              `xml:"pageMargins"`
+	PageSetUp             xlsxPageSetUp                `xml:"pageSetup"`
+	HeaderFooter          xlsxHeaderFooter             `xml:"headerFooter"`
+	RowBreaks             *xlsxRawElement              `xml:"rowBreaks"`
+	ColBreaks             *xlsxRawElement              `xml:"colBreaks"`
+	CustomProperties      *xlsxRawElement              `xml:"customProperties"`
+	CellWatches           *xlsxRawElement              `xml:"cellWatches"`
+	IgnoredErrors         *xlsxRawElement              `xml:"ignoredErrors"`
+	SmartTags             *xlsxRawElement              `xml:"smartTags"`
+	Drawing               *xlsxDrawing                 `xml:"drawing,omitempty"`
+	LegacyDrawing         *xlsxLegacyDrawing           `xml:"legacyDrawing,omitempty"`
+	LegacyDrawingHF       *xlsxRawElement              `xml:"legacyDrawingHF"`
+	DrawingHF             *xlsxRawElement              `xml:"drawingHF"`
+	Picture               *xlsxRawElement              `xml:"picture"`
+	OleObjects            *xlsxRawElement              `xml:"oleObjects"`
+	Controls              *xlsxRawElement              `xml:"controls"`
+	WebPublishItems       *xlsxRawElement              `xml:"webPublishItems"`
+	// Unknown holds the elements that are not part of the schema,
+	// mostly mc:AlternateContent blocks around controls and OLE
+	// objects, which is why they are written here.
+	Unknown    []xlsxRawElement `xml:",any"`
+	TableParts *xlsxTableParts  `xml:"tableParts,omitempty"`
+	ExtLst     *xlsxInnerXML    `xml:"extLst,omitempty"`
+}
+
+// xlsxSheetProtection directly maps the sheetProtection element in the
+// namespace http://schemas.openxmlformats.org/spreadsheetml/2006/main
+// - the flags that say what may be done to a protected sheet are true
+// when that action is prohibited.  They are pointers because each has
+// its own default when it is left out.
+type xlsxSheetProtection struct {
+	Password            string `xml:"password,attr,omitempty"`
+	AlgorithmName       string `xml:"algorithmName,attr,omitempty"`
+	HashValue           string `xml:"hashValue,attr,omitempty"`
+	SaltValue           string `xml:"saltValue,attr,omitempty"`
+	SpinCount           int    `xml:"spinCount,attr,omitempty"`
+	Sheet               *bool  `xml:"sheet,attr"`
+	Objects             *bool  `xml:"objects,attr"`
+	Scenarios           *bool  `xml:"scenarios,attr"`
+	FormatCells         *bool  `xml:"formatCells,attr"`
+	FormatColumns       *bool  `xml:"formatColumns,attr"`
+	FormatRows          *bool  `xml:"formatRows,attr"`
+	InsertColumns       *bool  `xml:"insertColumns,attr"`
+	InsertRows          *bool  `xml:"insertRows,attr"`
+	InsertHyperlinks    *bool  `xml:"insertHyperlinks,attr"`
+	DeleteColumns       *bool  `xml:"deleteColumns,attr"`
+	DeleteRows          *bool  `xml:"deleteRows,attr"`
+	SelectLockedCells   *bool  `xml:"selectLockedCells,attr"`
+	Sort                *bool  `xml:"sort,attr"`
+	AutoFilter          *bool  `xml:"autoFilter,attr"`
+	PivotTables         *bool  `xml:"pivotTables,attr"`
+	SelectUnlockedCells *bool  `xml:"selectUnlockedCells,attr"`
+}
+
+// xlsxConditionalFormatting directly maps the conditionalFormatting
+// element in the namespace
+// http://schemas.openxmlformats.org/spreadsheetml/2006/main -
+// currently I have not checked it for completeness - it does as much
+// as I need.
+type xlsxConditionalFormatting struct {
+	Sqref  string        `xml:"sqref,attr"`
+	CfRule []*xlsxCfRule `xml:"cfRule"`
+}
+
+// xlsxCfRule directly maps the cfRule element in the namespace
+// http://schemas.openxmlformats.org/spreadsheetml/2006/main -
+// currently I have not checked it for completeness - it does as much
+// as I need.
+type xlsxCfRule struct {
+	Type         string          `xml:"type,attr,omitempty"`
+	DxfId        *int            `xml:"dxfId,attr"`
+	Priority     int             `xml:"priority,attr"`
+	StopIfTrue   bool            `xml:"stopIfTrue,attr,omitempty"`
+	AboveAverage *bool           `xml:"aboveAverage,attr"`
+	Percent      bool            `xml:"percent,attr,omitempty"`
+	Bottom       bool            `xml:"bottom,attr,omitempty"`
+	Operator     string          `xml:"operator,attr,omitempty"`
+	Text         string          `xml:"text,attr,omitempty"`
+	TimePeriod   string          `xml:"timePeriod,attr,omitempty"`
+	Rank         int             `xml:"rank,attr,omitempty"`
+	StdDev       int             `xml:"stdDev,attr,omitempty"`
+	EqualAverage bool            `xml:"equalAverage,attr,omitempty"`
+	Formula      []string        `xml:"formula"`
+	ColorScale   *xlsxColorScale `xml:"colorScale,omitempty"`
+	DataBar      *xlsxDataBar    `xml:"dataBar,omitempty"`
+	IconSet      *xlsxIconSet    `xml:"iconSet,omitempty"`
+	ExtLst       *xlsxInnerXML   `xml:"extLst,omitempty"`
+}
+
+// xlsxCfvo directly maps the cfvo element in the namespace
+// http://schemas.openxmlformats.org/spreadsheetml/2006/main
+type xlsxCfvo struct {
+	Type string `xml:"type,attr"`
+	Val  string `xml:"val,attr,omitempty"`
+	Gte  *bool  `xml:"gte,attr"`
+}
+
+// xlsxColorScale directly maps the colorScale element in the namespace
+// http://schemas.openxmlformats.org/spreadsheetml/2006/main
+type xlsxColorScale struct {
+	Cfvo  []xlsxCfvo  `xml:"cfvo"`
+	Color []xlsxColor `xml:"color"`
+}
+
+// xlsxDataBar directly maps the dataBar element in the namespace
+// http://schemas.openxmlformats.org/spreadsheetml/2006/main
+type xlsxDataBar struct {
+	MinLength int        `xml:"minLength,attr,omitempty"`
+	MaxLength int        `xml:"maxLength,attr,omitempty"`
+	ShowValue *bool      `xml:"showValue,attr"`
+	Cfvo      []xlsxCfvo `xml:"cfvo"`
+	Color     xlsxColor  `xml:"color"`
+}
+
+// xlsxIconSet directly maps the iconSet element in the namespace
+// http://schemas.openxmlformats.org/spreadsheetml/2006/main
+type xlsxIconSet struct {
+	IconSet   string     `xml:"iconSet,attr,omitempty"`
+	ShowValue *bool      `xml:"showValue,attr"`
+	Reverse   bool       `xml:"reverse,attr,omitempty"`
+	Cfvo      []xlsxCfvo `xml:"cfvo"`
+}
+
+// xlsxInnerXML holds the raw XML content of an element that is not
+// mapped any further, such as an extLst.
+type xlsxInnerXML struct {
+	Content string `xml:",innerxml"`
+}
+
+// xlsxRawElement holds an element of a worksheet that is not mapped
+// any further, with its attributes, so that it can be written back as
+// it was read.  Once read, the names of the element and of its
+// attributes are given the prefixes that they had in the file by
+// qualifyRawNames, as their content refers to those prefixes too.
+type xlsxRawElement struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Content string     `xml:",innerxml"`
+}
+
+// xlsxHyperlinks directly maps the hyperlinks element in the namespace
+// http://schemas.openxmlformats.org/spreadsheetml/2006/main
+type xlsxHyperlinks struct {
+	Hyperlink []xlsxHyperlink `xml:"hyperlink"`
+}
+
+// xlsxHyperlink directly maps the hyperlink element in the namespace
+// http://schemas.openxmlformats.org/spreadsheetml/2006/main - links
+// to a URL refer to it through a relationship of the worksheet.
+type xlsxHyperlink struct {
+	Ref      string `xml:"ref,attr"`
+	Id       string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr,omitempty"`
+	Location string `xml:"location,attr,omitempty"`
+	Tooltip  string `xml:"tooltip,attr,omitempty"`
+	Display  string `xml:"display,attr,omitempty"`
 }
 
 // xlsxHeaderFooter directly maps the headerFooter element in the namespace
@@ -124,24 +287,26 @@ type xlsxSheetViews struct {
 // currently I have not checked it for completeness - it does as much
 // as I need.
 type xlsxSheetView struct {
-	WindowProtection        bool            `xml:"windowProtection,attr"`
-	ShowFormulas            bool            `xml:"showFormulas,attr"`
-	ShowGridLines           bool            `xml:"showGridLines,attr"`
-	ShowRowColHeaders       bool            `xml:"showRowColHeaders,attr"`
-	ShowZeros               bool            `xml:"showZeros,attr"`
-	RightToLeft             bool            `xml:"rightToLeft,attr"`
-	TabSelected             bool            `xml:"tabSelected,attr"`
-	ShowOutlineSymbols      bool            `xml:"showOutlineSymbols,attr"`
-	DefaultGridColor        bool            `xml:"defaultGridColor,attr"`
-	View                    string          `xml:"view,attr"`
-	TopLeftCell             string          `xml:"topLeftCell,attr"`
-	ColorId                 int             `xml:"colorId,attr"`
-	ZoomScale               float64         `xml:"zoomScale,attr"`
-	ZoomScaleNormal         float64         `xml:"zoomScaleNormal,attr"`
-	ZoomScalePageLayoutView float64         `xml:"zoomScalePageLayoutView,attr"`
-	WorkbookViewId          int             `xml:"workbookViewId,attr"`
-	Pane                    *xlsxPane       `xml:"pane"`
-	Selection               []xlsxSelection `xml:"selection"`
+	WindowProtection        bool             `xml:"windowProtection,attr"`
+	ShowFormulas            bool             `xml:"showFormulas,attr"`
+	ShowGridLines           bool             `xml:"showGridLines,attr"`
+	ShowRowColHeaders       bool             `xml:"showRowColHeaders,attr"`
+	ShowZeros               bool             `xml:"showZeros,attr"`
+	RightToLeft             bool             `xml:"rightToLeft,attr"`
+	TabSelected             bool             `xml:"tabSelected,attr"`
+	ShowOutlineSymbols      bool             `xml:"showOutlineSymbols,attr"`
+	DefaultGridColor        bool             `xml:"defaultGridColor,attr"`
+	View                    string           `xml:"view,attr"`
+	TopLeftCell             string           `xml:"topLeftCell,attr"`
+	ColorId                 int              `xml:"colorId,attr"`
+	ZoomScale               float64          `xml:"zoomScale,attr"`
+	ZoomScaleNormal         float64          `xml:"zoomScaleNormal,attr"`
+	ZoomScalePageLayoutView float64          `xml:"zoomScalePageLayoutView,attr"`
+	WorkbookViewId          int              `xml:"workbookViewId,attr"`
+	Attrs                   []xml.Attr       `xml:",any,attr"`
+	Pane                    *xlsxPane        `xml:"pane"`
+	Selection               []xlsxSelection  `xml:"selection"`
+	Unknown                 []xlsxRawElement `xml:",any"`
 }
 
 // xlsxSelection directly maps the selection element in the namespace
@@ -173,6 +338,8 @@ type xlsxPane struct {
 // as I need.
 type xlsxSheetPr struct {
 	FilterMode  bool              `xml:"filterMode,attr"`
+	Attrs       []xml.Attr        `xml:",any,attr"`
+	Unknown     []xlsxRawElement  `xml:",any"`
 	PageSetUpPr []xlsxPageSetUpPr `xml:"pageSetUpPr"`
 }
 